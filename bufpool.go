@@ -0,0 +1,109 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"sync"
+)
+
+const (
+	minFrameClass = 6  // smallest pooled buffer: 64 bytes
+	maxFrameClass = 20 // largest pooled buffer: 1MiB
+)
+
+// framePool recycles the buffers of received frames.
+// Buffers are pooled by size class, in powers of two, so that the buffers
+// handed out follow the sizes of the recently received frames.
+// Frames larger than the largest size class are not pooled.
+type framePool struct {
+	classes [maxFrameClass - minFrameClass + 1]sync.Pool
+	holders sync.Pool // spare *[]byte, so that putting a buffer does not allocate
+
+	frames   sync.Pool // spare *[][]byte, holding the frames of a message
+	fholders sync.Pool // spare *[][]byte, so that putting frames does not allocate
+}
+
+func newFramePool() *framePool {
+	return &framePool{}
+}
+
+// frameClass returns the index of the smallest size class holding size bytes.
+func frameClass(size int) int {
+	c := 0
+	for 1<<uint(c+minFrameClass) < size {
+		c++
+	}
+	return c
+}
+
+// get returns a buffer of size bytes.
+func (p *framePool) get(size int) []byte {
+	if size == 0 || size > 1<<maxFrameClass {
+		return make([]byte, size)
+	}
+	c := frameClass(size)
+	if v := p.classes[c].Get(); v != nil {
+		h := v.(*[]byte)
+		buf := (*h)[:size]
+		*h = nil
+		p.holders.Put(h)
+		return buf
+	}
+	return make([]byte, size, 1<<uint(c+minFrameClass))
+}
+
+// getFrames returns an empty slice to hold the frames of a message.
+func (p *framePool) getFrames() [][]byte {
+	v := p.frames.Get()
+	if v == nil {
+		return nil
+	}
+	h := v.(*[][]byte)
+	frames := (*h)[:0]
+	*h = nil
+	p.fholders.Put(h)
+	return frames
+}
+
+// put hands the buffers of frames back to the pool.
+// Buffers whose capacity is not one of the size classes are dropped.
+func (p *framePool) put(frames [][]byte) {
+	for _, frame := range frames {
+		n := cap(frame)
+		if n < 1<<minFrameClass || n > 1<<maxFrameClass || n&(n-1) != 0 {
+			continue
+		}
+		h, _ := p.holders.Get().(*[]byte)
+		if h == nil {
+			h = new([]byte)
+		}
+		*h = frame[:0]
+		p.classes[frameClass(n)].Put(h)
+	}
+	if cap(frames) == 0 {
+		return
+	}
+	for i := range frames {
+		frames[i] = nil
+	}
+	h, _ := p.fholders.Get().(*[][]byte)
+	if h == nil {
+		h = new([][]byte)
+	}
+	*h = frames[:0]
+	p.frames.Put(h)
+}
+
+// MsgPool is a pool of buffers for received messages.
+// A MsgPool may be shared by several sockets.
+// See WithMsgPool.
+type MsgPool struct {
+	p *framePool
+}
+
+// NewMsgPool returns a new, empty, pool of buffers for received messages.
+func NewMsgPool() *MsgPool {
+	return &MsgPool{p: newFramePool()}
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// coalesce makes the connection buffer its small outgoing frames,
+// see WithWriteBatching.
+// coalesce must be called before any message is sent.
+func (c *Conn) coalesce(size int, delay time.Duration) {
+	c.cw = newCoalescer(c.rw, size, delay)
+	c.wr = c.cw
+}
+
+// coalescer buffers small writes to w, and writes them out at once when
+// the buffer reaches size bytes or when delay elapsed since the first
+// buffered write.
+// Writes are never reordered nor split: the ZMTP framing is preserved.
+type coalescer struct {
+	mu    sync.Mutex
+	w     io.Writer
+	buf   []byte
+	size  int
+	delay time.Duration
+	timer *time.Timer // pending flush of the buffer, if any
+	err   error       // error of a delayed flush, reported by the next write
+}
+
+func newCoalescer(w io.Writer, size int, delay time.Duration) *coalescer {
+	return &coalescer{
+		w:     w,
+		buf:   make([]byte, 0, size),
+		size:  size,
+		delay: delay,
+	}
+}
+
+func (c *coalescer) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return 0, c.err
+	}
+	if len(c.buf)+len(p) > c.size {
+		if err := c.flush(); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) >= c.size {
+		// large writes gain nothing from being buffered.
+		return c.w.Write(p)
+	}
+
+	c.buf = append(c.buf, p...)
+	switch {
+	case len(c.buf) >= c.size:
+		if err := c.flush(); err != nil {
+			return 0, err
+		}
+	case c.timer == nil:
+		c.timer = time.AfterFunc(c.delay, c.expire)
+	}
+	return len(p), nil
+}
+
+// expire flushes the buffer once its delay elapsed.
+func (c *coalescer) expire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flush()
+}
+
+// flush writes the buffered bytes out.
+// flush must be called with c.mu held.
+func (c *coalescer) flush() error {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if len(c.buf) == 0 || c.err != nil {
+		return c.err
+	}
+	_, err := c.w.Write(c.buf)
+	c.buf = c.buf[:0]
+	if err != nil {
+		c.err = errors.Wrapf(err, "zmq4: could not flush coalesced frames")
+	}
+	return c.err
+}
+
+// stop writes the buffered bytes out, and cancels any pending flush.
+func (c *coalescer) stop() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flush()
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"time"
+)
+
+// ConfigSnapshot describes the effective configuration of a socket,
+// as set by options at creation time and by Socket.SetOption since.
+// Durations left to their default are reported with their effective value.
+type ConfigSnapshot struct {
+	Type     SocketType
+	ID       SocketIdentity
+	Security SecurityType // security mechanism of new connections
+
+	SendHWM     int           // high water mark for outbound messages
+	RecvHWM     int           // high water mark for inbound messages, per connection
+	Linger      time.Duration // linger period for pending messages at Close
+	SendTimeout time.Duration // maximum time a Send may block
+	RecvTimeout time.Duration // maximum time a Recv may block, 0 for no limit
+
+	SendRetries      int           // number of retries of failed sends
+	SendBackoff      time.Duration // time to wait between two send attempts
+	DialerRetry      time.Duration // time between two dial attempts
+	DialerTimeout    time.Duration // maximum time a dial may take
+	HandshakeTimeout time.Duration // maximum time a ZMTP handshake may take, 0 for no limit
+	TCPNetwork       string        // network of tcp endpoints: "tcp", "tcp4" (IPv4 only) or "tcp6" (IPv6 only)
+	MulticastTTL     int           // time-to-live of the packets sent to pgm and epgm endpoints
+	TLS              bool          // whether tcp connections are secured with TLS
+	DNSRoundRobin    bool          // whether tcp endpoints are dialed at each address of their host
+	DNSTTL           time.Duration // time between two resolutions of the hosts of round-robin endpoints
+
+	MaxMsgSize       int64 // maximum size of a received message, <= 0 for no limit
+	TruncateOversize bool  // whether oversized messages are truncated
+	MaxConnections   int   // maximum number of connected peers, <= 0 for no limit
+	StreamThreshold  int64 // size above which single-frame messages are streamed, <= 0 if disabled
+	Immediate        bool  // whether messages are only queued while a peer is connected
+
+	WriteBatchSize  int           // size up to which small outgoing frames are coalesced, 0 if disabled
+	WriteBatchDelay time.Duration // maximum time outgoing frames are coalesced for
+
+	HeartbeatInterval    time.Duration // interval between two ZMTP heartbeats, 0 if disabled
+	HeartbeatTimeout     time.Duration // time to wait for a ZMTP heartbeat reply
+	AppHeartbeatInterval time.Duration // interval between two application heartbeats, 0 if disabled
+	AppHeartbeatTimeout  time.Duration // time to wait for an application heartbeat echo
+
+	ZMTPVersion [2]int // major and minor ZMTP version spoken with peers
+
+	RouterMandatory           bool // whether sends to unknown peers fail (ROUTER)
+	RouterHandover            bool // whether identities are handed over to reconnecting peers (ROUTER)
+	ProbeRouter               bool // whether an empty message is sent to new peers (ROUTER, DEALER)
+	XPubVerbose               bool // whether all subscriptions are delivered (XPUB)
+	XPubVerboser              bool // whether all subscriptions and unsubscriptions are delivered (XPUB)
+	DropConsecutiveDuplicates bool // whether duplicate consecutive messages are dropped (SUB)
+	BufferPool                bool // whether the buffers of received messages are pooled
+
+	Metadata Metadata // application metadata sent during the handshake
+}
+
+// Config returns a snapshot of the effective configuration of the socket.
+func (sck *socket) Config() ConfigSnapshot {
+	sck.mu.RLock()
+	defer sck.mu.RUnlock()
+
+	cfg := ConfigSnapshot{
+		Type:     sck.typ,
+		ID:       sck.id,
+		Security: sck.sec.Type(),
+
+		SendHWM:     sck.sndhwm,
+		RecvHWM:     sck.rcvhwm,
+		Linger:      sck.linger,
+		SendTimeout: sck.sndtimeo,
+		RecvTimeout: sck.rcvtimeo,
+
+		SendRetries:      sck.sndretry,
+		SendBackoff:      sck.sndbackoff,
+		DialerRetry:      sck.retry,
+		DialerTimeout:    sck.dialer.Timeout,
+		HandshakeTimeout: sck.hstimeo,
+		TCPNetwork:       sck.tcpnet,
+		MulticastTTL:     sck.mcastTTL,
+		TLS:              sck.tlscfg != nil,
+		DNSRoundRobin:    sck.dnsrr,
+		DNSTTL:           sck.dnsttl,
+
+		MaxMsgSize:       sck.maxsz,
+		TruncateOversize: sck.trunc,
+		MaxConnections:   sck.maxconns,
+		StreamThreshold:  sck.streamsz,
+		Immediate:        sck.immediate,
+
+		WriteBatchSize:  sck.batchsz,
+		WriteBatchDelay: sck.batchdl,
+
+		HeartbeatInterval:    sck.hbivl,
+		HeartbeatTimeout:     sck.hbtimeout,
+		AppHeartbeatInterval: sck.ahbivl,
+		AppHeartbeatTimeout:  sck.ahbtimeout,
+
+		ZMTPVersion: [2]int{int(sck.version[0]), int(sck.version[1])},
+
+		RouterMandatory:           sck.mandatory,
+		RouterHandover:            sck.handover,
+		ProbeRouter:               sck.probe,
+		XPubVerbose:               sck.verbose,
+		XPubVerboser:              sck.verboser,
+		DropConsecutiveDuplicates: sck.dedup,
+		BufferPool:                sck.pool != nil,
+
+		Metadata: make(Metadata, len(sck.meta)),
+	}
+	if cfg.HeartbeatInterval > 0 && cfg.HeartbeatTimeout <= 0 {
+		cfg.HeartbeatTimeout = cfg.HeartbeatInterval
+	}
+	if cfg.AppHeartbeatInterval > 0 && cfg.AppHeartbeatTimeout <= 0 {
+		cfg.AppHeartbeatTimeout = cfg.AppHeartbeatInterval
+	}
+	for k, v := range sck.meta {
+		cfg.Metadata[k] = v
+	}
+	return cfg
+}
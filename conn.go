@@ -6,10 +6,16 @@ package zmq4
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"encoding/binary"
 	"io"
+	"io/ioutil"
+	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -17,9 +23,15 @@ import (
 // Conn implements the ZeroMQ Message Transport Protocol as defined
 // in https://rfc.zeromq.org/spec:23/ZMTP/.
 type Conn struct {
+	active int64    // time of the last frame read or written, in Unix nanoseconds. accessed atomically.
+	ctr    counters // activity of the connection. accessed atomically.
+	ep     string   // endpoint the connection was established on.
+
 	typ    SocketType
 	id     SocketIdentity
 	rw     io.ReadWriteCloser
+	wr     io.Writer // writer of outgoing frames: rw, or a coalescer over rw.
+	cw     *coalescer
 	sec    Security
 	Server bool
 	Meta   Metadata
@@ -28,12 +40,75 @@ type Conn struct {
 		Meta   Metadata
 	}
 
+	// Handshake holds the durations of the handshake phases
+	// of the connection.
+	Handshake HandshakeTimings
+
+	connected time.Time // time the connection joined its socket.
+
+	maxMsgSize int64 // maximum size of a received message. no limit if <= 0.
+	truncate   bool  // whether oversized messages are truncated, instead of closing the connection.
+	streamsz   int64 // size above which single-frame messages are streamed. never streamed if <= 0.
+
+	raw      bool // raw connections exchange bytes without ZMTP framing.
+	notified bool // whether a raw connection reported its opening.
+
+	version [2]uint8   // ZMTP version spoken over the connection.
+	pool    *framePool // pool of frame buffers for received messages. nil to always allocate.
+
+	once    sync.Once
+	onClose func(c *Conn) // called once, when the connection is closed.
+	done    chan struct{} // closed when the connection is closed.
+	pong    chan struct{} // signaled when a PONG command is received.
+	apong   chan []byte   // receives the nonce of application heartbeat replies.
+	ahb     bool          // whether application heartbeats are exchanged with the peer.
+	wmu     sync.Mutex    // serializes writes of messages and commands.
+
 	mu     sync.RWMutex
 	topics map[string]struct{} // set of subscribed topics
 }
 
+// HandshakeTimings describes the durations of the phases of
+// a connection handshake.
+type HandshakeTimings struct {
+	Connect  time.Duration // transport connection. zero for accepted connections.
+	Greeting time.Duration // ZMTP greeting exchange.
+	Security time.Duration // security mechanism handshake, including metadata exchange.
+}
+
+// Total returns the overall duration of the handshake.
+func (t HandshakeTimings) Total() time.Duration {
+	return t.Connect + t.Greeting + t.Security
+}
+
+// Close closes the connection.
+// Subsequent calls to Close are no-ops.
 func (c *Conn) Close() error {
-	return c.rw.Close()
+	var err error
+	c.once.Do(func() {
+		if c.cw != nil {
+			// frames still coalesced are sent before closing.
+			c.cw.stop()
+		}
+		// done is closed first, so that the operations failing on the
+		// closed connection report ErrClosedConn.
+		close(c.done)
+		err = c.rw.Close()
+		if c.onClose != nil {
+			c.onClose(c)
+		}
+	})
+	return err
+}
+
+// UnderlyingConn returns the network connection the ZMTP connection runs
+// over, e.g. to tune TCP keep-alives or buffer sizes, or nil if the
+// connection was not opened over a net.Conn.
+// Reading from or writing to the returned connection corrupts the ZMTP
+// stream.
+func (c *Conn) UnderlyingConn() net.Conn {
+	nc, _ := c.rw.(net.Conn)
+	return nc
 }
 
 func (c *Conn) Read(p []byte) (int, error) {
@@ -41,12 +116,27 @@ func (c *Conn) Read(p []byte) (int, error) {
 }
 
 func (c *Conn) Write(p []byte) (int, error) {
-	return c.rw.Write(p)
+	return c.wr.Write(p)
 }
 
 // Open opens a ZMTP connection over rw with the given security, socket type and identity.
 // Open performs a complete ZMTP handshake.
 func Open(rw io.ReadWriteCloser, sec Security, sockType SocketType, sockID SocketIdentity, server bool) (*Conn, error) {
+	conn, err := newConn(rw, sec, sockType, sockID, server)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.init(sec)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// newConn creates a ZMTP connection over rw, without performing the handshake.
+func newConn(rw io.ReadWriteCloser, sec Security, sockType SocketType, sockID SocketIdentity, server bool) (*Conn, error) {
 	if rw == nil {
 		return nil, errors.Errorf("zmq4: invalid nil read-writer")
 	}
@@ -59,20 +149,23 @@ func Open(rw io.ReadWriteCloser, sec Security, sockType SocketType, sockID Socke
 		typ:    sockType,
 		id:     sockID,
 		rw:     rw,
+		wr:     rw,
 		sec:    sec,
 		Server: server,
 		Meta:   make(Metadata),
 		topics: make(map[string]struct{}),
+		done:   make(chan struct{}),
+		pong:   make(chan struct{}, 1),
+		apong:  make(chan []byte, 1),
+
+		version: defaultVersion,
 	}
+	conn.touch()
 	conn.Meta[sysSockType] = string(conn.typ)
 	conn.Meta[sysSockID] = conn.id.String()
+	conn.Meta[appHeartbeatProperty] = "1"
 	conn.Peer.Meta = make(Metadata)
 
-	err := conn.init(sec)
-	if err != nil {
-		return nil, err
-	}
-
 	return conn, nil
 }
 
@@ -80,19 +173,37 @@ func Open(rw io.ReadWriteCloser, sec Security, sockType SocketType, sockID Socke
 func (conn *Conn) init(sec Security) error {
 	var err error
 
+	switch conn.version {
+	case defaultVersion, [2]uint8{3, 1}:
+		// ok.
+	case [2]uint8{2, 0}:
+		start := time.Now()
+		err = conn.init2()
+		conn.Handshake.Greeting = time.Since(start)
+		return err
+	default:
+		return errZMTPVersion
+	}
+
+	start := time.Now()
 	err = conn.greet(conn.Server)
 	if err != nil {
 		return errors.Wrapf(err, "zmq4: could not exchange greetings")
 	}
+	conn.Handshake.Greeting = time.Since(start)
 
+	start = time.Now()
 	err = conn.sec.Handshake(conn, conn.Server)
 	if err != nil {
 		return errors.Wrapf(err, "zmq4: could not perform security handshake")
 	}
+	conn.Handshake.Security = time.Since(start)
 
 	peer := SocketType(conn.Peer.Meta[sysSockType])
-	if !peer.IsCompatible(conn.typ) {
-		return errors.Errorf("zmq4: peer=%q not compatible with %q", peer, conn.typ)
+	if err := conn.checkPeer(peer); err != nil {
+		// notify the peer before the connection is closed.
+		conn.SendCmd(CmdError, errorReason(reasonIncompatible))
+		return err
 	}
 
 	// FIXME(sbinet): if security mechanism does not define a client/server
@@ -100,12 +211,85 @@ func (conn *Conn) init(sec Security) error {
 	// as per:
 	//  https://rfc.zeromq.org/spec:23/ZMTP/#topology
 
+	conn.ahb = conn.appHeartbeats()
+	return nil
+}
+
+// init2 performs a ZMTP 2.0 handshake, as per:
+//  https://rfc.zeromq.org/spec:15/ZMTP/
+// ZMTP 2.0 has no security mechanisms nor metadata: the socket type and
+// identity are exchanged in the greeting.
+func (conn *Conn) init2() error {
+	if conn.sec.Type() != NullSecurity {
+		return errors.Wrapf(errBadSec, "zmq4: ZMTP 2.0 does not support %s security", conn.sec.Type())
+	}
+
+	typ, ok := zmtp2SockTypes[conn.typ]
+	if !ok {
+		return errors.Errorf("zmq4: socket type %q not supported by ZMTP 2.0", conn.typ)
+	}
+	id := []byte(conn.id.String())
+
+	// signature, revision, socket-type and identity as a final-short frame.
+	buf := make([]byte, 0, 10+2+2+len(id))
+	buf = append(buf, sigHeader, 0, 0, 0, 0, 0, 0, 0, 0, sigFooter)
+	buf = append(buf, zmtp2Revision, typ)
+	buf = append(buf, 0, byte(len(id)))
+	buf = append(buf, id...)
+	_, err := conn.rw.Write(buf)
+	if err != nil {
+		return errors.Wrapf(err, "zmq4: could not send ZMTP 2.0 greeting")
+	}
+
+	var hdr [14]byte
+	_, err = io.ReadFull(conn.rw, hdr[:])
+	if err != nil {
+		return errors.Wrapf(err, "zmq4: could not recv ZMTP 2.0 greeting")
+	}
+	if hdr[0] != sigHeader || hdr[9] != sigFooter || hdr[10] < zmtp2Revision {
+		return errGreeting
+	}
+	if hdr[12] != 0 {
+		return errors.Wrapf(errGreeting, "zmq4: invalid ZMTP 2.0 identity frame")
+	}
+
+	var peer SocketType
+	for k, v := range zmtp2SockTypes {
+		if v == hdr[11] {
+			peer = k
+			break
+		}
+	}
+	if peer == "" {
+		return errors.Errorf("zmq4: invalid ZMTP 2.0 peer socket type 0x%02x", hdr[11])
+	}
+	conn.Peer.Meta[sysSockType] = string(peer)
+
+	if n := int(hdr[13]); n > 0 {
+		pid := make([]byte, n)
+		_, err = io.ReadFull(conn.rw, pid)
+		if err != nil {
+			return errors.Wrapf(err, "zmq4: could not recv ZMTP 2.0 peer identity")
+		}
+		conn.Peer.Meta[sysSockID] = string(pid)
+	}
+
+	return conn.checkPeer(peer)
+}
+
+// checkPeer returns an error if a peer of the given socket type can not
+// be connected to the connection.
+// The socket type is announced by the peer, and may thus be unknown.
+func (conn *Conn) checkPeer(peer SocketType) error {
+	if _, ok := peerTypes[peer]; !ok || !conn.typ.IsCompatible(peer) {
+		return errors.Wrapf(ErrIncompatibleSocket, "zmq4: %v peer not compatible with %v socket", peer, conn.typ)
+	}
 	return nil
 }
 
 func (conn *Conn) greet(server bool) error {
 	var err error
-	send := greeting{Version: defaultVersion}
+	send := greeting{Version: conn.version}
 	send.Sig.Header = sigHeader
 	send.Sig.Footer = sigFooter
 	kind := string(conn.sec.Type())
@@ -113,6 +297,9 @@ func (conn *Conn) greet(server bool) error {
 		return errSecMech
 	}
 	copy(send.Mechanism[:], kind)
+	if server && conn.sec.Type() != NullSecurity {
+		send.Server = 0x01
+	}
 
 	err = send.write(conn.rw)
 	if err != nil {
@@ -127,7 +314,7 @@ func (conn *Conn) greet(server bool) error {
 
 	peerKind := asString(recv.Mechanism[:])
 	if peerKind != kind {
-		return errBadSec
+		return &SecurityMismatchError{Local: conn.sec.Type(), Remote: SecurityType(peerKind)}
 	}
 
 	conn.Peer.Server, err = asBool(recv.Server)
@@ -135,9 +322,30 @@ func (conn *Conn) greet(server bool) error {
 		return errors.Wrapf(err, "zmq4: could not get peer server flag")
 	}
 
+	if conn.sec.Type() != NullSecurity && conn.Peer.Server == server {
+		return errSecRole
+	}
+
+	// peers announcing an older minor version are spoken to in theirs,
+	// peers announcing a newer version downgrade to ours.
+	if recv.Version[0] == conn.version[0] && recv.Version[1] < conn.version[1] {
+		conn.version[1] = recv.Version[1]
+	}
+
 	return nil
 }
 
+// Version returns the ZMTP version negotiated with the peer.
+func (c *Conn) Version() (major, minor int) {
+	return int(c.version[0]), int(c.version[1])
+}
+
+// pings reports whether the ZMTP version negotiated with the peer defines
+// the PING and PONG commands, i.e. ZMTP 3.1 and later.
+func (c *Conn) pings() bool {
+	return c.version[0] > 3 || (c.version[0] == 3 && c.version[1] >= 1)
+}
+
 // SendCmd sends a ZMTP command over the wire.
 func (c *Conn) SendCmd(name string, body []byte) error {
 	cmd := Cmd{Name: name, Body: body}
@@ -145,11 +353,47 @@ func (c *Conn) SendCmd(name string, body []byte) error {
 	if err != nil {
 		return err
 	}
-	return c.send(true, buf, 0)
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.closedErr(c.send(true, buf, 0))
 }
 
 // SendMsg sends a ZMTP message over the wire.
 func (c *Conn) SendMsg(msg Msg) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.raw {
+		return c.closedErr(c.sendRaw(msg))
+	}
+	return c.closedErr(c.sendFrames(msg))
+}
+
+// closedErr returns ErrClosedConn in place of the error err of an
+// operation, if the connection was closed.
+func (c *Conn) closedErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	select {
+	case <-c.done:
+		return ErrClosedConn
+	default:
+		return err
+	}
+}
+
+// sendFrames sends the frames of msg, with the connection locked for
+// writing.
+func (c *Conn) sendFrames(msg Msg) error {
+	if name, ok := c.subscriptionCmd(msg); ok {
+		cmd := Cmd{Name: name, Body: msg.Frames[0][1:]}
+		buf, err := cmd.marshalZMTP()
+		if err != nil {
+			return err
+		}
+		return c.send(true, buf, 0)
+	}
+
 	nframes := len(msg.Frames)
 	for i, frame := range msg.Frames {
 		var flag byte
@@ -164,11 +408,48 @@ func (c *Conn) SendMsg(msg Msg) error {
 	return nil
 }
 
+// subscriptionCmd returns the name of the ZMTP 3.1 command msg is sent
+// as, if msg is a subscription message of a SUB or XSUB socket to a peer
+// speaking ZMTP 3.1.
+func (c *Conn) subscriptionCmd(msg Msg) (string, bool) {
+	if c.version[0] != 3 || c.version[1] < 1 || (c.typ != Sub && c.typ != XSub) || !isTopic(msg) {
+		return "", false
+	}
+	if msg.Frames[0][0] == 1 {
+		return CmdSubscribe, true
+	}
+	return CmdCancel, true
+}
+
+// sendFrame sends a single frame of a message.
+// The connection is locked for writing from the first frame of a message
+// until its last frame, or until a frame could not be sent.
+func (c *Conn) sendFrame(frame []byte, first, more bool) error {
+	if c.raw {
+		return errRawFrame
+	}
+	if first {
+		c.wmu.Lock()
+	}
+	var flag byte
+	if more {
+		flag ^= hasMoreBitFlag
+	}
+	err := c.send(false, frame, flag)
+	if err != nil || !more {
+		c.wmu.Unlock()
+	}
+	if err != nil {
+		return errors.Wrapf(err, "zmq4: error sending frame")
+	}
+	return nil
+}
+
 // RecvMsg receives a ZMTP message from the wire.
 func (c *Conn) RecvMsg() (Msg, error) {
 	msg := c.read()
 	if msg.err != nil {
-		return msg, errors.WithStack(msg.err)
+		return msg, exportErr(errors.WithStack(msg.err))
 	}
 
 	if !msg.isCmd() {
@@ -215,7 +496,7 @@ func (c *Conn) RecvCmd() (Cmd, error) {
 	var cmd Cmd
 	msg := c.read()
 	if msg.err != nil {
-		return cmd, errors.WithStack(msg.err)
+		return cmd, exportErr(errors.WithStack(msg.err))
 	}
 
 	if !msg.isCmd() {
@@ -238,47 +519,172 @@ func (c *Conn) RecvCmd() (Cmd, error) {
 		return cmd, errors.WithStack(err)
 	}
 
+	if cmd.Name == CmdError {
+		return cmd, exportErr(peerError(cmd.Body))
+	}
+
 	return cmd, nil
 }
 
 func (c *Conn) send(isCommand bool, body []byte, flag byte) error {
+	if isCommand {
+		flag ^= isCommandBitFlag
+	}
+	if err := c.sendHeader(uint64(len(body)), flag); err != nil {
+		return err
+	}
+
+	if _, err := c.sec.Encrypt(c.wr, body); err != nil {
+		return err
+	}
+
+	c.touch()
+	return nil
+}
+
+// sendHeader writes the header of a frame of size bytes.
+func (c *Conn) sendHeader(size uint64, flag byte) error {
+	var hdr [8 + 1]byte
+	_, err := c.wr.Write(frameHeader(&hdr, size, flag))
+	return err
+}
+
+// frameHeader encodes into hdr the header of a frame of size bytes,
+// and returns the encoded header.
+func frameHeader(hdr *[8 + 1]byte, size uint64, flag byte) []byte {
 	// Long flag
-	size := len(body)
-	isLong := size > 255
-	if isLong {
-		flag ^= isLongBitFlag
+	if size > 255 {
+		hdr[0] = flag ^ isLongBitFlag
+		binary.BigEndian.PutUint64(hdr[1:], size)
+		return hdr[:9]
 	}
+	hdr[0] = flag
+	hdr[1] = uint8(size)
+	return hdr[:2]
+}
 
-	if isCommand {
-		flag ^= isCommandBitFlag
+// sendBatch sends msgs in order.
+// Over NULL security, the frames of all messages are handed to the
+// transport in a single vectored write (writev for TCP connections).
+func (c *Conn) sendBatch(msgs []Msg) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.raw || c.sec.Type() != NullSecurity {
+		for i, msg := range msgs {
+			var err error
+			if c.raw {
+				err = c.sendRaw(msg)
+			} else {
+				err = c.sendFrames(msg)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "zmq4: error sending message %d/%d", i+1, len(msgs))
+			}
+		}
+		return nil
 	}
 
+	n := 0
+	for _, msg := range msgs {
+		n += len(msg.Frames)
+	}
 	var (
-		hdr = [8 + 1]byte{flag}
-		hsz int
+		hdrs = make([][8 + 1]byte, n)
+		bufs = make(net.Buffers, 0, 2*n)
 	)
+	for _, msg := range msgs {
+		for i, frame := range msg.Frames {
+			var flag byte
+			if i < len(msg.Frames)-1 {
+				flag ^= hasMoreBitFlag
+			}
+			hdr := &hdrs[len(bufs)/2]
+			bufs = append(bufs, frameHeader(hdr, uint64(len(frame)), flag), frame)
+		}
+	}
+	if _, err := bufs.WriteTo(c.wr); err != nil {
+		return errors.Wrapf(err, "zmq4: error sending %d messages", len(msgs))
+	}
+	c.touch()
+	return nil
+}
 
-	// Write out the message itself
-	if isLong {
-		hsz = 9
-		binary.BigEndian.PutUint64(hdr[1:], uint64(size))
-	} else {
-		hsz = 2
-		hdr[1] = uint8(size)
+// sendStream sends the last frame of a message, made of the size bytes
+// read from r, without holding the frame in memory.
+// first reports whether the frame is the first frame of the message: the
+// connection is otherwise already locked for writing by sendFrame.
+func (c *Conn) sendStream(r io.Reader, size int64, first bool) error {
+	if c.raw {
+		return errRawFrame
 	}
-	if _, err := c.rw.Write(hdr[:hsz]); err != nil {
-		return err
+	if first {
+		c.wmu.Lock()
 	}
+	defer c.wmu.Unlock()
 
-	if _, err := c.sec.Encrypt(c.rw, body); err != nil {
-		return err
+	if c.sec.Type() != NullSecurity {
+		// the security mechanism may transform the whole frame.
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return errors.Wrapf(err, "zmq4: could not read frame")
+		}
+		if err := c.send(false, body, 0); err != nil {
+			return errors.Wrapf(err, "zmq4: error sending frame")
+		}
+		return nil
 	}
 
+	if err := c.sendHeader(uint64(size), 0); err != nil {
+		return errors.Wrapf(err, "zmq4: error sending frame")
+	}
+	if _, err := io.CopyN(c.wr, r, size); err != nil {
+		// the peer expects size bytes: the connection is unusable.
+		c.rw.Close()
+		return errors.Wrapf(err, "zmq4: error streaming frame")
+	}
+	c.touch()
 	return nil
 }
 
+// touch records activity on the connection.
+func (c *Conn) touch() {
+	atomic.StoreInt64(&c.active, time.Now().UnixNano())
+}
+
+// idle returns the time elapsed since the last activity on the connection.
+func (c *Conn) idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&c.active)))
+}
+
 // read returns the isCommand flag, the body of the message, and optionally an error
 func (c *Conn) read() Msg {
+	if c.raw {
+		msg := c.readRaw()
+		msg.err = c.closedErr(msg.err)
+		return msg
+	}
+	msg := c.readFrames()
+	if msg.err != nil && len(msg.Frames) > 0 {
+		// the connection broke in the middle of a multipart message:
+		// the frames read so far are dropped, so that only complete
+		// messages are ever delivered.
+		if c.pool != nil {
+			c.pool.put(msg.Frames)
+		}
+		msg.Frames = nil
+		msg.truncated = false
+		if errors.Cause(msg.err) == io.EOF {
+			msg.err = io.ErrUnexpectedEOF
+		}
+	}
+	msg.err = c.closedErr(msg.err)
+	return msg
+}
+
+// readFrames reads the frames of the next message from the wire, up to
+// the first error.
+func (c *Conn) readFrames() Msg {
+
 	var (
 		header  [2]byte
 		longHdr [8]byte
@@ -286,7 +692,11 @@ func (c *Conn) read() Msg {
 
 		hasMore = true
 		isCmd   = false
+		total   uint64
 	)
+	if c.pool != nil {
+		msg.Frames = c.pool.getFrames()
+	}
 
 	for hasMore {
 
@@ -322,31 +732,97 @@ func (c *Conn) read() Msg {
 			return msg
 		}
 
-		body := make([]byte, size)
-		_, msg.err = io.ReadFull(c.rw, body)
-		if msg.err != nil {
+		total += size
+		if c.maxMsgSize > 0 && (size > uint64(c.maxMsgSize) || total > uint64(c.maxMsgSize)) {
+			if c.truncate && !isCmd {
+				// keep what fits within the limit and drain the rest.
+				var keep uint64
+				if prev := total - size; prev < uint64(c.maxMsgSize) {
+					keep = uint64(c.maxMsgSize) - prev
+				}
+				msg.truncated = true
+				body := make([]byte, keep)
+				_, msg.err = io.ReadFull(c.rw, body)
+				if msg.err != nil {
+					return msg
+				}
+				_, msg.err = io.CopyN(ioutil.Discard, c.rw, int64(size-keep))
+				if msg.err != nil {
+					return msg
+				}
+				if keep > 0 {
+					frame, err := c.decrypt(body)
+					if err != nil {
+						msg.err = err
+						return msg
+					}
+					msg.Frames = append(msg.Frames, frame)
+				}
+				continue
+			}
+			// do not try to allocate (and drain) a possibly huge frame:
+			// the connection is unusable from now on.
+			c.rw.Close()
+			msg.err = ErrMsgTooLarge
 			return msg
 		}
 
-		// fast path for NULL security: we bypass the bytes.Buffer allocation.
-		switch c.sec.Type() {
-		case NullSecurity: // FIXME(sbinet): also do that for non-encrypted PLAIN?
-			msg.Frames = append(msg.Frames, body)
-			continue
+		if c.streamsz > 0 && size > uint64(c.streamsz) && !hasMore && !isCmd &&
+			len(msg.Frames) == 0 && c.sec.Type() == NullSecurity {
+			// the frame is not assembled: it is read from the wire by
+			// its consumer, before the next message.
+			msg.stream = newFrameStream(c.rw, int64(size))
+			c.touch()
+			return msg
 		}
 
-		buf := new(bytes.Buffer)
-		if _, msg.err = c.sec.Decrypt(buf, body); msg.err != nil {
+		body := c.alloc(int(size))
+		_, msg.err = io.ReadFull(c.rw, body)
+		if msg.err != nil {
 			return msg
 		}
-		msg.Frames = append(msg.Frames, buf.Bytes())
+
+		frame, err := c.decrypt(body)
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+		if c.pool != nil && c.sec.Type() != NullSecurity {
+			// the decrypted frame does not alias the wire buffer.
+			c.pool.put([][]byte{body})
+		}
+		msg.Frames = append(msg.Frames, frame)
 	}
 	if isCmd {
 		msg.Type = CmdMsg
 	}
+	c.touch()
 	return msg
 }
 
+// alloc returns a buffer for a received frame of size bytes.
+func (c *Conn) alloc(size int) []byte {
+	if c.pool == nil {
+		return make([]byte, size)
+	}
+	return c.pool.get(size)
+}
+
+// decrypt returns the plaintext of a received frame body.
+func (c *Conn) decrypt(body []byte) ([]byte, error) {
+	// fast path for NULL security: we bypass the bytes.Buffer allocation.
+	switch c.sec.Type() {
+	case NullSecurity: // FIXME(sbinet): also do that for non-encrypted PLAIN?
+		return body, nil
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := c.sec.Decrypt(buf, body); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func (conn *Conn) subscribe(msg Msg) {
 	conn.mu.Lock()
 	v := msg.Frames[0]
@@ -374,3 +850,272 @@ func (conn *Conn) subscribed(topic string) bool {
 	}
 	return false
 }
+
+// subscriptions returns the sorted list of topics the peer subscribed to.
+func (conn *Conn) subscriptions() [][]byte {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	topics := make([]string, 0, len(conn.topics))
+	for k := range conn.topics {
+		topics = append(topics, k)
+	}
+	return sortedTopics(topics)
+}
+
+// sendRaw writes the frames of msg over the wire, without ZMTP framing.
+func (c *Conn) sendRaw(msg Msg) error {
+	for i, frame := range msg.Frames {
+		_, err := c.wr.Write(frame)
+		if err != nil {
+			return errors.Wrapf(err, "zmq4: error sending raw frame %d/%d", i+1, len(msg.Frames))
+		}
+	}
+	c.touch()
+	return nil
+}
+
+// readRaw reads the next chunk of bytes available on the wire, as a
+// single frame message.
+// The first message read from a raw connection is an empty frame,
+// signaling the opening of the connection.
+func (c *Conn) readRaw() Msg {
+	const size = 8192
+
+	var msg Msg
+	if !c.notified {
+		c.notified = true
+		msg.Frames = [][]byte{{}}
+		return msg
+	}
+
+	buf := make([]byte, size)
+	n, err := c.rw.Read(buf)
+	if n == 0 && err == nil {
+		err = io.ErrNoProgress
+	}
+	if n > 0 {
+		c.touch()
+		msg.Frames = [][]byte{buf[:n]}
+		return msg
+	}
+	msg.err = err
+	return msg
+}
+
+// recv reads the next message from the wire, handling the heartbeat
+// commands: PING commands are answered with a PONG, PONG commands are
+// recorded. Heartbeat commands are not returned to the caller.
+func (c *Conn) recv() Msg {
+	for {
+		msg := c.read()
+		if msg.err != nil || len(msg.Frames) != 1 {
+			return msg
+		}
+		if !msg.isCmd() {
+			if !c.ahb {
+				return msg
+			}
+			op, nonce, ok := appHeartbeatFrame(msg.Frames[0])
+			if !ok {
+				return msg
+			}
+			switch op {
+			case appHeartbeatPing:
+				err := c.SendMsg(NewMsg(newAppHeartbeatFrame(appHeartbeatPong, nonce)))
+				if err != nil {
+					return Msg{err: err}
+				}
+			case appHeartbeatPong:
+				select {
+				case c.apong <- nonce:
+				default:
+				}
+			}
+			continue
+		}
+
+		var cmd Cmd
+		err := cmd.unmarshalZMTP(msg.Frames[0])
+		if err != nil {
+			return msg
+		}
+
+		switch cmd.Name {
+		case CmdPing:
+			// PING: ping-ttl (2 octets), followed by the ping-context
+			// that must be echoed back in the PONG.
+			var ctx []byte
+			if len(cmd.Body) > 2 {
+				ctx = cmd.Body[2:]
+			}
+			err = c.SendCmd(CmdPong, ctx)
+			if err != nil {
+				return Msg{err: err}
+			}
+		case CmdPong:
+			select {
+			case c.pong <- struct{}{}:
+			default:
+			}
+		case CmdError:
+			// the peer reports an error, and closes the connection.
+			return Msg{err: peerError(cmd.Body)}
+		case CmdSubscribe, CmdCancel:
+			// ZMTP 3.1 subscriptions are delivered like the ZMTP 3.0
+			// subscription messages.
+			var flag byte
+			if cmd.Name == CmdSubscribe {
+				flag = 1
+			}
+			return Msg{Frames: [][]byte{append([]byte{flag}, cmd.Body...)}}
+		default:
+			return msg
+		}
+	}
+}
+
+// heartbeat sends a PING command to the peer every interval and closes
+// the connection if no PONG is received within timeout.
+func (c *Conn) heartbeat(ctx context.Context, interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// ping-ttl is expressed in tenths of seconds.
+	var ttl [2]byte
+	binary.BigEndian.PutUint16(ttl[:], uint16(timeout/(100*time.Millisecond)))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		err := c.SendCmd(CmdPing, ttl[:])
+		if err != nil {
+			c.Close()
+			return
+		}
+
+		timer := time.NewTimer(timeout)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-c.done:
+			timer.Stop()
+			return
+		case <-c.pong:
+			timer.Stop()
+		case <-timer.C:
+			c.Close()
+			return
+		}
+	}
+}
+
+// Application heartbeats are single-frame user messages, exchanged by
+// peers speaking a ZMTP version without PING and PONG commands.
+// A frame is made of a reserved prefix, an operation and a nonce:
+// the nonce of a ping must be echoed back in the pong.
+// Peers supporting application heartbeats advertise it with the
+// X-Zmq4-Heartbeat metadata property: frames are only exchanged, and
+// intercepted, when both peers advertised it.
+const (
+	appHeartbeatProperty = "Zmq4-Heartbeat"
+	appHeartbeatPrefix   = "\x00zmq4-heartbeat\x00"
+	appHeartbeatNonce    = 8
+
+	appHeartbeatPing byte = 'P'
+	appHeartbeatPong byte = 'R'
+)
+
+// newAppHeartbeatFrame returns an application heartbeat frame.
+func newAppHeartbeatFrame(op byte, nonce []byte) []byte {
+	frame := make([]byte, 0, len(appHeartbeatPrefix)+1+len(nonce))
+	frame = append(frame, appHeartbeatPrefix...)
+	frame = append(frame, op)
+	return append(frame, nonce...)
+}
+
+// appHeartbeatFrame decodes an application heartbeat frame.
+func appHeartbeatFrame(frame []byte) (op byte, nonce []byte, ok bool) {
+	const n = len(appHeartbeatPrefix)
+	if len(frame) != n+1+appHeartbeatNonce || string(frame[:n]) != appHeartbeatPrefix {
+		return 0, nil, false
+	}
+	op = frame[n]
+	switch op {
+	case appHeartbeatPing, appHeartbeatPong:
+		return op, frame[n+1:], true
+	}
+	return 0, nil, false
+}
+
+// appHeartbeats reports whether application heartbeats are exchanged with
+// the peer: the peer must advertise them, ZMTP 3.1 peers are sent PING
+// commands instead, and the frames sent by SUB and XSUB sockets are
+// subscriptions, never echoed back.
+func (c *Conn) appHeartbeats() bool {
+	if c.pings() || c.Peer.Meta["X-"+appHeartbeatProperty] == "" {
+		return false
+	}
+	for _, typ := range []SocketType{c.typ, SocketType(c.Peer.Meta[sysSockType])} {
+		switch typ {
+		case Sub, XSub:
+			return false
+		}
+	}
+	return true
+}
+
+// appHeartbeat sends an application heartbeat to the peer every interval
+// and closes the connection if the peer does not echo it back within
+// timeout, or echoes back an invalid nonce.
+func (c *Conn) appHeartbeat(ctx context.Context, interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	nonce := make([]byte, appHeartbeatNonce)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		_, err := rand.Read(nonce)
+		if err != nil {
+			c.Close()
+			return
+		}
+		err = c.SendMsg(NewMsg(newAppHeartbeatFrame(appHeartbeatPing, nonce)))
+		if err != nil {
+			c.Close()
+			return
+		}
+
+		timer := time.NewTimer(timeout)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-c.done:
+			timer.Stop()
+			return
+		case echo := <-c.apong:
+			timer.Stop()
+			if !bytes.Equal(echo, nonce) {
+				c.Close()
+				return
+			}
+		case <-timer.C:
+			c.Close()
+			return
+		}
+	}
+}
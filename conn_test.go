@@ -0,0 +1,586 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestConnMaxMsgSize(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+	}{
+		{
+			name: "huge-frame",
+			raw: func() []byte {
+				hdr := make([]byte, 9)
+				hdr[0] = isLongBitFlag
+				binary.BigEndian.PutUint64(hdr[1:], 1<<40)
+				return hdr
+			}(),
+		},
+		{
+			name: "multipart",
+			raw: append(
+				append([]byte{hasMoreBitFlag, 10}, make([]byte, 10)...),
+				append([]byte{0, 10}, make([]byte, 10)...)...,
+			),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p1, p2 := net.Pipe()
+			defer p1.Close()
+			defer p2.Close()
+
+			conn, err := newConn(p1, nullSecurity{}, Pull, nil, false)
+			if err != nil {
+				t.Fatalf("could not create conn: %v", err)
+			}
+			conn.maxMsgSize = 16
+
+			go p2.Write(tc.raw)
+
+			msg := conn.read()
+			if got, want := msg.err, ErrMsgTooLarge; got != want {
+				t.Fatalf("invalid error: got=%v, want=%v", got, want)
+			}
+			// the oversized frame is not drained: the connection is closed.
+			if _, err := p2.Write([]byte{0}); err == nil {
+				t.Fatalf("connection not closed")
+			}
+		})
+	}
+}
+
+func TestConnZMTP2(t *testing.T) {
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+	defer p2.Close()
+
+	conn, err := newConn(p1, nullSecurity{}, Pull, SocketIdentity("pull"), true)
+	if err != nil {
+		t.Fatalf("could not create conn: %v", err)
+	}
+	conn.version = [2]uint8{2, 0}
+
+	// hand-crafted ZMTP 2.0 PUSH peer.
+	want := []byte{0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0x7f, 0x01, 0x07, 0x00, 4, 'p', 'u', 'l', 'l'}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := p2.Write([]byte{0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0x7f, 0x01, 0x08, 0x00, 6, 'l', 'e', 'g', 'a', 'c', 'y'})
+		errc <- err
+	}()
+
+	got := make([]byte, len(want))
+	go func() {
+		_, err := io.ReadFull(p2, got)
+		errc <- err
+	}()
+
+	err = conn.init(conn.sec)
+	if err != nil {
+		t.Fatalf("could not perform ZMTP 2.0 handshake: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			t.Fatalf("could not exchange greetings: %v", err)
+		}
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Fatalf("invalid greeting:\ngot= %q\nwant=%q", got, want)
+	}
+	if got, want := conn.Peer.Meta[sysSockType], string(Push); got != want {
+		t.Fatalf("invalid peer socket type: got=%q, want=%q", got, want)
+	}
+	if got, want := conn.Peer.Meta[sysSockID], "legacy"; got != want {
+		t.Fatalf("invalid peer identity: got=%q, want=%q", got, want)
+	}
+
+	go p2.Write([]byte{0x00, 5, 'h', 'e', 'l', 'l', 'o'})
+	msg := conn.read()
+	if msg.err != nil {
+		t.Fatalf("could not read message: %v", msg.err)
+	}
+	if got, want := string(msg.Frames[0]), "hello"; got != want {
+		t.Fatalf("invalid message: got=%q, want=%q", got, want)
+	}
+
+	go func() {
+		errc <- conn.SendMsg(NewMsgString("world"))
+	}()
+	raw := make([]byte, 7)
+	if _, err := io.ReadFull(p2, raw); err != nil {
+		t.Fatalf("could not read frame: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("could not send message: %v", err)
+	}
+	if got, want := raw, []byte{0x00, 5, 'w', 'o', 'r', 'l', 'd'}; !bytes.Equal(got, want) {
+		t.Fatalf("invalid frame: got=%q, want=%q", got, want)
+	}
+}
+
+func TestConnZMTPVersion(t *testing.T) {
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+	defer p2.Close()
+
+	conn, err := newConn(p1, nullSecurity{}, Pull, nil, true)
+	if err != nil {
+		t.Fatalf("could not create conn: %v", err)
+	}
+	conn.version = [2]uint8{4, 0}
+	if got, want := conn.init(conn.sec), errZMTPVersion; got != want {
+		t.Fatalf("invalid error: got=%v, want=%v", got, want)
+	}
+}
+
+func TestConnIncompatibleVersion(t *testing.T) {
+	if major, minor, patch := Version(); major != 3 || minor != 0 || patch != 0 {
+		t.Fatalf("invalid version: got=%d.%d.%d, want=3.0.0", major, minor, patch)
+	}
+
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+	defer p2.Close()
+
+	conn, err := newConn(p1, nullSecurity{}, Pull, nil, true)
+	if err != nil {
+		t.Fatalf("could not create conn: %v", err)
+	}
+
+	// hand-crafted ZMTP 2.0 PUSH peer.
+	go p2.Write([]byte{0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0x7f, 0x01, 0x08, 0x00, 0})
+	go io.Copy(ioutil.Discard, p2)
+
+	err = conn.init(conn.sec)
+	if got, want := errors.Cause(err), ErrIncompatibleVersion; got != want {
+		t.Fatalf("invalid error: got=%v, want=%v", err, want)
+	}
+}
+
+func TestConnAppHeartbeat(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c1, c2 := newTestConnPair(t, Pair)
+	defer c1.Close()
+	defer c2.Close()
+	// both peers advertised application heartbeats during the handshake.
+	c1.ahb = true
+
+	const (
+		interval = 10 * time.Millisecond
+		timeout  = 50 * time.Millisecond
+	)
+
+	go func() {
+		for c1.recv().err == nil {
+		}
+	}()
+
+	// the peer echoes heartbeats until muted.
+	var mute int32
+	go func() {
+		for {
+			msg := c2.read()
+			if msg.err != nil {
+				return
+			}
+			op, nonce, ok := appHeartbeatFrame(msg.Frames[0])
+			if !ok || op != appHeartbeatPing || atomic.LoadInt32(&mute) != 0 {
+				continue
+			}
+			err := c2.SendMsg(NewMsg(newAppHeartbeatFrame(appHeartbeatPong, nonce)))
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	go c1.appHeartbeat(ctx, interval, timeout)
+
+	// sockets echo heartbeats while receiving messages.
+	e1, e2 := newTestConnPair(t, Pair)
+	defer e1.Close()
+	defer e2.Close()
+	e1.ahb, e2.ahb = true, true
+	for _, c := range []*Conn{e1, e2} {
+		go func(c *Conn) {
+			for c.recv().err == nil {
+			}
+		}(c)
+	}
+	go e1.appHeartbeat(ctx, interval, timeout)
+
+	select {
+	case <-c1.done:
+		t.Fatalf("live peer declared dead")
+	case <-e1.done:
+		t.Fatalf("live socket peer declared dead")
+	case <-time.After(10 * interval):
+	}
+
+	atomic.StoreInt32(&mute, 1)
+	start := time.Now()
+
+	select {
+	case <-c1.done:
+		if elapsed := time.Since(start); elapsed < timeout {
+			t.Fatalf("peer declared dead too early: %v", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("mute peer not declared dead")
+	}
+}
+
+func TestConnAppHeartbeats(t *testing.T) {
+	for _, tc := range []struct {
+		typ       SocketType
+		peer      SocketType
+		version   [2]uint8
+		advertise bool
+		want      bool
+	}{
+		{Push, Pull, [2]uint8{3, 0}, true, true},
+		{Push, Pull, [2]uint8{3, 0}, false, false},
+		{Push, Pull, [2]uint8{2, 0}, false, false},
+		{Push, Pull, [2]uint8{3, 1}, true, false},
+		{Pub, Sub, [2]uint8{3, 0}, true, false},
+		{Sub, Pub, [2]uint8{3, 0}, true, false},
+		{XSub, XPub, [2]uint8{3, 0}, true, false},
+		{XPub, XSub, [2]uint8{3, 0}, true, false},
+	} {
+		conn := &Conn{typ: tc.typ, version: tc.version}
+		conn.Peer.Meta = Metadata{sysSockType: string(tc.peer)}
+		if tc.advertise {
+			conn.Peer.Meta["X-"+appHeartbeatProperty] = "1"
+		}
+		if got := conn.appHeartbeats(); got != tc.want {
+			t.Fatalf("%v-%v ZMTP %d.%d (advertised=%v): invalid app heartbeats: got=%v, want=%v",
+				tc.typ, tc.peer, tc.version[0], tc.version[1], tc.advertise, got, tc.want)
+		}
+	}
+}
+
+func TestConnCheckPeer(t *testing.T) {
+	conn := &Conn{typ: Sub}
+	for _, tc := range []struct {
+		peer SocketType
+		ok   bool
+	}{
+		{Pub, true},
+		{XPub, true},
+		{Rep, false},
+		{"NO-SUCH-TYPE", false}, // announced by the peer: must not panic.
+	} {
+		err := conn.checkPeer(tc.peer)
+		if tc.ok {
+			if err != nil {
+				t.Fatalf("%v: could not connect to %v: %v", conn.typ, tc.peer, err)
+			}
+			continue
+		}
+		if errors.Cause(err) != ErrIncompatibleSocket {
+			t.Fatalf("%v: invalid error for %v peer: got=%v, want=%v", conn.typ, tc.peer, err, ErrIncompatibleSocket)
+		}
+	}
+}
+
+// writeRecorder records the writes made to it.
+type writeRecorder struct {
+	mu     sync.Mutex
+	writes []string
+}
+
+func (w *writeRecorder) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func (w *writeRecorder) get() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.writes...)
+}
+
+func TestCoalescer(t *testing.T) {
+	var (
+		rec = &writeRecorder{}
+		c   = newCoalescer(rec, 8, 20*time.Millisecond)
+	)
+	for _, p := range []string{"ab", "cd", "ef"} {
+		c.Write([]byte(p))
+	}
+	if got := rec.get(); len(got) != 0 {
+		t.Fatalf("small writes were not coalesced: %q", got)
+	}
+
+	// the buffer is full: it is flushed at once.
+	c.Write([]byte("gh"))
+	if got, want := rec.get(), []string{"abcdefgh"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid writes once full:\ngot= %q\nwant=%q", got, want)
+	}
+
+	// large writes are not buffered, nor reordered.
+	c.Write([]byte("ij"))
+	c.Write([]byte("0123456789"))
+	if got, want := rec.get(), []string{"abcdefgh", "ij", "0123456789"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid writes after a large one:\ngot= %q\nwant=%q", got, want)
+	}
+
+	// pending writes are flushed once the delay elapsed.
+	c.Write([]byte("kl"))
+	time.Sleep(100 * time.Millisecond)
+	if got, want := rec.get(), []string{"abcdefgh", "ij", "0123456789", "kl"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid writes after the delay:\ngot= %q\nwant=%q", got, want)
+	}
+
+	c.Write([]byte("mn"))
+	if err := c.stop(); err != nil {
+		t.Fatalf("could not stop: %v", err)
+	}
+	if got, want := rec.get(), []string{"abcdefgh", "ij", "0123456789", "kl", "mn"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid writes after stop:\ngot= %q\nwant=%q", got, want)
+	}
+}
+
+func TestCoalescerError(t *testing.T) {
+	r, w := net.Pipe()
+	c := newCoalescer(w, 64, time.Millisecond)
+	r.Close()
+
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatalf("buffered write failed: %v", err)
+	}
+	// the error of the delayed flush is reported by the next write.
+	time.Sleep(50 * time.Millisecond)
+	if _, err := c.Write([]byte("world")); err == nil {
+		t.Fatalf("expected an error writing after a failed flush")
+	}
+}
+
+func TestConnZMTP31(t *testing.T) {
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+	defer p2.Close()
+
+	conn, err := newConn(p1, nullSecurity{}, Pub, nil, true)
+	if err != nil {
+		t.Fatalf("could not create conn: %v", err)
+	}
+	conn.version = [2]uint8{3, 1}
+
+	// recorded greeting and commands of a libzmq-4.3 SUB peer.
+	greeting := make([]byte, 64)
+	copy(greeting, []byte{0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0x7f, 0x03, 0x01, 'N', 'U', 'L', 'L'})
+	ready := append([]byte{0x04, 25, 5}, "READY\x0bSocket-Type\x00\x00\x00\x03SUB"...)
+	ping := append([]byte{0x04, 9, 4}, "PING\x00\x00hb"...)
+	pong := append([]byte{0x04, 7, 4}, "PONG"+"hb"...)
+	subscribe := append([]byte{0x04, 14, 9}, "SUBSCRIBE"+"news"...)
+	cancel := append([]byte{0x04, 11, 6}, "CANCEL"+"news"...)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- func() error {
+			buf := make([]byte, 64)
+			if _, err := io.ReadFull(p2, buf); err != nil {
+				return err
+			}
+			if got, want := buf[10:12], []byte{3, 1}; !bytes.Equal(got, want) {
+				return errors.Errorf("invalid announced version: got=%v, want=%v", got, want)
+			}
+			if _, err := p2.Write(greeting); err != nil {
+				return err
+			}
+			if _, err := io.ReadFull(p2, buf[:2]); err != nil {
+				return err
+			}
+			if _, err := io.ReadFull(p2, make([]byte, buf[1])); err != nil {
+				return err
+			}
+			if _, err := p2.Write(ready); err != nil {
+				return err
+			}
+
+			// PING commands are answered, even without heartbeats.
+			if _, err := p2.Write(ping); err != nil {
+				return err
+			}
+			buf = make([]byte, len(pong))
+			if _, err := io.ReadFull(p2, buf); err != nil {
+				return err
+			}
+			if !bytes.Equal(buf, pong) {
+				return errors.Errorf("invalid PONG:\ngot= %q\nwant=%q", buf, pong)
+			}
+			if _, err := p2.Write(subscribe); err != nil {
+				return err
+			}
+			_, err := p2.Write(cancel)
+			return err
+		}()
+	}()
+
+	if err := conn.init(conn.sec); err != nil {
+		t.Fatalf("could not perform handshake: %v", err)
+	}
+	if major, minor := conn.Version(); major != 3 || minor != 1 {
+		t.Fatalf("invalid negotiated version: got=%d.%d, want=3.1", major, minor)
+	}
+
+	for _, want := range []string{"\x01news", "\x00news"} {
+		msg := conn.recv()
+		if msg.err != nil {
+			t.Fatalf("could not recv subscription: %v", msg.err)
+		}
+		if !isTopic(msg) || string(msg.Frames[0]) != want {
+			t.Fatalf("invalid subscription: got=%q, want=%q", msg.Frames, want)
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("peer error: %v", err)
+	}
+}
+
+func TestConnZMTP31Negotiation(t *testing.T) {
+	for _, tc := range []struct {
+		peer [2]uint8
+		want [2]uint8
+	}{
+		{peer: [2]uint8{3, 0}, want: [2]uint8{3, 0}},
+		{peer: [2]uint8{3, 1}, want: [2]uint8{3, 1}},
+	} {
+		tc := tc
+		t.Run(fmt.Sprintf("%d.%d", tc.peer[0], tc.peer[1]), func(t *testing.T) {
+			// both ends write their greeting first: the pipe must be buffered.
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("could not listen: %v", err)
+			}
+			defer l.Close()
+			p1, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Fatalf("could not dial: %v", err)
+			}
+			p2, err := l.Accept()
+			if err != nil {
+				t.Fatalf("could not accept: %v", err)
+			}
+
+			sub, err := newConn(p1, nullSecurity{}, Sub, nil, true)
+			if err != nil {
+				t.Fatalf("could not create conn: %v", err)
+			}
+			defer sub.Close()
+			pub, err := newConn(p2, nullSecurity{}, Pub, nil, false)
+			if err != nil {
+				t.Fatalf("could not create conn: %v", err)
+			}
+			defer pub.Close()
+			sub.version = [2]uint8{3, 1}
+			pub.version = tc.peer
+
+			errc := make(chan error, 1)
+			go func() { errc <- pub.init(pub.sec) }()
+			if err := sub.init(sub.sec); err != nil {
+				t.Fatalf("could not perform handshake: %v", err)
+			}
+			if err := <-errc; err != nil {
+				t.Fatalf("could not perform peer handshake: %v", err)
+			}
+			for _, c := range []*Conn{sub, pub} {
+				if major, minor := c.Version(); major != int(tc.want[0]) || minor != int(tc.want[1]) {
+					t.Fatalf("%v: invalid negotiated version: got=%d.%d, want=%d.%d", c.typ, major, minor, tc.want[0], tc.want[1])
+				}
+			}
+
+			go func() { errc <- sub.SendMsg(NewMsg([]byte("\x01news"))) }()
+			msg := pub.read()
+			if msg.err != nil {
+				t.Fatalf("could not read subscription: %v", msg.err)
+			}
+			if err := <-errc; err != nil {
+				t.Fatalf("could not send subscription: %v", err)
+			}
+			// ZMTP 3.1 subscriptions are sent as commands.
+			if got, want := msg.isCmd(), tc.want[1] == 1; got != want {
+				t.Fatalf("invalid subscription command: got=%v, want=%v", got, want)
+			}
+		})
+	}
+}
+
+func TestConnErrClosedConn(t *testing.T) {
+	c1, c2 := newTestConnPair(t, Pair)
+	defer c2.Close()
+
+	if err := c1.Close(); err != nil {
+		t.Fatalf("could not close conn: %v", err)
+	}
+
+	if err := c1.SendMsg(NewMsgString("data")); errors.Cause(err) != ErrClosedConn {
+		t.Fatalf("invalid send error: got=%v, want=%v", err, ErrClosedConn)
+	}
+	if _, err := c1.RecvMsg(); errors.Cause(err) != ErrClosedConn {
+		t.Fatalf("invalid recv error: got=%v, want=%v", err, ErrClosedConn)
+	}
+}
+
+func TestConnPeerError(t *testing.T) {
+	for _, tc := range []struct {
+		reason string
+		cause  error
+	}{
+		{reason: reasonIncompatible, cause: ErrIncompatibleSocket},
+		{reason: reasonTooManyPeers, cause: ErrTooManyConnections},
+		{reason: "authentication failed"},
+	} {
+		tc := tc
+		t.Run(tc.reason, func(t *testing.T) {
+			c1, c2 := newTestConnPair(t, Pair)
+			defer c1.Close()
+			defer c2.Close()
+
+			// commands sent during the handshake, and afterwards.
+			for _, recv := range []func() error{
+				func() error { _, err := c1.RecvCmd(); return err },
+				func() error { return exportErr(c1.recv().err) },
+			} {
+				go c2.SendCmd(CmdError, errorReason(tc.reason))
+
+				err := recv()
+				var zerr *ZMTPError
+				if !stderrors.As(err, &zerr) {
+					t.Fatalf("invalid error: got=%v (%T), want=*ZMTPError", err, err)
+				}
+				if zerr.Cmd != CmdError || zerr.Reason != tc.reason {
+					t.Fatalf("invalid ZMTP error: got=(%q, %q), want=(%q, %q)", zerr.Cmd, zerr.Reason, CmdError, tc.reason)
+				}
+				if tc.cause != nil && errors.Cause(err) != tc.cause {
+					t.Fatalf("invalid cause: got=%v, want=%v", errors.Cause(err), tc.cause)
+				}
+			}
+		})
+	}
+}
@@ -8,7 +8,9 @@ package zmq4
 
 import (
 	"context"
+	"io"
 	"net"
+	"time"
 
 	czmq4 "github.com/zeromq/goczmq"
 )
@@ -86,6 +88,54 @@ func (sck *csocket) Recv() (Msg, error) {
 	return Msg{Frames: frames}, err
 }
 
+// SendContext puts the message on the outbound send queue.
+func (sck *csocket) SendContext(ctx context.Context, msg Msg) error {
+	panic("not implemented")
+}
+
+// RecvContext receives a complete message.
+func (sck *csocket) RecvContext(ctx context.Context) (Msg, error) {
+	panic("not implemented")
+}
+
+// TrySend sends msg if it can be done without waiting.
+func (sck *csocket) TrySend(msg Msg) (bool, error) {
+	panic("not implemented")
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (sck *csocket) TryRecv() (Msg, bool, error) {
+	panic("not implemented")
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (sck *csocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	panic("not implemented")
+}
+
+// SendBatch sends msgs, in order, in as few writes as possible.
+func (sck *csocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	panic("not implemented")
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (sck *csocket) SetSendDeadline(t time.Time) {
+	panic("not implemented")
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (sck *csocket) SetRecvDeadline(t time.Time) {
+	panic("not implemented")
+}
+
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (sck *csocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	panic("not implemented")
+}
+
 // Listen connects a local endpoint to the Socket.
 func (sck *csocket) Listen(addr string) error {
 	_, err := sck.sock.Bind(addr)
@@ -97,6 +147,41 @@ func (sck *csocket) Dial(addr string) error {
 	return sck.sock.Connect(addr)
 }
 
+// Unbind stops listening on a local endpoint.
+func (sck *csocket) Unbind(addr string) error {
+	return sck.sock.Unbind(addr)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (sck *csocket) Disconnect(addr string) error {
+	return sck.sock.Disconnect(addr)
+}
+
+// Addr returns the address the Socket is listening on.
+func (sck *csocket) Addr() net.Addr {
+	panic("not implemented")
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (sck *csocket) BoundEndpoints() []string {
+	panic("not implemented")
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to.
+func (sck *csocket) DialEndpoints() []string {
+	panic("not implemented")
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (sck *csocket) Monitor() <-chan Event {
+	panic("not implemented")
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (sck *csocket) WaitConnected(ctx context.Context) error {
+	panic("not implemented")
+}
+
 // Type returns the type of this Socket (PUB, SUB, ...)
 func (sck *csocket) Type() SocketType {
 	switch sck.sock.GetType() {
@@ -126,6 +211,74 @@ func (sck *csocket) Type() SocketType {
 	panic("invalid C-socket type")
 }
 
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+func (sck *csocket) ConnMetadata(peer string) map[string]string {
+	panic("not implemented")
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (sck *csocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	panic("not implemented")
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (sck *csocket) PeerConn(peer string) (net.Conn, error) {
+	panic("not implemented")
+}
+
+// Peers returns the peers connected to the socket.
+func (sck *csocket) Peers() []PeerInfo {
+	panic("not implemented")
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on.
+func (sck *csocket) RotateSecurity(sec Security) {
+	panic("not implemented")
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle.
+func (sck *csocket) CloseIdle(maxIdle time.Duration) int {
+	panic("not implemented")
+}
+
+// Stats returns the activity of the Socket.
+func (sck *csocket) Stats() Stats {
+	panic("not implemented")
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (sck *csocket) Config() ConfigSnapshot {
+	panic("not implemented")
+}
+
+// SendFrame sends a single frame of a message.
+// More frames of the same message follow when more is true.
+func (sck *csocket) SendFrame(frame []byte, more bool) error {
+	panic("not implemented")
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (sck *csocket) RecvFrame() ([]byte, bool, error) {
+	panic("not implemented")
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+func (sck *csocket) SendFrames(r io.Reader, size int64) error {
+	panic("not implemented")
+}
+
+// RecvFrameTo writes the next frame of a message to w.
+func (sck *csocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	panic("not implemented")
+}
+
 // Conn returns the underlying net.Conn the socket is bound to.
 func (sck *csocket) Conn() net.Conn {
 	panic("not implemented")
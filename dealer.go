@@ -6,12 +6,16 @@ package zmq4
 
 import (
 	"context"
+	"io"
+	"net"
+	"time"
 )
 
 // NewDealer returns a new DEALER ZeroMQ socket.
 // The returned socket value is initially unbound.
 func NewDealer(ctx context.Context, opts ...Option) Socket {
 	dealer := &dealerSocket{newSocket(ctx, Dealer, opts...)}
+	dealer.sck.w = newLBWriter(dealer.sck.ctx)
 	return dealer
 }
 
@@ -36,6 +40,12 @@ func (dealer *dealerSocket) Recv() (Msg, error) {
 	return dealer.sck.Recv()
 }
 
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (dealer *dealerSocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	return dealer.sck.RecvWithMeta()
+}
+
 // Listen connects a local endpoint to the Socket.
 func (dealer *dealerSocket) Listen(ep string) error {
 	return dealer.sck.Listen(ep)
@@ -46,6 +56,21 @@ func (dealer *dealerSocket) Dial(ep string) error {
 	return dealer.sck.Dial(ep)
 }
 
+// Unbind stops listening on a local endpoint.
+func (dealer *dealerSocket) Unbind(ep string) error {
+	return dealer.sck.Unbind(ep)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (dealer *dealerSocket) Disconnect(ep string) error {
+	return dealer.sck.Disconnect(ep)
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (dealer *dealerSocket) WaitConnected(ctx context.Context) error {
+	return dealer.sck.WaitConnected(ctx)
+}
+
 // Type returns the type of this Socket (PUB, SUB, ...)
 func (dealer *dealerSocket) Type() SocketType {
 	return dealer.sck.Type()
@@ -53,6 +78,9 @@ func (dealer *dealerSocket) Type() SocketType {
 
 // GetOption is used to retrieve an option for a socket.
 func (dealer *dealerSocket) GetOption(name string) (interface{}, error) {
+	if name == OptionProbeRouter {
+		return dealer.sck.getProbe(), nil
+	}
 	return dealer.sck.GetOption(name)
 }
 
@@ -61,6 +89,151 @@ func (dealer *dealerSocket) SetOption(name string, value interface{}) error {
 	return dealer.sck.SetOption(name, value)
 }
 
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+func (dealer *dealerSocket) ConnMetadata(peer string) map[string]string {
+	return dealer.sck.ConnMetadata(peer)
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (dealer *dealerSocket) Monitor() <-chan Event {
+	return dealer.sck.Monitor()
+}
+
+// Addr returns the address the Socket is listening on, or nil if
+// the Socket is not listening.
+func (dealer *dealerSocket) Addr() net.Addr {
+	return dealer.sck.Addr()
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (dealer *dealerSocket) BoundEndpoints() []string {
+	return dealer.sck.BoundEndpoints()
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (dealer *dealerSocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	return dealer.sck.ConnHandshake(peer)
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (dealer *dealerSocket) PeerConn(peer string) (net.Conn, error) {
+	return dealer.sck.PeerConn(peer)
+}
+
+// Peers returns the peers connected to the Socket, in the order they
+// connected.
+func (dealer *dealerSocket) Peers() []PeerInfo {
+	return dealer.sck.Peers()
+}
+
+// SendFrame sends a single frame of a message.
+// More frames of the same message follow when more is true.
+func (dealer *dealerSocket) SendFrame(frame []byte, more bool) error {
+	return dealer.sck.SendFrame(frame, more)
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (dealer *dealerSocket) RecvFrame() ([]byte, bool, error) {
+	return dealer.sck.recvFrame(dealer.Recv)
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+func (dealer *dealerSocket) SendFrames(rd io.Reader, size int64) error {
+	return dealer.sck.SendFrames(rd, size)
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (dealer *dealerSocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	return dealer.sck.RecvFrameTo(w)
+}
+
+// SendContext puts the message on the outbound send queue.
+// SendContext blocks until the message can be queued, the send deadline
+// expires or ctx is done.
+func (dealer *dealerSocket) SendContext(ctx context.Context, msg Msg) error {
+	return dealer.sck.SendContext(ctx, msg)
+}
+
+// SendBatch sends msgs, in order, in as few writes as possible.
+func (dealer *dealerSocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	return dealer.sck.SendBatch(ctx, msgs)
+}
+
+// RecvContext receives a complete message.
+// RecvContext returns ctx.Err() without consuming a message if ctx is done
+// first.
+func (dealer *dealerSocket) RecvContext(ctx context.Context) (Msg, error) {
+	return dealer.sck.RecvContext(ctx)
+}
+
+// TrySend sends msg if it can be done without waiting.
+func (dealer *dealerSocket) TrySend(msg Msg) (bool, error) {
+	return trySend(dealer.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (dealer *dealerSocket) TryRecv() (Msg, bool, error) {
+	return tryRecv(dealer.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (dealer *dealerSocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, dealer.TryRecv, dealer.RecvContext)
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (dealer *dealerSocket) SetSendDeadline(t time.Time) {
+	dealer.sck.SetSendDeadline(t)
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (dealer *dealerSocket) SetRecvDeadline(t time.Time) {
+	dealer.sck.SetRecvDeadline(t)
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+func (dealer *dealerSocket) RotateSecurity(sec Security) {
+	dealer.sck.RotateSecurity(sec)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (dealer *dealerSocket) CloseIdle(maxIdle time.Duration) int {
+	return dealer.sck.CloseIdle(maxIdle)
+}
+
+// Stats returns the activity of the Socket.
+func (dealer *dealerSocket) Stats() Stats {
+	return dealer.sck.Stats()
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to,
+// in the order they were dialed.
+func (dealer *dealerSocket) DialEndpoints() []string {
+	return dealer.sck.DialEndpoints()
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (dealer *dealerSocket) Config() ConfigSnapshot {
+	return dealer.sck.Config()
+}
+
+// base returns the socket implementing the core of the Socket.
+func (dealer *dealerSocket) base() *socket {
+	return dealer.sck
+}
+
 var (
 	_ Socket = (*dealerSocket)(nil)
 )
@@ -0,0 +1,340 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build zmq4_draft
+// +build zmq4_draft
+
+package zmq4
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NewDish returns a new DISH ZeroMQ socket.
+// DISH sockets receive the messages of the groups they joined, with Join,
+// from their RADIO peers. The group of a received message is given by
+// Msg.Group.
+// The returned socket value is initially unbound.
+func NewDish(ctx context.Context, opts ...Option) DishSocket {
+	dish := &dishSocket{
+		sck:    newSocket(ctx, Dish, opts...),
+		groups: make(map[string]struct{}),
+	}
+	dish.sck.r = newFQReaderHook(dish.sck.ctx, dish.recv)
+	dish.sck.w = nil
+	dish.sck.onConn = dish.greet
+	return dish
+}
+
+// DishSocket is a DISH ZeroMQ socket, as returned by NewDish.
+type DishSocket interface {
+	Socket
+
+	// Join joins group: messages of that group are received from now on.
+	Join(group string) error
+
+	// Leave leaves group: messages of that group are not received anymore.
+	Leave(group string) error
+}
+
+// dishSocket is a DISH ZeroMQ socket.
+type dishSocket struct {
+	sck *socket
+
+	mu     sync.RWMutex
+	groups map[string]struct{} // joined groups
+}
+
+// Join joins group: messages of that group are received from now on.
+func (dish *dishSocket) Join(group string) error {
+	if err := validGroup(group); err != nil {
+		return err
+	}
+	dish.mu.Lock()
+	_, dup := dish.groups[group]
+	dish.groups[group] = struct{}{}
+	dish.mu.Unlock()
+	if dup {
+		return errors.Errorf("zmq4: group %q already joined", group)
+	}
+	return dish.send(CmdJoin, group)
+}
+
+// Leave leaves group: messages of that group are not received anymore.
+func (dish *dishSocket) Leave(group string) error {
+	dish.mu.Lock()
+	_, ok := dish.groups[group]
+	delete(dish.groups, group)
+	dish.mu.Unlock()
+	if !ok {
+		return errors.Errorf("zmq4: group %q not joined", group)
+	}
+	return dish.send(CmdLeave, group)
+}
+
+// send sends the command name about group to all the peers.
+func (dish *dishSocket) send(name, group string) error {
+	dish.sck.mu.RLock()
+	conns := append([]*Conn(nil), dish.sck.conns...)
+	dish.sck.mu.RUnlock()
+
+	var err error
+	for _, c := range conns {
+		e := c.SendCmd(name, []byte(group))
+		if e != nil && err == nil {
+			err = errors.Wrapf(e, "zmq4: could not send %s command to %q", name, c.ep)
+		}
+	}
+	return err
+}
+
+// greet sends the joined groups to the new peer c.
+func (dish *dishSocket) greet(c *Conn) {
+	dish.mu.RLock()
+	defer dish.mu.RUnlock()
+	for group := range dish.groups {
+		err := c.SendCmd(CmdJoin, []byte(group))
+		if err != nil {
+			logf(dish.sck.log, LevelWarn, "zmq4: could not send JOIN command to %q: %+v", c.ep, err)
+			return
+		}
+	}
+}
+
+// recv moves the group frame of the messages received by a DISH to their
+// Group, and drops the messages of groups that are not joined.
+func (dish *dishSocket) recv(r *msgReader, msg *Msg) bool {
+	if msg.err != nil {
+		return true
+	}
+	if len(msg.Frames) != 2 {
+		return false
+	}
+	group := string(msg.Frames[0])
+	dish.mu.RLock()
+	_, ok := dish.groups[group]
+	dish.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	msg.Group = group
+	msg.Frames = msg.Frames[1:]
+	return true
+}
+
+// Close closes the open Socket
+func (dish *dishSocket) Close() error {
+	return dish.sck.Close()
+}
+
+// Send puts the message on the outbound send queue.
+// Send blocks until the message can be queued or the send deadline expires.
+func (*dishSocket) Send(msg Msg) error {
+	return errors.Errorf("zmq4: DISH sockets can't send messages")
+}
+
+// Recv receives a complete message.
+func (dish *dishSocket) Recv() (Msg, error) {
+	return dish.sck.Recv()
+}
+
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (dish *dishSocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	return dish.sck.RecvWithMeta()
+}
+
+// Listen connects a local endpoint to the Socket.
+func (dish *dishSocket) Listen(ep string) error {
+	return dish.sck.Listen(ep)
+}
+
+// Dial connects a remote endpoint to the Socket.
+func (dish *dishSocket) Dial(ep string) error {
+	return dish.sck.Dial(ep)
+}
+
+// Unbind stops listening on a local endpoint.
+func (dish *dishSocket) Unbind(ep string) error {
+	return dish.sck.Unbind(ep)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (dish *dishSocket) Disconnect(ep string) error {
+	return dish.sck.Disconnect(ep)
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (dish *dishSocket) WaitConnected(ctx context.Context) error {
+	return dish.sck.WaitConnected(ctx)
+}
+
+// Type returns the type of this Socket (PUB, SUB, ...)
+func (dish *dishSocket) Type() SocketType {
+	return dish.sck.Type()
+}
+
+// GetOption is used to retrieve an option for a socket.
+func (dish *dishSocket) GetOption(name string) (interface{}, error) {
+	return dish.sck.GetOption(name)
+}
+
+// SetOption is used to set an option for a socket.
+func (dish *dishSocket) SetOption(name string, value interface{}) error {
+	return dish.sck.SetOption(name, value)
+}
+
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+func (dish *dishSocket) ConnMetadata(peer string) map[string]string {
+	return dish.sck.ConnMetadata(peer)
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (dish *dishSocket) Monitor() <-chan Event {
+	return dish.sck.Monitor()
+}
+
+// Addr returns the address the Socket is listening on, or nil if
+// the Socket is not listening.
+func (dish *dishSocket) Addr() net.Addr {
+	return dish.sck.Addr()
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (dish *dishSocket) BoundEndpoints() []string {
+	return dish.sck.BoundEndpoints()
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (dish *dishSocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	return dish.sck.ConnHandshake(peer)
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (dish *dishSocket) PeerConn(peer string) (net.Conn, error) {
+	return dish.sck.PeerConn(peer)
+}
+
+// Peers returns the peers connected to the Socket, in the order they
+// connected.
+func (dish *dishSocket) Peers() []PeerInfo {
+	return dish.sck.Peers()
+}
+
+// SendFrame sends a single frame of a message.
+// More frames of the same message follow when more is true.
+func (dish *dishSocket) SendFrame(frame []byte, more bool) error {
+	return dish.sck.SendFrame(frame, more)
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+// The group of the message is not returned.
+func (dish *dishSocket) RecvFrame() ([]byte, bool, error) {
+	return dish.sck.recvFrame(dish.Recv)
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+func (dish *dishSocket) SendFrames(rd io.Reader, size int64) error {
+	return dish.sck.SendFrames(rd, size)
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (dish *dishSocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	return dish.sck.RecvFrameTo(w)
+}
+
+// RecvContext receives a complete message.
+// RecvContext returns ctx.Err() without consuming a message if ctx is done
+// first.
+func (dish *dishSocket) RecvContext(ctx context.Context) (Msg, error) {
+	return dish.sck.RecvContext(ctx)
+}
+
+// TrySend sends msg if it can be done without waiting.
+func (dish *dishSocket) TrySend(msg Msg) (bool, error) {
+	return trySend(dish.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (dish *dishSocket) TryRecv() (Msg, bool, error) {
+	return tryRecv(dish.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (dish *dishSocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, dish.TryRecv, dish.RecvContext)
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (dish *dishSocket) SetSendDeadline(t time.Time) {
+	dish.sck.SetSendDeadline(t)
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (dish *dishSocket) SetRecvDeadline(t time.Time) {
+	dish.sck.SetRecvDeadline(t)
+}
+
+// SendContext puts the message on the outbound send queue.
+func (dish *dishSocket) SendContext(ctx context.Context, msg Msg) error {
+	return dish.Send(msg)
+}
+
+// SendBatch sends msgs, in order, one at a time.
+func (dish *dishSocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	return sendEach(ctx, dish.SendContext, msgs)
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+func (dish *dishSocket) RotateSecurity(sec Security) {
+	dish.sck.RotateSecurity(sec)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (dish *dishSocket) CloseIdle(maxIdle time.Duration) int {
+	return dish.sck.CloseIdle(maxIdle)
+}
+
+// Stats returns the activity of the Socket.
+func (dish *dishSocket) Stats() Stats {
+	return dish.sck.Stats()
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to,
+// in the order they were dialed.
+func (dish *dishSocket) DialEndpoints() []string {
+	return dish.sck.DialEndpoints()
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (dish *dishSocket) Config() ConfigSnapshot {
+	return dish.sck.Config()
+}
+
+// base returns the socket implementing the core of the Socket.
+func (dish *dishSocket) base() *socket {
+	return dish.sck
+}
+
+var (
+	_ DishSocket = (*dishSocket)(nil)
+)
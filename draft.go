@@ -0,0 +1,87 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build zmq4_draft
+// +build zmq4_draft
+
+package zmq4
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// Draft socket types, enabled by the zmq4_draft build tag.
+const (
+	Scatter SocketType = "SCATTER" // a ZMQ_SCATTER socket
+	Gather  SocketType = "GATHER"  // a ZMQ_GATHER socket
+	Radio   SocketType = "RADIO"   // a ZMQ_RADIO socket
+	Dish    SocketType = "DISH"    // a ZMQ_DISH socket
+)
+
+// ZMTP 3.1 commands of DISH sockets joining and leaving groups.
+const (
+	CmdJoin  = "JOIN"
+	CmdLeave = "LEAVE"
+)
+
+// maxGroupLen is the maximum length of a RADIO/DISH group.
+const maxGroupLen = 15
+
+func init() {
+	peerTypes[Scatter] = []SocketType{Gather}
+	peerTypes[Gather] = []SocketType{Scatter}
+	peerTypes[Radio] = []SocketType{Dish}
+	peerTypes[Dish] = []SocketType{Radio}
+
+	// PGM is not reliable yet: NAK, SPM and repair data are missing, so
+	// lost packets are skipped instead of being retransmitted.
+	transports["pgm"] = transport{multicast: true}
+	transports["epgm"] = transport{multicast: true}
+}
+
+// validGroup returns an error if group is not a valid RADIO/DISH group.
+func validGroup(group string) error {
+	if len(group) > maxGroupLen {
+		return errors.Errorf("zmq4: group %q longer than %d bytes", group, maxGroupLen)
+	}
+	return nil
+}
+
+// errMultipart returns the error of sending a multipart message over
+// a socket of type typ.
+func errMultipart(typ SocketType) error {
+	return errors.Errorf("zmq4: %s sockets can not send multipart messages", typ)
+}
+
+// sockLock is a mutex, locked at the socket level by thread-safe sockets,
+// whose locking can be canceled.
+type sockLock chan struct{}
+
+func newSockLock() sockLock {
+	return make(sockLock, 1)
+}
+
+// lock locks l, or returns ctx.Err() if ctx is done first.
+func (l sockLock) lock(ctx context.Context) error {
+	if dontWait(ctx) {
+		select {
+		case l <- struct{}{}:
+			return nil
+		default:
+			return ErrWouldBlock
+		}
+	}
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l sockLock) unlock() {
+	<-l
+}
@@ -0,0 +1,183 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrClosedConn is returned by the operations of closed connections.
+	ErrClosedConn = errors.New("zmq4: use of closed connection")
+
+	// ErrTimeout is returned by the operations that did not complete
+	// before their timeout or deadline.
+	// ErrTimeout is context.DeadlineExceeded, so that existing comparisons
+	// keep working, and errors.Is(err, ErrTimeout) also reports the
+	// timeouts of the network, such as dial and handshake timeouts.
+	ErrTimeout = context.DeadlineExceeded
+)
+
+// ErrBadEndpoint is returned when listening on or dialing an endpoint
+// that is not valid, such as an endpoint with an unknown transport.
+type ErrBadEndpoint struct {
+	Endpoint string
+	Err      error // reason why the endpoint is not valid
+}
+
+func (e *ErrBadEndpoint) Error() string {
+	return fmt.Sprintf("zmq4: invalid endpoint %q: %s", e.Endpoint, strings.TrimPrefix(e.Err.Error(), "zmq4: "))
+}
+
+func (e *ErrBadEndpoint) Cause() error  { return e.Err }
+func (e *ErrBadEndpoint) Unwrap() error { return e.Err }
+
+// ErrUnknownTransport is the reason of the ErrBadEndpoint errors of
+// endpoints whose scheme, such as tcp or ipc, names no known transport.
+type ErrUnknownTransport struct {
+	Scheme string
+}
+
+func (e *ErrUnknownTransport) Error() string {
+	return fmt.Sprintf("zmq4: unknown transport %q", e.Scheme)
+}
+
+// ErrHandshake is returned when the ZMTP handshake with a peer fails.
+type ErrHandshake struct {
+	Reason string // reason of the failure, as reported by the peer if it did
+	Err    error
+}
+
+func newErrHandshake(err error) *ErrHandshake {
+	reason := errors.Cause(err).Error()
+	return &ErrHandshake{
+		Reason: strings.TrimPrefix(reason, "zmq4: "),
+		Err:    err,
+	}
+}
+
+func (e *ErrHandshake) Error() string {
+	if e.Err == nil {
+		return "zmq4: handshake failed: " + e.Reason
+	}
+	return "zmq4: handshake failed: " + strings.TrimPrefix(e.Err.Error(), "zmq4: ")
+}
+
+func (e *ErrHandshake) Cause() error  { return e.Err }
+func (e *ErrHandshake) Unwrap() error { return e.Err }
+
+// ZMTPError is returned when a peer reports an error with a ZMTP command,
+// e.g. when it rejects the type of the socket or its credentials.
+type ZMTPError struct {
+	Cmd    string // name of the command reporting the error, CmdError
+	Reason string // reason of the error, as reported by the peer
+}
+
+func (e *ZMTPError) Error() string {
+	return fmt.Sprintf("zmq4: peer error: %q", e.Reason)
+}
+
+// zmtpCause is a ZMTP error whose reason is known to this package, and
+// reported as the given error: errors.Cause returns it, and errors.As
+// with a *ZMTPError target finds the ZMTP error.
+type zmtpCause struct {
+	zerr  *ZMTPError
+	cause error
+}
+
+func (e *zmtpCause) Error() string { return e.zerr.Error() }
+func (e *zmtpCause) Cause() error  { return e.cause }
+func (e *zmtpCause) Unwrap() error { return e.cause }
+
+func (e *zmtpCause) As(target interface{}) bool {
+	if t, ok := target.(**ZMTPError); ok {
+		*t = e.zerr
+		return true
+	}
+	return false
+}
+
+// exportErr returns err as returned to the callers of the package.
+// Wrapped errors are wrapped once more, so that the errors they wrap can
+// be found with errors.Is and errors.As, as well as with errors.Cause.
+func exportErr(err error) error {
+	if err == nil || errors.Cause(err) == err {
+		return err
+	}
+	if _, ok := err.(*exportedError); ok {
+		return err
+	}
+	return &exportedError{err}
+}
+
+// exportedError is a wrapped error whose chain of wrapped errors, made of
+// errors.Cause and errors.Unwrap links, can be inspected with errors.Is
+// and errors.As.
+type exportedError struct {
+	err error
+}
+
+func (e *exportedError) Error() string { return e.err.Error() }
+func (e *exportedError) Cause() error  { return e.err }
+
+func (e *exportedError) Is(target error) bool {
+	for err := e.err; err != nil; err = nextErr(err) {
+		if stderrors.Is(err, target) {
+			return true
+		}
+		if ne, ok := err.(net.Error); ok && ne.Timeout() && target == ErrTimeout {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *exportedError) As(target interface{}) bool {
+	for err := e.err; err != nil; err = nextErr(err) {
+		if stderrors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Format formats the error like the wrapped error, with its stack trace
+// for %+v.
+func (e *exportedError) Format(s fmt.State, verb rune) {
+	if f, ok := e.err.(fmt.Formatter); ok {
+		f.Format(s, verb)
+		return
+	}
+	switch verb {
+	case 'q':
+		fmt.Fprintf(s, "%q", e.Error())
+	default:
+		io.WriteString(s, e.Error())
+	}
+}
+
+// nextErr returns the error wrapped by err, if any.
+func nextErr(err error) error {
+	if c, ok := err.(interface{ Cause() error }); ok {
+		return c.Cause()
+	}
+	return stderrors.Unwrap(err)
+}
+
+var (
+	_ error = (*ErrBadEndpoint)(nil)
+	_ error = (*ErrUnknownTransport)(nil)
+	_ error = (*ErrHandshake)(nil)
+	_ error = (*ZMTPError)(nil)
+	_ error = (*zmtpCause)(nil)
+	_ error = (*exportedError)(nil)
+)
@@ -0,0 +1,259 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build zmq4_draft
+// +build zmq4_draft
+
+package zmq4
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NewGather returns a new GATHER ZeroMQ socket.
+// GATHER sockets are the thread-safe successors of PULL sockets: messages
+// are fair-queued from the connected peers, and may be received from
+// several goroutines at once. Multipart messages are dropped.
+// The returned socket value is initially unbound.
+func NewGather(ctx context.Context, opts ...Option) Socket {
+	gather := &gatherSocket{sck: newSocket(ctx, Gather, opts...), lk: newSockLock()}
+	gather.sck.r = newFQReaderHook(gather.sck.ctx, gatherRecv)
+	gather.sck.w = nil
+	return gather
+}
+
+// gatherSocket is a GATHER ZeroMQ socket.
+type gatherSocket struct {
+	sck *socket
+	lk  sockLock // serializes receives
+}
+
+// Close closes the open Socket
+func (gather *gatherSocket) Close() error {
+	return gather.sck.Close()
+}
+
+// Send puts the message on the outbound send queue.
+// Send blocks until the message can be queued or the send deadline expires.
+func (*gatherSocket) Send(msg Msg) error {
+	return errors.Errorf("zmq4: GATHER sockets can't send messages")
+}
+
+// Recv receives a complete message.
+func (gather *gatherSocket) Recv() (Msg, error) {
+	return gather.RecvContext(context.Background())
+}
+
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (gather *gatherSocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	gather.lk.lock(context.Background())
+	defer gather.lk.unlock()
+	return gather.sck.RecvWithMeta()
+}
+
+// Listen connects a local endpoint to the Socket.
+func (gather *gatherSocket) Listen(ep string) error {
+	return gather.sck.Listen(ep)
+}
+
+// Dial connects a remote endpoint to the Socket.
+func (gather *gatherSocket) Dial(ep string) error {
+	return gather.sck.Dial(ep)
+}
+
+// Unbind stops listening on a local endpoint.
+func (gather *gatherSocket) Unbind(ep string) error {
+	return gather.sck.Unbind(ep)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (gather *gatherSocket) Disconnect(ep string) error {
+	return gather.sck.Disconnect(ep)
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (gather *gatherSocket) WaitConnected(ctx context.Context) error {
+	return gather.sck.WaitConnected(ctx)
+}
+
+// Type returns the type of this Socket (PUB, SUB, ...)
+func (gather *gatherSocket) Type() SocketType {
+	return gather.sck.Type()
+}
+
+// GetOption is used to retrieve an option for a socket.
+func (gather *gatherSocket) GetOption(name string) (interface{}, error) {
+	return gather.sck.GetOption(name)
+}
+
+// SetOption is used to set an option for a socket.
+func (gather *gatherSocket) SetOption(name string, value interface{}) error {
+	return gather.sck.SetOption(name, value)
+}
+
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+func (gather *gatherSocket) ConnMetadata(peer string) map[string]string {
+	return gather.sck.ConnMetadata(peer)
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (gather *gatherSocket) Monitor() <-chan Event {
+	return gather.sck.Monitor()
+}
+
+// Addr returns the address the Socket is listening on, or nil if
+// the Socket is not listening.
+func (gather *gatherSocket) Addr() net.Addr {
+	return gather.sck.Addr()
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (gather *gatherSocket) BoundEndpoints() []string {
+	return gather.sck.BoundEndpoints()
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (gather *gatherSocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	return gather.sck.ConnHandshake(peer)
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (gather *gatherSocket) PeerConn(peer string) (net.Conn, error) {
+	return gather.sck.PeerConn(peer)
+}
+
+// Peers returns the peers connected to the Socket, in the order they
+// connected.
+func (gather *gatherSocket) Peers() []PeerInfo {
+	return gather.sck.Peers()
+}
+
+// SendFrame sends a single frame of a message.
+// More frames of the same message follow when more is true.
+func (gather *gatherSocket) SendFrame(frame []byte, more bool) error {
+	return gather.sck.SendFrame(frame, more)
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (gather *gatherSocket) RecvFrame() ([]byte, bool, error) {
+	gather.lk.lock(context.Background())
+	defer gather.lk.unlock()
+	return gather.sck.RecvFrame()
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+func (gather *gatherSocket) SendFrames(rd io.Reader, size int64) error {
+	return gather.sck.SendFrames(rd, size)
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (gather *gatherSocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	gather.lk.lock(context.Background())
+	defer gather.lk.unlock()
+	return gather.sck.RecvFrameTo(w)
+}
+
+// RecvContext receives a complete message.
+// RecvContext returns ctx.Err() without consuming a message if ctx is done
+// first.
+func (gather *gatherSocket) RecvContext(ctx context.Context) (Msg, error) {
+	if err := gather.lk.lock(ctx); err != nil {
+		return Msg{}, err
+	}
+	defer gather.lk.unlock()
+	return gather.sck.RecvContext(ctx)
+}
+
+// TrySend sends msg if it can be done without waiting.
+func (gather *gatherSocket) TrySend(msg Msg) (bool, error) {
+	return trySend(gather.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (gather *gatherSocket) TryRecv() (Msg, bool, error) {
+	return tryRecv(gather.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (gather *gatherSocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, gather.TryRecv, gather.RecvContext)
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (gather *gatherSocket) SetSendDeadline(t time.Time) {
+	gather.sck.SetSendDeadline(t)
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (gather *gatherSocket) SetRecvDeadline(t time.Time) {
+	gather.sck.SetRecvDeadline(t)
+}
+
+// SendContext puts the message on the outbound send queue.
+func (gather *gatherSocket) SendContext(ctx context.Context, msg Msg) error {
+	return gather.Send(msg)
+}
+
+// SendBatch sends msgs, in order, one at a time.
+func (gather *gatherSocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	return sendEach(ctx, gather.SendContext, msgs)
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+func (gather *gatherSocket) RotateSecurity(sec Security) {
+	gather.sck.RotateSecurity(sec)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (gather *gatherSocket) CloseIdle(maxIdle time.Duration) int {
+	return gather.sck.CloseIdle(maxIdle)
+}
+
+// Stats returns the activity of the Socket.
+func (gather *gatherSocket) Stats() Stats {
+	return gather.sck.Stats()
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to,
+// in the order they were dialed.
+func (gather *gatherSocket) DialEndpoints() []string {
+	return gather.sck.DialEndpoints()
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (gather *gatherSocket) Config() ConfigSnapshot {
+	return gather.sck.Config()
+}
+
+// base returns the socket implementing the core of the Socket.
+func (gather *gatherSocket) base() *socket {
+	return gather.sck
+}
+
+// gatherRecv drops the multipart messages sent by misbehaving peers.
+func gatherRecv(r *msgReader, msg *Msg) bool {
+	return msg.err != nil || len(msg.Frames) == 1
+}
+
+var (
+	_ Socket = (*gatherSocket)(nil)
+)
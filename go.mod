@@ -1,5 +1,7 @@
 module github.com/go-zeromq/zmq4
 
+go 1.13
+
 require (
 	github.com/pkg/errors v0.8.0
 	golang.org/x/net v0.0.0-20180629035331-4cb1c02c05b0
@@ -22,6 +22,9 @@ type conn struct {
 
 	rdeadline pipeDeadline
 	wdeadline pipeDeadline
+
+	rmu  sync.Mutex // Protects rbuf
+	rbuf []byte     // data received but not yet read
 }
 
 func (c *conn) Write(data []byte) (int, error) {
@@ -54,7 +57,6 @@ func (c *conn) write(data []byte) (int, error) {
 	case <-c.wdeadline.wait():
 		return n, timeoutError{}
 	}
-	return n, nil
 }
 
 func (c *conn) Read(data []byte) (int, error) {
@@ -66,27 +68,50 @@ func (c *conn) Read(data []byte) (int, error) {
 }
 
 func (c *conn) read(data []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	if len(c.rbuf) > 0 {
+		n := copy(data, c.rbuf)
+		c.rbuf = c.rbuf[n:]
+		return n, nil
+	}
+
 	switch {
 	case isClosedChan(c.localDone):
 		return 0, io.ErrClosedPipe
-	case isClosedChan(c.remoteDone):
-		return 0, io.EOF
 	case isClosedChan(c.rdeadline.wait()):
 		return 0, timeoutError{}
 	}
 
 	select {
 	case bw := <-c.r:
-		nr := copy(data, bw)
-		if len(data) < len(bw) {
-			return nr, io.ErrShortBuffer
+		return c.copyBuffer(data, bw)
+	case <-c.localDone:
+		return 0, io.ErrClosedPipe
+	case <-c.remoteDone:
+		// deliver the data written before the remote end was closed.
+		select {
+		case bw := <-c.r:
+			return c.copyBuffer(data, bw)
+		default:
+			return 0, io.EOF
 		}
-		return nr, nil
 	case <-c.rdeadline.wait():
 		return 0, timeoutError{}
 	}
 }
 
+// copyBuffer copies src into dst, keeping what does not fit for the
+// next read.
+func (c *conn) copyBuffer(dst, src []byte) (int, error) {
+	n := copy(dst, src)
+	if n < len(src) {
+		c.rbuf = append([]byte(nil), src[n:]...)
+	}
+	return n, nil
+}
+
 func (c *conn) LocalAddr() net.Addr  { return c.addr }
 func (c *conn) RemoteAddr() net.Addr { return c.addr }
 
@@ -18,6 +18,7 @@ var (
 
 	ErrClosed      = errors.New("inproc: connection closed")
 	ErrConnRefused = errors.New("inproc: connection refused")
+	ErrAddrInUse   = errors.New("inproc: address already in use")
 )
 
 func init() {
@@ -37,7 +38,7 @@ type context struct {
 type Listener struct {
 	addr Addr
 
-	pipes  []*pipe
+	pipes  []*pipe // dialed pipes waiting to be accepted
 	closed bool
 }
 
@@ -92,7 +93,7 @@ func Listen(addr string) (*Listener, error) {
 	_, dup := mgr.db[addr]
 	if dup {
 		mgr.mu.Unlock()
-		return nil, errors.Errorf("inproc: address %q already in use", addr)
+		return nil, errors.Wrapf(ErrAddrInUse, "inproc: could not listen to %q", addr)
 	}
 
 	l := &Listener{
@@ -126,48 +127,45 @@ func (l *Listener) Close() error {
 			err = e
 		}
 	}
+	l.pipes = nil
 	l.closed = true
 	delete(mgr.db, string(l.addr))
+	mgr.cv.Broadcast()
 	return err
 }
 
 // Accept waits for and returns the next connection to the listener.
 func (l *Listener) Accept() (net.Conn, error) {
 	mgr.mu.Lock()
-	p := newPipe(l.addr)
-	l.pipes = append(l.pipes, p)
-	closed := l.closed
-	mgr.cv.Broadcast()
-	mgr.mu.Unlock()
+	defer mgr.mu.Unlock()
 
-	if closed {
-		return nil, ErrClosed
+	for {
+		if l.closed {
+			return nil, ErrClosed
+		}
+		if len(l.pipes) != 0 {
+			p := l.pipes[0]
+			l.pipes = l.pipes[1:]
+			return p.p1, nil
+		}
+		mgr.cv.Wait()
 	}
-	return p.p1, nil
 }
 
 // Dial connects to the given address.
+// The connection is queued until the listener accepts it.
 func Dial(addr string) (net.Conn, error) {
 	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
 
-	for {
-		var (
-			l  *Listener
-			ok bool
-		)
-		if l, ok = mgr.db[addr]; !ok || l == nil {
-			mgr.mu.Unlock()
-			return nil, ErrConnRefused
-		}
-		if n := len(l.pipes); n != 0 {
-			p := l.pipes[n-1]
-			l.pipes = l.pipes[:n-1]
-			mgr.mu.Unlock()
-			return p.p2, nil
-		}
-		mgr.cv.Wait()
+	l, ok := mgr.db[addr]
+	if !ok || l == nil {
+		return nil, ErrConnRefused
 	}
-	panic("unreachable")
+	p := newPipe(l.addr)
+	l.pipes = append(l.pipes, p)
+	mgr.cv.Broadcast()
+	return p.p2, nil
 }
 
 // Addr represents an in-process "network" end-point address.
@@ -0,0 +1,64 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	stderrors "errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ipcProbeTimeout is the maximum time spent checking whether a process
+// listens on an existing ipc socket file.
+const ipcProbeTimeout = time.Second
+
+// ipcAbstract reports whether addr, written ipc://@name, names a unix
+// socket of the Linux abstract namespace, which lives outside of the
+// filesystem.
+func ipcAbstract(addr string) bool {
+	return strings.HasPrefix(addr, "@")
+}
+
+// prepareIPC prepares the filesystem for listening on the unix socket addr:
+// missing parent directories are created, and a stale socket file, left
+// over by a process that exited without removing it, is removed.
+// Socket files a process still listens on are left alone: listening on
+// them then fails with an address in use.
+func prepareIPC(addr string) error {
+	if ipcAbstract(addr) {
+		return nil
+	}
+	if dir := filepath.Dir(addr); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	fi, err := os.Lstat(addr)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	conn, err := net.DialTimeout("unix", addr, ipcProbeTimeout)
+	if err == nil {
+		conn.Close()
+		return nil
+	}
+	if !stderrors.Is(err, syscall.ECONNREFUSED) {
+		return nil
+	}
+	return os.Remove(addr)
+}
+
+// removeIPC removes the socket file of the unix socket addr, if any.
+func removeIPC(addr string) {
+	if ipcAbstract(addr) {
+		return
+	}
+	os.Remove(addr)
+}
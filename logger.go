@@ -0,0 +1,134 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+)
+
+// Level is the severity of a log entry.
+type Level int
+
+const (
+	LevelDebug Level = iota // connections coming and going
+	LevelInfo               // notable but expected conditions
+	LevelWarn               // connections lost or turned down
+	LevelError              // failed handshakes, binds and dials
+)
+
+func (lvl Level) String() string {
+	switch lvl {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Level(%d)", int(lvl))
+}
+
+// Field is a key/value pair attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger is the interface of structured loggers receiving the diagnostic
+// entries of sockets: their lifecycle events, and their internal errors
+// such as connection errors and dropped messages.
+// Log may be called concurrently from several goroutines.
+// See WithLogger.
+type Logger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+// NewStdLogger returns a Logger writing each entry to w as a line of text,
+// made of the level, the message and the key=value fields of the entry.
+func NewStdLogger(w io.Writer) Logger {
+	return &stdLogger{w: w}
+}
+
+type stdLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *stdLogger) Log(level Level, msg string, fields ...Field) {
+	buf := formatEntry(level, msg, fields)
+	buf.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(buf.Bytes())
+}
+
+// NewLogLogger returns a Logger printing each entry to l, formatted like
+// the entries of NewStdLogger.
+func NewLogLogger(l *log.Logger) Logger {
+	return &logLogger{l: l}
+}
+
+type logLogger struct {
+	l *log.Logger
+}
+
+func (l *logLogger) Log(level Level, msg string, fields ...Field) {
+	l.l.Print(formatEntry(level, msg, fields).String())
+}
+
+// formatEntry formats a log entry as a line of text, without the final newline.
+func formatEntry(level Level, msg string, fields []Field) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%v %s", level, msg)
+	for _, f := range fields {
+		fmt.Fprintf(buf, " %s=%q", f.Key, fmt.Sprint(f.Value))
+	}
+	return buf
+}
+
+// logf formats a message to l at the given level, if l is not nil.
+func logf(l Logger, level Level, format string, args ...interface{}) {
+	if l == nil {
+		return
+	}
+	l.Log(level, fmt.Sprintf(format, args...))
+}
+
+// logEvent logs the lifecycle event ev.
+func (sck *socket) logEvent(ev Event) {
+	l := sck.log
+	if l == nil {
+		return
+	}
+
+	level := LevelDebug
+	switch ev.Type {
+	case EventHandshakeFailed, EventBindFailed, EventConnectFailed:
+		level = LevelError
+	case EventRejected, EventIdentityConflict:
+		level = LevelWarn
+	case EventDisconnected:
+		if sck.ctx.Err() == nil {
+			// the peer went away, or the connection broke.
+			level = LevelWarn
+		}
+	}
+
+	fields := []Field{
+		{Key: "socket", Value: sck.typ},
+		{Key: "endpoint", Value: ev.Endpoint},
+	}
+	if ev.Err != nil {
+		fields = append(fields, Field{Key: "error", Value: ev.Err})
+	}
+	l.Log(level, "zmq4: "+ev.Type.String(), fields...)
+}
@@ -0,0 +1,118 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"fmt"
+	"sync"
+)
+
+// EventType describes the kind of a socket lifecycle event.
+type EventType int
+
+const (
+	EventListening        EventType = iota // the socket is listening on an endpoint
+	EventBindFailed                        // the socket could not listen on an endpoint
+	EventAccepted                          // a connection from a remote peer was accepted
+	EventConnected                         // a connection to a remote peer was established
+	EventConnectFailed                     // the socket could not dial an endpoint
+	EventHandshakeFailed                   // the ZMTP handshake with a peer failed
+	EventDisconnected                      // a connection to a peer was closed
+	EventRejected                          // a connection from a remote peer was rejected
+	EventIdentityConflict                  // a peer announced the identity of an already connected peer
+)
+
+func (typ EventType) String() string {
+	switch typ {
+	case EventListening:
+		return "listening"
+	case EventBindFailed:
+		return "bind-failed"
+	case EventAccepted:
+		return "accepted"
+	case EventConnected:
+		return "connected"
+	case EventConnectFailed:
+		return "connect-failed"
+	case EventHandshakeFailed:
+		return "handshake-failed"
+	case EventDisconnected:
+		return "disconnected"
+	case EventRejected:
+		return "rejected"
+	case EventIdentityConflict:
+		return "identity-conflict"
+	}
+	return fmt.Sprintf("EventType(%d)", int(typ))
+}
+
+// Event describes a lifecycle event of a socket.
+type Event struct {
+	Type     EventType
+	Endpoint string // endpoint the event relates to
+	Err      error  // error associated with the event, if any
+
+	// Handshake holds the durations of the handshake phases
+	// for EventAccepted and EventConnected events.
+	Handshake HandshakeTimings
+}
+
+func (ev Event) String() string {
+	if ev.Err != nil {
+		return fmt.Sprintf("Event{%v, %q, err=%v}", ev.Type, ev.Endpoint, ev.Err)
+	}
+	return fmt.Sprintf("Event{%v, %q}", ev.Type, ev.Endpoint)
+}
+
+// monitor dispatches socket events to its subscribers.
+type monitor struct {
+	mu     sync.Mutex
+	subs   []chan Event
+	closed bool
+}
+
+// subscribe returns a new channel receiving all events emitted from now on.
+func (m *monitor) subscribe() <-chan Event {
+	const size = 16
+	c := make(chan Event, size)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		close(c)
+		return c
+	}
+	m.subs = append(m.subs, c)
+	return c
+}
+
+// emit sends ev to all subscribers.
+// Events are dropped for subscribers that are not keeping up.
+func (m *monitor) emit(ev Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	for _, c := range m.subs {
+		select {
+		case c <- ev:
+		default:
+		}
+	}
+}
+
+// close closes all the subscribers channels.
+func (m *monitor) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	m.closed = true
+	for _, c := range m.subs {
+		close(c)
+	}
+	m.subs = nil
+}
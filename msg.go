@@ -8,34 +8,81 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strings"
 )
 
+// MsgType tells the messages sent by applications from the ZMTP commands
+// sent by the peers, such as PING or SUBSCRIBE.
 type MsgType byte
 
 const (
-	UsrMsg MsgType = 0
-	CmdMsg MsgType = 1
+	UsrMsg MsgType = 0 // message sent by an application
+	CmdMsg MsgType = 1 // ZMTP command
 )
 
+func (typ MsgType) String() string {
+	switch typ {
+	case UsrMsg:
+		return "UsrMsg"
+	case CmdMsg:
+		return "CmdMsg"
+	default:
+		return fmt.Sprintf("MsgType(%d)", byte(typ))
+	}
+}
+
 // Msg is a ZMTP message, possibly composed of multiple frames.
 type Msg struct {
 	Frames [][]byte
 	Type   MsgType
-	err    error
+
+	// Group is the group of a message sent by a RADIO socket, or received
+	// by a DISH socket. Groups are at most 15 bytes long.
+	// RADIO and DISH are draft socket types, see the zmq4_draft build tag.
+	Group string
+
+	// Metadata holds the properties of the connection a received
+	// message came from (Socket-Type, Identity, ...).
+	// Metadata is shared between messages and must not be modified.
+	Metadata Metadata
+
+	err       error
+	truncated bool         // whether the message was truncated to the maximum message size.
+	pool      *framePool   // pool the frames are released to, if any.
+	stream    *frameStream // body of a frame left on the wire, if any.
 }
 
+// RecvMeta describes the state of a socket when a message was received.
+type RecvMeta struct {
+	// QueueDepth is the number of messages that were queued
+	// behind the received message.
+	QueueDepth int
+
+	// Truncated reports whether the received message was truncated
+	// to the maximum message size of the socket.
+	// See WithTruncateOversize.
+	Truncated bool
+}
+
+// NewMsg returns a single-frame message.
+// The frame is not copied.
 func NewMsg(frame []byte) Msg {
 	return Msg{Frames: [][]byte{frame}}
 }
 
+// NewMsgFrom returns a multipart message made of the given frames.
+// The frames are not copied.
 func NewMsgFrom(frames ...[]byte) Msg {
 	return Msg{Frames: frames}
 }
 
+// NewMsgString returns a single-frame message holding a copy of frame.
 func NewMsgString(frame string) Msg {
 	return NewMsg([]byte(frame))
 }
 
+// NewMsgFromString returns a multipart message holding a copy of each of
+// the given frames.
 func NewMsgFromString(frames []string) Msg {
 	msg := Msg{Frames: make([][]byte, len(frames))}
 	for i, frame := range frames {
@@ -44,15 +91,35 @@ func NewMsgFromString(frames []string) Msg {
 	return msg
 }
 
+// NewMsgStringParts returns a multipart message holding a copy of each of
+// the given parts, e.g. a topic and a body.
+func NewMsgStringParts(parts ...string) Msg {
+	return NewMsgFromString(parts)
+}
+
 func (msg Msg) isCmd() bool {
 	return msg.Type == CmdMsg
 }
 
+// Err returns the error a message was received with, if any, e.g. when a
+// socket reports the end of a connection as a message.
 func (msg Msg) Err() error {
 	return msg.err
 }
 
+// Frame returns the i-th frame of the message, or nil if the message has
+// no such frame.
+// The returned frame aliases the frame of the message.
+func (msg Msg) Frame(i int) []byte {
+	if i < 0 || i >= len(msg.Frames) {
+		return nil
+	}
+	return msg.Frames[i]
+}
+
 // Bytes returns the concatenated content of all its frames.
+// For a single-frame message, Bytes returns a copy of that frame.
+// Use Frame(0) or FrameString(0) to retrieve the first frame only.
 func (msg Msg) Bytes() []byte {
 	buf := make([]byte, 0, msg.size())
 	for _, frame := range msg.Frames {
@@ -61,6 +128,28 @@ func (msg Msg) Bytes() []byte {
 	return buf
 }
 
+// FrameString returns the i-th frame of the message as a string, or an
+// empty string if the message has no such frame.
+func (msg Msg) FrameString(i int) string {
+	return string(msg.Frame(i))
+}
+
+// Strings returns the frames of the message as strings.
+// The strings share a single copy of the frames.
+func (msg Msg) Strings() []string {
+	var buf strings.Builder
+	buf.Grow(msg.size())
+	for _, frame := range msg.Frames {
+		buf.Write(frame)
+	}
+	all := buf.String()
+	strs := make([]string, len(msg.Frames))
+	for i, frame := range msg.Frames {
+		strs[i], all = all[:len(frame)], all[len(frame):]
+	}
+	return strs
+}
+
 func (msg Msg) size() int {
 	n := 0
 	for _, frame := range msg.Frames {
@@ -69,6 +158,10 @@ func (msg Msg) size() int {
 	return n
 }
 
+// String returns a human readable representation of all the frames
+// of the message, quoted.
+// Use string(msg.Bytes()) to retrieve the content of the message, and
+// FrameString or Strings to retrieve its frames.
 func (msg Msg) String() string {
 	buf := new(bytes.Buffer)
 	buf.WriteString("Msg{Frames:{")
@@ -82,8 +175,42 @@ func (msg Msg) String() string {
 	return buf.String()
 }
 
+// GoString returns a representation of the message as a Go value, with
+// its frames quoted so that the bytes that are not printable are shown
+// hex-escaped, e.g. the routing envelopes of ROUTER and DEALER messages.
+func (msg Msg) GoString() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "zmq4.Msg{Type:zmq4.%v, Frames:[][]byte{", msg.Type)
+	for i, frame := range msg.Frames {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(buf, "[]byte(%+q)", frame)
+	}
+	buf.WriteString("}")
+	if msg.Group != "" {
+		fmt.Fprintf(buf, ", Group:%q", msg.Group)
+	}
+	if msg.err != nil {
+		fmt.Fprintf(buf, ", err:%q", msg.err.Error())
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+// Clone returns a deep copy of the message.
+// The frames of the returned message do not alias the frames of msg,
+// so a message may be safely retained or modified after a receive.
+// The connection metadata is shared between both messages.
 func (msg Msg) Clone() Msg {
-	o := Msg{Frames: make([][]byte, len(msg.Frames))}
+	o := Msg{
+		Frames:    make([][]byte, len(msg.Frames)),
+		Type:      msg.Type,
+		Group:     msg.Group,
+		Metadata:  msg.Metadata,
+		err:       msg.err,
+		truncated: msg.truncated,
+	}
 	for i, frame := range msg.Frames {
 		o.Frames[i] = make([]byte, len(frame))
 		copy(o.Frames[i], frame)
@@ -91,6 +218,19 @@ func (msg Msg) Clone() Msg {
 	return o
 }
 
+// Release hands the frames of a message received from a socket created
+// with WithMsgPool back to the pool, for reuse by later receives.
+// The frames of the message must not be used after Release.
+// Release is a no-op for other messages.
+func (msg *Msg) Release() {
+	if msg.pool == nil {
+		return
+	}
+	msg.pool.put(msg.Frames)
+	msg.pool = nil
+	msg.Frames = nil
+}
+
 // Cmd is a ZMTP Cmd as per:
 //  https://rfc.zeromq.org/spec:23/ZMTP/#formal-grammar
 type Cmd struct {
@@ -0,0 +1,222 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestMsgAccessors(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		msg   Msg
+		bytes string
+		str   string
+		first string
+		strs  []string
+	}{
+		{
+			name:  "empty",
+			msg:   Msg{},
+			bytes: "",
+			str:   "Msg{Frames:{}}",
+			first: "",
+			strs:  []string{},
+		},
+		{
+			name:  "single-frame",
+			msg:   NewMsgString("hello"),
+			bytes: "hello",
+			str:   `Msg{Frames:{"hello"}}`,
+			first: "hello",
+			strs:  []string{"hello"},
+		},
+		{
+			name:  "multi-frame",
+			msg:   NewMsgStringParts("topic", "", "body"),
+			bytes: "topicbody",
+			str:   `Msg{Frames:{"topic", "", "body"}}`,
+			first: "topic",
+			strs:  []string{"topic", "", "body"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, want := string(tc.msg.Bytes()), tc.bytes; got != want {
+				t.Fatalf("invalid bytes: got=%q, want=%q", got, want)
+			}
+			if got, want := tc.msg.String(), tc.str; got != want {
+				t.Fatalf("invalid string: got=%q, want=%q", got, want)
+			}
+			if got, want := fmt.Sprint(tc.msg), tc.str; got != want {
+				t.Fatalf("invalid Stringer: got=%q, want=%q", got, want)
+			}
+			if got, want := tc.msg.FrameString(0), tc.first; got != want {
+				t.Fatalf("invalid first frame: got=%q, want=%q", got, want)
+			}
+			if got, want := tc.msg.Strings(), tc.strs; !reflect.DeepEqual(got, want) {
+				t.Fatalf("invalid strings: got=%q, want=%q", got, want)
+			}
+		})
+	}
+}
+
+func TestMsgStringParts(t *testing.T) {
+	for _, parts := range [][]string{
+		{},
+		{"hello"},
+		{"topic", "body"},
+		{"", "envelope", "", "\x00\xff"},
+	} {
+		msg := NewMsgStringParts(parts...)
+		if got, want := len(msg.Frames), len(parts); got != want {
+			t.Fatalf("invalid number of frames: got=%d, want=%d", got, want)
+		}
+		if got := msg.Strings(); !reflect.DeepEqual(got, parts) {
+			t.Fatalf("invalid round-trip: got=%q, want=%q", got, parts)
+		}
+		if got := NewMsgStringParts(msg.Strings()...); !reflect.DeepEqual(got.Frames, msg.Frames) {
+			t.Fatalf("invalid round-trip: got=%q, want=%q", got.Frames, msg.Frames)
+		}
+	}
+
+	// the message holds a copy of the parts.
+	parts := []string{"a", "b"}
+	msg := NewMsgStringParts(parts...)
+	strs := msg.Strings()
+	msg.Frames[0][0] = 'c'
+	if got, want := parts[0], "a"; got != want {
+		t.Fatalf("message aliases its parts: got=%q, want=%q", got, want)
+	}
+	if got, want := strs[0], "a"; got != want {
+		t.Fatalf("strings alias the message frames: got=%q, want=%q", got, want)
+	}
+}
+
+func TestMsgStringsAllocs(t *testing.T) {
+	msg := NewMsgStringParts("topic", "header", "body", "trailer")
+	// one allocation for the slice, one for the content of all the strings.
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = msg.Strings()
+	})
+	if allocs > 2 {
+		t.Fatalf("too many allocations: got=%v, want<=2", allocs)
+	}
+}
+
+func TestMsgBytesAliasing(t *testing.T) {
+	msg := NewMsgString("hello")
+	raw := msg.Bytes()
+	raw[0] = 'j'
+	if got, want := string(msg.Frames[0]), "hello"; got != want {
+		t.Fatalf("Bytes aliases the message frames: got=%q, want=%q", got, want)
+	}
+}
+
+func TestMsgClone(t *testing.T) {
+	meta := Metadata{sysSockType: string(Push)}
+	msg := Msg{
+		Frames:    [][]byte{[]byte("topic"), []byte("body")},
+		Type:      CmdMsg,
+		Metadata:  meta,
+		truncated: true,
+	}
+
+	clone := msg.Clone()
+	if !reflect.DeepEqual(clone, msg) {
+		t.Fatalf("invalid clone:\ngot= %#v\nwant=%#v", clone, msg)
+	}
+
+	// modifying the original frames must not modify the clone.
+	msg.Frames[0][0] = 'T'
+	msg.Frames[1] = []byte("other")
+	want := [][]byte{[]byte("topic"), []byte("body")}
+	if !reflect.DeepEqual(clone.Frames, want) {
+		t.Fatalf("clone aliases the original frames:\ngot= %q\nwant=%q", clone.Frames, want)
+	}
+}
+
+func TestMsgFrame(t *testing.T) {
+	msg := NewMsgFrom([]byte("topic"), []byte("body"))
+	for _, tc := range []struct {
+		i    int
+		want []byte
+	}{
+		{-1, nil},
+		{0, []byte("topic")},
+		{1, []byte("body")},
+		{2, nil},
+	} {
+		if got := msg.Frame(tc.i); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("invalid frame %d: got=%q, want=%q", tc.i, got, tc.want)
+		}
+	}
+
+	// Frame aliases the frames of the message, Clone does not.
+	clone := msg.Clone()
+	msg.Frame(0)[0] = 'T'
+	if got, want := string(msg.Frames[0]), "Topic"; got != want {
+		t.Fatalf("Frame does not alias the message frames: got=%q, want=%q", got, want)
+	}
+	if got, want := string(clone.Frame(0)), "topic"; got != want {
+		t.Fatalf("clone aliases the message frames: got=%q, want=%q", got, want)
+	}
+}
+
+func TestMsgFromStringAliasing(t *testing.T) {
+	frames := []string{"a", "b"}
+	msg := NewMsgFromString(frames)
+	msg.Frames[0][0] = 'c'
+	if got, want := frames[0], "a"; got != want {
+		t.Fatalf("message aliases its strings: got=%q, want=%q", got, want)
+	}
+}
+
+func TestMsgGoString(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		msg  Msg
+		want string
+	}{
+		{
+			name: "empty",
+			msg:  Msg{},
+			want: `zmq4.Msg{Type:zmq4.UsrMsg, Frames:[][]byte{}}`,
+		},
+		{
+			name: "envelope",
+			msg:  NewMsgFrom([]byte{0, 0x80, 'i', 'd'}, nil, []byte("héllo")),
+			want: `zmq4.Msg{Type:zmq4.UsrMsg, Frames:[][]byte{[]byte("\x00\x80id"), []byte(""), []byte("h\u00e9llo")}}`,
+		},
+		{
+			name: "cmd",
+			msg:  Msg{Type: CmdMsg, Frames: [][]byte{[]byte("\x04PING")}, err: ErrClosedConn},
+			want: `zmq4.Msg{Type:zmq4.CmdMsg, Frames:[][]byte{[]byte("\x04PING")}, err:"zmq4: use of closed connection"}`,
+		},
+		{
+			name: "group",
+			msg:  Msg{Frames: [][]byte{[]byte("data")}, Group: "weather"},
+			want: `zmq4.Msg{Type:zmq4.UsrMsg, Frames:[][]byte{[]byte("data")}, Group:"weather"}`,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := fmt.Sprintf("%#v", tc.msg); got != tc.want {
+				t.Fatalf("invalid Go string:\ngot= %s\nwant=%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMsgErr(t *testing.T) {
+	if err := NewMsgString("hello").Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg := Msg{err: ErrClosedConn}
+	if got, want := msg.Err(), ErrClosedConn; got != want {
+		t.Fatalf("invalid error: got=%v, want=%v", got, want)
+	}
+}
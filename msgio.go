@@ -7,8 +7,13 @@ package zmq4
 import (
 	"context"
 	"io"
+	"net"
+	"os"
 	"sync"
+	"sync/atomic"
+	"syscall"
 
+	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -19,6 +24,30 @@ type rpool interface {
 	addConn(r *msgReader)
 	rmConn(r *msgReader)
 	read(ctx context.Context, msg *Msg) error
+
+	// readMeta reads a message and fills meta with informations
+	// about the reader state at dequeue time.
+	readMeta(ctx context.Context, msg *Msg, meta *RecvMeta) error
+}
+
+// hwmSetter is implemented by pools with configurable queue capacities.
+type hwmSetter interface {
+	setHWM(n int)
+}
+
+// framePicker is implemented by write pools sending each message to
+// a single peer, allowing messages to be sent frame by frame.
+type framePicker interface {
+	// pick returns the peer a message starting with frame is sent to.
+	// pick reports whether frame is consumed to elect the peer
+	// (e.g. a ROUTER identity) and must not be sent.
+	pick(ctx context.Context, frame []byte) (w *msgWriter, consumed bool, err error)
+}
+
+// flusher is implemented by the write pools queueing outbound messages.
+type flusher interface {
+	// flush blocks until the queued messages are written or ctx is done.
+	flush(ctx context.Context) error
 }
 
 // wpool is the interface that writes ZMQ messages to a pool of connections.
@@ -30,8 +59,18 @@ type wpool interface {
 	write(ctx context.Context, msg Msg) error
 }
 
+// batchWriter is implemented by the writer pools sending a batch of
+// messages to a single peer at once.
+type batchWriter interface {
+	writeBatch(ctx context.Context, msgs []Msg) error
+}
+
 type msgReader struct {
-	r *Conn
+	r   *Conn
+	ep  string     // endpoint of the connection
+	tr  Tracer     // optional tracer of received messages
+	log Logger     // optional logger of internal errors
+	st  *sockStats // optional activity of the socket
 }
 
 func newMsgReader(c *Conn) *msgReader {
@@ -40,7 +79,17 @@ func newMsgReader(c *Conn) *msgReader {
 
 // read reads data over the wire and assembles it into a complete message
 func (r *msgReader) read(ctx context.Context, msg *Msg) error {
-	*msg = r.r.read()
+	*msg = r.r.recv()
+	msg.Metadata = r.r.Peer.Meta
+	if msg.err == nil {
+		r.r.ctr.recv(*msg)
+		if r.st != nil {
+			r.st.recv(*msg)
+		}
+	}
+	if r.tr != nil && msg.err == nil {
+		r.tr.TraceRecv(r.ep, *msg)
+	}
 	return msg.err
 }
 
@@ -49,7 +98,11 @@ func (r *msgReader) Close() error {
 }
 
 type msgWriter struct {
-	w *Conn
+	w   *Conn
+	ep  string     // endpoint of the connection
+	tr  Tracer     // optional tracer of sent messages
+	log Logger     // optional logger of internal errors
+	st  *sockStats // optional activity of the socket
 }
 
 func newMsgWriter(c *Conn) *msgWriter {
@@ -60,53 +113,252 @@ func (w *msgWriter) Close() error {
 	return w.w.Close()
 }
 
+// lost returns whether the write error err means the peer is gone:
+// the peer closed or reset the connection, or the connection was closed.
+func (w *msgWriter) lost(err error) bool {
+	select {
+	case <-w.w.done:
+		return true
+	default:
+	}
+	return isConnLost(err)
+}
+
+// isConnLost returns whether err reports a connection closed by the peer,
+// e.g. a broken pipe or a connection reset.
+func isConnLost(err error) bool {
+	err = errors.Cause(err)
+	if err == io.ErrClosedPipe {
+		// pipes and inproc connections.
+		return true
+	}
+	if op, ok := err.(*net.OpError); ok {
+		if se, ok := op.Err.(*os.SyscallError); ok {
+			return se.Err == syscall.EPIPE || se.Err == syscall.ECONNRESET
+		}
+	}
+	return false
+}
+
 // write sends data over the wire.
 func (w *msgWriter) write(ctx context.Context, msg Msg) error {
+	if w.tr != nil {
+		w.tr.TraceSend(w.ep, msg)
+	}
 	err := w.w.SendMsg(msg)
+	w.sent(msg, true, err)
+	return err
+}
+
+// writeContext sends msg like write, but gives up as soon as ctx is done.
+// The connection is then closed, as the message may have been partially
+// written to the wire.
+func (w *msgWriter) writeContext(ctx context.Context, msg Msg) error {
+	return w.withContext(ctx, func() error { return w.write(ctx, msg) })
+}
+
+// writeBatch sends msgs over the wire, in order, in as few writes as
+// possible. It gives up as soon as ctx is done, like writeContext.
+func (w *msgWriter) writeBatch(ctx context.Context, msgs []Msg) error {
+	return w.withContext(ctx, func() error {
+		if w.tr != nil {
+			for _, msg := range msgs {
+				w.tr.TraceSend(w.ep, msg)
+			}
+		}
+		err := w.w.closedErr(w.w.sendBatch(msgs))
+		if err != nil {
+			w.sent(Msg{}, true, err)
+			return err
+		}
+		for _, msg := range msgs {
+			w.sent(msg, true, nil)
+		}
+		return nil
+	})
+}
+
+// withContext runs the write function, but gives up as soon as ctx is
+// done, closing the connection.
+func (w *msgWriter) withContext(ctx context.Context, write func() error) error {
+	if ctx.Done() == nil {
+		return write()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- write()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		select {
+		case err := <-done:
+			return err
+		default:
+		}
+		w.Close()
+		<-done
+		err := errors.Wrapf(ctx.Err(), "zmq4: could not write to %q", w.ep)
+		if w.st != nil {
+			w.st.setErr(w.ep, err)
+		}
+		return err
+	}
+}
+
+// writeFrame sends a single frame of a message over the wire.
+// first reports whether frame is the first frame of the message.
+func (w *msgWriter) writeFrame(frame []byte, first, more bool) error {
+	if w.tr != nil {
+		w.tr.TraceSend(w.ep, NewMsg(frame))
+	}
+	err := w.w.sendFrame(frame, first, more)
+	w.sent(NewMsg(frame), !more, err)
 	return err
 }
 
-// qreader is a queued-message reader.
-type qreader struct {
+// writeStream sends the last frame of a message, made of the size bytes
+// read from r. first reports whether it is the first frame of the message.
+func (w *msgWriter) writeStream(r io.Reader, size int64, first bool) error {
+	err := w.w.sendStream(r, size, first)
+	if err != nil {
+		if w.st != nil {
+			w.st.setErr(w.ep, err)
+		}
+		return err
+	}
+	atomic.AddUint64(&w.w.ctr.bytesSent, uint64(size))
+	atomic.AddUint64(&w.w.ctr.msgsSent, 1)
+	if w.st != nil {
+		atomic.AddUint64(&w.st.bytesSent, uint64(size))
+		atomic.AddUint64(&w.st.msgsSent, 1)
+	}
+	return nil
+}
+
+// sent records the outcome of sending msg, which completes a message if last.
+func (w *msgWriter) sent(msg Msg, last bool, err error) {
+	if err != nil {
+		if w.st != nil {
+			w.st.setErr(w.ep, err)
+		}
+		return
+	}
+	n := uint64(msgSize(msg))
+	atomic.AddUint64(&w.w.ctr.bytesSent, n)
+	if last {
+		atomic.AddUint64(&w.w.ctr.msgsSent, 1)
+	}
+	if w.st != nil {
+		atomic.AddUint64(&w.st.bytesSent, n)
+		if last {
+			atomic.AddUint64(&w.st.msgsSent, 1)
+		}
+	}
+}
+
+// dropped records a message dropped because the peer was too slow.
+func (w *msgWriter) dropped() {
+	w.w.ctr.dropped()
+	if w.st != nil {
+		w.st.dropped()
+	}
+}
+
+// fqreader is a fair-queued message reader.
+// Each connection has its own bounded queue and read services them
+// in a round-robin fashion, so a chatty peer can not starve the others.
+type fqreader struct {
 	ctx context.Context
 	mu  sync.RWMutex
 	rs  []*msgReader
-	c   chan Msg
+	qs  []*rqueue // per-connection queues, serviced round-robin.
+	cur int       // index of the next queue to service.
+
+	avail chan struct{} // signaled when a message has been queued.
+	hwm   int           // capacity of the per-connection queues.
+
+	// hook, if set, is applied to every message read from a connection.
+	// Messages for which hook returns false are not queued.
+	hook func(r *msgReader, msg *Msg) bool
 
 	sem *semaphore // ready when a connection is live.
+
+	watchers signals // notified when a message may be available.
+
+	cancel context.CancelFunc // stops all the listen goroutines.
+	wg     sync.WaitGroup     // tracks the listen goroutines.
 }
 
-func newQReader(ctx context.Context) *qreader {
-	const qrsize = 10
-	return &qreader{
-		ctx: ctx,
-		c:   make(chan Msg, qrsize),
-		sem: newSemaphore(),
+// rqueue is the bounded queue of messages read from a single connection.
+type rqueue struct {
+	r *msgReader
+	c chan Msg // closed when the connection is done.
+}
+
+func newFQReader(ctx context.Context) *fqreader {
+	return newFQReaderHook(ctx, nil)
+}
+
+// newFQReaderHook returns a fair-queued reader applying hook to
+// every message read from its connections.
+func newFQReaderHook(ctx context.Context, hook func(r *msgReader, msg *Msg) bool) *fqreader {
+	ctx, cancel := context.WithCancel(ctx)
+	return &fqreader{
+		ctx:    ctx,
+		cancel: cancel,
+		avail:  make(chan struct{}, 1),
+		hwm:    defaultHWM,
+		hook:   hook,
+		sem:    newSemaphore(),
 	}
 }
 
-func (q *qreader) Close() error {
-	q.mu.RLock()
-	var err error
+// Close closes all the connections of the reader and waits for
+// their listen goroutines to exit.
+func (q *fqreader) Close() error {
+	q.cancel()
+	q.mu.Lock()
+	rs := q.rs
+	q.rs = nil
+	q.mu.Unlock()
+
 	var grp errgroup.Group
-	for i := range q.rs {
-		grp.Go(q.rs[i].Close)
+	for i := range rs {
+		grp.Go(rs[i].Close)
 	}
-	err = grp.Wait()
-	q.rs = nil
-	q.mu.RUnlock()
+	err := grp.Wait()
+	q.wg.Wait()
 	return err
 }
 
-func (q *qreader) addConn(r *msgReader) {
-	go q.listen(q.ctx, r)
+// setHWM sets the capacity of the queues of connections added from now on.
+func (q *fqreader) setHWM(n int) {
+	q.mu.Lock()
+	q.hwm = n
+	q.mu.Unlock()
+}
+
+func (q *fqreader) addConn(r *msgReader) {
 	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ctx.Err() != nil {
+		// reader is closed.
+		r.Close()
+		return
+	}
+	rq := &rqueue{r: r, c: make(chan Msg, q.hwm)}
+	q.wg.Add(1)
+	go q.listen(q.ctx, rq)
 	q.sem.enable()
 	q.rs = append(q.rs, r)
-	q.mu.Unlock()
+	q.qs = append(q.qs, rq)
 }
 
-func (q *qreader) rmConn(r *msgReader) {
+func (q *fqreader) rmConn(r *msgReader) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
@@ -122,29 +374,147 @@ func (q *qreader) rmConn(r *msgReader) {
 	}
 }
 
-func (q *qreader) read(ctx context.Context, msg *Msg) error {
-	q.sem.lock()
+func (q *fqreader) read(ctx context.Context, msg *Msg) error {
+	return q.readMeta(ctx, msg, nil)
+}
+
+func (q *fqreader) readMeta(ctx context.Context, msg *Msg, meta *RecvMeta) error {
+	err := q.readStream(ctx, msg, meta)
+	if err == nil && msg.stream != nil {
+		err = msg.stream.assemble(msg)
+	}
+	return err
+}
+
+// readStream reads a message like readMeta, but leaves the body of
+// a streamed frame on the wire, for the caller to consume.
+func (q *fqreader) readStream(ctx context.Context, msg *Msg, meta *RecvMeta) error {
+	err := q.sem.wait(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		if q.next(msg, meta) {
+			return msg.err
+		}
+		if dontWait(ctx) {
+			return ErrWouldBlock
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-q.avail:
+		}
+	}
+}
+
+// next dequeues the next message, servicing the connection queues
+// in a round-robin fashion.
+// next returns false if no message is available.
+// If meta is not nil, it is filled with the number of messages still queued.
+func (q *fqreader) next(msg *Msg, meta *RecvMeta) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for n := len(q.qs); n > 0; n-- {
+		if q.cur >= len(q.qs) {
+			q.cur = 0
+		}
+		rq := q.qs[q.cur]
+		select {
+		case m, ok := <-rq.c:
+			if !ok {
+				// connection is done and its queue has been drained.
+				q.qs = append(q.qs[:q.cur], q.qs[q.cur+1:]...)
+				q.sem.disable()
+				continue
+			}
+			*msg = m
+			q.cur++
+			if meta != nil {
+				meta.QueueDepth = q.depth()
+				meta.Truncated = m.truncated
+			}
+			q.notify() // more messages may be waiting for other readers.
+			return true
+		default:
+			q.cur++
+		}
+	}
+	return false
+}
+
+// depth returns the number of queued messages.
+func (q *fqreader) depth() int {
+	n := 0
+	for _, rq := range q.qs {
+		n += len(rq.c)
+	}
+	return n
+}
+
+// notify signals that a message may be available.
+func (q *fqreader) notify() {
 	select {
-	case <-ctx.Done():
-	case *msg = <-q.c:
+	case q.avail <- struct{}{}:
+	default:
 	}
-	return msg.err
+	q.watchers.notify()
 }
 
-func (q *qreader) listen(ctx context.Context, r *msgReader) {
+// pending returns the number of queued messages.
+func (q *fqreader) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.depth()
+}
+
+func (q *fqreader) listen(ctx context.Context, rq *rqueue) {
+	r := rq.r
+	defer q.wg.Done()
 	defer q.rmConn(r)
 	defer r.Close()
+	defer q.notify()
+	defer close(rq.c)
 
 	for {
 		var msg Msg
 		err := r.read(ctx, &msg)
+		if err != nil && ctx.Err() == nil {
+			logf(r.log, LevelWarn, "zmq4: could not read from %q: %+v", r.ep, err)
+		}
+		if q.hook != nil && !q.hook(r, &msg) {
+			if err != nil {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			if errors.Cause(msg.err) == ErrClosedConn {
+				// the connection was closed on our side, e.g. by
+				// Unbind or Disconnect: there is nothing to report.
+				return
+			}
+			// the connection is done: report its error only if there
+			// is room for it, so a dead peer never holds its goroutine.
+			select {
+			case rq.c <- msg:
+			default:
+			}
+			return
+		}
 		select {
 		case <-ctx.Done():
 			return
-		default:
-			q.c <- msg
-			if err != nil {
+		case rq.c <- msg:
+			q.notify()
+		}
+		if msg.stream != nil {
+			// the frame body must be consumed before the next message.
+			select {
+			case <-ctx.Done():
 				return
+			case <-msg.stream.done:
 			}
 		}
 	}
@@ -166,15 +536,17 @@ func newMWriter(ctx context.Context) *mwriter {
 
 func (w *mwriter) Close() error {
 	w.mu.Lock()
+	ws := w.ws
+	w.ws = nil
+	w.mu.Unlock()
+
 	var err error
-	for _, ww := range w.ws {
+	for _, ww := range ws {
 		e := ww.Close()
 		if e != nil && err == nil {
 			err = e
 		}
 	}
-	w.ws = nil
-	w.mu.Unlock()
 	return err
 }
 
@@ -198,108 +570,524 @@ func (mw *mwriter) rmConn(w *msgWriter) {
 	}
 	if cur >= 0 {
 		mw.ws = append(mw.ws[:cur], mw.ws[cur+1:]...)
+		mw.sem.disable()
 	}
 }
 
+// write sends msg to all peers, concurrently.
+// Each peer is given until the deadline of ctx: a peer failing or timing
+// out does not abort the writes to the other peers.
+// Peers that went away are dropped, and only fail the write if no peer
+// received msg.
 func (w *mwriter) write(ctx context.Context, msg Msg) error {
-	w.sem.lock()
-	grp, ctx := errgroup.WithContext(ctx)
+	if err := w.sem.wait(ctx); err != nil {
+		return err
+	}
+	var (
+		grp  errgroup.Group
+		lmu  sync.Mutex
+		lost []*msgWriter
+		lerr error
+	)
+	// the peers are written to without holding mu: peers timing out are
+	// closed, and thus removed from w.
 	w.mu.Lock()
-	for i := range w.ws {
-		ww := w.ws[i]
+	ws := make([]*msgWriter, len(w.ws))
+	copy(ws, w.ws)
+	w.mu.Unlock()
+
+	n := len(ws)
+	for i := range ws {
+		ww := ws[i]
 		grp.Go(func() error {
-			return ww.write(ctx, msg)
+			err := ww.writeContext(ctx, msg)
+			if err == nil || ctx.Err() != nil || !ww.lost(err) {
+				return err
+			}
+			logf(ww.log, LevelWarn, "zmq4: could not write to %q: %+v", ww.ep, err)
+			lmu.Lock()
+			lost = append(lost, ww)
+			lerr = err
+			lmu.Unlock()
+			return nil
 		})
 	}
 	err := grp.Wait()
-	w.mu.Unlock()
+
+	for _, ww := range lost {
+		w.rmConn(ww)
+		ww.Close()
+	}
+	if err == nil && len(lost) == n {
+		err = lerr
+	}
 	return err
 }
 
+// lbwriter is a load-balanced message writer.
+// Each message is sent to the next ready peer, in a round-robin fashion.
+// A message is only considered sent once it was completely written to a
+// peer: peers failing a write are dropped from the rotation. If the peer
+// went away, e.g. with a broken pipe or a connection reset, the message
+// is retried once on the next ready peer, before any subsequent message.
+// The write error is reported otherwise.
 type lbwriter struct {
 	ctx context.Context
-	c   chan Msg
-	sem *semaphore
+	wmu sync.Mutex // serializes writes, preserving the order of messages.
+
+	mu  sync.Mutex
+	ws  []*msgWriter // ready peers.
+	cur int          // index of the next peer to write to.
+	sem *semaphore   // live count of ready peers.
+
+	avail chan struct{} // signaled when a peer has been added.
+	done  chan struct{} // closed by Close.
 }
 
 func newLBWriter(ctx context.Context) *lbwriter {
-	const size = 10
 	return &lbwriter{
-		ctx: ctx,
-		c:   make(chan Msg, size),
-		sem: newSemaphore(),
+		ctx:   ctx,
+		sem:   newSemaphore(),
+		avail: make(chan struct{}, 1),
+		done:  make(chan struct{}),
 	}
 }
 
+// Close closes the peers of the writer.
+// Writes in progress and subsequent writes fail, and peers added afterwards
+// are closed right away.
 func (lw *lbwriter) Close() error {
-	close(lw.c)
-	return nil
+	lw.mu.Lock()
+	ws := lw.ws
+	lw.ws = nil
+	select {
+	case <-lw.done:
+	default:
+		close(lw.done)
+	}
+	lw.mu.Unlock()
+
+	var err error
+	for _, w := range ws {
+		e := w.Close()
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
 }
 
 func (lw *lbwriter) addConn(w *msgWriter) {
+	lw.mu.Lock()
+	select {
+	case <-lw.done:
+		lw.mu.Unlock()
+		w.Close()
+		return
+	default:
+	}
+	lw.ws = append(lw.ws, w)
 	lw.sem.enable()
-	go lw.listen(lw.ctx, w)
+	lw.mu.Unlock()
+
+	select {
+	case lw.avail <- struct{}{}:
+	default:
+	}
 }
 
-func (*lbwriter) rmConn(w *msgWriter) {}
+func (lw *lbwriter) rmConn(w *msgWriter) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	cur := -1
+	for i := range lw.ws {
+		if lw.ws[i] == w {
+			cur = i
+			break
+		}
+	}
+	if cur < 0 {
+		return
+	}
+	lw.ws = append(lw.ws[:cur], lw.ws[cur+1:]...)
+	lw.sem.disable()
+	if cur < lw.cur {
+		lw.cur--
+	}
+	if lw.cur >= len(lw.ws) {
+		lw.cur = 0
+	}
+}
 
 func (lw *lbwriter) write(ctx context.Context, msg Msg) error {
-	lw.sem.lock()
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case lw.c <- msg:
-		return nil
+	lw.wmu.Lock()
+	defer lw.wmu.Unlock()
+
+	retried := false
+	for {
+		w, err := lw.next(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = w.writeContext(ctx, msg)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			// the peer is stalled: the message can not be retried in time.
+			return err
+		}
+
+		// the peer failed: drop it from the rotation and, if the peer
+		// went away, retry the message once with the next ready peer.
+		logf(w.log, LevelWarn, "zmq4: could not write to %q: %+v", w.ep, err)
+		lost := w.lost(err)
+		lw.rmConn(w)
+		w.Close()
+		if retried || !lost || lw.ready() == 0 {
+			return err
+		}
+		retried = true
 	}
 }
 
-func (lw *lbwriter) listen(ctx context.Context, w *msgWriter) {
-	defer lw.rmConn(w)
-	defer w.Close()
+// writeBatch sends msgs, in order, to the next ready peer.
+// The batch is not retried on another peer if the write fails, as some
+// of its messages may have been delivered.
+func (lw *lbwriter) writeBatch(ctx context.Context, msgs []Msg) error {
+	lw.wmu.Lock()
+	defer lw.wmu.Unlock()
 
+	w, err := lw.next(ctx)
+	if err != nil {
+		return err
+	}
+	err = w.writeBatch(ctx, msgs)
+	if err != nil {
+		logf(w.log, LevelWarn, "zmq4: could not write to %q: %+v", w.ep, err)
+		lw.rmConn(w)
+		w.Close()
+	}
+	return err
+}
+
+func (lw *lbwriter) pick(ctx context.Context, frame []byte) (*msgWriter, bool, error) {
+	w, err := lw.next(ctx)
+	return w, false, err
+}
+
+// ready returns the number of ready peers.
+func (lw *lbwriter) ready() int {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return len(lw.ws)
+}
+
+// next returns the next ready peer, waiting for one to be added
+// if there is none.
+// next fails once the writer is closed or its context is done, even if
+// peers are still ready.
+func (lw *lbwriter) next(ctx context.Context) (*msgWriter, error) {
 	for {
+		select {
+		case <-lw.done:
+			return nil, errClosedWriter
+		case <-lw.ctx.Done():
+			return nil, lw.ctx.Err()
+		default:
+		}
+
+		lw.mu.Lock()
+		if n := len(lw.ws); n > 0 {
+			w := lw.ws[lw.cur]
+			lw.cur = (lw.cur + 1) % n
+			lw.mu.Unlock()
+			return w, nil
+		}
+		lw.mu.Unlock()
+
+		if dontWait(ctx) {
+			return nil, ErrWouldBlock
+		}
 		select {
 		case <-ctx.Done():
-			return
-		case msg, ok := <-lw.c:
-			if !ok {
+			return nil, ctx.Err()
+		case <-lw.ctx.Done():
+			return nil, lw.ctx.Err()
+		case <-lw.done:
+			return nil, errClosedWriter
+		case <-lw.avail:
+		}
+	}
+}
+
+// qwriter is a queued message writer.
+// Messages are queued up to the high water mark and written in order,
+// by a single goroutine, to the next ready peer of a load-balanced
+// writer. Messages are kept queued while no peer is ready, and a message
+// whose write failed is retried on the next ready peer.
+type qwriter struct {
+	ctx context.Context
+	lw  *lbwriter
+	q   *inflight // messages queued and not yet written.
+
+	mu    sync.Mutex
+	msgs  []Msg         // queued messages, in order.
+	hwm   int           // maximum number of queued messages.
+	space chan struct{} // signaled when a message has been dequeued, or hwm raised.
+	avail chan struct{} // signaled when a message has been queued.
+
+	immediate bool // whether messages are only queued while a peer is ready.
+}
+
+func newQWriter(ctx context.Context, hwm int) *qwriter {
+	qw := &qwriter{
+		ctx:   ctx,
+		lw:    newLBWriter(ctx),
+		q:     newInflight(),
+		hwm:   hwm,
+		space: make(chan struct{}, 1),
+		avail: make(chan struct{}, 1),
+	}
+	go qw.run()
+	return qw
+}
+
+func (qw *qwriter) Close() error {
+	return qw.lw.Close()
+}
+
+func (qw *qwriter) addConn(w *msgWriter) {
+	qw.lw.addConn(w)
+}
+
+func (qw *qwriter) rmConn(w *msgWriter) {
+	qw.lw.rmConn(w)
+}
+
+// setHWM sets the maximum number of queued messages.
+// Messages already queued beyond n are kept.
+func (qw *qwriter) setHWM(n int) {
+	qw.mu.Lock()
+	qw.hwm = n
+	qw.mu.Unlock()
+	wake(qw.space)
+}
+
+// write queues msg, blocking while the queue is full, and while no peer
+// is ready in immediate mode.
+func (qw *qwriter) write(ctx context.Context, msg Msg) error {
+	if qw.immediate {
+		if err := qw.lw.sem.wait(ctx); err != nil {
+			return err
+		}
+	}
+	for {
+		if qw.push(msg) {
+			return nil
+		}
+		if dontWait(ctx) {
+			return ErrWouldBlock
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-qw.space:
+		}
+	}
+}
+
+// push queues msg and reports whether the queue had room for it.
+func (qw *qwriter) push(msg Msg) bool {
+	qw.mu.Lock()
+	defer qw.mu.Unlock()
+	if len(qw.msgs) >= qw.hwm {
+		return false
+	}
+	qw.msgs = append(qw.msgs, msg)
+	qw.q.add()
+	wake(qw.avail)
+	if len(qw.msgs) < qw.hwm {
+		// let the next blocked write, if any, use the room left.
+		wake(qw.space)
+	}
+	return true
+}
+
+// pop dequeues the next message, if any.
+func (qw *qwriter) pop() (Msg, bool) {
+	qw.mu.Lock()
+	defer qw.mu.Unlock()
+	if len(qw.msgs) == 0 {
+		return Msg{}, false
+	}
+	msg := qw.msgs[0]
+	qw.msgs[0] = Msg{}
+	qw.msgs = qw.msgs[1:]
+	wake(qw.space)
+	return msg, true
+}
+
+// flush blocks until the queued messages are written or ctx is done.
+func (qw *qwriter) flush(ctx context.Context) error {
+	return qw.q.wait(ctx)
+}
+
+func (qw *qwriter) pick(ctx context.Context, frame []byte) (*msgWriter, bool, error) {
+	return qw.lw.pick(ctx, frame)
+}
+
+func (qw *qwriter) run() {
+	for {
+		msg, ok := qw.pop()
+		if !ok {
+			select {
+			case <-qw.ctx.Done():
 				return
+			case <-qw.avail:
 			}
-			err := w.write(ctx, msg)
-			if err != nil {
-				// try another msg writer
-				lw.c <- msg
-				break
+			continue
+		}
+		for qw.lw.write(qw.ctx, msg) != nil {
+			if qw.ctx.Err() != nil {
+				return
 			}
 		}
+		qw.q.done()
 	}
 }
 
+// wake signals c, a channel of capacity 1, without blocking.
+func wake(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// semaphore tracks the number of live connections of a pool.
+// It is ready while at least one connection is live, and may go back and
+// forth between ready and not ready as connections come and go.
 type semaphore struct {
-	ready chan struct{}
+	mu    sync.Mutex
+	n     int           // number of live connections.
+	ready chan struct{} // closed while n > 0.
 }
 
 func newSemaphore() *semaphore {
 	return &semaphore{ready: make(chan struct{})}
 }
 
+// enable records a new live connection.
 func (sem *semaphore) enable() {
-	select {
-	case _, ok := <-sem.ready:
-		if ok {
-			close(sem.ready)
-		}
-	default:
+	sem.mu.Lock()
+	defer sem.mu.Unlock()
+	sem.n++
+	if sem.n == 1 {
 		close(sem.ready)
 	}
 }
 
-func (sem *semaphore) lock() {
-	<-sem.ready
+// disable records the removal of a live connection.
+func (sem *semaphore) disable() {
+	sem.mu.Lock()
+	defer sem.mu.Unlock()
+	if sem.n == 0 {
+		return
+	}
+	sem.n--
+	if sem.n == 0 {
+		sem.ready = make(chan struct{})
+	}
+}
+
+// wait blocks until a connection is live or ctx is done.
+func (sem *semaphore) wait(ctx context.Context) error {
+	sem.mu.Lock()
+	ready := sem.ready
+	sem.mu.Unlock()
+
+	if dontWait(ctx) {
+		select {
+		case <-ready:
+			return nil
+		default:
+			return ErrWouldBlock
+		}
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-ready:
+		return nil
+	}
+}
+
+// inflight tracks the number of messages queued by a pool and not yet
+// written.
+type inflight struct {
+	mu   sync.Mutex
+	n    int           // number of queued messages.
+	idle chan struct{} // closed while n == 0.
+}
+
+func newInflight() *inflight {
+	idle := make(chan struct{})
+	close(idle)
+	return &inflight{idle: idle}
+}
+
+// add records a queued message.
+func (f *inflight) add() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n++
+	if f.n == 1 {
+		f.idle = make(chan struct{})
+	}
+}
+
+// done records that a queued message was written or dropped.
+func (f *inflight) done() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.n == 0 {
+		return
+	}
+	f.n--
+	if f.n == 0 {
+		close(f.idle)
+	}
+}
+
+// wait blocks until no message is queued or ctx is done.
+func (f *inflight) wait(ctx context.Context) error {
+	f.mu.Lock()
+	idle := f.idle
+	f.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 var (
-	_ rpool = (*qreader)(nil)
+	_ rpool = (*fqreader)(nil)
 	_ wpool = (*mwriter)(nil)
 	_ wpool = (*lbwriter)(nil)
+	_ wpool = (*qwriter)(nil)
+
+	_ batchWriter = (*lbwriter)(nil)
+
+	_ framePicker = (*lbwriter)(nil)
+	_ framePicker = (*qwriter)(nil)
+
+	_ flusher = (*qwriter)(nil)
+
+	_ hwmSetter = (*qwriter)(nil)
 )
@@ -0,0 +1,673 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// newTestConnPair returns two connected ZMTP connections, bypassing the handshake.
+func newTestConnPair(t *testing.T, typ SocketType) (*Conn, *Conn) {
+	p1, p2 := net.Pipe()
+	c1, err := newConn(p1, nullSecurity{}, typ, nil, true)
+	if err != nil {
+		t.Fatalf("could not create conn: %v", err)
+	}
+	c2, err := newConn(p2, nullSecurity{}, typ, nil, false)
+	if err != nil {
+		t.Fatalf("could not create conn: %v", err)
+	}
+	return c1, c2
+}
+
+func TestFQReader(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	q := newFQReader(ctx)
+	defer q.Close()
+
+	rfast, wfast := newTestConnPair(t, Pull)
+	rslow, wslow := newTestConnPair(t, Pull)
+	q.addConn(newMsgReader(rfast))
+	q.addConn(newMsgReader(rslow))
+
+	const (
+		nfast = 100
+		nslow = 5
+	)
+
+	go func() {
+		for i := 0; i < nfast; i++ {
+			wfast.SendMsg(NewMsgString("fast"))
+		}
+	}()
+	go func() {
+		for i := 0; i < nslow; i++ {
+			time.Sleep(5 * time.Millisecond)
+			wslow.SendMsg(NewMsgString("slow"))
+		}
+	}()
+
+	var (
+		nf, ns int
+		last   = -1
+	)
+	for i := 0; i < nfast+nslow; i++ {
+		var msg Msg
+		err := q.read(ctx, &msg)
+		if err != nil {
+			t.Fatalf("could not read message %d: %v", i, err)
+		}
+		switch string(msg.Frames[0]) {
+		case "fast":
+			nf++
+		case "slow":
+			ns++
+			last = i
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if nf != nfast || ns != nslow {
+		t.Fatalf("invalid number of messages: fast=%d/%d, slow=%d/%d", nf, nfast, ns, nslow)
+	}
+	if last >= nfast {
+		t.Fatalf("slow connection starved: last slow message read at %d/%d", last, nfast+nslow)
+	}
+}
+
+func TestLBWriterPeerFailure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	w := newLBWriter(ctx)
+	defer w.Close()
+
+	const (
+		nmsgs = 50
+		nkill = 5 // number of messages read by the killed peer before it dies.
+	)
+
+	type recv struct {
+		peer string
+		msg  string
+	}
+	msgs := make(chan recv, nmsgs)
+
+	for _, peer := range []string{"killed", "alive"} {
+		push, pull := newTestConnPair(t, Push)
+		w.addConn(newMsgWriter(push))
+		go func(peer string, pull *Conn) {
+			defer pull.Close()
+			for i := 0; peer != "killed" || i < nkill; i++ {
+				msg := pull.read()
+				if msg.err != nil {
+					return
+				}
+				msgs <- recv{peer: peer, msg: string(msg.Frames[0])}
+			}
+		}(peer, pull)
+	}
+
+	for i := 0; i < nmsgs; i++ {
+		err := w.write(ctx, NewMsgString(fmt.Sprintf("msg-%02d", i)))
+		if err != nil {
+			t.Fatalf("could not write message %d: %v", i, err)
+		}
+	}
+
+	var (
+		seen  = make(map[string]int)
+		peers = make(map[string]int)
+	)
+	for i := 0; i < nmsgs; i++ {
+		select {
+		case r := <-msgs:
+			seen[r.msg]++
+			peers[r.peer]++
+		case <-ctx.Done():
+			t.Fatalf("timeout after %d/%d messages", i, nmsgs)
+		}
+	}
+
+	for i := 0; i < nmsgs; i++ {
+		name := fmt.Sprintf("msg-%02d", i)
+		if n := seen[name]; n != 1 {
+			t.Fatalf("message %q received %d times, want exactly once", name, n)
+		}
+	}
+	if got, want := peers["killed"], nkill; got != want {
+		t.Fatalf("killed peer received %d messages, want %d", got, want)
+	}
+	if got, want := peers["alive"], nmsgs-nkill; got != want {
+		t.Fatalf("alive peer received %d messages, want %d", got, want)
+	}
+}
+
+func TestLBWriterCloseRace(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	w := newLBWriter(ctx)
+
+	// peers die after a few messages, so writes fail and are retried.
+	addPeer := func(nmsgs int) *Conn {
+		push, pull := newTestConnPair(t, Push)
+		w.addConn(newMsgWriter(push))
+		go func() {
+			defer pull.Close()
+			for i := 0; i < nmsgs; i++ {
+				if msg := pull.read(); msg.err != nil {
+					return
+				}
+			}
+		}()
+		return push
+	}
+	for i := 0; i < 4; i++ {
+		addPeer(10 + i)
+	}
+
+	const nwriters = 8
+	var wg sync.WaitGroup
+	wg.Add(nwriters + 1)
+	for i := 0; i < nwriters; i++ {
+		go func() {
+			defer wg.Done()
+			for w.write(ctx, NewMsgString("data")) == nil {
+			}
+		}()
+	}
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			addPeer(5)
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if err := w.Close(); err != nil {
+		t.Logf("close: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatalf("writers did not return after Close")
+	}
+
+	if err := w.write(ctx, NewMsgString("late")); err == nil {
+		t.Fatalf("expected an error writing to a closed writer")
+	}
+	c := addPeer(1)
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		t.Fatalf("peer added after Close was not closed")
+	}
+}
+
+func TestPubMWriterSlowSubscriber(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const (
+		hwm   = 10
+		nmsgs = 100
+	)
+
+	w := newPubMWriter(ctx)
+	w.setHWM(hwm)
+
+	wfast, rfast := newTestConnPair(t, Pub)
+	wslow, rslow := newTestConnPair(t, Pub)
+	defer rslow.Close() // never read from: the slow subscriber is stalled.
+
+	for _, c := range []*Conn{wfast, wslow} {
+		c.subscribe(NewMsg([]byte{1}))
+		w.addConn(newMsgWriter(c))
+	}
+
+	fast := make(chan Msg)
+	go func() {
+		defer rfast.Close()
+		for {
+			msg := rfast.read()
+			if msg.err != nil {
+				return
+			}
+			fast <- msg
+		}
+	}()
+
+	for i := 0; i < nmsgs; i++ {
+		want := fmt.Sprintf("msg-%02d", i)
+		start := time.Now()
+		err := w.write(ctx, NewMsgString(want))
+		if err != nil {
+			t.Fatalf("could not write message %d: %v", i, err)
+		}
+		select {
+		case msg := <-fast:
+			if got := string(msg.Frames[0]); got != want {
+				t.Fatalf("invalid message: got=%q, want=%q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("fast subscriber stalled on message %d", i)
+		}
+		if d := time.Since(start); d > 500*time.Millisecond {
+			t.Fatalf("fast subscriber latency too high: %v", d)
+		}
+	}
+
+	if n := atomic.LoadUint64(&w.dropped); n < nmsgs-hwm-1 || n > nmsgs-hwm {
+		t.Fatalf("invalid number of dropped messages: got=%d, want=%d", n, nmsgs-hwm-1)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- w.Close()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("could not stop subscriber goroutines")
+	}
+}
+
+func TestFQReaderNoLeak(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	before := runtime.NumGoroutine()
+
+	// churn of readers whose queues are full when they are closed.
+	for i := 0; i < 20; i++ {
+		q := newFQReader(ctx)
+		q.setHWM(1)
+		for j := 0; j < 3; j++ {
+			r, w := newTestConnPair(t, Pull)
+			q.addConn(newMsgReader(r))
+			go func() {
+				for k := 0; k < 3; k++ {
+					if w.SendMsg(NewMsgString("data")) != nil {
+						return
+					}
+				}
+			}()
+		}
+		time.Sleep(time.Millisecond)
+		err := q.Close()
+		if err != nil {
+			t.Fatalf("could not close reader %d: %v", i, err)
+		}
+	}
+
+	const slack = 2
+	timeout := time.After(5 * time.Second)
+	for {
+		n := runtime.NumGoroutine()
+		if n <= before+slack {
+			break
+		}
+		select {
+		case <-timeout:
+			buf := make([]byte, 1<<20)
+			buf = buf[:runtime.Stack(buf, true)]
+			t.Fatalf("goroutine leak: before=%d, after=%d\n%s", before, n, buf)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestMWriterCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	w := newMWriter(ctx)
+	defer w.Close()
+
+	wfast, rfast := newTestConnPair(t, Sub)
+	wslow, rslow := newTestConnPair(t, Sub)
+	defer rslow.Close() // never read from: writes to the slow peer block.
+
+	w.addConn(newMsgWriter(wfast))
+	w.addConn(newMsgWriter(wslow))
+
+	go func() {
+		defer rfast.Close()
+		for {
+			if msg := rfast.read(); msg.err != nil {
+				return
+			}
+		}
+	}()
+
+	wctx, wcancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer wcancel()
+
+	done := make(chan error)
+	go func() {
+		done <- w.write(wctx, NewMsgString("hello"))
+	}()
+
+	select {
+	case err := <-done:
+		if errors.Cause(err) != context.DeadlineExceeded {
+			t.Fatalf("invalid error: got=%v, want=%v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("broadcast did not honor context cancellation")
+	}
+}
+
+func TestMWriterSlowPeer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	w := newMWriter(ctx)
+	defer w.Close()
+
+	wfast, rfast := newTestConnPair(t, Sub)
+	wslow, rslow := newTestConnPair(t, Sub)
+	wdead, rdead := newTestConnPair(t, Sub)
+	rdead.Close() // writes to the dead peer fail right away.
+
+	for _, c := range []*Conn{wfast, wslow, wdead} {
+		w.addConn(newMsgWriter(c))
+	}
+
+	fast := make(chan time.Time, 1)
+	go func() {
+		defer rfast.Close()
+		if msg := rfast.read(); msg.err == nil {
+			fast <- time.Now()
+		}
+	}()
+	go func() {
+		defer rslow.Close()
+		time.Sleep(500 * time.Millisecond)
+		rslow.read()
+	}()
+
+	const timeout = 100 * time.Millisecond
+	wctx, wcancel := context.WithTimeout(ctx, timeout)
+	defer wcancel()
+
+	start := time.Now()
+	err := w.write(wctx, NewMsgString("hello"))
+	if err == nil {
+		t.Fatalf("expected an error writing to dead and slow peers")
+	}
+	if d := time.Since(start); d > 4*timeout {
+		t.Fatalf("write blocked on the slow peer: %v", d)
+	}
+
+	select {
+	case at := <-fast:
+		if d := at.Sub(start); d > timeout {
+			t.Fatalf("fast peer latency too high: %v", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("fast peer did not receive the message")
+	}
+}
+
+func TestLBWriterSendTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	w := newLBWriter(ctx)
+	defer w.Close()
+
+	wslow, rslow := newTestConnPair(t, Push)
+	w.addConn(newMsgWriter(wslow))
+	go func() {
+		defer rslow.Close()
+		time.Sleep(500 * time.Millisecond)
+		rslow.read()
+	}()
+
+	const timeout = 100 * time.Millisecond
+	wctx, wcancel := context.WithTimeout(ctx, timeout)
+	defer wcancel()
+
+	start := time.Now()
+	err := w.write(wctx, NewMsgString("hello"))
+	if errors.Cause(err) != context.DeadlineExceeded {
+		t.Fatalf("invalid error: got=%v, want=%v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > 4*timeout {
+		t.Fatalf("write blocked on the slow peer: %v", d)
+	}
+}
+
+func TestFQReaderPartialMessage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	q := newFQReader(ctx)
+	defer q.Close()
+
+	r, w := newTestConnPair(t, Pull)
+	q.addConn(newMsgReader(r))
+
+	go func() {
+		defer w.Close()
+		if err := w.SendMsg(NewMsgFromString([]string{"whole", "message"})); err != nil {
+			return
+		}
+		// the peer goes away between the frames of a message.
+		w.sendFrame([]byte("first"), true, true)
+	}()
+
+	var msg Msg
+	if err := q.read(ctx, &msg); err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	if got, want := len(msg.Frames), 2; got != want {
+		t.Fatalf("invalid number of frames: got=%d, want=%d", got, want)
+	}
+
+	msg = Msg{}
+	err := q.read(ctx, &msg)
+	if errors.Cause(err) != io.ErrUnexpectedEOF {
+		t.Fatalf("invalid error: got=%v, want=%v", err, io.ErrUnexpectedEOF)
+	}
+	if len(msg.Frames) != 0 {
+		t.Fatalf("partial message delivered: %q", msg.Frames)
+	}
+}
+
+func TestSemaphore(t *testing.T) {
+	sem := newSemaphore()
+
+	isReady := func() bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		return sem.wait(ctx) == nil
+	}
+
+	if isReady() {
+		t.Fatalf("semaphore ready without connection")
+	}
+	sem.enable()
+	sem.enable()
+	if !isReady() {
+		t.Fatalf("semaphore not ready with 2 connections")
+	}
+	sem.disable()
+	if !isReady() {
+		t.Fatalf("semaphore not ready with 1 connection")
+	}
+	sem.disable()
+	if isReady() {
+		t.Fatalf("semaphore ready after all connections were removed")
+	}
+	sem.disable() // spurious removal.
+	sem.enable()
+	if !isReady() {
+		t.Fatalf("semaphore not ready after a connection was re-added")
+	}
+}
+
+func TestIsConnLost(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}, true},
+		{&net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.ECONNRESET)}, true},
+		{errors.Wrapf(&net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}, "zmq4: error sending frame 1/1"), true},
+		{errors.Wrapf(io.ErrClosedPipe, "zmq4: error sending frame 1/1"), true},
+		{&net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.ENOBUFS)}, false},
+		{context.DeadlineExceeded, false},
+		{ErrBadFrame, false},
+	} {
+		if got := isConnLost(tc.err); got != tc.want {
+			t.Errorf("isConnLost(%v): got=%v, want=%v", tc.err, got, tc.want)
+		}
+	}
+}
+
+// newBrokenConn returns a connection whose peer went away.
+func newBrokenConn(t *testing.T) *Conn {
+	c, peer := newTestConnPair(t, Push)
+	peer.Close()
+	return c
+}
+
+func TestLBWriterBrokenPipe(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, tc := range []struct {
+		name   string
+		broken int // number of broken peers, before the healthy one.
+		ok     bool
+	}{
+		{"retried", 1, true},
+		{"retried-once", 2, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := newLBWriter(ctx)
+			defer w.Close()
+
+			for i := 0; i < tc.broken; i++ {
+				w.addConn(newMsgWriter(newBrokenConn(t)))
+			}
+			push, pull := newTestConnPair(t, Push)
+			defer pull.Close()
+			w.addConn(newMsgWriter(push))
+
+			recv := make(chan Msg, 1)
+			go func() { recv <- pull.read() }()
+
+			err := w.write(ctx, NewMsgString("hello"))
+			switch {
+			case tc.ok && err != nil:
+				t.Fatalf("could not write: %v", err)
+			case !tc.ok && !isConnLost(err):
+				t.Fatalf("invalid error: got=%v, want a lost connection", err)
+			}
+			if got, want := w.ready(), 1; got != want {
+				t.Fatalf("invalid number of ready peers: got=%d, want=%d", got, want)
+			}
+			if !tc.ok {
+				return
+			}
+			if msg := <-recv; msg.err != nil || string(msg.Frames[0]) != "hello" {
+				t.Fatalf("invalid message: %q (err=%v)", msg.Frames, msg.err)
+			}
+		})
+	}
+}
+
+func TestMWriterBrokenPipe(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	w := newMWriter(ctx)
+	defer w.Close()
+
+	w.addConn(newMsgWriter(newBrokenConn(t)))
+	push, pull := newTestConnPair(t, Push)
+	defer pull.Close()
+	w.addConn(newMsgWriter(push))
+
+	go pull.read()
+	// the broken peer does not fail the write to the healthy one.
+	if err := w.write(ctx, NewMsgString("hello")); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	if got, want := len(w.ws), 1; got != want {
+		t.Fatalf("invalid number of peers: got=%d, want=%d", got, want)
+	}
+
+	pull.Close()
+	if err := w.write(ctx, NewMsgString("hello")); !isConnLost(err) {
+		t.Fatalf("invalid error: got=%v, want a lost connection", err)
+	}
+	if got, want := len(w.ws), 0; got != want {
+		t.Fatalf("invalid number of peers: got=%d, want=%d", got, want)
+	}
+}
+
+func TestDontWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nowait := withDontWait(context.Background())
+
+	sem := newSemaphore()
+	if err := sem.wait(nowait); err != ErrWouldBlock {
+		t.Fatalf("invalid semaphore error: got=%v, want=%v", err, ErrWouldBlock)
+	}
+	sem.enable()
+	if err := sem.wait(nowait); err != nil {
+		t.Fatalf("could not wait for a ready semaphore: %v", err)
+	}
+
+	lw := newLBWriter(ctx)
+	if err := lw.write(nowait, NewMsgString("hello")); err != ErrWouldBlock {
+		t.Fatalf("invalid lbwriter error: got=%v, want=%v", err, ErrWouldBlock)
+	}
+
+	q := newFQReader(ctx)
+	var msg Msg
+	if err := q.read(nowait, &msg); err != ErrWouldBlock {
+		t.Fatalf("invalid fqreader error: got=%v, want=%v", err, ErrWouldBlock)
+	}
+
+	// without peers, the queue of the writer fills up: one message is kept
+	// by its writing goroutine, and hwm messages are queued.
+	const hwm = 1
+	qw := newQWriter(ctx, hwm)
+	var err error
+	for i := 0; i < hwm+2 && err == nil; i++ {
+		err = qw.write(nowait, NewMsgString("hello"))
+	}
+	if err != ErrWouldBlock {
+		t.Fatalf("invalid qwriter error: got=%v, want=%v", err, ErrWouldBlock)
+	}
+}
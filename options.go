@@ -5,17 +5,39 @@
 package zmq4
 
 import (
+	"context"
+	"crypto/tls"
+	"net"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 // Option configures some aspect of a ZeroMQ socket.
 // (e.g. SocketIdentity, Security, ...)
+//
+// The options that can also be changed at runtime, through
+// Socket.SetOption, are validated alike: the first invalid option a socket
+// is created with is reported by its first Listen or Dial.
 type Option func(s *socket)
 
+// setOption sets the option name of s, like SetOption, and records the
+// first error, reported by the first Listen or Dial of s.
+// Options not supported by the type of s are ignored.
+func (s *socket) setOption(name string, value interface{}) {
+	err := s.SetOption(name, value)
+	if err == nil || err == ErrUnknownOption || s.opterr != nil {
+		return
+	}
+	s.opterr = errors.Wrapf(err, "could not set option %q", name)
+}
+
 // WithID configures a ZeroMQ socket identity.
+// The identity is announced to peers during the handshake: ROUTER peers
+// route messages to the socket by its identity, across reconnections.
 func WithID(id SocketIdentity) Option {
 	return func(s *socket) {
-		s.id = id
+		s.setOption(OptionIdentity, id)
 	}
 }
 
@@ -27,11 +49,26 @@ func WithSecurity(sec Security) Option {
 	}
 }
 
+// WithEndpointSecurity configures a ZeroMQ socket to use the given security
+// mechanism for connections on the given endpoint, overriding the one
+// set with WithSecurity.
+// Accepted connections perform the handshake as the server, dialed ones
+// as the client, so a socket may listen and dial with the same mechanism.
+// If the security mechanism is nil, the NULL mechanism is used.
+func WithEndpointSecurity(endpoint string, sec Security) Option {
+	return func(s *socket) {
+		if sec == nil {
+			sec = nullSecurity{}
+		}
+		s.esec[endpoint] = sec
+	}
+}
+
 // WithDialerRetry configures the time to wait before two failed attempts
 // at dialing an endpoint.
 func WithDialerRetry(retry time.Duration) Option {
 	return func(s *socket) {
-		s.retry = retry
+		s.setOption(OptionDialerRetry, retry)
 	}
 }
 
@@ -39,7 +76,440 @@ func WithDialerRetry(retry time.Duration) Option {
 // for a connect to complete.
 func WithDialerTimeout(timeout time.Duration) Option {
 	return func(s *socket) {
-		s.dialer.Timeout = timeout
+		s.setOption(OptionDialerTimeout, timeout)
+	}
+}
+
+// WithHandshakeTimeout configures the maximum time a ZeroMQ socket
+// waits for a peer to complete the ZMTP handshake: greetings, security
+// handshake and metadata exchange.
+// Connections whose handshake takes longer are closed. Listening sockets
+// keep accepting other peers, and dialing sockets retry the connection.
+// The timeout defaults to 30s; a timeout of 0 disables it.
+func WithHandshakeTimeout(timeout time.Duration) Option {
+	return func(s *socket) {
+		s.setOption(OptionHandshakeTimeout, timeout)
+	}
+}
+
+// WithDialer configures the dialer used to connect to remote endpoints
+// over the tcp, ipc and udp transports, e.g. to set keep-alive periods,
+// a local address or socket options through Dialer.Control.
+// WithDialer replaces the dialer timeout: use WithDialerTimeout after it
+// to override it.
+func WithDialer(dialer net.Dialer) Option {
+	return func(s *socket) {
+		s.dialer = dialer
+	}
+}
+
+// WithListenConfig configures how a ZeroMQ socket listens on endpoints
+// over the tcp, ipc and udp transports.
+// ListenConfig.Control allows to set socket options, such as SO_REUSEPORT,
+// before the listener is bound.
+func WithListenConfig(lc net.ListenConfig) Option {
+	return func(s *socket) {
+		s.lc = lc
+	}
+}
+
+// WithTLS configures a ZeroMQ socket to secure its tcp connections with
+// TLS: connections are wrapped in TLS, both on the Dial and Listen sides,
+// before the ZMTP handshake, which then runs over the encrypted stream.
+// Listening sockets need cfg to hold a certificate. Dialing sockets verify
+// the certificate of the peer against the host of the endpoint, unless
+// cfg.ServerName is set.
+// TLS is a transport-layer security, independent of the ZMTP security
+// mechanism configured with WithSecurity.
+func WithTLS(cfg *tls.Config) Option {
+	return func(s *socket) {
+		s.tlscfg = cfg
+	}
+}
+
+// WithIPv4Only configures the IP version of the tcp endpoints a ZeroMQ
+// socket listens on and dials: IPv4 only if ipv4only is true, IPv6 only
+// otherwise.
+// Sockets use both IPv4 and IPv6 by default: a wildcard endpoint, such as
+// tcp://*:5555 or tcp://[::]:5555, then also accepts IPv4 peers.
+func WithIPv4Only(ipv4only bool) Option {
+	return func(s *socket) {
+		s.tcpnet = "tcp6"
+		if ipv4only {
+			s.tcpnet = "tcp4"
+		}
+	}
+}
+
+// WithDNSRoundRobin configures whether a ZeroMQ socket dialing a tcp
+// endpoint whose host is a name, rather than an IP address, connects to
+// each of the addresses the name resolves to, instead of a single one.
+// Messages are then distributed over all the addresses, as for several
+// endpoints. Dial succeeds if at least one of the addresses is connected.
+// The name is resolved again every DNS TTL, see WithDNSTTL: connections are
+// opened to the new addresses, dropped peers are dialed again and the
+// connections to the addresses no longer listed are closed.
+func WithDNSRoundRobin(enable bool) Option {
+	return func(s *socket) {
+		s.dnsrr = enable
+	}
+}
+
+// WithDNSTTL configures the time between two resolutions of the hosts of
+// the tcp endpoints dialed with WithDNSRoundRobin. The default is 30s.
+func WithDNSTTL(d time.Duration) Option {
+	return func(s *socket) {
+		if d > 0 {
+			s.dnsttl = d
+		}
+	}
+}
+
+// WithResolver configures the resolver of the hosts of the tcp endpoints
+// dialed with WithDNSRoundRobin, in place of net.DefaultResolver.
+func WithResolver(r Resolver) Option {
+	return func(s *socket) {
+		s.resolver = r
+	}
+}
+
+// WithMulticastTTL configures the time-to-live, or maximum number of
+// network hops, of the packets a ZeroMQ socket sends to pgm and epgm
+// endpoints. The default is 1: packets do not leave the local network.
+// The pgm and epgm transports are only available with the zmq4_draft
+// build tag.
+func WithMulticastTTL(n int) Option {
+	return func(s *socket) {
+		s.mcastTTL = n
+	}
+}
+
+// WithContextDialer configures the function used to connect to remote
+// endpoints over the tcp, ipc and udp transports, in place of
+// the default net.Dialer.
+// The dialer timeout set with WithDialerTimeout does not apply to
+// a custom dial function.
+func WithContextDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(s *socket) {
+		s.dial = dial
+	}
+}
+
+// WithMaxConnections configures the maximum number of peers connected
+// to a ZeroMQ socket.
+// Peers connecting to a socket that reached its limit are turned down
+// with ErrTooManyConnections.
+// There is no limit if n <= 0.
+func WithMaxConnections(n int) Option {
+	return func(s *socket) {
+		s.maxconns = n
+	}
+}
+
+// WithImmediate configures whether a socket only queues the messages sent
+// while a peer completed its handshake, like ZMQ_IMMEDIATE: Send then
+// blocks while no peer is connected, until a peer connects or the send
+// timeout expires, instead of queuing messages no peer may ever receive.
+// This option only changes the behavior of PAIR sockets: the sockets
+// load-balancing their messages, e.g. PUSH and DEALER, never queue
+// messages while no peer is connected.
+func WithImmediate(immediate bool) Option {
+	return func(s *socket) {
+		s.immediate = immediate
+	}
+}
+
+// WithLinger configures how long Close keeps writing the messages a
+// ZeroMQ socket queued, e.g. by PAIR and PUB sockets, before dropping them.
+// Queued messages are dropped at once by default.
+func WithLinger(linger time.Duration) Option {
+	return func(s *socket) {
+		s.setOption(OptionLinger, linger)
+	}
+}
+
+// WithSendTimeout configures the maximum time a send on a ZeroMQ socket
+// may block. The timeout defaults to 5 minutes.
+func WithSendTimeout(timeout time.Duration) Option {
+	return func(s *socket) {
+		s.setOption(OptionSendTimeout, timeout)
+	}
+}
+
+// WithRecvTimeout configures the maximum time a receive on a ZeroMQ
+// socket may block. There is no limit by default.
+func WithRecvTimeout(timeout time.Duration) Option {
+	return func(s *socket) {
+		s.setOption(OptionRecvTimeout, timeout)
+	}
+}
+
+// WithSendHWM configures the high water mark for the outbound messages
+// of a ZeroMQ socket: the maximum number of messages queued by PAIR
+// sockets, or for each subscriber of PUB and XPUB sockets.
+// The high water mark defaults to 10.
+func WithSendHWM(n int) Option {
+	return func(s *socket) {
+		s.setOption(OptionSendHWM, n)
+	}
+}
+
+// WithRecvHWM configures the high water mark for the inbound messages of
+// a ZeroMQ socket: the maximum number of messages queued for each peer.
+// The high water mark defaults to 10.
+func WithRecvHWM(n int) Option {
+	return func(s *socket) {
+		s.setOption(OptionRecvHWM, n)
+	}
+}
+
+// WithTruncateOversize configures whether messages larger than the maximum
+// message size are truncated and delivered, instead of closing the
+// connection they were received from.
+// Truncated messages hold the first bytes of the message, up to the
+// maximum message size, and are reported by RecvMeta.Truncated.
+// See WithMaxMsgSize.
+func WithTruncateOversize(truncate bool) Option {
+	return func(s *socket) {
+		s.trunc = truncate
+	}
+}
+
+// WithRouterMandatory configures whether a ROUTER socket reports
+// ErrHostUnreachable when sending a message to an unknown peer, instead
+// of silently dropping it (the default).
+// This option is ignored by other socket types.
+// See also OptionRouterMandatory.
+func WithRouterMandatory(mandatory bool) Option {
+	return func(s *socket) {
+		s.setOption(OptionRouterMandatory, mandatory)
+	}
+}
+
+// WithRouterHandover configures whether a ROUTER socket hands the identity
+// of a connected peer over to a new connection announcing the same
+// identity, e.g. a peer reconnecting after a crash, closing the old
+// connection.
+// By default, both connections are kept.
+// In both cases, the collision is reported by an EventIdentityConflict
+// event.
+// This option is ignored by other socket types.
+// See also OptionRouterHandover.
+func WithRouterHandover(handover bool) Option {
+	return func(s *socket) {
+		s.setOption(OptionRouterHandover, handover)
+	}
+}
+
+// WithProbeRouter configures whether a ROUTER or DEALER socket sends an
+// empty message to each new peer, as soon as the handshake completes, so
+// ROUTER peers learn its identity without waiting for it to speak first.
+// A ROUTER peer receives the probe as a message made of the identity of
+// the socket and an empty frame.
+// This option is ignored by other socket types.
+// See also OptionProbeRouter.
+func WithProbeRouter(probe bool) Option {
+	return func(s *socket) {
+		s.setOption(OptionProbeRouter, probe)
+	}
+}
+
+// WithWelcomeMessage configures a PUB or XPUB socket to send msg to each
+// new subscriber, ahead of any other message: PUB sockets send it once the
+// handshake with the subscriber completes, XPUB sockets once its first
+// subscription is received.
+// The message is sent once per connection, including to subscribers that
+// reconnect, through the queue of the subscriber.
+// This option is ignored by other socket types.
+func WithWelcomeMessage(msg Msg) Option {
+	return func(s *socket) {
+		welcome := msg.Clone()
+		s.welcome = &welcome
+	}
+}
+
+// WithXPubVerbose configures whether a XPUB socket delivers every
+// subscription message to the application, even for topics other peers
+// are already subscribed to, e.g. to re-send a cached value to each new
+// subscriber.
+// This option is ignored by other socket types.
+// See also OptionXPubVerbose.
+func WithXPubVerbose(verbose bool) Option {
+	return func(s *socket) {
+		s.setOption(OptionXPubVerbose, verbose)
+	}
+}
+
+// WithXPubVerboser configures whether a XPUB socket delivers every
+// subscription and unsubscription message to the application, even for
+// topics other peers are still subscribed to.
+// This option is ignored by other socket types.
+// See also OptionXPubVerboser.
+func WithXPubVerboser(verboser bool) Option {
+	return func(s *socket) {
+		s.setOption(OptionXPubVerboser, verboser)
+	}
+}
+
+// WithDropConsecutiveDuplicates configures whether a SUB socket drops
+// a received message that is identical, frame by frame, to the message
+// it delivered just before.
+// This suits publishers periodically re-sending an unchanged state.
+// This option is ignored by other socket types.
+func WithDropConsecutiveDuplicates(drop bool) Option {
+	return func(s *socket) {
+		s.dedup = drop
+	}
+}
+
+// WithStreamThreshold configures the size in bytes above which a frame,
+// received as the single frame of a message, is not assembled in memory:
+// it is copied from the wire to the writer given to Socket.RecvFrameTo.
+// Such frames are assembled as usual for Recv.
+// The connection the frame came from is not read from until the frame is
+// consumed, and frames are only streamed over connections without
+// encryption.
+// A value of n <= 0 disables streaming (the default.)
+// This option is only supported by PULL, DEALER, PAIR, SUB and XSUB
+// sockets, and is ignored by others.
+func WithStreamThreshold(n int64) Option {
+	return func(s *socket) {
+		s.streamsz = n
+	}
+}
+
+// WithWriteBatching configures a ZeroMQ socket to coalesce the small
+// frames it sends into writes of up to maxBytes bytes, to save syscalls
+// when sending many small messages.
+// Frames are written out once maxBytes bytes are pending, or at most
+// maxDelay after the first pending frame.
+// A send thus completes before its frames are on the wire: write errors
+// are reported by the following sends.
+// A maxBytes <= 0 disables batching (the default.)
+func WithWriteBatching(maxBytes int, maxDelay time.Duration) Option {
+	return func(s *socket) {
+		s.batchsz = maxBytes
+		s.batchdl = maxDelay
+	}
+}
+
+// WithMsgPool configures a socket to take the buffers of received
+// messages from pool, which may be shared with other sockets.
+// The message and its frames are owned by the caller until it calls
+// Msg.Release, which hands them back to the pool. Messages that are not
+// released are garbage collected as usual.
+// A nil pool disables pooling (the default.)
+func WithMsgPool(pool *MsgPool) Option {
+	return func(s *socket) {
+		s.pool = nil
+		if pool != nil {
+			s.pool = pool.p
+		}
+	}
+}
+
+// WithMetadata adds the key/value pair to the application metadata
+// sent to peers during the ZMTP handshake.
+// Peers see application metadata under the "X-" prefixed key.
+func WithMetadata(key, value string) Option {
+	return func(s *socket) {
+		s.meta[key] = value
+	}
+}
+
+// WithMaxMsgSize configures the maximum size in bytes of a received message.
+// Connections announcing a frame or a multipart message larger than n
+// are closed before any memory is allocated for it, and the receive
+// fails with ErrMsgTooLarge.
+// A value of n <= 0 disables the limit (the default.)
+func WithMaxMsgSize(n int64) Option {
+	return func(s *socket) {
+		s.setOption(OptionMaxMsgSize, n)
+	}
+}
+
+// WithSendRetry configures a ZeroMQ socket to retry up to n times a send
+// that failed because of a connection error, waiting backoff between two
+// attempts, before reporting the error.
+// Retries happen within the send timeout.
+// REQ sockets never retry sends: a request may already have reached a peer.
+func WithSendRetry(n int, backoff time.Duration) Option {
+	return func(s *socket) {
+		s.sndretry = n
+		s.sndbackoff = backoff
+	}
+}
+
+// WithTracer configures a ZeroMQ socket to notify t of every message
+// sent to or received from its peers.
+func WithTracer(t Tracer) Option {
+	return func(s *socket) {
+		s.tracer = t
+	}
+}
+
+// WithHeartbeatInterval configures a ZeroMQ socket to send a ZMTP PING
+// command to its peers every interval, to detect dead connections.
+// PING commands are only sent to peers speaking ZMTP 3.1 or later, see
+// WithZMTPVersion. Heartbeats are disabled by default.
+func WithHeartbeatInterval(interval time.Duration) Option {
+	return func(s *socket) {
+		s.hbivl = interval
+	}
+}
+
+// WithHeartbeatTimeout configures the time a ZeroMQ socket waits for the
+// ZMTP PONG reply to a heartbeat, before closing the connection.
+// The timeout defaults to the heartbeat interval.
+func WithHeartbeatTimeout(timeout time.Duration) Option {
+	return func(s *socket) {
+		s.hbtimeout = timeout
+	}
+}
+
+// WithAppHeartbeat configures a ZeroMQ socket to check the liveness of its
+// peers with application-level heartbeats: every interval, a reserved
+// single-frame message holding a random nonce is sent to each peer, which
+// must echo the nonce back within timeout.
+// Peers that do not echo a heartbeat in time, or echo an invalid nonce,
+// are disconnected. A timeout <= 0 defaults to interval.
+// zmq4 sockets advertise application heartbeats in their handshake
+// metadata: they are only sent to, and answered for, peers advertising
+// them too and speaking ZMTP 3.0, as ZMTP 3.1 peers are sent PING commands
+// (see WithHeartbeatInterval) and ZMTP 2.0 exchanges no metadata.
+// Other peers are neither pinged nor disconnected.
+// They are not exchanged between SUB or XSUB sockets and their peers, as
+// the messages sent by SUB and XSUB sockets are subscriptions.
+func WithAppHeartbeat(interval, timeout time.Duration) Option {
+	return func(s *socket) {
+		s.ahbivl = interval
+		s.ahbtimeout = timeout
+	}
+}
+
+// WithZMTPVersion configures the version of the ZMTP protocol a ZeroMQ
+// socket speaks with its peers.
+// ZMTP 3.0 (the default), ZMTP 3.1 and ZMTP 2.0 are supported.
+// ZMTP 3.1 peers, e.g. libzmq-4.2 and later, send their subscriptions
+// as SUBSCRIBE and CANCEL commands; sockets speaking ZMTP 3.1 downgrade
+// to ZMTP 3.0 with older peers. ZMTP 2.0 allows to talk to legacy
+// libzmq-2.x and libzmq-3.x peers, without security mechanisms nor
+// metadata.
+func WithZMTPVersion(major, minor int) Option {
+	return func(s *socket) {
+		s.version = [2]uint8{uint8(major), uint8(minor)}
+	}
+}
+
+// WithLogger configures a ZeroMQ socket to log its lifecycle events, such
+// as connections being accepted, dialed and closed, and its internal
+// errors, such as failed handshakes, connection errors and dropped
+// messages, to l.
+// A *log.Logger is adapted with NewLogLogger.
+// Nothing is logged by default.
+func WithLogger(l Logger) Option {
+	return func(s *socket) {
+		s.log = l
 	}
 }
 
@@ -59,7 +529,75 @@ func WithRecvBufferSize(size int) Option {
 }
 */
 
+// Names of the options that can be set and retrieved at runtime via
+// Socket.SetOption and Socket.GetOption.
+// SetOption reports ErrBadProperty for values of the wrong type or out of
+// range, and ErrUnknownOption for options not supported by the socket type.
+// See SupportedOptions.
 const (
-	OptionSubscribe   = "SUBSCRIBE"
-	OptionUnsubscribe = "UNSUBSCRIBE"
+	OptionSubscribe   = "SUBSCRIBE"   // string: topic to subscribe to (SUB)
+	OptionUnsubscribe = "UNSUBSCRIBE" // string: topic to unsubscribe from (SUB)
+
+	OptionIdentity = "IDENTITY" // SocketIdentity or []byte: identity of the socket, immutable after Listen or Dial
+	OptionHWM      = "HWM"      // int: high water mark for both outbound and inbound messages (reads as SNDHWM)
+
+	OptionSendHWM       = "SNDHWM"          // int: high water mark for outbound messages
+	OptionRecvHWM       = "RCVHWM"          // int: high water mark for inbound messages, per connection
+	OptionLinger        = "LINGER"          // time.Duration: how long Close writes queued messages for (default 0: dropped)
+	OptionSendTimeout   = "SNDTIMEO"        // time.Duration: maximum time a Send may block
+	OptionRecvTimeout   = "RCVTIMEO"        // time.Duration: maximum time a Recv may block, 0 for no limit
+	OptionDialerRetry   = "RECONNECT_IVL"   // time.Duration: time between two dial attempts
+	OptionDialerTimeout = "CONNECT_TIMEOUT" // time.Duration: maximum time a dial may take
+	OptionMaxMsgSize    = "MAXMSGSIZE"      // int64: maximum size of a received message, <= 0 for no limit
+
+	OptionHandshakeTimeout = "HANDSHAKE_IVL" // time.Duration: maximum time a ZMTP handshake may take, 0 for no limit
+
+	OptionRouterMandatory = "ROUTER_MANDATORY" // bool: whether sends to unknown peers fail with ErrHostUnreachable (ROUTER)
+	OptionRouterHandover  = "ROUTER_HANDOVER"  // bool: whether identities are handed over to reconnecting peers (ROUTER)
+	OptionProbeRouter     = "PROBE_ROUTER"     // bool: whether an empty message is sent to new peers (ROUTER, DEALER)
+	OptionXPubVerbose     = "XPUB_VERBOSE"     // bool: whether all subscriptions are delivered (XPUB)
+	OptionXPubVerboser    = "XPUB_VERBOSER"    // bool: whether all subscriptions and unsubscriptions are delivered (XPUB)
 )
+
+// commonOptions are the options supported by all socket types.
+var commonOptions = []string{
+	OptionIdentity,
+	OptionHWM,
+	OptionSendHWM,
+	OptionRecvHWM,
+	OptionLinger,
+	OptionSendTimeout,
+	OptionRecvTimeout,
+	OptionDialerRetry,
+	OptionDialerTimeout,
+	OptionHandshakeTimeout,
+	OptionMaxMsgSize,
+}
+
+// SupportedOptions returns the names of the options that sockets of the
+// given type support through Socket.SetOption.
+func SupportedOptions(typ SocketType) []string {
+	opts := append([]string(nil), commonOptions...)
+	switch typ {
+	case Sub:
+		opts = append(opts, OptionSubscribe, OptionUnsubscribe)
+	case Dealer:
+		opts = append(opts, OptionProbeRouter)
+	case Router:
+		opts = append(opts, OptionRouterMandatory, OptionRouterHandover, OptionProbeRouter)
+	case XPub:
+		opts = append(opts, OptionXPubVerbose, OptionXPubVerboser)
+	}
+	return opts
+}
+
+// supportsOption returns whether sockets of the given type support the
+// option name.
+func supportsOption(typ SocketType, name string) bool {
+	for _, opt := range SupportedOptions(typ) {
+		if opt == name {
+			return true
+		}
+	}
+	return false
+}
@@ -6,12 +6,25 @@ package zmq4
 
 import (
 	"context"
+	"io"
+	"net"
+	"time"
 )
 
 // NewPair returns a new PAIR ZeroMQ socket.
 // The returned socket value is initially unbound.
+//
+// PAIR sockets are connected to at most one peer at a time: connections
+// accepted while a peer is connected are rejected.
+// Messages sent while no peer is connected are queued, up to the send
+// high water mark, and delivered once a peer connects, unless the socket
+// is configured with WithImmediate.
 func NewPair(ctx context.Context, opts ...Option) Socket {
 	pair := &pairSocket{newSocket(ctx, Pair, opts...)}
+	pair.sck.maxconns = 1
+	w := newQWriter(pair.sck.ctx, pair.sck.sndhwm)
+	w.immediate = pair.sck.immediate
+	pair.sck.w = w
 	return pair
 }
 
@@ -36,6 +49,12 @@ func (pair *pairSocket) Recv() (Msg, error) {
 	return pair.sck.Recv()
 }
 
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (pair *pairSocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	return pair.sck.RecvWithMeta()
+}
+
 // Listen connects a local endpoint to the Socket.
 func (pair *pairSocket) Listen(ep string) error {
 	return pair.sck.Listen(ep)
@@ -46,6 +65,21 @@ func (pair *pairSocket) Dial(ep string) error {
 	return pair.sck.Dial(ep)
 }
 
+// Unbind stops listening on a local endpoint.
+func (pair *pairSocket) Unbind(ep string) error {
+	return pair.sck.Unbind(ep)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (pair *pairSocket) Disconnect(ep string) error {
+	return pair.sck.Disconnect(ep)
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (pair *pairSocket) WaitConnected(ctx context.Context) error {
+	return pair.sck.WaitConnected(ctx)
+}
+
 // Type returns the type of this Socket (PUB, SUB, ...)
 func (pair *pairSocket) Type() SocketType {
 	return pair.sck.Type()
@@ -61,6 +95,151 @@ func (pair *pairSocket) SetOption(name string, value interface{}) error {
 	return pair.sck.SetOption(name, value)
 }
 
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+func (pair *pairSocket) ConnMetadata(peer string) map[string]string {
+	return pair.sck.ConnMetadata(peer)
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (pair *pairSocket) Monitor() <-chan Event {
+	return pair.sck.Monitor()
+}
+
+// Addr returns the address the Socket is listening on, or nil if
+// the Socket is not listening.
+func (pair *pairSocket) Addr() net.Addr {
+	return pair.sck.Addr()
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (pair *pairSocket) BoundEndpoints() []string {
+	return pair.sck.BoundEndpoints()
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (pair *pairSocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	return pair.sck.ConnHandshake(peer)
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (pair *pairSocket) PeerConn(peer string) (net.Conn, error) {
+	return pair.sck.PeerConn(peer)
+}
+
+// Peers returns the peers connected to the Socket, in the order they
+// connected.
+func (pair *pairSocket) Peers() []PeerInfo {
+	return pair.sck.Peers()
+}
+
+// SendFrame sends a single frame of a message.
+// More frames of the same message follow when more is true.
+func (pair *pairSocket) SendFrame(frame []byte, more bool) error {
+	return pair.sck.SendFrame(frame, more)
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (pair *pairSocket) RecvFrame() ([]byte, bool, error) {
+	return pair.sck.recvFrame(pair.Recv)
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+func (pair *pairSocket) SendFrames(rd io.Reader, size int64) error {
+	return pair.sck.SendFrames(rd, size)
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (pair *pairSocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	return pair.sck.RecvFrameTo(w)
+}
+
+// SendContext puts the message on the outbound send queue.
+// SendContext blocks until the message can be queued, the send deadline
+// expires or ctx is done.
+func (pair *pairSocket) SendContext(ctx context.Context, msg Msg) error {
+	return pair.sck.SendContext(ctx, msg)
+}
+
+// SendBatch sends msgs, in order, in as few writes as possible.
+func (pair *pairSocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	return pair.sck.SendBatch(ctx, msgs)
+}
+
+// RecvContext receives a complete message.
+// RecvContext returns ctx.Err() without consuming a message if ctx is done
+// first.
+func (pair *pairSocket) RecvContext(ctx context.Context) (Msg, error) {
+	return pair.sck.RecvContext(ctx)
+}
+
+// TrySend sends msg if it can be done without waiting.
+func (pair *pairSocket) TrySend(msg Msg) (bool, error) {
+	return trySend(pair.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (pair *pairSocket) TryRecv() (Msg, bool, error) {
+	return tryRecv(pair.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (pair *pairSocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, pair.TryRecv, pair.RecvContext)
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (pair *pairSocket) SetSendDeadline(t time.Time) {
+	pair.sck.SetSendDeadline(t)
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (pair *pairSocket) SetRecvDeadline(t time.Time) {
+	pair.sck.SetRecvDeadline(t)
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+func (pair *pairSocket) RotateSecurity(sec Security) {
+	pair.sck.RotateSecurity(sec)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (pair *pairSocket) CloseIdle(maxIdle time.Duration) int {
+	return pair.sck.CloseIdle(maxIdle)
+}
+
+// Stats returns the activity of the Socket.
+func (pair *pairSocket) Stats() Stats {
+	return pair.sck.Stats()
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to,
+// in the order they were dialed.
+func (pair *pairSocket) DialEndpoints() []string {
+	return pair.sck.DialEndpoints()
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (pair *pairSocket) Config() ConfigSnapshot {
+	return pair.sck.Config()
+}
+
+// base returns the socket implementing the core of the Socket.
+func (pair *pairSocket) base() *socket {
+	return pair.sck
+}
+
 var (
 	_ Socket = (*pairSocket)(nil)
 )
@@ -0,0 +1,41 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"time"
+)
+
+// PeerInfo describes a peer connected to a socket.
+type PeerInfo struct {
+	Endpoint    string     // endpoint the connection was established on
+	RemoteAddr  string     // address of the peer
+	ID          string     // identity of the peer, as used by ConnMetadata and PeerConn
+	Type        SocketType // socket type announced by the peer, empty for raw connections
+	ConnectedAt time.Time  // time the connection with the peer was established
+
+	// Handshake holds the durations of the handshake phases
+	// of the connection.
+	Handshake HandshakeTimings
+}
+
+// Peers returns the peers connected to the socket, in the order they
+// connected.
+func (sck *socket) Peers() []PeerInfo {
+	sck.mu.RLock()
+	defer sck.mu.RUnlock()
+	peers := make([]PeerInfo, 0, len(sck.conns))
+	for _, c := range sck.conns {
+		peers = append(peers, PeerInfo{
+			Endpoint:    c.ep,
+			RemoteAddr:  c.remoteAddr(),
+			ID:          c.Peer.Meta[sysSockID],
+			Type:        SocketType(c.Peer.Meta[sysSockType]),
+			ConnectedAt: c.connected,
+			Handshake:   c.Handshake,
+		})
+	}
+	return peers
+}
@@ -0,0 +1,508 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	pgmProtocol  = 113  // IP protocol number of PGM
+	pgmODATA     = 0x04 // original data packet
+	pgmRDATA     = 0x05 // repair data packet
+	pgmHeaderLen = 24   // common header and data packet header
+	pgmMaxTSDU   = 1280 // maximum size of the data of a packet
+	pgmNoOffset  = 0xffff
+)
+
+// parsePGMAddr parses the address of a pgm or epgm endpoint, made of an
+// optional interface name or address and a semicolon, followed by a
+// multicast group, e.g. eth0;239.192.1.1:5555 or 239.192.1.1:5555.
+// A nil interface stands for the default multicast interface.
+func parsePGMAddr(addr string) (*net.Interface, *net.UDPAddr, error) {
+	iface := ""
+	if i := strings.Index(addr, ";"); i >= 0 {
+		iface, addr = addr[:i], addr[i+1:]
+	}
+	group, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, nil, errors.Wrapf(errInvalidAddress, "zmq4: invalid multicast group %q: %v", addr, err)
+	}
+	if !group.IP.IsMulticast() || group.Port == 0 {
+		return nil, nil, errors.Wrapf(errInvalidAddress, "zmq4: invalid multicast group %q", addr)
+	}
+
+	switch iface {
+	case "", "*":
+		return nil, group, nil
+	}
+	if ip := net.ParseIP(iface); ip != nil {
+		ifi, err := interfaceByIP(ip)
+		return ifi, group, err
+	}
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "zmq4: invalid multicast interface %q", iface)
+	}
+	return ifi, group, nil
+}
+
+// interfaceByIP returns the network interface with the address ip.
+func interfaceByIP(ip net.IP) (*net.Interface, error) {
+	ifis, err := net.Interfaces()
+	if err != nil {
+		return nil, errors.Wrapf(err, "zmq4: could not list network interfaces")
+	}
+	for i := range ifis {
+		addrs, err := ifis[i].Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if n, ok := addr.(*net.IPNet); ok && n.IP.Equal(ip) {
+				return &ifis[i], nil
+			}
+		}
+	}
+	return nil, errors.Errorf("zmq4: no network interface with address %v", ip)
+}
+
+// listenPGM makes a PUB socket publish its messages to the multicast
+// group of a pgm or epgm endpoint.
+func (sck *socket) listenPGM(network, addr, endpoint string) error {
+	zconn, err := sck.joinPGM(network, addr, Pub)
+	if err != nil {
+		err = errors.Wrapf(err, "could not listen to %q", endpoint)
+		sck.emit(Event{Type: EventBindFailed, Endpoint: endpoint, Err: err})
+		return err
+	}
+	sck.mu.Lock()
+	sck.bound = append(sck.bound, endpoint)
+	sck.binds = append(sck.binds, endpoint)
+	sck.mu.Unlock()
+	sck.emit(Event{Type: EventListening, Endpoint: endpoint})
+
+	sck.addConn(zconn, endpoint)
+	return nil
+}
+
+// dialPGM makes a SUB socket receive the messages published to the
+// multicast group of a pgm or epgm endpoint.
+func (sck *socket) dialPGM(network, addr, endpoint string) error {
+	zconn, err := sck.joinPGM(network, addr, Sub)
+	if err != nil {
+		err = errors.Wrapf(err, "could not dial to %q", endpoint)
+		sck.emit(Event{Type: EventConnectFailed, Endpoint: endpoint, Err: err})
+		return err
+	}
+	sck.mu.Lock()
+	sck.dialed = append(sck.dialed, endpoint)
+	sck.mu.Unlock()
+
+	sck.addConn(zconn, endpoint)
+	sck.emit(Event{Type: EventConnected, Endpoint: endpoint})
+	return nil
+}
+
+// joinPGM opens a connection to the multicast group of a pgm or epgm
+// endpoint, for a socket of type typ.
+// There is no ZMTP handshake on multicast transports: the connection
+// carries the frames of messages only.
+func (sck *socket) joinPGM(network, addr string, typ SocketType) (*Conn, error) {
+	if sck.typ != typ {
+		verb := "listen on"
+		if typ == Sub {
+			verb = "dial"
+		}
+		return nil, errors.Errorf("zmq4: only %s sockets can %s %s endpoints", typ, verb, network)
+	}
+	ifi, group, err := parsePGMAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := newPGMConn(network, ifi, group, sck.mcastTTL, typ == Pub)
+	if err != nil {
+		return nil, err
+	}
+	zconn, err := newConn(conn, nullSecurity{}, sck.typ, sck.id, typ == Pub)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	zconn.maxMsgSize = sck.maxsz
+	zconn.truncate = sck.trunc
+	zconn.pool = sck.pool
+	if typ == Pub {
+		// receivers filter the messages by themselves.
+		zconn.subscribe(NewMsg([]byte{1}))
+	}
+	return zconn, nil
+}
+
+// multicast returns whether c is connected to a multicast group.
+func (c *Conn) multicast() bool {
+	_, ok := c.rw.(*pgmConn)
+	return ok
+}
+
+// pgmConn is a connection to a multicast group, carrying the frames of
+// messages in PGM data packets (RFC 3208), sent over IP (pgm) or in UDP
+// datagrams (epgm).
+// The frames of a message are split over as many packets as needed.
+// Receivers detect lost packets with the sequence numbers of each
+// sender, and skip the messages they were part of. Lost packets are not
+// repaired: there are no negative acknowledgements nor retransmissions.
+type pgmConn struct {
+	c     net.PacketConn
+	group net.Addr // destination of the packets
+	port  uint16   // data-destination port, the port of the group
+	send  bool     // whether packets are sent to, or received from, the group
+
+	once sync.Once
+	done chan struct{} // closed by Close
+
+	// sender.
+	gsi   [6]byte // global source identifier
+	sport uint16  // source port
+	sqn   uint32  // sequence number of the next packet
+	fr    pgmFramer
+	out   []byte
+
+	// receiver.
+	srcs map[pgmTSI]*pgmSource
+	buf  []byte
+	in   []byte // complete messages, not read yet
+	lost uint64 // number of lost packets
+}
+
+// pgmTSI is the transport session identifier of a sender.
+type pgmTSI struct {
+	gsi   [6]byte
+	sport uint16
+}
+
+// pgmSource is the state of the stream of packets of a sender.
+type pgmSource struct {
+	sqn  uint32 // sequence number of the last packet
+	sync bool   // whether the start of a message was seen since the last loss
+	fr   pgmFramer
+}
+
+func newPGMConn(network string, ifi *net.Interface, group *net.UDPAddr, ttl int, send bool) (*pgmConn, error) {
+	var (
+		c   net.PacketConn
+		dst net.Addr
+		err error
+	)
+	switch network {
+	case "pgm":
+		c, err = net.ListenPacket("ip4:"+strconv.Itoa(pgmProtocol), "0.0.0.0")
+		dst = &net.IPAddr{IP: group.IP}
+	case "epgm":
+		laddr := "0.0.0.0:0"
+		if !send {
+			// concurrent receivers of the group are allowed.
+			laddr = group.String()
+		}
+		c, err = net.ListenPacket("udp4", laddr)
+		dst = group
+	default:
+		return nil, errors.Errorf("zmq4: unknown multicast protocol %q", network)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p := ipv4.NewPacketConn(c)
+	if send {
+		if ifi != nil {
+			err = p.SetMulticastInterface(ifi)
+		}
+		if err == nil {
+			err = p.SetMulticastTTL(ttl)
+		}
+		if err == nil {
+			err = p.SetMulticastLoopback(true)
+		}
+	} else {
+		err = p.JoinGroup(ifi, &net.UDPAddr{IP: group.IP})
+	}
+	if err != nil {
+		c.Close()
+		return nil, errors.Wrapf(err, "zmq4: could not join multicast group %v", group)
+	}
+
+	conn := &pgmConn{
+		c:     c,
+		group: dst,
+		port:  uint16(group.Port),
+		send:  send,
+		done:  make(chan struct{}),
+	}
+	if send {
+		var id [8]byte
+		if _, err := io.ReadFull(rand.Reader, id[:]); err != nil {
+			c.Close()
+			return nil, errors.Wrapf(err, "zmq4: could not generate PGM source identifier")
+		}
+		copy(conn.gsi[:], id[:6])
+		conn.sport = binary.BigEndian.Uint16(id[6:]) | 1
+		conn.out = make([]byte, 0, pgmHeaderLen+2+pgmMaxTSDU)
+	} else {
+		conn.srcs = make(map[pgmTSI]*pgmSource)
+		conn.buf = make([]byte, 64<<10)
+	}
+	return conn, nil
+}
+
+// Read reads the complete messages received from the group.
+// Connections sending to the group receive nothing.
+func (c *pgmConn) Read(p []byte) (int, error) {
+	if c.send {
+		<-c.done
+		return 0, io.EOF
+	}
+	for len(c.in) == 0 {
+		n, _, err := c.c.ReadFrom(c.buf)
+		if err != nil {
+			return 0, err
+		}
+		c.recv(c.buf[:n])
+	}
+	n := copy(p, c.in)
+	c.in = c.in[n:]
+	return n, nil
+}
+
+// recv handles the packet pkt, appending the messages it completes to c.in.
+func (c *pgmConn) recv(pkt []byte) {
+	if len(pkt) < pgmHeaderLen+2 {
+		return
+	}
+	switch pkt[4] {
+	case pgmODATA, pgmRDATA:
+	default:
+		return
+	}
+	if binary.BigEndian.Uint16(pkt[2:]) != c.port {
+		return
+	}
+	if binary.BigEndian.Uint16(pkt[6:]) != 0 && onesSum(pkt) != 0xffff {
+		return
+	}
+	tsdu := int(binary.BigEndian.Uint16(pkt[14:]))
+	if tsdu < 2 || pgmHeaderLen+tsdu > len(pkt) {
+		return
+	}
+
+	var tsi pgmTSI
+	copy(tsi.gsi[:], pkt[8:14])
+	tsi.sport = binary.BigEndian.Uint16(pkt[0:])
+	sqn := binary.BigEndian.Uint32(pkt[16:])
+	src, ok := c.srcs[tsi]
+	if !ok {
+		src = &pgmSource{sqn: sqn - 1}
+		c.srcs[tsi] = src
+	}
+	switch d := int32(sqn - src.sqn); {
+	case d <= 0:
+		// duplicate or late packet.
+		return
+	case d > 1:
+		// the messages of the lost packets can not be completed.
+		c.lost += uint64(d - 1)
+		src.fr.reset()
+		src.sync = false
+	}
+	src.sqn = sqn
+
+	off := binary.BigEndian.Uint16(pkt[pgmHeaderLen:])
+	data := pkt[pgmHeaderLen+2 : pgmHeaderLen+tsdu]
+	if !src.sync {
+		if off == pgmNoOffset || int(off) > len(data) {
+			// no message starts in this packet.
+			return
+		}
+		data = data[off:]
+		src.sync = true
+	}
+	src.fr.feed(data, func(msg []byte) error {
+		c.in = append(c.in, msg...)
+		return nil
+	})
+}
+
+// Write sends the frames written to it to the group, once they form a
+// complete message. Commands are not sent, and connections receiving
+// from the group discard what is written to them: subscriptions are
+// applied by the receivers.
+func (c *pgmConn) Write(p []byte) (int, error) {
+	if !c.send {
+		return len(p), nil
+	}
+	err := c.fr.feed(p, c.sendMsg)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// sendMsg sends the frames of a message in as many packets as needed.
+func (c *pgmConn) sendMsg(msg []byte) error {
+	off := uint16(0)
+	for len(msg) > 0 {
+		n := len(msg)
+		if n > pgmMaxTSDU {
+			n = pgmMaxTSDU
+		}
+		_, err := c.c.WriteTo(c.packet(msg[:n], off), c.group)
+		if err != nil {
+			return errors.Wrapf(err, "zmq4: could not send PGM packet")
+		}
+		msg = msg[n:]
+		off = pgmNoOffset
+	}
+	return nil
+}
+
+// packet returns the data packet carrying data, the next packet of the
+// sender. off is the offset of the first message starting in data.
+func (c *pgmConn) packet(data []byte, off uint16) []byte {
+	pkt := c.out[:pgmHeaderLen+2]
+	binary.BigEndian.PutUint16(pkt[0:], c.sport)
+	binary.BigEndian.PutUint16(pkt[2:], c.port)
+	pkt[4] = pgmODATA
+	pkt[5] = 0 // options
+	binary.BigEndian.PutUint16(pkt[6:], 0)
+	copy(pkt[8:14], c.gsi[:])
+	binary.BigEndian.PutUint16(pkt[14:], uint16(2+len(data)))
+	binary.BigEndian.PutUint32(pkt[16:], c.sqn)
+	binary.BigEndian.PutUint32(pkt[20:], c.sqn) // trailing edge: no repairs
+	binary.BigEndian.PutUint16(pkt[24:], off)
+	pkt = append(pkt, data...)
+
+	sum := ^onesSum(pkt)
+	if sum == 0 {
+		sum = 0xffff
+	}
+	binary.BigEndian.PutUint16(pkt[6:], sum)
+	c.sqn++
+	return pkt
+}
+
+// onesSum returns the 16-bit one's complement sum of b.
+func onesSum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return uint16(sum)
+}
+
+func (c *pgmConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return c.c.Close()
+}
+
+func (c *pgmConn) LocalAddr() net.Addr                { return c.c.LocalAddr() }
+func (c *pgmConn) RemoteAddr() net.Addr               { return c.group }
+func (c *pgmConn) SetDeadline(t time.Time) error      { return c.c.SetDeadline(t) }
+func (c *pgmConn) SetReadDeadline(t time.Time) error  { return c.c.SetReadDeadline(t) }
+func (c *pgmConn) SetWriteDeadline(t time.Time) error { return c.c.SetWriteDeadline(t) }
+
+// pgmFramer splits a stream of ZMTP frames into complete messages,
+// leaving commands out.
+type pgmFramer struct {
+	hdr  []byte // header of the current frame
+	body bool   // whether the header of the current frame is complete
+	size uint64 // size of the rest of the body of the current frame
+	msg  []byte // frames of the current message
+}
+
+// feed consumes p, calling fn with the frames of each message p completes.
+// The frames passed to fn are only valid until fn returns.
+func (f *pgmFramer) feed(p []byte, fn func(msg []byte) error) error {
+	for len(p) > 0 {
+		if !f.body {
+			f.hdr = append(f.hdr, p[0])
+			p = p[1:]
+			n := 2
+			if f.hdr[0]&isLongBitFlag != 0 {
+				n = 9
+			}
+			if len(f.hdr) < n {
+				continue
+			}
+			if n == 2 {
+				f.size = uint64(f.hdr[1])
+			} else {
+				f.size = binary.BigEndian.Uint64(f.hdr[1:])
+			}
+			f.body = true
+			if !f.command() {
+				f.msg = append(f.msg, f.hdr...)
+			}
+		}
+
+		n := uint64(len(p))
+		if n > f.size {
+			n = f.size
+		}
+		if !f.command() {
+			f.msg = append(f.msg, p[:n]...)
+		}
+		p = p[n:]
+		f.size -= n
+		if f.size > 0 {
+			continue
+		}
+
+		// the frame is complete.
+		flag := f.hdr[0]
+		f.hdr = f.hdr[:0]
+		f.body = false
+		if flag&(isCommandBitFlag|hasMoreBitFlag) == 0 {
+			err := fn(f.msg)
+			f.msg = f.msg[:0]
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// command returns whether the current frame is a command.
+func (f *pgmFramer) command() bool {
+	return f.hdr[0]&isCommandBitFlag != 0
+}
+
+// reset drops the current message.
+func (f *pgmFramer) reset() {
+	f.hdr = f.hdr[:0]
+	f.body = false
+	f.size = 0
+	f.msg = f.msg[:0]
+}
+
+var (
+	_ net.Conn = (*pgmConn)(nil)
+)
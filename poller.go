@@ -0,0 +1,187 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PollEvent is a set of conditions a Poller waits for on a socket.
+type PollEvent int
+
+const (
+	PollIn  PollEvent = 1 << iota // a message can be received without blocking
+	PollOut                       // a message can be sent: at least one peer is connected
+)
+
+// Polled describes the conditions met by a polled socket.
+type Polled struct {
+	Socket Socket
+	Events PollEvent
+}
+
+// Poller waits for conditions on several sockets at once, the way
+// zmq_poll does, e.g. to serve a ROUTER frontend and a DEALER backend
+// from a single goroutine.
+type Poller struct {
+	mu    sync.Mutex
+	items []pollItem
+	c     chan struct{} // signaled when a polled socket may have changed state
+}
+
+type pollItem struct {
+	s      Socket
+	sck    *socket
+	events PollEvent
+}
+
+// pollable is implemented by the sockets of this package.
+type pollable interface {
+	base() *socket
+}
+
+// NewPoller returns a new Poller, with no socket to poll.
+func NewPoller() *Poller {
+	return &Poller{c: make(chan struct{}, 1)}
+}
+
+// Add registers s to be polled for the given events.
+// Sockets not implemented by this package can not be polled.
+func (p *Poller) Add(s Socket, events PollEvent) error {
+	ps, ok := s.(pollable)
+	if !ok {
+		return errors.Wrapf(errInvalidSocket, "zmq4: can not poll %v socket", s.Type())
+	}
+	sck := ps.base()
+	sck.watchers.add(p.c)
+	if r, ok := sck.r.(*fqreader); ok {
+		r.watchers.add(p.c)
+	}
+
+	p.mu.Lock()
+	p.items = append(p.items, pollItem{s: s, sck: sck, events: events})
+	p.mu.Unlock()
+	return nil
+}
+
+// Remove unregisters s from the poller.
+func (p *Poller) Remove(s Socket) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, item := range p.items {
+		if item.s != s {
+			continue
+		}
+		item.sck.watchers.remove(p.c)
+		if r, ok := item.sck.r.(*fqreader); ok {
+			r.watchers.remove(p.c)
+		}
+		p.items = append(p.items[:i], p.items[i+1:]...)
+		return
+	}
+}
+
+// Wait blocks until at least one polled socket meets the conditions it was
+// registered for, and returns these sockets.
+// Wait returns no socket if none was ready within timeout.
+// A zero timeout checks the sockets without blocking, a negative timeout
+// waits forever.
+// Wait fails if a polled socket is closed.
+func (p *Poller) Wait(timeout time.Duration) ([]Polled, error) {
+	var deadline <-chan time.Time
+	if timeout >= 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		polled, err := p.poll()
+		if err != nil || len(polled) > 0 {
+			return polled, err
+		}
+		select {
+		case <-p.c:
+		case <-deadline:
+			return nil, nil
+		}
+	}
+}
+
+func (p *Poller) poll() ([]Polled, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var polled []Polled
+	for _, item := range p.items {
+		if err := item.sck.ctx.Err(); err != nil {
+			return nil, errors.Wrapf(err, "zmq4: could not poll %v socket", item.s.Type())
+		}
+		var events PollEvent
+		if item.events&PollIn != 0 && item.sck.readable() {
+			events |= PollIn
+		}
+		if item.events&PollOut != 0 && item.sck.writable() {
+			events |= PollOut
+		}
+		if events != 0 {
+			polled = append(polled, Polled{Socket: item.s, Events: events})
+		}
+	}
+	return polled, nil
+}
+
+// readable returns whether a message can be received without blocking.
+func (sck *socket) readable() bool {
+	r, ok := sck.r.(*fqreader)
+	return ok && r.pending() > 0
+}
+
+// writable returns whether a message can be sent to a connected peer.
+func (sck *socket) writable() bool {
+	if sck.w == nil || sck.typ == Sub {
+		return false
+	}
+	sck.mu.RLock()
+	defer sck.mu.RUnlock()
+	return len(sck.conns) > 0
+}
+
+// signals notifies a set of channels of state changes, without blocking.
+type signals struct {
+	mu sync.Mutex
+	cs []chan struct{}
+}
+
+func (s *signals) add(c chan struct{}) {
+	s.mu.Lock()
+	s.cs = append(s.cs, c)
+	s.mu.Unlock()
+}
+
+func (s *signals) remove(c chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.cs {
+		if s.cs[i] == c {
+			s.cs = append(s.cs[:i], s.cs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *signals) notify() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.cs {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -17,12 +17,34 @@ var (
 	errGreeting      = errors.New("zmq4: invalid greeting received")
 	errSecMech       = errors.New("zmq4: invalid security mechanism")
 	errBadSec        = errors.New("zmq4: invalid or unsupported security mechanism")
+	errSecRole       = errors.New("zmq4: peers announced the same security role")
 	ErrBadCmd        = errors.New("zmq4: invalid command name")
 	ErrBadFrame      = errors.New("zmq4: invalid frame")
 	errOverflow      = errors.New("zmq4: overflow")
 	errEmptyAppMDKey = errors.New("zmq4: empty application metadata key")
 	errDupAppMDKey   = errors.New("zmq4: duplicate application metadata key")
 	errBoolCnv       = errors.New("zmq4: invalid byte to bool conversion")
+	errZMTPVersion   = errors.New("zmq4: unsupported ZMTP version")
+	errRawFrame      = errors.New("zmq4: raw connections can not send messages frame by frame")
+
+	// ErrIncompatibleVersion is returned when a peer speaks a ZMTP version
+	// older than ZMTP 3.
+	ErrIncompatibleVersion = errors.New("zmq4: incompatible ZMTP version")
+
+	// ErrIncompatibleSocket is returned when a peer announces a socket
+	// type that can not be connected to the socket, e.g. a REP peer of
+	// a SUB socket.
+	ErrIncompatibleSocket = errors.New("zmq4: incompatible socket types")
+
+	// ErrMsgTooLarge is returned when a peer announces a frame or
+	// a multipart message larger than the maximum message size.
+	// The connection to the peer is closed. See WithMaxMsgSize.
+	ErrMsgTooLarge = errors.New("zmq4: message too large")
+
+	// ErrWouldBlock is returned by the operations of sockets that would
+	// have to wait to complete, when they were asked not to.
+	// See Socket.TrySend and Socket.TryRecv.
+	ErrWouldBlock = errors.New("zmq4: operation would block")
 )
 
 const (
@@ -44,6 +66,65 @@ var (
 	}
 )
 
+// Version returns the version of the ZMTP protocol spoken by this package.
+func Version() (major, minor, patch int) {
+	return int(majorVersion), int(minorVersion), 0
+}
+
+// ERROR command reasons.
+const (
+	reasonTooManyPeers = "too-many-peers"
+	reasonIncompatible = "incompatible-socket-type"
+)
+
+// errorReason returns the body of an ERROR command for the given reason.
+func errorReason(reason string) []byte {
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	return append([]byte{byte(len(reason))}, reason...)
+}
+
+// peerError returns the error reported by a peer through
+// the body of an ERROR command, as a *ZMTPError.
+// The reasons known to this package are also reported as their error:
+// errors.Cause returns ErrTooManyConnections for too-many-peers errors.
+func peerError(body []byte) error {
+	reason := string(body)
+	if len(body) > 0 && int(body[0]) == len(body)-1 {
+		reason = string(body[1:])
+	}
+	zerr := &ZMTPError{Cmd: CmdError, Reason: reason}
+	switch reason {
+	case reasonTooManyPeers:
+		return errors.WithStack(&zmtpCause{zerr, ErrTooManyConnections})
+	case reasonIncompatible:
+		return errors.WithStack(&zmtpCause{zerr, ErrIncompatibleSocket})
+	}
+	return errors.WithStack(zerr)
+}
+
+// ZMTP 2.0 greeting fields, as per:
+//  https://rfc.zeromq.org/spec:15/ZMTP/
+const (
+	zmtp2Revision uint8 = 0x01
+)
+
+// zmtp2SockTypes maps socket types to their ZMTP 2.0 greeting encoding.
+var zmtp2SockTypes = map[SocketType]byte{
+	Pair:   0x00,
+	Pub:    0x01,
+	Sub:    0x02,
+	Req:    0x03,
+	Rep:    0x04,
+	Dealer: 0x05,
+	Router: 0x06,
+	Pull:   0x07,
+	Push:   0x08,
+	XPub:   0x09,
+	XSub:   0x0a,
+}
+
 const (
 	maxUint   = ^uint(0)
 	maxInt    = int(maxUint >> 1)
@@ -90,32 +171,31 @@ type greeting struct {
 }
 
 func (g *greeting) read(r io.Reader) error {
+	// read the signature and the major version first: older peers only
+	// send the rest of their greeting once they have received ours.
 	var data [64]byte
-	_, err := io.ReadFull(r, data[:])
+	_, err := io.ReadFull(r, data[:11])
 	if err != nil {
 		return err
 	}
 
-	err = g.unmarshal(data[:])
-	if err != nil {
-		return err
-	}
-
-	if g.Sig.Header != sigHeader {
+	if data[0] != sigHeader || data[9] != sigFooter {
 		return errGreeting
 	}
 
-	if g.Sig.Footer != sigFooter {
-		return errGreeting
+	// version negotiation, as per
+	// https://rfc.zeromq.org/spec:23/ZMTP/#version-negotiation:
+	// peers speaking a newer version downgrade to ours.
+	if data[10] < majorVersion {
+		return ErrIncompatibleVersion
 	}
 
-	// FIXME(sbinet): handle version negotiations as per
-	// https://rfc.zeromq.org/spec:23/ZMTP/#version-negotiation
-	if g.Version != defaultVersion {
-		return errGreeting
+	_, err = io.ReadFull(r, data[11:])
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return g.unmarshal(data[:])
 }
 
 func (g *greeting) unmarshal(data []byte) error {
@@ -6,18 +6,23 @@ package zmq4
 
 import (
 	"context"
+	"io"
+	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
-	"golang.org/x/sync/errgroup"
 )
 
 // NewPub returns a new PUB ZeroMQ socket.
 // The returned socket value is initially unbound.
 func NewPub(ctx context.Context, opts ...Option) Socket {
 	pub := &pubSocket{sck: newSocket(ctx, Pub, opts...)}
-	pub.sck.w = newPubMWriter(pub.sck.ctx)
-	pub.sck.r = newPubQReader(pub.sck.ctx)
+	w := newPubMWriter(pub.sck.ctx)
+	w.welcome = pub.sck.welcome
+	pub.sck.w = w
+	pub.sck.r = newFQReaderHook(pub.sck.ctx, pubRecv)
 	return pub
 }
 
@@ -31,12 +36,24 @@ func (pub *pubSocket) Close() error {
 	return pub.sck.Close()
 }
 
-// Send puts the message on the outbound send queue.
-// Send blocks until the message can be queued or the send deadline expires.
+// Send puts the message on the outbound send queue of every matching
+// subscriber.
+// Send does not block on slow subscribers: the message is dropped for
+// subscribers whose queue is full.
 func (pub *pubSocket) Send(msg Msg) error {
-	ctx, cancel := context.WithTimeout(pub.sck.ctx, pub.sck.timeout())
+	return pub.SendContext(context.Background(), msg)
+}
+
+// SendContext is like Send but gives up on the message once ctx is done.
+func (pub *pubSocket) SendContext(ctx context.Context, msg Msg) error {
+	ctx, cancel := pub.sck.sendContext(ctx)
 	defer cancel()
-	return pub.sck.w.write(ctx, msg)
+	return pub.sck.closedErr(pub.sck.w.write(ctx, msg))
+}
+
+// SendBatch sends msgs, in order, one at a time.
+func (pub *pubSocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	return sendEach(ctx, pub.SendContext, msgs)
 }
 
 // Recv receives a complete message.
@@ -45,6 +62,13 @@ func (*pubSocket) Recv() (Msg, error) {
 	return msg, msg.err
 }
 
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (pub *pubSocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	msg, err := pub.Recv()
+	return msg, RecvMeta{}, err
+}
+
 // Listen connects a local endpoint to the Socket.
 func (pub *pubSocket) Listen(ep string) error {
 	return pub.sck.Listen(ep)
@@ -55,6 +79,21 @@ func (pub *pubSocket) Dial(ep string) error {
 	return pub.sck.Dial(ep)
 }
 
+// Unbind stops listening on a local endpoint.
+func (pub *pubSocket) Unbind(ep string) error {
+	return pub.sck.Unbind(ep)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (pub *pubSocket) Disconnect(ep string) error {
+	return pub.sck.Disconnect(ep)
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (pub *pubSocket) WaitConnected(ctx context.Context) error {
+	return pub.sck.WaitConnected(ctx)
+}
+
 // Type returns the type of this Socket (PUB, SUB, ...)
 func (pub *pubSocket) Type() SocketType {
 	return pub.sck.Type()
@@ -70,98 +109,20 @@ func (pub *pubSocket) SetOption(name string, value interface{}) error {
 	return pub.sck.SetOption(name, value)
 }
 
-// pubQReader is a queued-message reader.
-type pubQReader struct {
-	ctx context.Context
-
-	mu sync.RWMutex
-	rs []*msgReader
-	c  chan Msg
-
-	sem *semaphore // ready when a connection is live.
-}
-
-func newPubQReader(ctx context.Context) *pubQReader {
-	const qrsize = 10
-	return &pubQReader{
-		ctx: ctx,
-		c:   make(chan Msg, qrsize),
-		sem: newSemaphore(),
-	}
-}
-
-func (q *pubQReader) Close() error {
-	q.mu.RLock()
-	var err error
-	for _, r := range q.rs {
-		e := r.Close()
-		if e != nil && err == nil {
-			err = e
-		}
-	}
-	q.rs = nil
-	q.mu.RUnlock()
-	return err
-}
-
-func (q *pubQReader) addConn(r *msgReader) {
-	go q.listen(q.ctx, r)
-	q.mu.Lock()
-	q.sem.enable()
-	q.rs = append(q.rs, r)
-	q.mu.Unlock()
-}
-
-func (q *pubQReader) rmConn(r *msgReader) {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-
-	cur := -1
-	for i := range q.rs {
-		if q.rs[i] == r {
-			cur = i
-			break
-		}
-	}
-	if cur >= 0 {
-		q.rs = append(q.rs[:cur], q.rs[cur+1:]...)
-	}
-}
-
-func (q *pubQReader) read(ctx context.Context, msg *Msg) error {
-	q.sem.lock()
-	select {
-	case <-ctx.Done():
-	case *msg = <-q.c:
+// pubRecv handles the subscription messages received by a PUB.
+func pubRecv(r *msgReader, msg *Msg) bool {
+	if msg.err != nil {
+		return false
 	}
-	return msg.err
-}
-
-func (q *pubQReader) listen(ctx context.Context, r *msgReader) {
-	defer q.rmConn(r)
-	defer r.Close()
-
-	for {
-		var msg Msg
-		err := r.read(ctx, &msg)
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			if err != nil {
-				return
-			}
-			switch {
-			case q.topic(msg):
-				r.r.subscribe(msg)
-			default:
-				q.c <- msg
-			}
-		}
+	if isTopic(*msg) {
+		r.r.subscribe(*msg)
+		return false
 	}
+	return true
 }
 
-func (q *pubQReader) topic(msg Msg) bool {
+// isTopic returns whether msg is a subscription message.
+func isTopic(msg Msg) bool {
 	if len(msg.Frames) != 1 {
 		return false
 	}
@@ -173,36 +134,97 @@ func (q *pubQReader) topic(msg Msg) bool {
 	return topic == 0 || topic == 1
 }
 
+// pubMWriter is the message writer of a PUB socket.
+// Each subscriber has its own bounded queue, serviced by a dedicated
+// goroutine, so a slow subscriber does not stall the others: messages
+// for a subscriber whose queue is full are dropped for that subscriber.
 type pubMWriter struct {
+	dropped uint64 // number of messages dropped for slow subscribers.
+
 	ctx context.Context
 	mu  sync.Mutex
-	ws  []*msgWriter
+	qs  []*pubQueue
+	hwm int       // capacity of the per-subscriber queues.
+	q   *inflight // messages queued and not yet written.
+	wg  sync.WaitGroup
+
+	// match reports whether a message is sent to a subscriber.
+	match func(c *Conn, msg Msg) bool
+
+	welcome *Msg // optional message queued first for each subscriber.
+	lazy    bool // whether the welcome message waits for a first subscription.
+}
+
+// pubQueue is the outbound queue of a single subscriber.
+type pubQueue struct {
+	w        *msgWriter
+	c        chan Msg // closed when the subscriber is removed.
+	welcomed bool     // whether the welcome message was queued.
 }
 
 func newPubMWriter(ctx context.Context) *pubMWriter {
+	return newPubMWriterMatch(ctx, pubMatch)
+}
+
+// newPubMWriterMatch returns a writer sending messages to the subscribers
+// for which match returns true.
+func newPubMWriterMatch(ctx context.Context, match func(c *Conn, msg Msg) bool) *pubMWriter {
 	return &pubMWriter{
-		ctx: ctx,
+		ctx:   ctx,
+		hwm:   defaultHWM,
+		q:     newInflight(),
+		match: match,
+	}
+}
+
+// pubMatch reports whether the subscriber c subscribed to the topic,
+// the first frame, of msg.
+func pubMatch(c *Conn, msg Msg) bool {
+	var topic string
+	if len(msg.Frames) > 0 {
+		topic = string(msg.Frames[0])
 	}
+	return c.subscribed(topic)
+}
+
+// setHWM sets the capacity of the queues of subscribers added from now on.
+func (mw *pubMWriter) setHWM(n int) {
+	mw.mu.Lock()
+	mw.hwm = n
+	mw.mu.Unlock()
 }
 
 func (w *pubMWriter) Close() error {
 	w.mu.Lock()
+	qs := w.qs
+	w.qs = nil
+	for _, q := range qs {
+		close(q.c)
+	}
+	w.mu.Unlock()
+
 	var err error
-	for _, ww := range w.ws {
-		e := ww.Close()
+	for _, q := range qs {
+		e := q.w.Close()
 		if e != nil && err == nil {
 			err = e
 		}
 	}
-	w.ws = nil
-	w.mu.Unlock()
+	w.wg.Wait()
 	return err
 }
 
 func (mw *pubMWriter) addConn(w *msgWriter) {
 	mw.mu.Lock()
-	mw.ws = append(mw.ws, w)
+	q := &pubQueue{w: w, c: make(chan Msg, mw.hwm)}
+	if !mw.lazy || len(w.w.subscriptions()) > 0 {
+		mw.greet(q)
+	}
+	mw.qs = append(mw.qs, q)
 	mw.mu.Unlock()
+
+	mw.wg.Add(1)
+	go mw.listen(q)
 }
 
 func (mw *pubMWriter) rmConn(w *msgWriter) {
@@ -210,37 +232,244 @@ func (mw *pubMWriter) rmConn(w *msgWriter) {
 	defer mw.mu.Unlock()
 
 	cur := -1
-	for i := range mw.ws {
-		if mw.ws[i] == w {
+	for i := range mw.qs {
+		if mw.qs[i].w == w {
 			cur = i
 			break
 		}
 	}
 	if cur >= 0 {
-		mw.ws = append(mw.ws[:cur], mw.ws[cur+1:]...)
+		close(mw.qs[cur].c)
+		mw.qs = append(mw.qs[:cur], mw.qs[cur+1:]...)
+	}
+}
+
+// flush blocks until the messages queued for the subscribers are written
+// or ctx is done.
+func (mw *pubMWriter) flush(ctx context.Context) error {
+	return mw.q.wait(ctx)
+}
+
+// subscribe records the subscription msg of the subscriber c.
+// The welcome message is queued for c ahead of the messages of its first
+// subscription.
+func (mw *pubMWriter) subscribe(c *Conn, msg Msg) {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	if msg.Frames[0][0] == 1 {
+		for _, q := range mw.qs {
+			if q.w.w == c {
+				mw.greet(q)
+			}
+		}
+	}
+	c.subscribe(msg)
+}
+
+// greet queues the welcome message, if any, for the subscriber of q,
+// once per subscriber.
+func (mw *pubMWriter) greet(q *pubQueue) {
+	if mw.welcome == nil || q.welcomed {
+		return
+	}
+	q.welcomed = true
+	mw.q.add()
+	select {
+	case q.c <- *mw.welcome:
+	default:
+		mw.q.done()
+		atomic.AddUint64(&mw.dropped, 1)
+		q.w.dropped()
+		logf(q.w.log, LevelWarn, "zmq4: dropped welcome message for slow subscriber on %q", q.w.ep)
+	}
+}
+
+// listen sends the messages queued for a subscriber, in order.
+func (mw *pubMWriter) listen(q *pubQueue) {
+	defer mw.wg.Done()
+	for {
+		select {
+		case <-mw.ctx.Done():
+			return
+		case msg, ok := <-q.c:
+			if !ok {
+				return
+			}
+			err := q.w.write(mw.ctx, msg)
+			mw.q.done()
+			if err != nil {
+				logf(q.w.log, LevelWarn, "zmq4: could not write to %q: %+v", q.w.ep, err)
+				q.w.Close()
+				// closing the connection closed q.c: drop the messages
+				// still queued for the subscriber.
+				for range q.c {
+					mw.q.done()
+				}
+				return
+			}
+		}
 	}
 }
 
 func (w *pubMWriter) write(ctx context.Context, msg Msg) error {
-	grp, ctx := errgroup.WithContext(ctx)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
 	w.mu.Lock()
-	topic := string(msg.Frames[0])
-	for i := range w.ws {
-		ww := w.ws[i]
-		grp.Go(func() error {
-			if !ww.w.subscribed(topic) {
-				return nil
-			}
-			return ww.write(ctx, msg)
-		})
+	for _, q := range w.qs {
+		if !w.match(q.w.w, msg) {
+			continue
+		}
+		w.q.add()
+		select {
+		case q.c <- msg:
+		default:
+			w.q.done()
+			atomic.AddUint64(&w.dropped, 1)
+			q.w.dropped()
+			logf(q.w.log, LevelWarn, "zmq4: dropped message for slow subscriber on %q", q.w.ep)
+		}
 	}
-	err := grp.Wait()
 	w.mu.Unlock()
-	return err
+	return nil
+}
+
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+func (pub *pubSocket) ConnMetadata(peer string) map[string]string {
+	return pub.sck.ConnMetadata(peer)
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (pub *pubSocket) Monitor() <-chan Event {
+	return pub.sck.Monitor()
+}
+
+// Addr returns the address the Socket is listening on, or nil if
+// the Socket is not listening.
+func (pub *pubSocket) Addr() net.Addr {
+	return pub.sck.Addr()
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (pub *pubSocket) BoundEndpoints() []string {
+	return pub.sck.BoundEndpoints()
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (pub *pubSocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	return pub.sck.ConnHandshake(peer)
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (pub *pubSocket) PeerConn(peer string) (net.Conn, error) {
+	return pub.sck.PeerConn(peer)
+}
+
+// Peers returns the peers connected to the Socket, in the order they
+// connected.
+func (pub *pubSocket) Peers() []PeerInfo {
+	return pub.sck.Peers()
+}
+
+// SendFrame sends a single frame of a message.
+// More frames of the same message follow when more is true.
+func (pub *pubSocket) SendFrame(frame []byte, more bool) error {
+	return pub.sck.SendFrame(frame, more)
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (pub *pubSocket) RecvFrame() ([]byte, bool, error) {
+	return pub.sck.recvFrame(pub.Recv)
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+func (pub *pubSocket) SendFrames(rd io.Reader, size int64) error {
+	return pub.sck.SendFrames(rd, size)
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (pub *pubSocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	return pub.sck.recvFrameTo(pub.Recv, w)
+}
+
+// RecvContext receives a complete message.
+func (pub *pubSocket) RecvContext(ctx context.Context) (Msg, error) {
+	return pub.Recv()
+}
+
+// TrySend sends msg if it can be done without waiting.
+func (pub *pubSocket) TrySend(msg Msg) (bool, error) {
+	return trySend(pub.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (pub *pubSocket) TryRecv() (Msg, bool, error) {
+	return tryRecv(pub.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (pub *pubSocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, pub.TryRecv, pub.RecvContext)
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (pub *pubSocket) SetSendDeadline(t time.Time) {
+	pub.sck.SetSendDeadline(t)
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (pub *pubSocket) SetRecvDeadline(t time.Time) {
+	pub.sck.SetRecvDeadline(t)
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+func (pub *pubSocket) RotateSecurity(sec Security) {
+	pub.sck.RotateSecurity(sec)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (pub *pubSocket) CloseIdle(maxIdle time.Duration) int {
+	return pub.sck.CloseIdle(maxIdle)
+}
+
+// Stats returns the activity of the Socket.
+func (pub *pubSocket) Stats() Stats {
+	return pub.sck.Stats()
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to,
+// in the order they were dialed.
+func (pub *pubSocket) DialEndpoints() []string {
+	return pub.sck.DialEndpoints()
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (pub *pubSocket) Config() ConfigSnapshot {
+	return pub.sck.Config()
+}
+
+// base returns the socket implementing the core of the Socket.
+func (pub *pubSocket) base() *socket {
+	return pub.sck
 }
 
 var (
-	_ rpool  = (*pubQReader)(nil)
-	_ wpool  = (*pubMWriter)(nil)
-	_ Socket = (*pubSocket)(nil)
+	_ wpool   = (*pubMWriter)(nil)
+	_ flusher = (*pubMWriter)(nil)
+	_ Socket  = (*pubSocket)(nil)
 )
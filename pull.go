@@ -6,6 +6,9 @@ package zmq4
 
 import (
 	"context"
+	"io"
+	"net"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -14,6 +17,7 @@ import (
 // The returned socket value is initially unbound.
 func NewPull(ctx context.Context, opts ...Option) Socket {
 	pull := &pullSocket{newSocket(ctx, Pull, opts...)}
+	pull.sck.r = newFQReader(pull.sck.ctx)
 	pull.sck.w = nil
 	return pull
 }
@@ -39,6 +43,12 @@ func (pull *pullSocket) Recv() (Msg, error) {
 	return pull.sck.Recv()
 }
 
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (pull *pullSocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	return pull.sck.RecvWithMeta()
+}
+
 // Listen connects a local endpoint to the Socket.
 func (pull *pullSocket) Listen(ep string) error {
 	return pull.sck.Listen(ep)
@@ -49,6 +59,21 @@ func (pull *pullSocket) Dial(ep string) error {
 	return pull.sck.Dial(ep)
 }
 
+// Unbind stops listening on a local endpoint.
+func (pull *pullSocket) Unbind(ep string) error {
+	return pull.sck.Unbind(ep)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (pull *pullSocket) Disconnect(ep string) error {
+	return pull.sck.Disconnect(ep)
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (pull *pullSocket) WaitConnected(ctx context.Context) error {
+	return pull.sck.WaitConnected(ctx)
+}
+
 // Type returns the type of this Socket (PUB, SUB, ...)
 func (pull *pullSocket) Type() SocketType {
 	return pull.sck.Type()
@@ -64,6 +89,149 @@ func (pull *pullSocket) SetOption(name string, value interface{}) error {
 	return pull.sck.SetOption(name, value)
 }
 
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+func (pull *pullSocket) ConnMetadata(peer string) map[string]string {
+	return pull.sck.ConnMetadata(peer)
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (pull *pullSocket) Monitor() <-chan Event {
+	return pull.sck.Monitor()
+}
+
+// Addr returns the address the Socket is listening on, or nil if
+// the Socket is not listening.
+func (pull *pullSocket) Addr() net.Addr {
+	return pull.sck.Addr()
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (pull *pullSocket) BoundEndpoints() []string {
+	return pull.sck.BoundEndpoints()
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (pull *pullSocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	return pull.sck.ConnHandshake(peer)
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (pull *pullSocket) PeerConn(peer string) (net.Conn, error) {
+	return pull.sck.PeerConn(peer)
+}
+
+// Peers returns the peers connected to the Socket, in the order they
+// connected.
+func (pull *pullSocket) Peers() []PeerInfo {
+	return pull.sck.Peers()
+}
+
+// SendFrame sends a single frame of a message.
+// More frames of the same message follow when more is true.
+func (pull *pullSocket) SendFrame(frame []byte, more bool) error {
+	return pull.sck.SendFrame(frame, more)
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (pull *pullSocket) RecvFrame() ([]byte, bool, error) {
+	return pull.sck.recvFrame(pull.Recv)
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+func (pull *pullSocket) SendFrames(rd io.Reader, size int64) error {
+	return pull.sck.SendFrames(rd, size)
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (pull *pullSocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	return pull.sck.RecvFrameTo(w)
+}
+
+// RecvContext receives a complete message.
+// RecvContext returns ctx.Err() without consuming a message if ctx is done
+// first.
+func (pull *pullSocket) RecvContext(ctx context.Context) (Msg, error) {
+	return pull.sck.RecvContext(ctx)
+}
+
+// TrySend sends msg if it can be done without waiting.
+func (pull *pullSocket) TrySend(msg Msg) (bool, error) {
+	return trySend(pull.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (pull *pullSocket) TryRecv() (Msg, bool, error) {
+	return tryRecv(pull.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (pull *pullSocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, pull.TryRecv, pull.RecvContext)
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (pull *pullSocket) SetSendDeadline(t time.Time) {
+	pull.sck.SetSendDeadline(t)
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (pull *pullSocket) SetRecvDeadline(t time.Time) {
+	pull.sck.SetRecvDeadline(t)
+}
+
+// SendContext puts the message on the outbound send queue.
+func (pull *pullSocket) SendContext(ctx context.Context, msg Msg) error {
+	return pull.Send(msg)
+}
+
+// SendBatch sends msgs, in order, one at a time.
+func (pull *pullSocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	return sendEach(ctx, pull.SendContext, msgs)
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+func (pull *pullSocket) RotateSecurity(sec Security) {
+	pull.sck.RotateSecurity(sec)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (pull *pullSocket) CloseIdle(maxIdle time.Duration) int {
+	return pull.sck.CloseIdle(maxIdle)
+}
+
+// Stats returns the activity of the Socket.
+func (pull *pullSocket) Stats() Stats {
+	return pull.sck.Stats()
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to,
+// in the order they were dialed.
+func (pull *pullSocket) DialEndpoints() []string {
+	return pull.sck.DialEndpoints()
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (pull *pullSocket) Config() ConfigSnapshot {
+	return pull.sck.Config()
+}
+
+// base returns the socket implementing the core of the Socket.
+func (pull *pullSocket) base() *socket {
+	return pull.sck
+}
+
 var (
 	_ Socket = (*pullSocket)(nil)
 )
@@ -6,6 +6,9 @@ package zmq4
 
 import (
 	"context"
+	"io"
+	"net"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -14,6 +17,7 @@ import (
 // The returned socket value is initially unbound.
 func NewPush(ctx context.Context, opts ...Option) Socket {
 	push := &pushSocket{newSocket(ctx, Push, opts...)}
+	push.sck.w = newLBWriter(push.sck.ctx)
 	push.sck.r = nil
 	return push
 }
@@ -39,6 +43,13 @@ func (*pushSocket) Recv() (Msg, error) {
 	return Msg{}, errors.Errorf("zmq4: PUSH sockets can't recv messages")
 }
 
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (push *pushSocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	msg, err := push.Recv()
+	return msg, RecvMeta{}, err
+}
+
 // Listen connects a local endpoint to the Socket.
 func (push *pushSocket) Listen(ep string) error {
 	return push.sck.Listen(ep)
@@ -49,6 +60,21 @@ func (push *pushSocket) Dial(ep string) error {
 	return push.sck.Dial(ep)
 }
 
+// Unbind stops listening on a local endpoint.
+func (push *pushSocket) Unbind(ep string) error {
+	return push.sck.Unbind(ep)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (push *pushSocket) Disconnect(ep string) error {
+	return push.sck.Disconnect(ep)
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (push *pushSocket) WaitConnected(ctx context.Context) error {
+	return push.sck.WaitConnected(ctx)
+}
+
 // Type returns the type of this Socket (PUB, SUB, ...)
 func (push *pushSocket) Type() SocketType {
 	return push.sck.Type()
@@ -64,6 +90,149 @@ func (push *pushSocket) SetOption(name string, value interface{}) error {
 	return push.sck.SetOption(name, value)
 }
 
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+func (push *pushSocket) ConnMetadata(peer string) map[string]string {
+	return push.sck.ConnMetadata(peer)
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (push *pushSocket) Monitor() <-chan Event {
+	return push.sck.Monitor()
+}
+
+// Addr returns the address the Socket is listening on, or nil if
+// the Socket is not listening.
+func (push *pushSocket) Addr() net.Addr {
+	return push.sck.Addr()
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (push *pushSocket) BoundEndpoints() []string {
+	return push.sck.BoundEndpoints()
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (push *pushSocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	return push.sck.ConnHandshake(peer)
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (push *pushSocket) PeerConn(peer string) (net.Conn, error) {
+	return push.sck.PeerConn(peer)
+}
+
+// Peers returns the peers connected to the Socket, in the order they
+// connected.
+func (push *pushSocket) Peers() []PeerInfo {
+	return push.sck.Peers()
+}
+
+// SendFrame sends a single frame of a message.
+// More frames of the same message follow when more is true.
+func (push *pushSocket) SendFrame(frame []byte, more bool) error {
+	return push.sck.SendFrame(frame, more)
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (push *pushSocket) RecvFrame() ([]byte, bool, error) {
+	return push.sck.recvFrame(push.Recv)
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+func (push *pushSocket) SendFrames(rd io.Reader, size int64) error {
+	return push.sck.SendFrames(rd, size)
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (push *pushSocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	return push.sck.recvFrameTo(push.Recv, w)
+}
+
+// RecvContext receives a complete message.
+func (push *pushSocket) RecvContext(ctx context.Context) (Msg, error) {
+	return push.Recv()
+}
+
+// TrySend sends msg if it can be done without waiting.
+func (push *pushSocket) TrySend(msg Msg) (bool, error) {
+	return trySend(push.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (push *pushSocket) TryRecv() (Msg, bool, error) {
+	return tryRecv(push.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (push *pushSocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, push.TryRecv, push.RecvContext)
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (push *pushSocket) SetSendDeadline(t time.Time) {
+	push.sck.SetSendDeadline(t)
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (push *pushSocket) SetRecvDeadline(t time.Time) {
+	push.sck.SetRecvDeadline(t)
+}
+
+// SendContext puts the message on the outbound send queue.
+// SendContext blocks until the message can be queued, the send deadline
+// expires or ctx is done.
+func (push *pushSocket) SendContext(ctx context.Context, msg Msg) error {
+	return push.sck.SendContext(ctx, msg)
+}
+
+// SendBatch sends msgs, in order, in as few writes as possible.
+func (push *pushSocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	return push.sck.SendBatch(ctx, msgs)
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+func (push *pushSocket) RotateSecurity(sec Security) {
+	push.sck.RotateSecurity(sec)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (push *pushSocket) CloseIdle(maxIdle time.Duration) int {
+	return push.sck.CloseIdle(maxIdle)
+}
+
+// Stats returns the activity of the Socket.
+func (push *pushSocket) Stats() Stats {
+	return push.sck.Stats()
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to,
+// in the order they were dialed.
+func (push *pushSocket) DialEndpoints() []string {
+	return push.sck.DialEndpoints()
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (push *pushSocket) Config() ConfigSnapshot {
+	return push.sck.Config()
+}
+
+// base returns the socket implementing the core of the Socket.
+func (push *pushSocket) base() *socket {
+	return push.sck
+}
+
 var (
 	_ Socket = (*pushSocket)(nil)
 )
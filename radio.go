@@ -0,0 +1,302 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build zmq4_draft
+// +build zmq4_draft
+
+package zmq4
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NewRadio returns a new RADIO ZeroMQ socket.
+// RADIO sockets send each message to the DISH peers that joined the group
+// of the message, given by Msg.Group.
+// The returned socket value is initially unbound.
+func NewRadio(ctx context.Context, opts ...Option) Socket {
+	radio := &radioSocket{
+		sck:    newSocket(ctx, Radio, opts...),
+		groups: make(map[*Conn]map[string]struct{}),
+	}
+	radio.sck.w = newPubMWriterMatch(radio.sck.ctx, radio.match)
+	radio.sck.r = newFQReaderHook(radio.sck.ctx, radio.recv)
+	return radio
+}
+
+// radioSocket is a RADIO ZeroMQ socket.
+type radioSocket struct {
+	sck *socket
+
+	mu     sync.RWMutex
+	groups map[*Conn]map[string]struct{} // groups joined by each peer
+}
+
+// Close closes the open Socket
+func (radio *radioSocket) Close() error {
+	return radio.sck.Close()
+}
+
+// Send puts the message on the outbound send queue of every peer that
+// joined the group of the message.
+// Messages are made of a single frame.
+// Send does not block on slow peers: the message is dropped for peers
+// whose queue is full.
+func (radio *radioSocket) Send(msg Msg) error {
+	return radio.SendContext(context.Background(), msg)
+}
+
+// Recv receives a complete message.
+func (*radioSocket) Recv() (Msg, error) {
+	return Msg{}, errors.Errorf("zmq4: RADIO sockets can't recv messages")
+}
+
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (radio *radioSocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	msg, err := radio.Recv()
+	return msg, RecvMeta{}, err
+}
+
+// Listen connects a local endpoint to the Socket.
+func (radio *radioSocket) Listen(ep string) error {
+	return radio.sck.Listen(ep)
+}
+
+// Dial connects a remote endpoint to the Socket.
+func (radio *radioSocket) Dial(ep string) error {
+	return radio.sck.Dial(ep)
+}
+
+// Unbind stops listening on a local endpoint.
+func (radio *radioSocket) Unbind(ep string) error {
+	return radio.sck.Unbind(ep)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (radio *radioSocket) Disconnect(ep string) error {
+	return radio.sck.Disconnect(ep)
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (radio *radioSocket) WaitConnected(ctx context.Context) error {
+	return radio.sck.WaitConnected(ctx)
+}
+
+// Type returns the type of this Socket (PUB, SUB, ...)
+func (radio *radioSocket) Type() SocketType {
+	return radio.sck.Type()
+}
+
+// GetOption is used to retrieve an option for a socket.
+func (radio *radioSocket) GetOption(name string) (interface{}, error) {
+	return radio.sck.GetOption(name)
+}
+
+// SetOption is used to set an option for a socket.
+func (radio *radioSocket) SetOption(name string, value interface{}) error {
+	return radio.sck.SetOption(name, value)
+}
+
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+func (radio *radioSocket) ConnMetadata(peer string) map[string]string {
+	return radio.sck.ConnMetadata(peer)
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (radio *radioSocket) Monitor() <-chan Event {
+	return radio.sck.Monitor()
+}
+
+// Addr returns the address the Socket is listening on, or nil if
+// the Socket is not listening.
+func (radio *radioSocket) Addr() net.Addr {
+	return radio.sck.Addr()
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (radio *radioSocket) BoundEndpoints() []string {
+	return radio.sck.BoundEndpoints()
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (radio *radioSocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	return radio.sck.ConnHandshake(peer)
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (radio *radioSocket) PeerConn(peer string) (net.Conn, error) {
+	return radio.sck.PeerConn(peer)
+}
+
+// Peers returns the peers connected to the Socket, in the order they
+// connected.
+func (radio *radioSocket) Peers() []PeerInfo {
+	return radio.sck.Peers()
+}
+
+// SendFrame sends a single frame of a message.
+// More frames of the same message follow when more is true.
+func (radio *radioSocket) SendFrame(frame []byte, more bool) error {
+	return radio.sck.SendFrame(frame, more)
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (radio *radioSocket) RecvFrame() ([]byte, bool, error) {
+	return radio.sck.recvFrame(radio.Recv)
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+func (radio *radioSocket) SendFrames(rd io.Reader, size int64) error {
+	return radio.sck.SendFrames(rd, size)
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (radio *radioSocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	return radio.sck.recvFrameTo(radio.Recv, w)
+}
+
+// RecvContext receives a complete message.
+func (radio *radioSocket) RecvContext(ctx context.Context) (Msg, error) {
+	return radio.Recv()
+}
+
+// TrySend sends msg if it can be done without waiting.
+func (radio *radioSocket) TrySend(msg Msg) (bool, error) {
+	return trySend(radio.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (radio *radioSocket) TryRecv() (Msg, bool, error) {
+	return tryRecv(radio.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (radio *radioSocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, radio.TryRecv, radio.RecvContext)
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (radio *radioSocket) SetSendDeadline(t time.Time) {
+	radio.sck.SetSendDeadline(t)
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (radio *radioSocket) SetRecvDeadline(t time.Time) {
+	radio.sck.SetRecvDeadline(t)
+}
+
+// SendContext puts the message on the outbound send queue.
+// SendContext blocks until the message can be queued, the send deadline
+// expires or ctx is done.
+func (radio *radioSocket) SendContext(ctx context.Context, msg Msg) error {
+	if len(msg.Frames) != 1 {
+		return errMultipart(Radio)
+	}
+	if err := validGroup(msg.Group); err != nil {
+		return err
+	}
+	// the group is sent as a first frame.
+	return radio.sck.SendContext(ctx, NewMsgFrom([]byte(msg.Group), msg.Frames[0]))
+}
+
+// SendBatch sends msgs, in order, one at a time.
+func (radio *radioSocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	return sendEach(ctx, radio.SendContext, msgs)
+}
+
+// match reports whether the peer c joined the group of msg.
+func (radio *radioSocket) match(c *Conn, msg Msg) bool {
+	radio.mu.RLock()
+	defer radio.mu.RUnlock()
+	_, ok := radio.groups[c][string(msg.Frames[0])]
+	return ok
+}
+
+// recv records the groups joined and left by the peers.
+// Messages sent by the peers are not delivered: RADIO sockets can not
+// receive messages.
+func (radio *radioSocket) recv(r *msgReader, msg *Msg) bool {
+	if msg.err != nil {
+		radio.mu.Lock()
+		delete(radio.groups, r.r)
+		radio.mu.Unlock()
+		return false
+	}
+	if !msg.isCmd() || len(msg.Frames) != 1 {
+		return false
+	}
+	var cmd Cmd
+	if err := cmd.unmarshalZMTP(msg.Frames[0]); err != nil {
+		return false
+	}
+
+	radio.mu.Lock()
+	defer radio.mu.Unlock()
+	switch cmd.Name {
+	case CmdJoin:
+		groups := radio.groups[r.r]
+		if groups == nil {
+			groups = make(map[string]struct{})
+			radio.groups[r.r] = groups
+		}
+		groups[string(cmd.Body)] = struct{}{}
+	case CmdLeave:
+		delete(radio.groups[r.r], string(cmd.Body))
+	}
+	return false
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+func (radio *radioSocket) RotateSecurity(sec Security) {
+	radio.sck.RotateSecurity(sec)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (radio *radioSocket) CloseIdle(maxIdle time.Duration) int {
+	return radio.sck.CloseIdle(maxIdle)
+}
+
+// Stats returns the activity of the Socket.
+func (radio *radioSocket) Stats() Stats {
+	return radio.sck.Stats()
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to,
+// in the order they were dialed.
+func (radio *radioSocket) DialEndpoints() []string {
+	return radio.sck.DialEndpoints()
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (radio *radioSocket) Config() ConfigSnapshot {
+	return radio.sck.Config()
+}
+
+// base returns the socket implementing the core of the Socket.
+func (radio *radioSocket) base() *socket {
+	return radio.sck
+}
+
+var (
+	_ Socket = (*radioSocket)(nil)
+)
@@ -6,18 +6,37 @@ package zmq4
 
 import (
 	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
+var errRepNoRequest = errors.New("zmq4: REP socket has no pending request to reply to")
+
 // NewRep returns a new REP ZeroMQ socket.
 // The returned socket value is initially unbound.
 func NewRep(ctx context.Context, opts ...Option) Socket {
-	rep := &repSocket{newSocket(ctx, Rep, opts...)}
+	rep := &repSocket{sck: newSocket(ctx, Rep, opts...)}
+	rep.sck.r = newFQReaderHook(rep.sck.ctx, repRecv)
+	rep.sck.w = newRouterMWriter(rep.sck.ctx)
 	return rep
 }
 
 // repSocket is a REP ZeroMQ socket.
+//
+// Requests are received with the identity of the requesting peer
+// prepended, followed by the envelope of the request: all the frames up
+// to and including the empty delimiter frame.
+// The identity and the envelope are stripped by Recv and restored by
+// Send, so the reply is routed back to the requesting peer.
 type repSocket struct {
 	sck *socket
+
+	mu  sync.Mutex
+	env [][]byte // identity and envelope of the pending request.
 }
 
 // Close closes the open Socket
@@ -28,19 +47,129 @@ func (rep *repSocket) Close() error {
 // Send puts the message on the outbound send queue.
 // Send blocks until the message can be queued or the send deadline expires.
 func (rep *repSocket) Send(msg Msg) error {
-	msg.Frames = append([][]byte{nil}, msg.Frames...)
-	return rep.sck.Send(msg)
+	return rep.SendContext(context.Background(), msg)
+}
+
+// SendContext puts the message on the outbound send queue.
+// SendContext blocks until the message can be queued, the send deadline
+// expires or ctx is done.
+// The pending request can be replied to again if the reply was not sent.
+func (rep *repSocket) SendContext(ctx context.Context, msg Msg) error {
+	rep.mu.Lock()
+	env := rep.env
+	rep.env = nil
+	rep.mu.Unlock()
+	if env == nil {
+		return errRepNoRequest
+	}
+
+	frames := make([][]byte, 0, len(env)+len(msg.Frames))
+	frames = append(frames, env...)
+	msg.Frames = append(frames, msg.Frames...)
+	err := rep.sck.SendContext(ctx, msg)
+	if err != nil {
+		rep.mu.Lock()
+		if rep.env == nil {
+			rep.env = env
+		}
+		rep.mu.Unlock()
+	}
+	return err
+}
+
+// SendBatch sends msgs, in order, one at a time.
+func (rep *repSocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	return sendEach(ctx, rep.SendContext, msgs)
 }
 
 // Recv receives a complete message.
 func (rep *repSocket) Recv() (Msg, error) {
-	msg, err := rep.sck.Recv()
-	if len(msg.Frames) > 1 {
-		msg.Frames = msg.Frames[1:]
+	return rep.RecvContext(context.Background())
+}
+
+// RecvContext receives a complete message.
+// RecvContext returns ctx.Err() without consuming a message if ctx is done
+// first.
+func (rep *repSocket) RecvContext(ctx context.Context) (Msg, error) {
+	msg, err := rep.sck.RecvContext(ctx)
+	if err == nil {
+		rep.open(&msg)
 	}
 	return msg, err
 }
 
+// TrySend sends msg if it can be done without waiting.
+func (rep *repSocket) TrySend(msg Msg) (bool, error) {
+	return trySend(rep.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (rep *repSocket) TryRecv() (Msg, bool, error) {
+	return tryRecv(rep.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (rep *repSocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, rep.TryRecv, rep.RecvContext)
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (rep *repSocket) SetSendDeadline(t time.Time) {
+	rep.sck.SetSendDeadline(t)
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (rep *repSocket) SetRecvDeadline(t time.Time) {
+	rep.sck.SetRecvDeadline(t)
+}
+
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (rep *repSocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	msg, meta, err := rep.sck.RecvWithMeta()
+	if err == nil {
+		rep.open(&msg)
+	}
+	return msg, meta, err
+}
+
+// open strips the identity and the envelope of a request, recording them
+// for the reply.
+func (rep *repSocket) open(msg *Msg) {
+	i := delimiter(msg.Frames[1:]) + 1
+	rep.mu.Lock()
+	rep.env = msg.Frames[:i+1]
+	rep.mu.Unlock()
+	msg.Frames = msg.Frames[i+1:]
+}
+
+// repRecv prepends the identity of the peer to the requests received by
+// a REP and discards the malformed ones, lacking an envelope delimiter.
+func repRecv(r *msgReader, msg *Msg) bool {
+	if msg.err != nil {
+		return false
+	}
+	if delimiter(msg.Frames) < 0 {
+		return false
+	}
+	id := []byte(r.r.Peer.Meta[sysSockID])
+	msg.Frames = append([][]byte{id}, msg.Frames...)
+	return true
+}
+
+// delimiter returns the index of the empty delimiter frame ending
+// the envelope of a message, or -1.
+func delimiter(frames [][]byte) int {
+	for i, frame := range frames {
+		if len(frame) == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
 // Listen connects a local endpoint to the Socket.
 func (rep *repSocket) Listen(ep string) error {
 	return rep.sck.Listen(ep)
@@ -51,6 +180,21 @@ func (rep *repSocket) Dial(ep string) error {
 	return rep.sck.Dial(ep)
 }
 
+// Unbind stops listening on a local endpoint.
+func (rep *repSocket) Unbind(ep string) error {
+	return rep.sck.Unbind(ep)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (rep *repSocket) Disconnect(ep string) error {
+	return rep.sck.Disconnect(ep)
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (rep *repSocket) WaitConnected(ctx context.Context) error {
+	return rep.sck.WaitConnected(ctx)
+}
+
 // Type returns the type of this Socket (PUB, SUB, ...)
 func (rep *repSocket) Type() SocketType {
 	return rep.sck.Type()
@@ -66,6 +210,122 @@ func (rep *repSocket) SetOption(name string, value interface{}) error {
 	return rep.sck.SetOption(name, value)
 }
 
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+func (rep *repSocket) ConnMetadata(peer string) map[string]string {
+	return rep.sck.ConnMetadata(peer)
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (rep *repSocket) Monitor() <-chan Event {
+	return rep.sck.Monitor()
+}
+
+// Addr returns the address the Socket is listening on, or nil if
+// the Socket is not listening.
+func (rep *repSocket) Addr() net.Addr {
+	return rep.sck.Addr()
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (rep *repSocket) BoundEndpoints() []string {
+	return rep.sck.BoundEndpoints()
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (rep *repSocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	return rep.sck.ConnHandshake(peer)
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (rep *repSocket) PeerConn(peer string) (net.Conn, error) {
+	return rep.sck.PeerConn(peer)
+}
+
+// Peers returns the peers connected to the Socket, in the order they
+// connected.
+func (rep *repSocket) Peers() []PeerInfo {
+	return rep.sck.Peers()
+}
+
+// SendFrame sends a single frame of a message.
+// More frames of the same message follow when more is true.
+// The identity and the envelope of the pending request are restored
+// before the first frame of the reply.
+func (rep *repSocket) SendFrame(frame []byte, more bool) error {
+	return rep.sck.sendFrame(rep.envelope, frame, more)
+}
+
+// envelope returns the identity and the envelope of the pending request,
+// which are consumed by the reply.
+func (rep *repSocket) envelope() ([][]byte, error) {
+	rep.mu.Lock()
+	env := rep.env
+	rep.env = nil
+	rep.mu.Unlock()
+	if env == nil {
+		return nil, errRepNoRequest
+	}
+	return env, nil
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (rep *repSocket) RecvFrame() ([]byte, bool, error) {
+	return rep.sck.recvFrame(rep.Recv)
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+// The identity and the envelope of the pending request are restored
+// before the frame, unless frames of the reply were already sent.
+func (rep *repSocket) SendFrames(rd io.Reader, size int64) error {
+	return rep.sck.sendStream(rep.envelope, rd, size)
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (rep *repSocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	return rep.sck.recvFrameTo(rep.Recv, w)
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+func (rep *repSocket) RotateSecurity(sec Security) {
+	rep.sck.RotateSecurity(sec)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (rep *repSocket) CloseIdle(maxIdle time.Duration) int {
+	return rep.sck.CloseIdle(maxIdle)
+}
+
+// Stats returns the activity of the Socket.
+func (rep *repSocket) Stats() Stats {
+	return rep.sck.Stats()
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to,
+// in the order they were dialed.
+func (rep *repSocket) DialEndpoints() []string {
+	return rep.sck.DialEndpoints()
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (rep *repSocket) Config() ConfigSnapshot {
+	return rep.sck.Config()
+}
+
+// base returns the socket implementing the core of the Socket.
+func (rep *repSocket) base() *socket {
+	return rep.sck
+}
+
 var (
 	_ Socket = (*repSocket)(nil)
 )
@@ -6,12 +6,16 @@ package zmq4
 
 import (
 	"context"
+	"io"
+	"net"
+	"time"
 )
 
 // NewReq returns a new REQ ZeroMQ socket.
 // The returned socket value is initially unbound.
 func NewReq(ctx context.Context, opts ...Option) Socket {
 	req := &reqSocket{newSocket(ctx, Req, opts...)}
+	req.sck.w = newLBWriter(req.sck.ctx)
 	return req
 }
 
@@ -27,20 +31,79 @@ func (req *reqSocket) Close() error {
 
 // Send puts the message on the outbound send queue.
 // Send blocks until the message can be queued or the send deadline expires.
+// Requests are prepended with an empty delimiter frame and load-balanced
+// across the connected peers.
 func (req *reqSocket) Send(msg Msg) error {
+	return req.SendContext(context.Background(), msg)
+}
+
+// SendContext puts the message on the outbound send queue.
+// SendContext blocks until the message can be queued, the send deadline
+// expires or ctx is done.
+func (req *reqSocket) SendContext(ctx context.Context, msg Msg) error {
 	msg.Frames = append([][]byte{nil}, msg.Frames...)
-	return req.sck.Send(msg)
+	return req.sck.SendContext(ctx, msg)
+}
+
+// SendBatch sends msgs, in order, one at a time.
+func (req *reqSocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	return sendEach(ctx, req.SendContext, msgs)
 }
 
 // Recv receives a complete message.
+// The empty delimiter frame of the reply is stripped.
 func (req *reqSocket) Recv() (Msg, error) {
-	msg, err := req.sck.Recv()
+	return req.RecvContext(context.Background())
+}
+
+// RecvContext receives a complete message.
+// RecvContext returns ctx.Err() without consuming a message if ctx is done
+// first.
+func (req *reqSocket) RecvContext(ctx context.Context) (Msg, error) {
+	msg, err := req.sck.RecvContext(ctx)
 	if len(msg.Frames) > 1 {
 		msg.Frames = msg.Frames[1:]
 	}
 	return msg, err
 }
 
+// TrySend sends msg if it can be done without waiting.
+func (req *reqSocket) TrySend(msg Msg) (bool, error) {
+	return trySend(req.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (req *reqSocket) TryRecv() (Msg, bool, error) {
+	return tryRecv(req.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (req *reqSocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, req.TryRecv, req.RecvContext)
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (req *reqSocket) SetSendDeadline(t time.Time) {
+	req.sck.SetSendDeadline(t)
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (req *reqSocket) SetRecvDeadline(t time.Time) {
+	req.sck.SetRecvDeadline(t)
+}
+
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (req *reqSocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	msg, meta, err := req.sck.RecvWithMeta()
+	if len(msg.Frames) > 1 {
+		msg.Frames = msg.Frames[1:]
+	}
+	return msg, meta, err
+}
+
 // Listen connects a local endpoint to the Socket.
 func (req *reqSocket) Listen(ep string) error {
 	return req.sck.Listen(ep)
@@ -51,6 +114,21 @@ func (req *reqSocket) Dial(ep string) error {
 	return req.sck.Dial(ep)
 }
 
+// Unbind stops listening on a local endpoint.
+func (req *reqSocket) Unbind(ep string) error {
+	return req.sck.Unbind(ep)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (req *reqSocket) Disconnect(ep string) error {
+	return req.sck.Disconnect(ep)
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (req *reqSocket) WaitConnected(ctx context.Context) error {
+	return req.sck.WaitConnected(ctx)
+}
+
 // Type returns the type of this Socket (PUB, SUB, ...)
 func (req *reqSocket) Type() SocketType {
 	return req.sck.Type()
@@ -66,6 +144,112 @@ func (req *reqSocket) SetOption(name string, value interface{}) error {
 	return req.sck.SetOption(name, value)
 }
 
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+func (req *reqSocket) ConnMetadata(peer string) map[string]string {
+	return req.sck.ConnMetadata(peer)
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (req *reqSocket) Monitor() <-chan Event {
+	return req.sck.Monitor()
+}
+
+// Addr returns the address the Socket is listening on, or nil if
+// the Socket is not listening.
+func (req *reqSocket) Addr() net.Addr {
+	return req.sck.Addr()
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (req *reqSocket) BoundEndpoints() []string {
+	return req.sck.BoundEndpoints()
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (req *reqSocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	return req.sck.ConnHandshake(peer)
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (req *reqSocket) PeerConn(peer string) (net.Conn, error) {
+	return req.sck.PeerConn(peer)
+}
+
+// Peers returns the peers connected to the Socket, in the order they
+// connected.
+func (req *reqSocket) Peers() []PeerInfo {
+	return req.sck.Peers()
+}
+
+// SendFrame sends a single frame of a message.
+// More frames of the same message follow when more is true.
+// Requests are prepended with an empty delimiter frame.
+func (req *reqSocket) SendFrame(frame []byte, more bool) error {
+	return req.sck.sendFrame(reqEnvelope, frame, more)
+}
+
+// reqEnvelope returns the empty delimiter frame prepended to requests.
+func reqEnvelope() ([][]byte, error) {
+	return [][]byte{nil}, nil
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (req *reqSocket) RecvFrame() ([]byte, bool, error) {
+	return req.sck.recvFrame(req.Recv)
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+// Requests are prepended with an empty delimiter frame.
+func (req *reqSocket) SendFrames(rd io.Reader, size int64) error {
+	return req.sck.sendStream(reqEnvelope, rd, size)
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (req *reqSocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	return req.sck.recvFrameTo(req.Recv, w)
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+func (req *reqSocket) RotateSecurity(sec Security) {
+	req.sck.RotateSecurity(sec)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (req *reqSocket) CloseIdle(maxIdle time.Duration) int {
+	return req.sck.CloseIdle(maxIdle)
+}
+
+// Stats returns the activity of the Socket.
+func (req *reqSocket) Stats() Stats {
+	return req.sck.Stats()
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to,
+// in the order they were dialed.
+func (req *reqSocket) DialEndpoints() []string {
+	return req.sck.DialEndpoints()
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (req *reqSocket) Config() ConfigSnapshot {
+	return req.sck.Config()
+}
+
+// base returns the socket implementing the core of the Socket.
+func (req *reqSocket) base() *socket {
+	return req.sck
+}
+
 var (
 	_ Socket = (*reqSocket)(nil)
 )
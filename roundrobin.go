@@ -0,0 +1,210 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultDNSTTL = 30 * time.Second
+
+// Resolver looks up the addresses of a host. *net.Resolver implements
+// Resolver.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+}
+
+// roundRobin reports whether the tcp endpoint address addr is to be dialed
+// at each of the addresses of its host, and returns its host and port.
+// Only hostnames are resolved: IP addresses are dialed as is.
+func (sck *socket) roundRobin(network, addr string) (host, port string, ok bool) {
+	if !sck.dnsrr || network != "tcp" {
+		return "", "", false
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" || net.ParseIP(host) != nil {
+		return "", "", false
+	}
+	return host, port, true
+}
+
+// resolve returns the addresses of host usable on the tcp network of
+// the socket, sorted.
+func (sck *socket) resolve(host string) ([]string, error) {
+	ips, err := sck.resolver.LookupHost(sck.ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := ips[:0:0]
+	for _, v := range ips {
+		ip := net.ParseIP(v)
+		if ip == nil {
+			continue
+		}
+		switch ipv4 := ip.To4() != nil; {
+		case sck.tcpnet == "tcp4" && !ipv4, sck.tcpnet == "tcp6" && ipv4:
+			continue
+		}
+		addrs = append(addrs, v)
+	}
+	if len(addrs) == 0 {
+		return nil, errors.Errorf("no address of %q on network %q", host, sck.tcpnet)
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// dialRoundRobin connects the socket to each of the addresses of host,
+// the host of endpoint, and keeps the connections in line with the
+// addresses host resolves to, until endpoint is disconnected.
+// Dialing succeeds if at least one of the addresses could be connected to.
+func (sck *socket) dialRoundRobin(endpoint, host, port, peer string) error {
+	addrs, err := sck.resolve(host)
+	if err != nil {
+		err = errors.Wrapf(err, "could not dial to %q", endpoint)
+		sck.emit(Event{Type: EventConnectFailed, Endpoint: endpoint, Err: err})
+		return err
+	}
+
+	rr := &roundRobin{
+		sck:      sck,
+		endpoint: endpoint,
+		host:     host,
+		port:     port,
+		peer:     peer,
+		conns:    make(map[string]*Conn),
+	}
+	rr.update(sck.ctx, addrs, maxDialRetries)
+	if len(rr.conns) == 0 {
+		return errors.Errorf("could not dial to any address of %q", endpoint)
+	}
+
+	ctx, cancel := context.WithCancel(sck.ctx)
+	sck.mu.Lock()
+	sck.dialed = append(sck.dialed, endpoint)
+	sck.resolving[endpoint] = cancel
+	sck.mu.Unlock()
+
+	go rr.run(ctx)
+	return nil
+}
+
+// roundRobin holds the connections of a socket to the addresses of the
+// host of a tcp endpoint.
+type roundRobin struct {
+	sck      *socket
+	endpoint string
+	host     string
+	port     string
+	peer     string
+
+	conns map[string]*Conn // connections, by address
+}
+
+// run resolves the host every dnsttl and updates the connections, until
+// ctx is done.
+func (rr *roundRobin) run(ctx context.Context) {
+	rr.sck.mu.RLock()
+	ttl := rr.sck.dnsttl
+	rr.sck.mu.RUnlock()
+
+	tick := time.NewTicker(ttl)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		addrs, err := rr.sck.resolve(rr.host)
+		if err != nil {
+			// keep the current connections until the host resolves again.
+			logf(rr.sck.log, LevelWarn, "zmq4: could not resolve %q: %+v", rr.host, err)
+			continue
+		}
+		rr.update(ctx, addrs, 0)
+	}
+}
+
+// update connects to the addresses the socket is not connected to, and
+// closes the connections to the addresses no longer listed.
+// Addresses are dialed concurrently, each up to maxRetries+1 times.
+// Connections opened once ctx is done are closed.
+func (rr *roundRobin) update(ctx context.Context, addrs []string, maxRetries int) {
+	keep := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		keep[addr] = true
+	}
+	for addr, c := range rr.conns {
+		select {
+		case <-c.done:
+			// the peer went away: dial it again.
+			delete(rr.conns, addr)
+			continue
+		default:
+		}
+		if !keep[addr] {
+			c.Close()
+			delete(rr.conns, addr)
+		}
+	}
+
+	var (
+		wg    sync.WaitGroup
+		conns = make([]*Conn, len(addrs))
+	)
+	for i, addr := range addrs {
+		if _, ok := rr.conns[addr]; ok {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			c, err := rr.sck.connect(rr.transport(), net.JoinHostPort(addr, rr.port), rr.endpoint, rr.peer, maxRetries)
+			if err != nil {
+				logf(rr.sck.log, LevelError, "zmq4: could not dial to %q at %s: %+v", rr.endpoint, addr, err)
+				return
+			}
+			conns[i] = c
+		}(i, addr)
+	}
+	wg.Wait()
+
+	for i, c := range conns {
+		if c == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			// the endpoint was disconnected while dialing.
+			c.Close()
+			continue
+		}
+		rr.conns[addrs[i]] = c
+		rr.sck.addConn(c, rr.endpoint)
+		rr.sck.emit(Event{Type: EventConnected, Endpoint: rr.endpoint, Handshake: c.Handshake})
+	}
+}
+
+// transport returns the tcp transport dialing an address of the host.
+// TLS certificates are verified against the host, not its addresses.
+func (rr *roundRobin) transport() transport {
+	hostport := net.JoinHostPort(rr.host, rr.port)
+	return transport{
+		dial: func(sck *socket, addr string) (net.Conn, error) {
+			conn, err := sck.dialContext(sck.tcpnet, addr)
+			if err == nil && sck.tlscfg != nil {
+				conn = tls.Client(conn, sck.tlsConfig(hostport))
+			}
+			return conn, err
+		},
+	}
+}
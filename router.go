@@ -7,17 +7,28 @@ package zmq4
 import (
 	"bytes"
 	"context"
+	"io"
+	"net"
 	"sync"
+	"time"
 
+	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
 )
 
+// ErrHostUnreachable is returned when a ROUTER socket in mandatory mode
+// sends a message to an unknown peer.
+// See WithRouterMandatory and OptionRouterMandatory.
+var ErrHostUnreachable = errors.New("zmq4: host unreachable")
+
 // NewRouter returns a new ROUTER ZeroMQ socket.
 // The returned socket value is initially unbound.
-func NewRouter(ctx context.Context, opts ...Option) Socket {
+func NewRouter(ctx context.Context, opts ...Option) RouterSocket {
 	router := &routerSocket{newSocket(ctx, Router, opts...)}
-	router.sck.r = newRouterQReader(router.sck.ctx)
-	router.sck.w = newRouterMWriter(router.sck.ctx)
+	router.sck.r = newFQReaderHook(router.sck.ctx, routerRecv)
+	w := newRouterMWriter(router.sck.ctx)
+	w.mandatory = router.sck.mandatory
+	router.sck.w = w
 	return router
 }
 
@@ -34,9 +45,24 @@ func (router *routerSocket) Close() error {
 // Send puts the message on the outbound send queue.
 // Send blocks until the message can be queued or the send deadline expires.
 func (router *routerSocket) Send(msg Msg) error {
-	ctx, cancel := context.WithTimeout(router.sck.ctx, router.sck.timeout())
+	return router.SendContext(context.Background(), msg)
+}
+
+// SendContext puts the message on the outbound send queue.
+// SendContext blocks until the message can be queued, the send deadline
+// expires or ctx is done.
+func (router *routerSocket) SendContext(ctx context.Context, msg Msg) error {
+	if err := router.sck.partial(); err != nil {
+		return err
+	}
+	ctx, cancel := router.sck.sendContext(ctx)
 	defer cancel()
-	return router.sck.w.write(ctx, msg)
+	return router.sck.closedErr(router.sck.w.write(ctx, msg))
+}
+
+// SendBatch sends msgs, in order, one at a time.
+func (router *routerSocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	return sendEach(ctx, router.SendContext, msgs)
 }
 
 // Recv receives a complete message.
@@ -44,6 +70,12 @@ func (router *routerSocket) Recv() (Msg, error) {
 	return router.sck.Recv()
 }
 
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (router *routerSocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	return router.sck.RecvWithMeta()
+}
+
 // Listen connects a local endpoint to the Socket.
 func (router *routerSocket) Listen(ep string) error {
 	return router.sck.Listen(ep)
@@ -54,6 +86,21 @@ func (router *routerSocket) Dial(ep string) error {
 	return router.sck.Dial(ep)
 }
 
+// Unbind stops listening on a local endpoint.
+func (router *routerSocket) Unbind(ep string) error {
+	return router.sck.Unbind(ep)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (router *routerSocket) Disconnect(ep string) error {
+	return router.sck.Disconnect(ep)
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (router *routerSocket) WaitConnected(ctx context.Context) error {
+	return router.sck.WaitConnected(ctx)
+}
+
 // Type returns the type of this Socket (PUB, SUB, ...)
 func (router *routerSocket) Type() SocketType {
 	return router.sck.Type()
@@ -61,133 +108,144 @@ func (router *routerSocket) Type() SocketType {
 
 // GetOption is used to retrieve an option for a socket.
 func (router *routerSocket) GetOption(name string) (interface{}, error) {
+	switch name {
+	case OptionRouterMandatory:
+		w := router.sck.w.(*routerMWriter)
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return w.mandatory, nil
+	case OptionRouterHandover:
+		router.sck.mu.RLock()
+		defer router.sck.mu.RUnlock()
+		return router.sck.handover, nil
+	case OptionProbeRouter:
+		return router.sck.getProbe(), nil
+	}
 	return router.sck.GetOption(name)
 }
 
 // SetOption is used to set an option for a socket.
 func (router *routerSocket) SetOption(name string, value interface{}) error {
-	return router.sck.SetOption(name, value)
-}
-
-// routerQReader is a queued-message reader.
-type routerQReader struct {
-	ctx context.Context
-
-	mu sync.RWMutex
-	rs []*msgReader
-	c  chan Msg
-
-	sem *semaphore // ready when a connection is live.
-}
-
-func newRouterQReader(ctx context.Context) *routerQReader {
-	const qrsize = 10
-	return &routerQReader{
-		ctx: ctx,
-		c:   make(chan Msg, qrsize),
-		sem: newSemaphore(),
+	if err := router.sck.SetOption(name, value); err != nil {
+		return err
 	}
+	if name == OptionRouterMandatory {
+		w := router.sck.w.(*routerMWriter)
+		w.mu.Lock()
+		w.mandatory = value.(bool)
+		w.mu.Unlock()
+	}
+	return nil
 }
 
-func (q *routerQReader) Close() error {
-	q.mu.RLock()
-	var err error
-	for _, r := range q.rs {
-		e := r.Close()
-		if e != nil && err == nil {
-			err = e
-		}
+// SendTo sends msg to the peer identified by id.
+// The identity frame is prepended to msg, followed by an empty delimiter
+// frame when the peer is a REQ or REP socket.
+func (router *routerSocket) SendTo(id []byte, msg Msg) error {
+	frames := make([][]byte, 0, len(msg.Frames)+2)
+	frames = append(frames, id)
+	if router.delimited(string(id)) {
+		frames = append(frames, nil)
 	}
-	q.rs = nil
-	q.mu.RUnlock()
-	return err
+	msg.Frames = append(frames, msg.Frames...)
+	return router.Send(msg)
 }
 
-func (q *routerQReader) addConn(r *msgReader) {
-	go q.listen(q.ctx, r)
-	q.mu.Lock()
-	q.sem.enable()
-	q.rs = append(q.rs, r)
-	q.mu.Unlock()
+// ConnectPeer dials the remote endpoint ep, and routes messages to the
+// peer listening there under the given identity, whatever the identity
+// the peer announces, like ZMQ_CONNECT_ROUTING_ID does.
+// ConnectPeer fails if identity is empty or already used by a connected
+// peer.
+func (router *routerSocket) ConnectPeer(ep, identity string) error {
+	if identity == "" {
+		return errors.Errorf("zmq4: empty peer identity")
+	}
+	router.sck.mu.RLock()
+	_, dup := router.sck.ids[identity]
+	router.sck.mu.RUnlock()
+	if dup {
+		return errors.Errorf("zmq4: peer identity %q already in use", identity)
+	}
+	return exportErr(router.sck.dialPeer(ep, identity))
 }
 
-func (q *routerQReader) rmConn(r *msgReader) {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-
-	cur := -1
-	for i := range q.rs {
-		if q.rs[i] == r {
-			cur = i
-			break
-		}
+// RecvFrom receives a complete message, together with the identity of
+// the peer it came from.
+// The identity frame is stripped from the returned message, as well as
+// the empty delimiter frame of messages from REQ and REP peers.
+func (router *routerSocket) RecvFrom() ([]byte, Msg, error) {
+	msg, err := router.Recv()
+	if err != nil {
+		return nil, msg, err
 	}
-	if cur >= 0 {
-		q.rs = append(q.rs[:cur], q.rs[cur+1:]...)
+	id := msg.Frames[0]
+	msg.Frames = msg.Frames[1:]
+	if isDelimited(SocketType(msg.Metadata[sysSockType])) && len(msg.Frames) > 0 && len(msg.Frames[0]) == 0 {
+		msg.Frames = msg.Frames[1:]
 	}
+	return id, msg, nil
 }
 
-func (q *routerQReader) read(ctx context.Context, msg *Msg) error {
-	q.sem.lock()
-	select {
-	case <-ctx.Done():
-	case *msg = <-q.c:
+// delimited returns whether messages to the peer identified by id
+// need an empty delimiter frame.
+func (router *routerSocket) delimited(id string) bool {
+	router.sck.mu.RLock()
+	defer router.sck.mu.RUnlock()
+	c, ok := router.sck.ids[id]
+	if !ok {
+		return false
 	}
-	return msg.err
+	return isDelimited(SocketType(c.Peer.Meta[sysSockType]))
 }
 
-func (q *routerQReader) listen(ctx context.Context, r *msgReader) {
-	defer q.rmConn(r)
-	defer r.Close()
+// isDelimited returns whether sockets of type typ separate the routing
+// envelope from the payload with an empty delimiter frame.
+func isDelimited(typ SocketType) bool {
+	return typ == Req || typ == Rep
+}
 
-	id := []byte(r.r.Peer.Meta[sysSockID])
-	for {
-		var msg Msg
-		err := r.read(ctx, &msg)
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			if err != nil {
-				return
-			}
-			msg.Frames = append([][]byte{id}, msg.Frames...)
-			q.c <- msg
-		}
+// routerRecv prepends the peer identity to messages received by a ROUTER.
+func routerRecv(r *msgReader, msg *Msg) bool {
+	if msg.err != nil {
+		return false
 	}
+	id := []byte(r.r.Peer.Meta[sysSockID])
+	msg.Frames = append([][]byte{id}, msg.Frames...)
+	return true
 }
 
 type routerMWriter struct {
 	ctx context.Context
 	mu  sync.Mutex
 	ws  []*msgWriter
-	sem *semaphore
+
+	mandatory bool // whether messages to unknown peers fail with ErrHostUnreachable.
 }
 
 func newRouterMWriter(ctx context.Context) *routerMWriter {
 	return &routerMWriter{
 		ctx: ctx,
-		sem: newSemaphore(),
 	}
 }
 
 func (w *routerMWriter) Close() error {
 	w.mu.Lock()
+	ws := w.ws
+	w.ws = nil
+	w.mu.Unlock()
+
 	var err error
-	for _, ww := range w.ws {
+	for _, ww := range ws {
 		e := ww.Close()
 		if e != nil && err == nil {
 			err = e
 		}
 	}
-	w.ws = nil
-	w.mu.Unlock()
 	return err
 }
 
 func (mw *routerMWriter) addConn(w *msgWriter) {
 	mw.mu.Lock()
-	mw.sem.enable()
 	mw.ws = append(mw.ws, w)
 	mw.mu.Unlock()
 }
@@ -208,29 +266,182 @@ func (mw *routerMWriter) rmConn(w *msgWriter) {
 	}
 }
 
+// write sends msg to the peer identified by its first frame.
+// Messages are not held until a peer connects: a message sent while no
+// peer is connected is handled as any message to an unknown peer.
 func (w *routerMWriter) write(ctx context.Context, msg Msg) error {
-	w.sem.lock()
 	grp, ctx := errgroup.WithContext(ctx)
 	w.mu.Lock()
 	id := msg.Frames[0]
 	dmsg := NewMsgFrom(msg.Frames[1:]...)
+	found := false
 	for i := range w.ws {
 		ww := w.ws[i]
 		pid := []byte(ww.w.Peer.Meta[sysSockID])
 		if !bytes.Equal(pid, id) {
 			continue
 		}
+		found = true
 		grp.Go(func() error {
 			return ww.write(ctx, dmsg)
 		})
 	}
 	err := grp.Wait()
+	mandatory := w.mandatory
 	w.mu.Unlock()
+	if !found && mandatory {
+		return ErrHostUnreachable
+	}
 	return err
 }
 
+// pick returns the peer whose identity is id.
+func (w *routerMWriter) pick(ctx context.Context, id []byte) (*msgWriter, bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ww := range w.ws {
+		if bytes.Equal([]byte(ww.w.Peer.Meta[sysSockID]), id) {
+			return ww, true, nil
+		}
+	}
+	return nil, false, errors.Wrapf(ErrHostUnreachable, "zmq4: no peer with identity %q", id)
+}
+
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+func (router *routerSocket) ConnMetadata(peer string) map[string]string {
+	return router.sck.ConnMetadata(peer)
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (router *routerSocket) Monitor() <-chan Event {
+	return router.sck.Monitor()
+}
+
+// Addr returns the address the Socket is listening on, or nil if
+// the Socket is not listening.
+func (router *routerSocket) Addr() net.Addr {
+	return router.sck.Addr()
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (router *routerSocket) BoundEndpoints() []string {
+	return router.sck.BoundEndpoints()
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (router *routerSocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	return router.sck.ConnHandshake(peer)
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (router *routerSocket) PeerConn(peer string) (net.Conn, error) {
+	return router.sck.PeerConn(peer)
+}
+
+// Peers returns the peers connected to the Socket, in the order they
+// connected.
+func (router *routerSocket) Peers() []PeerInfo {
+	return router.sck.Peers()
+}
+
+// SendFrame sends a single frame of a message.
+// More frames of the same message follow when more is true.
+func (router *routerSocket) SendFrame(frame []byte, more bool) error {
+	return router.sck.SendFrame(frame, more)
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (router *routerSocket) RecvFrame() ([]byte, bool, error) {
+	return router.sck.recvFrame(router.Recv)
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+func (router *routerSocket) SendFrames(rd io.Reader, size int64) error {
+	return router.sck.SendFrames(rd, size)
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (router *routerSocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	return router.sck.recvFrameTo(router.Recv, w)
+}
+
+// RecvContext receives a complete message.
+// RecvContext returns ctx.Err() without consuming a message if ctx is done
+// first.
+func (router *routerSocket) RecvContext(ctx context.Context) (Msg, error) {
+	return router.sck.RecvContext(ctx)
+}
+
+// TrySend sends msg if it can be done without waiting.
+func (router *routerSocket) TrySend(msg Msg) (bool, error) {
+	return trySend(router.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (router *routerSocket) TryRecv() (Msg, bool, error) {
+	return tryRecv(router.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (router *routerSocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, router.TryRecv, router.RecvContext)
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (router *routerSocket) SetSendDeadline(t time.Time) {
+	router.sck.SetSendDeadline(t)
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (router *routerSocket) SetRecvDeadline(t time.Time) {
+	router.sck.SetRecvDeadline(t)
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+func (router *routerSocket) RotateSecurity(sec Security) {
+	router.sck.RotateSecurity(sec)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (router *routerSocket) CloseIdle(maxIdle time.Duration) int {
+	return router.sck.CloseIdle(maxIdle)
+}
+
+// Stats returns the activity of the Socket.
+func (router *routerSocket) Stats() Stats {
+	return router.sck.Stats()
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to,
+// in the order they were dialed.
+func (router *routerSocket) DialEndpoints() []string {
+	return router.sck.DialEndpoints()
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (router *routerSocket) Config() ConfigSnapshot {
+	return router.sck.Config()
+}
+
+// base returns the socket implementing the core of the Socket.
+func (router *routerSocket) base() *socket {
+	return router.sck
+}
+
 var (
-	_ rpool  = (*routerQReader)(nil)
-	_ wpool  = (*routerMWriter)(nil)
-	_ Socket = (*routerSocket)(nil)
+	_ wpool       = (*routerMWriter)(nil)
+	_ framePicker = (*routerMWriter)(nil)
+	_ Socket      = (*routerSocket)(nil)
 )
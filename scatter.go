@@ -0,0 +1,260 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build zmq4_draft
+// +build zmq4_draft
+
+package zmq4
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NewScatter returns a new SCATTER ZeroMQ socket.
+// SCATTER sockets are the thread-safe successors of PUSH sockets: messages
+// are distributed round-robin to the connected peers, and may be sent
+// from several goroutines at once. Messages are made of a single frame.
+// The returned socket value is initially unbound.
+func NewScatter(ctx context.Context, opts ...Option) Socket {
+	scatter := &scatterSocket{sck: newSocket(ctx, Scatter, opts...), lk: newSockLock()}
+	scatter.sck.w = newLBWriter(scatter.sck.ctx)
+	scatter.sck.r = nil
+	return scatter
+}
+
+// scatterSocket is a SCATTER ZeroMQ socket.
+type scatterSocket struct {
+	sck *socket
+	lk  sockLock // serializes sends
+}
+
+// Close closes the open Socket
+func (scatter *scatterSocket) Close() error {
+	return scatter.sck.Close()
+}
+
+// Send puts the message on the outbound send queue.
+// Send blocks until the message can be queued or the send deadline expires.
+func (scatter *scatterSocket) Send(msg Msg) error {
+	return scatter.SendContext(context.Background(), msg)
+}
+
+// Recv receives a complete message.
+func (*scatterSocket) Recv() (Msg, error) {
+	return Msg{}, errors.Errorf("zmq4: SCATTER sockets can't recv messages")
+}
+
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (scatter *scatterSocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	msg, err := scatter.Recv()
+	return msg, RecvMeta{}, err
+}
+
+// Listen connects a local endpoint to the Socket.
+func (scatter *scatterSocket) Listen(ep string) error {
+	return scatter.sck.Listen(ep)
+}
+
+// Dial connects a remote endpoint to the Socket.
+func (scatter *scatterSocket) Dial(ep string) error {
+	return scatter.sck.Dial(ep)
+}
+
+// Unbind stops listening on a local endpoint.
+func (scatter *scatterSocket) Unbind(ep string) error {
+	return scatter.sck.Unbind(ep)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (scatter *scatterSocket) Disconnect(ep string) error {
+	return scatter.sck.Disconnect(ep)
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (scatter *scatterSocket) WaitConnected(ctx context.Context) error {
+	return scatter.sck.WaitConnected(ctx)
+}
+
+// Type returns the type of this Socket (PUB, SUB, ...)
+func (scatter *scatterSocket) Type() SocketType {
+	return scatter.sck.Type()
+}
+
+// GetOption is used to retrieve an option for a socket.
+func (scatter *scatterSocket) GetOption(name string) (interface{}, error) {
+	return scatter.sck.GetOption(name)
+}
+
+// SetOption is used to set an option for a socket.
+func (scatter *scatterSocket) SetOption(name string, value interface{}) error {
+	return scatter.sck.SetOption(name, value)
+}
+
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+func (scatter *scatterSocket) ConnMetadata(peer string) map[string]string {
+	return scatter.sck.ConnMetadata(peer)
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (scatter *scatterSocket) Monitor() <-chan Event {
+	return scatter.sck.Monitor()
+}
+
+// Addr returns the address the Socket is listening on, or nil if
+// the Socket is not listening.
+func (scatter *scatterSocket) Addr() net.Addr {
+	return scatter.sck.Addr()
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (scatter *scatterSocket) BoundEndpoints() []string {
+	return scatter.sck.BoundEndpoints()
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (scatter *scatterSocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	return scatter.sck.ConnHandshake(peer)
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (scatter *scatterSocket) PeerConn(peer string) (net.Conn, error) {
+	return scatter.sck.PeerConn(peer)
+}
+
+// Peers returns the peers connected to the Socket, in the order they
+// connected.
+func (scatter *scatterSocket) Peers() []PeerInfo {
+	return scatter.sck.Peers()
+}
+
+// SendFrame sends a single frame of a message.
+// More frames of the same message follow when more is true.
+// SCATTER messages are made of a single frame: more must be false.
+func (scatter *scatterSocket) SendFrame(frame []byte, more bool) error {
+	if more {
+		return errMultipart(Scatter)
+	}
+	scatter.lk.lock(context.Background())
+	defer scatter.lk.unlock()
+	return scatter.sck.SendFrame(frame, more)
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (scatter *scatterSocket) RecvFrame() ([]byte, bool, error) {
+	return scatter.sck.recvFrame(scatter.Recv)
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+func (scatter *scatterSocket) SendFrames(rd io.Reader, size int64) error {
+	scatter.lk.lock(context.Background())
+	defer scatter.lk.unlock()
+	return scatter.sck.SendFrames(rd, size)
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (scatter *scatterSocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	return scatter.sck.recvFrameTo(scatter.Recv, w)
+}
+
+// RecvContext receives a complete message.
+func (scatter *scatterSocket) RecvContext(ctx context.Context) (Msg, error) {
+	return scatter.Recv()
+}
+
+// TrySend sends msg if it can be done without waiting.
+func (scatter *scatterSocket) TrySend(msg Msg) (bool, error) {
+	return trySend(scatter.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (scatter *scatterSocket) TryRecv() (Msg, bool, error) {
+	return tryRecv(scatter.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (scatter *scatterSocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, scatter.TryRecv, scatter.RecvContext)
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (scatter *scatterSocket) SetSendDeadline(t time.Time) {
+	scatter.sck.SetSendDeadline(t)
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (scatter *scatterSocket) SetRecvDeadline(t time.Time) {
+	scatter.sck.SetRecvDeadline(t)
+}
+
+// SendContext puts the message on the outbound send queue.
+// SendContext blocks until the message can be queued, the send deadline
+// expires or ctx is done.
+func (scatter *scatterSocket) SendContext(ctx context.Context, msg Msg) error {
+	if len(msg.Frames) != 1 {
+		return errMultipart(Scatter)
+	}
+	if err := scatter.lk.lock(ctx); err != nil {
+		return err
+	}
+	defer scatter.lk.unlock()
+	return scatter.sck.SendContext(ctx, msg)
+}
+
+// SendBatch sends msgs, in order, one at a time.
+func (scatter *scatterSocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	return sendEach(ctx, scatter.SendContext, msgs)
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+func (scatter *scatterSocket) RotateSecurity(sec Security) {
+	scatter.sck.RotateSecurity(sec)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (scatter *scatterSocket) CloseIdle(maxIdle time.Duration) int {
+	return scatter.sck.CloseIdle(maxIdle)
+}
+
+// Stats returns the activity of the Socket.
+func (scatter *scatterSocket) Stats() Stats {
+	return scatter.sck.Stats()
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to,
+// in the order they were dialed.
+func (scatter *scatterSocket) DialEndpoints() []string {
+	return scatter.sck.DialEndpoints()
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (scatter *scatterSocket) Config() ConfigSnapshot {
+	return scatter.sck.Config()
+}
+
+// base returns the socket implementing the core of the Socket.
+func (scatter *scatterSocket) base() *socket {
+	return scatter.sck
+}
+
+var (
+	_ Socket = (*scatterSocket)(nil)
+)
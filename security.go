@@ -5,6 +5,7 @@
 package zmq4
 
 import (
+	"fmt"
 	"io"
 
 	"github.com/pkg/errors"
@@ -48,6 +49,18 @@ const (
 	CurveSecurity SecurityType = "CURVE"
 )
 
+// SecurityMismatchError is returned when a peer announces a security
+// mechanism different from the one of the socket during the ZMTP greeting.
+// The connection to the peer is then closed.
+type SecurityMismatchError struct {
+	Local  SecurityType // security mechanism of the socket
+	Remote SecurityType // security mechanism announced by the peer
+}
+
+func (e *SecurityMismatchError) Error() string {
+	return fmt.Sprintf("zmq4: security mechanism mismatch: local=%q remote=%q", e.Local, e.Remote)
+}
+
 // security implements the NULL security mechanism.
 type nullSecurity struct{}
 
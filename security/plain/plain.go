@@ -143,14 +143,18 @@ func (security) Decrypt(w io.Writer, data []byte) (int, error) {
 }
 
 // validateHello validates the user/passwd credentials.
+// The credentials are not authenticated: validateHello only checks the body
+// of the HELLO command is made of a username and a password.
 func validateHello(body []byte) error {
-	//	n := int(body[0])
-	//	user := body[1 : 1+n]
-	//	body = body[1+n:]
-	//	n = int(body[0])
-	//	pass := body[1 : 1+n]
-	//	body = body[1+n:]
-	//	log.Printf("user=%q, pass=%q, body=%q", user, pass, body)
+	for _, field := range []string{"username", "password"} {
+		if len(body) == 0 || len(body) < 1+int(body[0]) {
+			return errors.Errorf("security/plain: invalid HELLO %s", field)
+		}
+		body = body[1+int(body[0]):]
+	}
+	if len(body) != 0 {
+		return errors.Errorf("security/plain: invalid HELLO command")
+	}
 	return nil
 }
 
@@ -74,8 +74,8 @@ func TestHandshakeReqCRep(t *testing.T) {
 			return errors.Wrap(err, "could not recv REQ message")
 		}
 
-		if !reflect.DeepEqual(msg, reqQuit) {
-			return errors.Errorf("got = %v, want = %v", msg, repQuit)
+		if !reflect.DeepEqual(msg.Frames, reqQuit.Frames) || msg.Type != reqQuit.Type {
+			return errors.Errorf("got = %#v, want = %#v", msg, repQuit)
 		}
 
 		err = rep.Send(repQuit)
@@ -101,8 +101,8 @@ func TestHandshakeReqCRep(t *testing.T) {
 			return errors.Wrap(err, "could not recv REQ message")
 		}
 
-		if !reflect.DeepEqual(msg, repQuit) {
-			return errors.Errorf("got = %v, want = %v", msg, repQuit)
+		if !reflect.DeepEqual(msg.Frames, repQuit.Frames) || msg.Type != repQuit.Type {
+			return errors.Errorf("got = %#v, want = %#v", msg, repQuit)
 		}
 		return nil
 	})
@@ -143,8 +143,8 @@ func TestHandshakeCReqRep(t *testing.T) {
 			return errors.Wrap(err, "could not recv REQ message")
 		}
 
-		if !reflect.DeepEqual(msg, reqQuit) {
-			return errors.Errorf("got = %v, want = %v", msg, repQuit)
+		if !reflect.DeepEqual(msg.Frames, reqQuit.Frames) || msg.Type != reqQuit.Type {
+			return errors.Errorf("got = %#v, want = %#v", msg, repQuit)
 		}
 
 		err = rep.Send(repQuit)
@@ -170,8 +170,8 @@ func TestHandshakeCReqRep(t *testing.T) {
 			return errors.Wrap(err, "could not recv REQ message")
 		}
 
-		if !reflect.DeepEqual(msg, repQuit) {
-			return errors.Errorf("got = %v, want = %v", msg, repQuit)
+		if !reflect.DeepEqual(msg.Frames, repQuit.Frames) || msg.Type != repQuit.Type {
+			return errors.Errorf("got = %#v, want = %#v", msg, repQuit)
 		}
 		return nil
 	})
@@ -212,8 +212,8 @@ func TestHandshakeCReqCRep(t *testing.T) {
 			return errors.Wrap(err, "could not recv REQ message")
 		}
 
-		if !reflect.DeepEqual(msg, reqQuit) {
-			return errors.Errorf("got = %v, want = %v", msg, repQuit)
+		if !reflect.DeepEqual(msg.Frames, reqQuit.Frames) || msg.Type != reqQuit.Type {
+			return errors.Errorf("got = %#v, want = %#v", msg, repQuit)
 		}
 
 		err = rep.Send(repQuit)
@@ -239,8 +239,8 @@ func TestHandshakeCReqCRep(t *testing.T) {
 			return errors.Wrap(err, "could not recv REQ message")
 		}
 
-		if !reflect.DeepEqual(msg, repQuit) {
-			return errors.Errorf("got = %v, want = %v", msg, repQuit)
+		if !reflect.DeepEqual(msg.Frames, repQuit.Frames) || msg.Type != repQuit.Type {
+			return errors.Errorf("got = %#v, want = %#v", msg, repQuit)
 		}
 		return nil
 	})
@@ -16,6 +16,7 @@ import (
 	"time"
 
 	"github.com/go-zeromq/zmq4"
+	"github.com/go-zeromq/zmq4/security/null"
 	"github.com/go-zeromq/zmq4/security/plain"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
@@ -104,6 +105,201 @@ func TestHandshakeReqRep(t *testing.T) {
 	}
 }
 
+func TestHandshakeGateway(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	var (
+		upEP   = must(EndPoint("tcp"))
+		downEP = must(EndPoint("tcp"))
+	)
+
+	// the gateway is a PLAIN server for its downstream peers and
+	// a PLAIN client of its upstream peer.
+	gw := zmq4.NewPull(ctx,
+		zmq4.WithSecurity(plain.Security("", "")),
+		zmq4.WithEndpointSecurity(upEP, plain.Security("gateway", "secret")),
+	)
+	defer gw.Close()
+
+	up := zmq4.NewPush(ctx, zmq4.WithSecurity(plain.Security("", "")))
+	defer up.Close()
+
+	down := zmq4.NewPush(ctx, zmq4.WithSecurity(plain.Security("client", "secret")))
+	defer down.Close()
+
+	err := up.Listen(upEP)
+	if err != nil {
+		t.Fatalf("could not listen upstream: %v", err)
+	}
+
+	err = gw.Listen(downEP)
+	if err != nil {
+		t.Fatalf("could not listen downstream: %v", err)
+	}
+
+	err = gw.Dial(upEP)
+	if err != nil {
+		t.Fatalf("could not dial upstream: %v", err)
+	}
+
+	err = down.Dial(downEP)
+	if err != nil {
+		t.Fatalf("could not dial downstream: %v", err)
+	}
+
+	err = up.Send(zmq4.NewMsgString("from upstream"))
+	if err != nil {
+		t.Fatalf("could not send upstream message: %v", err)
+	}
+
+	err = down.Send(zmq4.NewMsgString("from downstream"))
+	if err != nil {
+		t.Fatalf("could not send downstream message: %v", err)
+	}
+
+	got := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		msg, err := gw.Recv()
+		if err != nil {
+			t.Fatalf("could not recv message %d: %v", i, err)
+		}
+		got[string(msg.Frames[0])] = true
+	}
+
+	for _, want := range []string{"from upstream", "from downstream"} {
+		if !got[want] {
+			t.Fatalf("missing message %q (got=%v)", want, got)
+		}
+	}
+}
+
+func TestHandshakeSameRole(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx, zmq4.WithSecurity(plain.Security("user", "secret")))
+	defer pull.Close()
+
+	evts := pull.Monitor()
+	err := pull.Listen(ep)
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	// a raw peer announcing itself as a PLAIN server.
+	conn, err := net.Dial("tcp", ep[len("tcp://"):])
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer conn.Close()
+
+	greeting := make([]byte, 64)
+	greeting[0] = 0xff
+	greeting[9] = 0x7f
+	greeting[10] = 3
+	copy(greeting[12:], "PLAIN")
+	greeting[32] = 0x01
+	_, err = conn.Write(greeting)
+	if err != nil {
+		t.Fatalf("could not write greeting: %v", err)
+	}
+
+	for {
+		select {
+		case ev := <-evts:
+			switch ev.Type {
+			case zmq4.EventHandshakeFailed:
+				return
+			case zmq4.EventAccepted:
+				t.Fatalf("handshake with a peer in the same role succeeded")
+			}
+		case <-ctx.Done():
+			t.Fatalf("timeout waiting for handshake failure")
+		}
+	}
+}
+
+func TestRotateSecurity(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx, zmq4.WithSecurity(plain.Security("user", "secret")))
+	defer pull.Close()
+
+	evts := pull.Monitor()
+	err := pull.Listen(ep)
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	// wait returns the outcome of the next handshake with pull.
+	wait := func() zmq4.EventType {
+		for {
+			select {
+			case ev := <-evts:
+				switch ev.Type {
+				case zmq4.EventAccepted, zmq4.EventHandshakeFailed:
+					return ev.Type
+				}
+			case <-ctx.Done():
+				t.Fatalf("timeout waiting for handshake")
+			}
+		}
+	}
+
+	old := zmq4.NewPush(ctx, zmq4.WithSecurity(plain.Security("user", "secret")))
+	defer old.Close()
+	err = old.Dial(ep)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	if got, want := wait(), zmq4.EventAccepted; got != want {
+		t.Fatalf("invalid handshake outcome: got=%v, want=%v", got, want)
+	}
+
+	pull.RotateSecurity(null.Security())
+
+	// new connections use the new mechanism...
+	stale := zmq4.NewPush(ctx, zmq4.WithSecurity(plain.Security("user", "secret")))
+	defer stale.Close()
+	if err := stale.Dial(ep); err == nil {
+		t.Fatalf("expected a handshake error with the rotated mechanism")
+	}
+	if got, want := wait(), zmq4.EventHandshakeFailed; got != want {
+		t.Fatalf("invalid handshake outcome: got=%v, want=%v", got, want)
+	}
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+	err = push.Dial(ep)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	if got, want := wait(), zmq4.EventAccepted; got != want {
+		t.Fatalf("invalid handshake outcome: got=%v, want=%v", got, want)
+	}
+
+	// ... while established connections keep theirs.
+	for _, sck := range []zmq4.Socket{old, push} {
+		err = sck.Send(zmq4.NewMsgString("hello"))
+		if err != nil {
+			t.Fatalf("could not send: %v", err)
+		}
+		msg, err := pull.Recv()
+		if err != nil {
+			t.Fatalf("could not recv: %v", err)
+		}
+		if got, want := string(msg.Frames[0]), "hello"; got != want {
+			t.Fatalf("invalid message: got=%q, want=%q", got, want)
+		}
+	}
+}
+
 func must(str string, err error) string {
 	if err != nil {
 		panic(err)
@@ -142,3 +338,101 @@ func newUUID() string {
 	uuid[6] = uuid[6]&^0xf0 | 0x40
 	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
 }
+
+func TestHandshakeMechanismMismatch(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	server := zmq4.NewRep(ctx, zmq4.WithSecurity(plain.Security("user", "secret")))
+	defer server.Close()
+
+	evts := server.Monitor()
+	if err := server.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	client := zmq4.NewReq(ctx, zmq4.WithSecurity(null.Security()))
+	defer client.Close()
+
+	err := client.Dial(ep)
+	if err == nil {
+		t.Fatalf("handshake with mismatched mechanisms succeeded")
+	}
+	const want = `zmq4: security mechanism mismatch: local="NULL" remote="PLAIN"`
+	cerr, ok := errors.Cause(err).(*zmq4.SecurityMismatchError)
+	if !ok {
+		t.Fatalf("invalid error type %T: %v", errors.Cause(err), err)
+	}
+	if got := cerr.Error(); got != want {
+		t.Fatalf("invalid error:\ngot= %q\nwant=%q", got, want)
+	}
+
+	for {
+		select {
+		case ev := <-evts:
+			switch ev.Type {
+			case zmq4.EventHandshakeFailed:
+				const want = `zmq4: security mechanism mismatch: local="PLAIN" remote="NULL"`
+				if cerr, ok := errors.Cause(ev.Err).(*zmq4.SecurityMismatchError); !ok || cerr.Error() != want {
+					t.Fatalf("invalid server error: %v", ev.Err)
+				}
+				return
+			case zmq4.EventAccepted:
+				t.Fatalf("handshake with mismatched mechanisms succeeded")
+			}
+		case <-ctx.Done():
+			t.Fatalf("timeout waiting for handshake failure")
+		}
+	}
+}
+
+// badHello is a PLAIN client sending a malformed HELLO command.
+type badHello struct{}
+
+func (badHello) Type() zmq4.SecurityType { return zmq4.PlainSecurity }
+
+func (badHello) Handshake(conn *zmq4.Conn, server bool) error {
+	// a username longer than the body.
+	if err := conn.SendCmd(zmq4.CmdHello, []byte{42, 'u'}); err != nil {
+		return err
+	}
+	_, err := conn.RecvCmd()
+	return err
+}
+
+func (badHello) Encrypt(w io.Writer, data []byte) (int, error) { return w.Write(data) }
+func (badHello) Decrypt(w io.Writer, data []byte) (int, error) { return w.Write(data) }
+
+func TestHandshakeInvalidHello(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	server := zmq4.NewRep(ctx, zmq4.WithSecurity(plain.Security("", "")))
+	defer server.Close()
+
+	if err := server.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	client := zmq4.NewReq(ctx, zmq4.WithSecurity(badHello{}))
+	defer client.Close()
+
+	err := client.Dial(ep)
+	if err == nil {
+		t.Fatalf("handshake with an invalid HELLO succeeded")
+	}
+	zerr, ok := errors.Cause(err).(*zmq4.ZMTPError)
+	if !ok {
+		t.Fatalf("invalid error type %T: %v", errors.Cause(err), err)
+	}
+	if got, want := zerr.Cmd, zmq4.CmdError; got != want {
+		t.Fatalf("invalid command: got=%q, want=%q", got, want)
+	}
+	if got, want := zerr.Reason, "invalid"; got != want {
+		t.Fatalf("invalid reason: got=%q, want=%q", got, want)
+	}
+}
@@ -74,8 +74,8 @@ func TestNullHandshakeReqRep(t *testing.T) {
 			return errors.Wrap(err, "could not recv REQ message")
 		}
 
-		if !reflect.DeepEqual(msg, reqQuit) {
-			return errors.Errorf("got = %v, want = %v", msg, repQuit)
+		if !reflect.DeepEqual(msg.Frames, reqQuit.Frames) || msg.Type != reqQuit.Type {
+			return errors.Errorf("got = %#v, want = %#v", msg, repQuit)
 		}
 
 		err = rep.Send(repQuit)
@@ -0,0 +1,94 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+var errShutdownTimeout = errors.New("zmq4: graceful shutdown deadline exceeded")
+
+// shutdownSignals are the signals triggering a graceful shutdown.
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// GracefulShutdown installs a signal handler for SIGINT and SIGTERM and,
+// once one of these signals is received or ctx is done, closes all the
+// provided sockets.
+//
+// The sockets stop accepting sends at once, and are closed once the
+// messages they queued are written, or the deadline expires: the deadline
+// supersedes the linger period of the sockets.
+//
+// The signal handler is installed before GracefulShutdown returns.
+// The returned channel receives the outcome of closing the sockets: nil when
+// all of them were flushed and closed within deadline, the first error
+// reported by a Close otherwise, or an error if the deadline expired first.
+func GracefulShutdown(ctx context.Context, deadline time.Duration, sockets ...Socket) <-chan error {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, shutdownSignals...)
+
+	errc := make(chan error, 1)
+	go func() {
+		defer signal.Stop(sigc)
+
+		select {
+		case <-ctx.Done():
+		case <-sigc:
+		}
+
+		errc <- closeAll(deadline, sockets)
+	}()
+	return errc
+}
+
+// closeAll flushes and closes all sockets concurrently and waits at most
+// deadline for them to complete.
+func closeAll(deadline time.Duration, sockets []Socket) error {
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+
+	var grp errgroup.Group
+	for i := range sockets {
+		sck := sockets[i]
+		grp.Go(func() error {
+			return closeContext(ctx, sck)
+		})
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- grp.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errShutdownTimeout
+	}
+}
+
+// closeContext closes s once the messages it queued are written or ctx
+// is done.
+// Sockets not implemented by this package are closed at once.
+func closeContext(ctx context.Context, s Socket) error {
+	ps, ok := s.(pollable)
+	if !ok {
+		return s.Close()
+	}
+	sck := ps.base()
+	if err := sck.drain(ctx); err != nil {
+		sck.close()
+		return errShutdownTimeout
+	}
+	return sck.close()
+}
@@ -6,10 +6,15 @@ package zmq4
 
 import (
 	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
 	"net"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/go-zeromq/zmq4/internal/inproc"
@@ -19,35 +24,154 @@ import (
 const (
 	defaultRetry   = 250 * time.Millisecond
 	defaultTimeout = 5 * time.Minute
+	defaultHWM     = 10
+
+	rejectTimeout = 5 * time.Second // maximum time spent turning down a peer
+
+	defaultHandshakeTimeout = 30 * time.Second
+
+	defaultMulticastTTL = 1 // multicast packets stay on the local network
+
+	maxDialRetries = 10 // failed dials retried before Dial gives up
 )
 
 var (
 	errInvalidAddress = errors.New("zmq4: invalid address")
 	errInvalidSocket  = errors.New("zmq4: invalid socket")
+	errPartialMsg     = errors.New("zmq4: a message is being sent frame by frame")
+	errClosedWriter   = errors.New("zmq4: write to a closed socket")
+
+	ErrBadProperty   = errors.New("zmq4: bad property")
+	ErrUnknownOption = errors.New("zmq4: unknown option")
+
+	// ErrAlreadyBound is returned when listening on an endpoint that
+	// is already bound.
+	ErrAlreadyBound = errors.New("zmq4: endpoint already bound")
+
+	// ErrAlreadyConnected is returned when dialing an endpoint the socket
+	// is already connected to, or is already dialing.
+	ErrAlreadyConnected = errors.New("zmq4: endpoint already connected")
+
+	// ErrEndpointNotFound is returned when unbinding an endpoint the
+	// socket is not listening on, or disconnecting an endpoint the socket
+	// did not dial.
+	ErrEndpointNotFound = errors.New("zmq4: endpoint not found")
 
-	ErrBadProperty = errors.New("zmq4: bad property")
+	// ErrOptionImmutable is returned when setting an option that can not
+	// be changed once the socket listened or dialed, such as OptionIdentity.
+	ErrOptionImmutable = errors.New("zmq4: option can not be changed after Listen or Dial")
+
+	// ErrClosedSocket is returned by the operations of closed sockets,
+	// including the operations still pending when the socket was closed.
+	ErrClosedSocket = errors.New("zmq4: use of closed socket")
+
+	// ErrTooManyConnections is returned when dialing a socket that
+	// reached its maximum number of connected peers.
+	ErrTooManyConnections = errors.New("zmq4: too many connections")
 )
 
 // socket implements the ZeroMQ socket interface
 type socket struct {
-	ep    string // socket end-point
+	stats sockStats // activity of the socket. first for the alignment of its atomic counters.
+
 	typ   SocketType
 	id    SocketIdentity
 	retry time.Duration
 	sec   Security
+	esec  map[string]Security // per-endpoint security mechanisms
+	maxsz int64               // maximum size of received messages
+	trunc bool                // truncate oversized messages instead of closing their connection
+	raw   bool                // raw byte streams, without ZMTP handshake nor framing
+
+	maxconns  int      // maximum number of connected peers (0: no limit)
+	mandatory bool     // whether ROUTER sockets fail sending to unknown peers
+	handover  bool     // whether ROUTER sockets hand identities over to reconnecting peers
+	probe     bool     // whether ROUTER and DEALER sockets send an empty message to new peers
+	immediate bool     // whether messages are only queued while a peer is connected
+	verbose   bool     // whether XPUB sockets deliver all subscriptions
+	verboser  bool     // whether XPUB sockets deliver all subscriptions and unsubscriptions
+	welcome   *Msg     // message first sent to each subscriber of PUB and XPUB sockets, if any
+	dedup     bool     // whether SUB sockets drop consecutive duplicate messages
+	streamsz  int64    // size above which received single-frame messages are streamed (0: never)
+	version   [2]uint8 // ZMTP version spoken with peers
+
+	pool *framePool // pool of frame buffers for received messages, if any
+
+	sndhwm   int           // high water mark for outbound messages
+	rcvhwm   int           // high water mark for inbound messages, per connection
+	linger   time.Duration // linger period for pending messages at Close
+	sndtimeo time.Duration // maximum time a Send may block
+	rcvtimeo time.Duration // maximum time a Recv may block (0: no limit)
+	snddl    time.Time     // deadline of Send operations (zero: none)
+	rcvdl    time.Time     // deadline of Recv operations (zero: none)
+
+	sndretry   int           // number of retries of failed sends
+	sndbackoff time.Duration // time to wait between two send attempts
+
+	batchsz int           // size up to which small outgoing frames are coalesced (0: never)
+	batchdl time.Duration // maximum time outgoing frames are coalesced for
+
+	hstimeo time.Duration // maximum time a ZMTP handshake may take (0: no limit)
+
+	hbivl     time.Duration // interval between two heartbeats (0: no heartbeat)
+	hbtimeout time.Duration // time to wait for a heartbeat reply
+
+	ahbivl     time.Duration // interval between two application heartbeats (0: no heartbeat)
+	ahbtimeout time.Duration // time to wait for an application heartbeat echo
 
 	mu    sync.RWMutex
 	ids   map[string]*Conn // ZMTP connection IDs
 	conns []*Conn          // ZMTP connections
+	sem   *semaphore       // ready when a connection is live.
 	r     rpool
 	w     wpool
 
-	props map[string]interface{} // properties of this socket
+	meta Metadata // application metadata sent during handshake
+	mon  monitor  // lifecycle events dispatcher
+
+	watchers signals // notified when peers come and go, for pollers
+
+	onConn func(c *Conn) // optional, called with each new ZMTP connection
+
+	fmu   sync.Mutex
+	fw    *msgWriter // peer of the message being sent frame by frame
+	fopen bool       // whether frames of the message were sent to fw
+
+	rmu     sync.Mutex
+	rframes [][]byte // remaining frames of the message being received frame by frame
+
+	tracer Tracer // optional tracer of sent and received messages
+	log    Logger // optional logger of lifecycle events and internal errors
 
-	ctx      context.Context // life-line of socket
-	cancel   context.CancelFunc
-	listener net.Listener
-	dialer   net.Dialer
+	ctx       context.Context // life-line of socket
+	cancel    context.CancelFunc
+	listeners []net.Listener
+	started   bool     // whether the socket listened or dialed
+	opterr    error    // first error of the options of the socket, reported by the first Listen or Dial
+	bound     []string // endpoints the socket is listening on
+	binds     []string // endpoints passed to Listen, indexed like bound
+	dialed    []string // endpoints the socket is connected to
+	dialer    net.Dialer
+	lc        net.ListenConfig
+	tcpnet    string // network of tcp endpoints: tcp, tcp4 or tcp6
+
+	// dial, if set, is used instead of dialer to connect to
+	// remote endpoints.
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	closed  chan struct{} // closed by Close
+	closing sync.Once
+
+	mcastTTL int // time-to-live of the packets sent to pgm and epgm endpoints
+
+	tlscfg *tls.Config // optional TLS configuration of tcp connections
+
+	dialing map[string]struct{} // endpoints being dialed
+
+	dnsrr     bool                          // whether tcp endpoints are dialed at each address of their host
+	dnsttl    time.Duration                 // time between two resolutions of the hosts of round-robin endpoints
+	resolver  Resolver                      // resolver of the hosts of round-robin endpoints
+	resolving map[string]context.CancelFunc // stops the resolutions of round-robin endpoints, by endpoint
 }
 
 func newDefaultSocket(ctx context.Context, sockType SocketType) *socket {
@@ -56,17 +180,32 @@ func newDefaultSocket(ctx context.Context, sockType SocketType) *socket {
 	}
 	ctx, cancel := context.WithCancel(ctx)
 	return &socket{
-		typ:    sockType,
-		retry:  defaultRetry,
-		sec:    nullSecurity{},
-		ids:    make(map[string]*Conn),
-		conns:  nil,
-		r:      newQReader(ctx),
-		w:      newMWriter(ctx),
-		props:  make(map[string]interface{}),
-		ctx:    ctx,
-		cancel: cancel,
-		dialer: net.Dialer{Timeout: defaultTimeout},
+		typ:      sockType,
+		retry:    defaultRetry,
+		hstimeo:  defaultHandshakeTimeout,
+		sec:      nullSecurity{},
+		version:  defaultVersion,
+		esec:     make(map[string]Security),
+		sndhwm:   defaultHWM,
+		rcvhwm:   defaultHWM,
+		sndtimeo: defaultTimeout,
+		ids:      make(map[string]*Conn),
+		conns:    nil,
+		sem:      newSemaphore(),
+		r:        newFQReader(ctx),
+		w:        newMWriter(ctx),
+		meta:     make(Metadata),
+		ctx:      ctx,
+		cancel:   cancel,
+		dialer:   net.Dialer{Timeout: defaultTimeout},
+		tcpnet:   "tcp",
+		closed:   make(chan struct{}),
+		mcastTTL: defaultMulticastTTL,
+		dialing:  make(map[string]struct{}),
+
+		dnsttl:    defaultDNSTTL,
+		resolver:  net.DefaultResolver,
+		resolving: make(map[string]context.CancelFunc),
 	}
 }
 
@@ -82,28 +221,70 @@ func newSocket(ctx context.Context, sockType SocketType, opts ...Option) *socket
 	return sck
 }
 
-// Close closes the open Socket
+// Close closes the open Socket.
+// Later sends fail with ErrClosedSocket at once, while the messages
+// already queued are written for up to the linger period of the socket
+// (see OptionLinger), and dropped afterwards. Pending sends and receives
+// then fail with ErrClosedSocket.
 func (sck *socket) Close() error {
-	sck.cancel()
-	if sck.listener != nil {
-		defer sck.listener.Close()
+	sck.mu.RLock()
+	linger := sck.linger
+	sck.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), linger)
+	defer cancel()
+	sck.drain(ctx)
+	return sck.close()
+}
+
+// drain stops the socket from accepting sends, and waits for the messages
+// it queued to be written, or ctx to be done.
+func (sck *socket) drain(ctx context.Context) error {
+	sck.closing.Do(func() { close(sck.closed) })
+	f, ok := sck.w.(flusher)
+	if !ok {
+		return nil
 	}
+	return f.flush(ctx)
+}
 
+// close closes the socket, dropping the messages it still queues.
+func (sck *socket) close() error {
+	sck.closing.Do(func() { close(sck.closed) })
+	sck.cancel()
+	defer sck.watchers.notify()
+	defer sck.mon.close()
+	sck.mu.RLock()
+	for _, l := range sck.listeners {
+		defer l.Close()
+	}
+	bound := sck.bound
 	if sck.conns == nil {
+		sck.mu.RUnlock()
 		return errInvalidSocket
 	}
+	conns := make([]*Conn, len(sck.conns))
+	copy(conns, sck.conns)
+	sck.mu.RUnlock()
 
 	var err error
-	sck.mu.RLock()
-	for _, conn := range sck.conns {
+	for _, conn := range conns {
 		e := conn.Close()
 		if e != nil && err == nil {
 			err = e
 		}
 	}
-	sck.mu.RUnlock()
-	if strings.HasPrefix(sck.ep, "ipc://") {
-		os.Remove(sck.ep[len("ipc://"):])
+	if sck.r != nil {
+		// wait for the reader goroutines to exit.
+		e := sck.r.Close()
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	for _, ep := range bound {
+		if strings.HasPrefix(ep, "ipc://") {
+			removeIPC(ep[len("ipc://"):])
+		}
 	}
 
 	return err
@@ -112,54 +293,582 @@ func (sck *socket) Close() error {
 // Send puts the message on the outbound send queue.
 // Send blocks until the message can be queued or the send deadline expires.
 func (sck *socket) Send(msg Msg) error {
-	ctx, cancel := context.WithTimeout(sck.ctx, sck.timeout())
+	return sck.SendContext(context.Background(), msg)
+}
+
+// SendContext puts the message on the outbound send queue.
+// SendContext blocks until the message can be queued, the send deadline
+// expires or ctx is done.
+// A message is either sent as a whole or not at all.
+func (sck *socket) SendContext(ctx context.Context, msg Msg) error {
+	if sck.isClosed() {
+		return ErrClosedSocket
+	}
+	if err := sck.partial(); err != nil {
+		return err
+	}
+	ctx, cancel := sck.sendContext(ctx)
 	defer cancel()
-	return sck.w.write(ctx, msg)
+
+	retry := sck.sndretry
+	if sck.typ == Req {
+		retry = 0
+	}
+	for i := 0; ; i++ {
+		err := sck.w.write(ctx, msg)
+		if err == nil || i >= retry || ctx.Err() != nil || errors.Cause(err) == ErrWouldBlock {
+			return sck.closedErr(err)
+		}
+		select {
+		case <-ctx.Done():
+			return sck.closedErr(err)
+		case <-time.After(sck.sndbackoff):
+		}
+	}
+}
+
+// closedErr returns ErrClosedSocket in place of the error err of an
+// operation, if the socket was closed, and err as exported otherwise.
+func (sck *socket) closedErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	select {
+	case <-sck.closed:
+		return ErrClosedSocket
+	default:
+		return exportErr(err)
+	}
+}
+
+// isClosed returns whether the socket is closed or being closed.
+func (sck *socket) isClosed() bool {
+	select {
+	case <-sck.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// partial returns errPartialMsg if a message is being sent frame by frame.
+func (sck *socket) partial() error {
+	sck.fmu.Lock()
+	defer sck.fmu.Unlock()
+	if sck.fw != nil {
+		return errPartialMsg
+	}
+	return nil
+}
+
+// SendBatch sends msgs, in order, to a single peer, in as few writes as
+// possible, if the writer of the socket supports it, and one at a time
+// otherwise.
+func (sck *socket) SendBatch(ctx context.Context, msgs []Msg) error {
+	bw, ok := sck.w.(batchWriter)
+	if !ok {
+		return sendEach(ctx, sck.SendContext, msgs)
+	}
+	if sck.isClosed() {
+		return ErrClosedSocket
+	}
+	if err := sck.partial(); err != nil {
+		return err
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	ctx, cancel := sck.sendContext(ctx)
+	defer cancel()
+	return sck.closedErr(bw.writeBatch(ctx, msgs))
+}
+
+// dontWaitKey is the key of the contexts of non-blocking operations.
+type dontWaitKey struct{}
+
+// withDontWait returns a context making the operations of sockets fail
+// with ErrWouldBlock, instead of waiting for peers or queued messages.
+func withDontWait(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dontWaitKey{}, true)
+}
+
+// dontWait returns whether the operations run with ctx must not wait.
+func dontWait(ctx context.Context) bool {
+	v, _ := ctx.Value(dontWaitKey{}).(bool)
+	return v
+}
+
+// trySend sends msg with send, without waiting.
+func trySend(send func(context.Context, Msg) error, msg Msg) (bool, error) {
+	err := send(withDontWait(context.Background()), msg)
+	if errors.Cause(err) == ErrWouldBlock {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// tryRecv receives a message with recv, without waiting.
+func tryRecv(recv func(context.Context) (Msg, error)) (Msg, bool, error) {
+	msg, err := recv(withDontWait(context.Background()))
+	if errors.Cause(err) == ErrWouldBlock {
+		return Msg{}, false, nil
+	}
+	return msg, err == nil, err
+}
+
+// recvAll receives messages until ctx is done, an error occurs or an
+// empty message is received.
+// Queued messages are received with try, without the cost of bounding
+// each receive by ctx, and recv waits for the next one.
+func recvAll(ctx context.Context, try func() (Msg, bool, error), recv func(context.Context) (Msg, error)) ([]Msg, error) {
+	var msgs []Msg
+	for {
+		if err := ctx.Err(); err != nil {
+			return msgs, err
+		}
+		msg, ok, err := try()
+		if err == nil && !ok {
+			msg, err = recv(ctx)
+		}
+		if err != nil {
+			return msgs, err
+		}
+		if len(msg.Frames) == 0 || (len(msg.Frames) == 1 && len(msg.Frames[0]) == 0) {
+			return msgs, nil
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+// sendEach sends msgs one at a time with send, stopping at the first
+// message that could not be sent.
+func sendEach(ctx context.Context, send func(context.Context, Msg) error, msgs []Msg) error {
+	for i, msg := range msgs {
+		if err := send(ctx, msg); err != nil {
+			return errors.Wrapf(err, "zmq4: could not send message %d/%d", i+1, len(msgs))
+		}
+	}
+	return nil
+}
+
+// SendFrame sends a single frame of a message.
+// The message is complete once a frame is sent with more set to false.
+func (sck *socket) SendFrame(frame []byte, more bool) error {
+	return sck.sendFrame(nil, frame, more)
+}
+
+// sendFrame sends a single frame of a message.
+// All the frames of a message are sent to the same peer, elected when
+// the first frame is sent. The envelope frames returned by env, if any,
+// are sent before the first frame of a message.
+func (sck *socket) sendFrame(env func() ([][]byte, error), frame []byte, more bool) error {
+	sck.fmu.Lock()
+	defer sck.fmu.Unlock()
+
+	frames, err := sck.elect(env, frame)
+	if err != nil {
+		return err
+	}
+	for i, f := range frames {
+		err := sck.writeFrame(f, more || i < len(frames)-1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// elect elects the peer of a message starting with frame, unless frames
+// of the message were already sent, and returns the frames to send.
+func (sck *socket) elect(env func() ([][]byte, error), frame []byte) ([][]byte, error) {
+	frames := [][]byte{frame}
+	if sck.fw != nil {
+		return frames, nil
+	}
+
+	p, ok := sck.w.(framePicker)
+	if !ok {
+		return nil, errors.Errorf("zmq4: %s sockets can not send messages frame by frame", sck.typ)
+	}
+	if env != nil {
+		hdr, err := env()
+		if err != nil {
+			return nil, err
+		}
+		frames = append(append([][]byte{}, hdr...), frame)
+	}
+
+	ctx, cancel := sck.sendContext(context.Background())
+	w, consumed, err := p.pick(ctx, frames[0])
+	cancel()
+	if err != nil {
+		return nil, sck.closedErr(err)
+	}
+	if consumed {
+		frames = frames[1:]
+	}
+	sck.fw = w
+	sck.fopen = false
+	return frames, nil
+}
+
+// writeFrame sends frame to the elected peer.
+// The message is complete, or aborted, if more is false or frame could
+// not be sent.
+func (sck *socket) writeFrame(frame []byte, more bool) error {
+	err := sck.fw.writeFrame(frame, !sck.fopen, more)
+	if err != nil || !more {
+		sck.fw = nil
+		sck.fopen = false
+		return err
+	}
+	sck.fopen = true
+	return nil
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+func (sck *socket) SendFrames(r io.Reader, size int64) error {
+	return sck.sendStream(nil, r, size)
+}
+
+// sendStream sends a single frame of size bytes, read from r, as the last
+// frame of a message. The frame is written to the wire as it is read.
+// If no frame of the message was sent yet, its peer is elected and the
+// envelope frames returned by env, if any, are sent before the frame.
+func (sck *socket) sendStream(env func() ([][]byte, error), r io.Reader, size int64) error {
+	if size < 0 {
+		return errors.Errorf("zmq4: invalid frame size %d", size)
+	}
+
+	sck.fmu.Lock()
+	defer sck.fmu.Unlock()
+
+	frames, err := sck.elect(env, nil)
+	if err != nil {
+		return err
+	}
+	if len(frames) == 0 {
+		// the peer was elected by the streamed frame (a ROUTER identity.)
+		sck.fw = nil
+		return errors.Errorf("zmq4: %s sockets can not stream the first frame of a message", sck.typ)
+	}
+	// the nil frame stands for the streamed frame.
+	for _, f := range frames[:len(frames)-1] {
+		err := sck.writeFrame(f, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	w, first := sck.fw, !sck.fopen
+	sck.fw = nil
+	sck.fopen = false
+	return w.writeStream(r, size, first)
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (sck *socket) RecvFrame() ([]byte, bool, error) {
+	return sck.recvFrame(sck.Recv)
+}
+
+// recvFrame returns the next frame of the messages received with recv,
+// and whether more frames of the same message follow.
+func (sck *socket) recvFrame(recv func() (Msg, error)) ([]byte, bool, error) {
+	sck.rmu.Lock()
+	defer sck.rmu.Unlock()
+
+	if sck.rframes == nil {
+		msg, err := recv()
+		if err != nil {
+			return nil, false, err
+		}
+		sck.rframes = msg.Frames
+	}
+	frame, more := sck.nextFrame()
+	return frame, more, nil
+}
+
+// nextFrame pops the next frame of the message being received frame by
+// frame, and reports whether more frames follow.
+func (sck *socket) nextFrame() ([]byte, bool) {
+	if len(sck.rframes) == 0 {
+		sck.rframes = nil
+		return nil, false
+	}
+	frame := sck.rframes[0]
+	sck.rframes = sck.rframes[1:]
+	more := len(sck.rframes) > 0
+	if !more {
+		sck.rframes = nil
+	}
+	return frame, more
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (sck *socket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	return sck.recvFrameTo(sck.recvStream, w)
+}
+
+// recvFrameTo writes the next frame of the messages received with recv to
+// w, and reports the number of bytes written and whether more frames of
+// the same message follow.
+// Streamed frames are copied from the wire to w.
+func (sck *socket) recvFrameTo(recv func() (Msg, error), w io.Writer) (int64, bool, error) {
+	sck.rmu.Lock()
+	defer sck.rmu.Unlock()
+
+	if sck.rframes == nil {
+		msg, err := recv()
+		if err != nil {
+			return 0, false, err
+		}
+		if msg.stream != nil {
+			n, err := msg.stream.writeTo(w)
+			return n, false, err
+		}
+		sck.rframes = msg.Frames
+	}
+	frame, more := sck.nextFrame()
+	n, err := w.Write(frame)
+	if err != nil {
+		return int64(n), more, errors.Wrapf(err, "zmq4: could not write frame")
+	}
+	return int64(n), more, nil
+}
+
+// recvStream receives a message, leaving the body of a streamed frame on
+// the wire.
+func (sck *socket) recvStream() (Msg, error) {
+	r, ok := sck.r.(*fqreader)
+	if !ok {
+		return sck.Recv()
+	}
+	ctx, cancel := sck.recvContext(context.Background())
+	defer cancel()
+	var msg Msg
+	err := r.readStream(ctx, &msg, nil)
+	if msg.stream == nil {
+		sck.recycle(&msg)
+	}
+	return msg, err
+}
+
+// streams reports whether large frames received by the socket may be
+// streamed. Sockets transforming the messages they receive assemble them.
+func (sck *socket) streams() bool {
+	switch sck.typ {
+	case Pull, Dealer, Pair, XSub:
+		return true
+	case Sub:
+		return !sck.dedup
+	}
+	return false
 }
 
 // Recv receives a complete message.
 func (sck *socket) Recv() (Msg, error) {
-	ctx, cancel := context.WithCancel(sck.ctx)
+	return sck.RecvContext(context.Background())
+}
+
+// RecvContext receives a complete message.
+// RecvContext returns ctx.Err() without consuming a message if ctx is done
+// before a message is available.
+func (sck *socket) RecvContext(ctx context.Context) (Msg, error) {
+	ctx, cancel := sck.recvContext(ctx)
 	defer cancel()
 	var msg Msg
-	err := sck.r.read(ctx, &msg)
+	err := sck.closedErr(sck.r.read(ctx, &msg))
+	sck.recycle(&msg)
 	return msg, err
 }
 
+// TrySend sends msg if it can be done without waiting.
+func (sck *socket) TrySend(msg Msg) (bool, error) {
+	return trySend(sck.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (sck *socket) TryRecv() (Msg, bool, error) {
+	return tryRecv(sck.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (sck *socket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, sck.TryRecv, sck.RecvContext)
+}
+
+// RecvWithMeta receives a complete message, together with informations
+// about the state of the socket at reception time.
+func (sck *socket) RecvWithMeta() (Msg, RecvMeta, error) {
+	ctx, cancel := sck.recvContext(context.Background())
+	defer cancel()
+	var (
+		msg  Msg
+		meta RecvMeta
+	)
+	err := sck.closedErr(sck.r.readMeta(ctx, &msg, &meta))
+	sck.recycle(&msg)
+	return msg, meta, err
+}
+
+// recycle attaches the buffer pool of the socket, if any, to msg so that
+// Msg.Release hands its frames back to the pool.
+func (sck *socket) recycle(msg *Msg) {
+	if sck.pool == nil {
+		return
+	}
+	msg.pool = sck.pool
+}
+
 // Listen connects a local endpoint to the Socket.
+// A socket may listen on several endpoints. Listening on an endpoint
+// that is already bound returns ErrAlreadyBound.
+// Listening on an ipc endpoint creates the missing parent directories of
+// its socket file, and replaces a stale socket file nothing listens on.
+// The socket file is removed on Close. Endpoints written ipc://@name use
+// the Linux abstract namespace instead, and touch no file.
+// Listen is safe to call concurrently with Listen and Dial.
 func (sck *socket) Listen(endpoint string) error {
-	sck.ep = endpoint
+	return exportErr(sck.listen(endpoint))
+}
+
+func (sck *socket) listen(endpoint string) error {
 	network, addr, err := splitAddr(endpoint)
 	if err != nil {
-		return err
+		return &ErrBadEndpoint{Endpoint: endpoint, Err: err}
 	}
 
-	var l net.Listener
+	sck.mu.Lock()
+	if err := sck.start(); err != nil {
+		sck.mu.Unlock()
+		return err
+	}
+	dup := false
+	for _, ep := range sck.bound {
+		dup = dup || ep == endpoint
+	}
+	sck.mu.Unlock()
+	if dup {
+		err = errors.Wrapf(ErrAlreadyBound, "could not listen to %q", endpoint)
+		sck.emit(Event{Type: EventBindFailed, Endpoint: endpoint, Err: err})
+		return err
+	}
 
-	switch network {
-	case "ipc":
-		l, err = net.Listen("unix", addr)
-	case "tcp":
-		l, err = net.Listen("tcp", addr)
-	case "udp":
-		l, err = net.Listen("udp", addr)
-	case "inproc":
-		l, err = inproc.Listen(addr)
-	default:
-		panic("zmq4: unknown protocol " + network)
+	tr := transports[network]
+	if tr.multicast {
+		return sck.listenPGM(network, addr, endpoint)
 	}
 
+	l, err := tr.listen(sck, addr)
 	if err != nil {
-		return errors.Wrapf(err, "could not listen to %q", endpoint)
+		if isAddrInUse(err) {
+			err = errors.Wrapf(ErrAlreadyBound, "could not listen to %q: %v", endpoint, err)
+		} else {
+			err = errors.Wrapf(err, "could not listen to %q", endpoint)
+		}
+		sck.emit(Event{Type: EventBindFailed, Endpoint: endpoint, Err: err})
+		return err
 	}
-	sck.listener = l
+	sck.mu.Lock()
+	sck.listeners = append(sck.listeners, l)
+	sck.bound = append(sck.bound, network+"://"+l.Addr().String())
+	sck.binds = append(sck.binds, endpoint)
+	sck.mu.Unlock()
+	sck.emit(Event{Type: EventListening, Endpoint: endpoint})
 
-	go sck.accept()
+	go sck.accept(l, endpoint)
 
 	return nil
 }
 
-func (sck *socket) accept() {
+// Unbind stops listening on an endpoint, and closes the connections
+// accepted on it. The endpoint is either the one passed to Listen or the
+// one reported by BoundEndpoints.
+// Unbind returns ErrEndpointNotFound if the socket is not listening on
+// the endpoint.
+func (sck *socket) Unbind(endpoint string) error {
+	sck.mu.Lock()
+	i := -1
+	for j := range sck.bound {
+		if sck.bound[j] == endpoint || sck.binds[j] == endpoint {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		sck.mu.Unlock()
+		return exportErr(errors.Wrapf(ErrEndpointNotFound, "could not unbind %q", endpoint))
+	}
+	bound, ep := sck.bound[i], sck.binds[i]
+	sck.bound = append(sck.bound[:i:i], sck.bound[i+1:]...)
+	sck.binds = append(sck.binds[:i:i], sck.binds[i+1:]...)
+
+	var l net.Listener
+	network, _, _ := splitAddr(bound)
+	for j, ll := range sck.listeners {
+		if network+"://"+ll.Addr().String() == bound {
+			l = ll
+			sck.listeners = append(sck.listeners[:j:j], sck.listeners[j+1:]...)
+			break
+		}
+	}
+	var conns []*Conn
+	for _, c := range sck.conns {
+		if c.ep == ep && c.Server {
+			conns = append(conns, c)
+		}
+	}
+	sck.mu.Unlock()
+
+	var err error
+	if l != nil {
+		err = l.Close()
+	}
+	for _, c := range conns {
+		c.Close()
+	}
+	if network == "ipc" {
+		removeIPC(bound[len("ipc://"):])
+	}
+	return err
+}
+
+// listens reports whether l is one of the listeners of the socket.
+func (sck *socket) listens(l net.Listener) bool {
+	sck.mu.RLock()
+	defer sck.mu.RUnlock()
+	for _, ll := range sck.listeners {
+		if ll == l {
+			return true
+		}
+	}
+	return false
+}
+
+// isAddrInUse returns whether err reports an address already in use.
+func isAddrInUse(err error) bool {
+	if errors.Cause(err) == inproc.ErrAddrInUse {
+		return true
+	}
+	if op, ok := err.(*net.OpError); ok {
+		if se, ok := op.Err.(*os.SyscallError); ok {
+			return se.Err == syscall.EADDRINUSE
+		}
+	}
+	return false
+}
+
+// isTimeout returns whether err reports an expired deadline.
+func isTimeout(err error) bool {
+	ne, ok := errors.Cause(err).(net.Error)
+	return ok && ne.Timeout()
+}
+
+func (sck *socket) accept(l net.Listener, endpoint string) {
 	ctx, cancel := context.WithCancel(sck.ctx)
 	defer cancel()
 	for {
@@ -167,74 +876,367 @@ func (sck *socket) accept() {
 		case <-ctx.Done():
 			return
 		default:
-			conn, err := sck.listener.Accept()
+			conn, err := l.Accept()
 			if err != nil {
-				// log.Printf("zmq4: error accepting connection from %q: %v", sck.ep, err)
+				// log.Printf("zmq4: error accepting connection from %q: %v", endpoint, err)
+				if !sck.listens(l) {
+					// the listener was closed by Unbind.
+					return
+				}
 				continue
 			}
 
-			zconn, err := Open(conn, sck.sec, sck.typ, sck.id, true)
-			if err != nil {
-				panic(err)
-				//		return errors.Wrapf(err, "could not open a ZMTP connection")
+			if sck.full() {
+				sck.emit(Event{Type: EventRejected, Endpoint: endpoint, Err: ErrTooManyConnections})
+				go sck.reject(conn, endpoint)
+				continue
 			}
 
-			sck.addConn(zconn)
+			go sck.handshake(conn, endpoint)
 		}
 	}
 }
 
+// handshake opens a ZMTP connection over conn, accepted on endpoint.
+// Handshakes run concurrently, so that a slow or silent peer does not
+// hold up the listener.
+func (sck *socket) handshake(conn net.Conn, endpoint string) {
+	zconn, err := sck.open(conn, endpoint, true)
+	if err != nil {
+		logf(sck.log, LevelError, "zmq4: could not open a ZMTP connection from %q: %+v", endpoint, err)
+		conn.Close()
+		sck.emit(Event{Type: EventHandshakeFailed, Endpoint: endpoint, Err: err})
+		return
+	}
+	if sck.ctx.Err() != nil {
+		// the socket was closed during the handshake.
+		zconn.Close()
+		return
+	}
+
+	sck.addConn(zconn, endpoint)
+	sck.emit(Event{Type: EventAccepted, Endpoint: endpoint, Handshake: zconn.Handshake})
+}
+
+// reject turns down a peer connecting to a socket that reached its
+// maximum number of peers.
+// The ZMTP greeting is performed so the peer is notified with an
+// ERROR command, in place of the security handshake.
+func (sck *socket) reject(conn net.Conn, endpoint string) {
+	defer conn.Close()
+	if sck.raw || sck.version[0] < 3 {
+		return
+	}
+
+	zconn, err := newConn(conn, sck.security(endpoint), sck.typ, sck.id, true)
+	if err != nil {
+		return
+	}
+	conn.SetDeadline(time.Now().Add(rejectTimeout))
+	err = zconn.greet(true)
+	if err != nil {
+		return
+	}
+	err = zconn.SendCmd(CmdError, errorReason(reasonTooManyPeers))
+	if err != nil {
+		return
+	}
+
+	// wait for the peer to hang up, so the ERROR command is not
+	// discarded by a reset of the connection.
+	io.Copy(ioutil.Discard, conn)
+}
+
 // Dial connects a remote endpoint to the Socket.
+// A socket may be connected to several endpoints. Dialing an endpoint
+// the socket is already connected to returns ErrAlreadyConnected.
+// Dial is safe to call concurrently with Listen and Dial.
 func (sck *socket) Dial(endpoint string) error {
-	sck.ep = endpoint
+	return exportErr(sck.dialPeer(endpoint, ""))
+}
+
+// start records that the socket listened or dialed, and returns the first
+// error of the options the socket was created with, once.
+// sck.mu must be held.
+func (sck *socket) start() error {
+	sck.started = true
+	err := sck.opterr
+	sck.opterr = nil
+	return err
+}
 
+// dialPeer connects a remote endpoint to the socket.
+// The peer is routed to under the given identity, if not empty, instead
+// of the identity it announces.
+func (sck *socket) dialPeer(endpoint, peer string) error {
 	network, addr, err := splitAddr(endpoint)
+	if err != nil {
+		return &ErrBadEndpoint{Endpoint: endpoint, Err: err}
+	}
+
+	sck.mu.Lock()
+	if err := sck.start(); err != nil {
+		sck.mu.Unlock()
+		return err
+	}
+	_, dup := sck.dialing[endpoint]
+	for _, c := range sck.conns {
+		dup = dup || (!c.Server && c.ep == endpoint)
+	}
+	if !dup {
+		sck.dialing[endpoint] = struct{}{}
+	}
+	sck.mu.Unlock()
+	if dup {
+		err = errors.Wrapf(ErrAlreadyConnected, "could not dial to %q", endpoint)
+		sck.emit(Event{Type: EventConnectFailed, Endpoint: endpoint, Err: err})
+		return err
+	}
+	defer func() {
+		sck.mu.Lock()
+		delete(sck.dialing, endpoint)
+		sck.mu.Unlock()
+	}()
+
+	tr := transports[network]
+	if tr.multicast {
+		return sck.dialPGM(network, addr, endpoint)
+	}
+	if host, port, ok := sck.roundRobin(network, addr); ok {
+		return sck.dialRoundRobin(endpoint, host, port, peer)
+	}
+
+	zconn, err := sck.connect(tr, addr, endpoint, peer, maxDialRetries)
 	if err != nil {
 		return err
 	}
 
+	sck.mu.Lock()
+	sck.dialed = append(sck.dialed, endpoint)
+	sck.mu.Unlock()
+	sck.addConn(zconn, endpoint)
+	sck.emit(Event{Type: EventConnected, Endpoint: endpoint, Handshake: zconn.Handshake})
+	return nil
+}
+
+// connect opens a ZMTP connection to addr, the address of endpoint,
+// trying again up to the given number of times if the dial fails or the
+// handshake times out.
+// The peer is routed to under the given identity, if not empty.
+func (sck *socket) connect(tr transport, addr, endpoint, peer string, maxRetries int) (*Conn, error) {
 	retries := 0
 	var conn net.Conn
 connect:
-	switch network {
-	case "ipc":
-		conn, err = sck.dialer.DialContext(sck.ctx, "unix", addr)
-	case "tcp":
-		conn, err = sck.dialer.DialContext(sck.ctx, "tcp", addr)
-	case "udp":
-		conn, err = sck.dialer.DialContext(sck.ctx, "udp", addr)
-	case "inproc":
-		conn, err = inproc.Dial(addr)
-	default:
-		panic("zmq4: unknown protocol " + network)
-	}
+	start := time.Now()
+	conn, err := tr.dial(sck, addr)
 
 	if err != nil {
-		if retries < 10 {
+		if retries < maxRetries {
 			retries++
+			atomic.AddUint64(&sck.stats.reconnects, 1)
 			time.Sleep(sck.retry)
 			goto connect
 		}
-		return errors.Wrapf(err, "could not dial to %q", endpoint)
+		err = errors.Wrapf(err, "could not dial to %q", endpoint)
+		sck.emit(Event{Type: EventConnectFailed, Endpoint: endpoint, Err: err})
+		return nil, err
 	}
 
 	if conn == nil {
-		return errors.Wrapf(err, "got a nil dial-conn to %q", endpoint)
+		return nil, errors.Wrapf(err, "got a nil dial-conn to %q", endpoint)
 	}
 
-	zconn, err := Open(conn, sck.sec, sck.typ, sck.id, false)
+	dialed := time.Since(start)
+
+	zconn, err := sck.open(conn, endpoint, false)
 	if err != nil {
-		return errors.Wrapf(err, "could not open a ZMTP connection")
+		logf(sck.log, LevelError, "zmq4: could not open a ZMTP connection to %q: %+v", endpoint, err)
+		conn.Close()
+		sck.emit(Event{Type: EventHandshakeFailed, Endpoint: endpoint, Err: err})
+		if isTimeout(err) && retries < maxRetries {
+			// the peer may be busy: try again, as for failed dials.
+			retries++
+			atomic.AddUint64(&sck.stats.reconnects, 1)
+			time.Sleep(sck.retry)
+			goto connect
+		}
+		return nil, errors.Wrapf(err, "could not open a ZMTP connection")
 	}
 	if zconn == nil {
-		return errors.Wrapf(err, "got a nil ZMTP connection to %q", endpoint)
+		return nil, errors.Wrapf(err, "got a nil ZMTP connection to %q", endpoint)
 	}
 
-	sck.addConn(zconn)
+	zconn.Handshake.Connect = dialed
+	if peer != "" {
+		zconn.Peer.Meta[sysSockID] = peer
+	}
+	return zconn, nil
+}
+
+// Disconnect closes the connections to an endpoint dialed with Dial.
+// Disconnect returns ErrEndpointNotFound if the socket did not dial the
+// endpoint.
+func (sck *socket) Disconnect(endpoint string) error {
+	sck.mu.Lock()
+	dialed := sck.dialed[:0:0]
+	for _, ep := range sck.dialed {
+		if ep != endpoint {
+			dialed = append(dialed, ep)
+		}
+	}
+	if len(dialed) == len(sck.dialed) {
+		sck.mu.Unlock()
+		return exportErr(errors.Wrapf(ErrEndpointNotFound, "could not disconnect %q", endpoint))
+	}
+	sck.dialed = dialed
+	if stop, ok := sck.resolving[endpoint]; ok {
+		stop()
+		delete(sck.resolving, endpoint)
+	}
+	var conns []*Conn
+	for _, c := range sck.conns {
+		if c.ep == endpoint && !c.Server {
+			conns = append(conns, c)
+		}
+	}
+	sck.mu.Unlock()
+
+	for _, c := range conns {
+		c.Close()
+	}
 	return nil
 }
 
-func (sck *socket) addConn(c *Conn) {
+// dialContext connects to addr on the named network, using the
+// user-provided dial function, if any.
+func (sck *socket) dialContext(network, addr string) (net.Conn, error) {
+	if sck.dial != nil {
+		return sck.dial(sck.ctx, network, addr)
+	}
+	return sck.dialer.DialContext(sck.ctx, network, addr)
+}
+
+// tlsConfig returns the TLS configuration of the connections dialed to
+// addr. The server name defaults to the host of addr.
+func (sck *socket) tlsConfig(addr string) *tls.Config {
+	cfg := sck.tlscfg
+	if cfg.ServerName != "" || cfg.InsecureSkipVerify {
+		return cfg
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return cfg
+	}
+	cfg = cfg.Clone()
+	cfg.ServerName = host
+	return cfg
+}
+
+// security returns the security mechanism used for connections
+// on the given endpoint.
+func (sck *socket) security(endpoint string) Security {
+	sck.mu.RLock()
+	defer sck.mu.RUnlock()
+	if sec, ok := sck.esec[endpoint]; ok {
+		return sec
+	}
+	return sck.sec
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+// Mechanisms configured with WithEndpointSecurity are not replaced.
+// If the security mechanism is nil, the NULL mechanism is used.
+func (sck *socket) RotateSecurity(sec Security) {
+	if sec == nil {
+		sec = nullSecurity{}
+	}
+	sck.mu.Lock()
+	sck.sec = sec
+	sck.mu.Unlock()
+}
+
+// open performs the ZMTP handshake over conn, announcing this socket's
+// metadata to the remote peer.
+// No handshake is performed for raw sockets.
+// The handshake is performed in the server role for accepted connections
+// and in the client role for dialed ones.
+func (sck *socket) open(conn net.Conn, endpoint string, server bool) (*Conn, error) {
+	sck.mu.RLock()
+	timeout := sck.hstimeo
+	sck.mu.RUnlock()
+	if timeout > 0 {
+		// peers that never complete the handshake must not hold the
+		// connection, nor the listener or dialer, forever.
+		conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	sec := sck.security(endpoint)
+	zconn, err := newConn(conn, sec, sck.typ, sck.id, server)
+	if err != nil {
+		return nil, err
+	}
+	if sck.raw {
+		zconn.raw = true
+		return zconn, nil
+	}
+	zconn.version = sck.version
+	for k, v := range sck.meta {
+		switch k {
+		case sysSockType, sysSockID:
+			// system properties can not be overridden.
+		default:
+			zconn.Meta[k] = v
+		}
+	}
+
+	err = zconn.init(sec)
+	if err != nil {
+		return nil, newErrHandshake(err)
+	}
+
+	// the message size limit applies to messages, not to the handshake.
+	zconn.maxMsgSize = sck.maxsz
+	zconn.truncate = sck.trunc
+	zconn.pool = sck.pool
+	if sck.streams() {
+		zconn.streamsz = sck.streamsz
+	}
+	if sck.batchsz > 0 {
+		zconn.coalesce(sck.batchsz, sck.batchdl)
+	}
+	return zconn, nil
+}
+
+func (sck *socket) addConn(c *Conn, endpoint string) {
+	var w *msgWriter
+	if sck.w != nil {
+		w = newMsgWriter(c)
+		w.ep = endpoint
+		w.tr = sck.tracer
+		w.log = sck.log
+		w.st = &sck.stats
+	}
+	c.ep = endpoint
+	c.connected = time.Now()
+	if uuid, ok := c.Peer.Meta[sysSockID]; ok && sck.typ == Router {
+		sck.collide(uuid, endpoint)
+	}
+	if sck.probing() && !c.raw {
+		// the probe goes out before any message queued for the peer.
+		if err := c.SendMsg(NewMsg(nil)); err != nil {
+			logf(sck.log, LevelWarn, "zmq4: could not send probe to %q: %+v", endpoint, err)
+		}
+	}
+	c.onClose = func(c *Conn) {
+		sck.rmConn(c)
+		if w != nil {
+			sck.w.rmConn(w)
+		}
+		sck.emit(Event{Type: EventDisconnected, Endpoint: endpoint})
+	}
 	sck.mu.Lock()
 	sck.conns = append(sck.conns, c)
 	uuid, ok := c.Peer.Meta[sysSockID]
@@ -244,12 +1246,187 @@ func (sck *socket) addConn(c *Conn) {
 	}
 	sck.ids[uuid] = c
 	if sck.r != nil {
-		sck.r.addConn(newMsgReader(c))
+		if r, ok := sck.r.(hwmSetter); ok {
+			r.setHWM(sck.rcvhwm)
+		}
+		rr := newMsgReader(c)
+		rr.ep = endpoint
+		rr.tr = sck.tracer
+		rr.log = sck.log
+		rr.st = &sck.stats
+		sck.r.addConn(rr)
 	}
-	if sck.w != nil {
-		sck.w.addConn(newMsgWriter(c))
+	if w != nil {
+		if ww, ok := sck.w.(hwmSetter); ok {
+			ww.setHWM(sck.sndhwm)
+		}
+		sck.w.addConn(w)
 	}
+	sck.sem.enable()
 	sck.mu.Unlock()
+	sck.watchers.notify()
+
+	if c.raw || c.multicast() {
+		return
+	}
+	if sck.onConn != nil {
+		sck.onConn(c)
+	}
+	if sck.hbivl > 0 && c.pings() {
+		timeout := sck.hbtimeout
+		if timeout <= 0 {
+			timeout = sck.hbivl
+		}
+		go c.heartbeat(sck.ctx, sck.hbivl, timeout)
+	}
+	if sck.ahbivl > 0 && c.ahb {
+		timeout := sck.ahbtimeout
+		if timeout <= 0 {
+			timeout = sck.ahbivl
+		}
+		go c.appHeartbeat(sck.ctx, sck.ahbivl, timeout)
+	}
+	if sck.r == nil {
+		// write-only sockets still read from their peers, to get the
+		// heartbeat replies and to notice peers going away: peers are
+		// dropped from the ready peers as soon as they disconnect.
+		go func() {
+			for {
+				msg := c.recv()
+				if msg.err != nil {
+					c.Close()
+					return
+				}
+			}
+		}()
+	}
+}
+
+// collide handles a new connection from a peer announcing the identity of
+// an already connected peer.
+// The collision is reported to the monitors of the socket, and the old
+// connection is closed when identities are handed over.
+func (sck *socket) collide(uuid, endpoint string) {
+	sck.mu.RLock()
+	old, ok := sck.ids[uuid]
+	handover := sck.handover
+	sck.mu.RUnlock()
+	if !ok {
+		return
+	}
+	sck.emit(Event{
+		Type:     EventIdentityConflict,
+		Endpoint: endpoint,
+		Err:      errors.Errorf("zmq4: peer identity %q already in use", uuid),
+	})
+	if handover {
+		// closing the old connection removes it from the routing table
+		// before the new one is added.
+		old.Close()
+	}
+}
+
+// getProbe returns OptionProbeRouter.
+func (sck *socket) getProbe() bool {
+	sck.mu.RLock()
+	defer sck.mu.RUnlock()
+	return sck.probe
+}
+
+// probing returns whether new peers are sent an empty probe message.
+func (sck *socket) probing() bool {
+	sck.mu.RLock()
+	defer sck.mu.RUnlock()
+	return sck.probe && (sck.typ == Router || sck.typ == Dealer)
+}
+
+// full returns whether the socket reached its maximum number of peers.
+func (sck *socket) full() bool {
+	sck.mu.RLock()
+	defer sck.mu.RUnlock()
+	return sck.maxconns > 0 && len(sck.conns) >= sck.maxconns
+}
+
+// rmConn removes a closed connection from the socket.
+func (sck *socket) rmConn(c *Conn) {
+	defer sck.watchers.notify()
+	sck.mu.Lock()
+	defer sck.mu.Unlock()
+
+	cur := -1
+	for i := range sck.conns {
+		if sck.conns[i] == c {
+			cur = i
+			break
+		}
+	}
+	if cur >= 0 {
+		sck.conns = append(sck.conns[:cur], sck.conns[cur+1:]...)
+		sck.sem.disable()
+	}
+
+	uuid := c.Peer.Meta[sysSockID]
+	if sck.ids[uuid] == c {
+		delete(sck.ids, uuid)
+	}
+}
+
+// Monitor returns a channel receiving the lifecycle events of the socket.
+func (sck *socket) Monitor() <-chan Event {
+	return sck.mon.subscribe()
+}
+
+// WaitConnected blocks until at least one peer is connected to the socket,
+// ctx is done or the socket is closed.
+func (sck *socket) WaitConnected(ctx context.Context) error {
+	select {
+	case <-sck.ctx.Done():
+		return sck.ctx.Err()
+	default:
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-sck.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return sck.sem.wait(ctx)
+}
+
+// Addr returns the address the socket is listening on, or nil if
+// the socket is not listening.
+// If Listen was called several times, the address of the most recent
+// listener is returned.
+func (sck *socket) Addr() net.Addr {
+	sck.mu.RLock()
+	defer sck.mu.RUnlock()
+	if len(sck.listeners) == 0 {
+		return nil
+	}
+	return sck.listeners[len(sck.listeners)-1].Addr()
+}
+
+// BoundEndpoints returns the endpoints the socket is listening on,
+// in the order they were bound.
+func (sck *socket) BoundEndpoints() []string {
+	sck.mu.RLock()
+	defer sck.mu.RUnlock()
+	eps := make([]string, len(sck.bound))
+	copy(eps, sck.bound)
+	return eps
+}
+
+// DialEndpoints returns the endpoints the socket is connected to,
+// in the order they were dialed.
+func (sck *socket) DialEndpoints() []string {
+	sck.mu.RLock()
+	defer sck.mu.RUnlock()
+	eps := make([]string, len(sck.dialed))
+	copy(eps, sck.dialed)
+	return eps
 }
 
 // Type returns the type of this Socket (PUB, SUB, ...)
@@ -257,25 +1434,289 @@ func (sck *socket) Type() SocketType {
 	return sck.typ
 }
 
+// ConnMetadata returns the metadata announced by the peer whose identity
+// is peer, or nil if no such peer is connected to the socket.
+func (sck *socket) ConnMetadata(peer string) map[string]string {
+	sck.mu.RLock()
+	defer sck.mu.RUnlock()
+	c, ok := sck.ids[peer]
+	if !ok {
+		return nil
+	}
+	md := make(map[string]string, len(c.Peer.Meta))
+	for k, v := range c.Peer.Meta {
+		md[k] = v
+	}
+	return md
+}
+
+// emit records the error of ev, if any, and sends ev to the
+// subscribers of the socket events.
+func (sck *socket) emit(ev Event) {
+	if ev.Err != nil {
+		sck.stats.setErr(ev.Endpoint, ev.Err)
+	}
+	sck.logEvent(ev)
+	sck.mon.emit(ev)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (sck *socket) CloseIdle(maxIdle time.Duration) int {
+	sck.mu.RLock()
+	var idle []*Conn
+	for _, c := range sck.conns {
+		if c.idle() > maxIdle {
+			idle = append(idle, c)
+		}
+	}
+	sck.mu.RUnlock()
+
+	for _, c := range idle {
+		c.Close()
+	}
+	return len(idle)
+}
+
+// ConnHandshake returns the durations of the handshake phases with the
+// peer whose identity is peer.
+func (sck *socket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	sck.mu.RLock()
+	defer sck.mu.RUnlock()
+	c, ok := sck.ids[peer]
+	if !ok {
+		return HandshakeTimings{}, false
+	}
+	return c.Handshake, true
+}
+
+// PeerConn returns the network connection to the peer whose identity
+// is peer.
+func (sck *socket) PeerConn(peer string) (net.Conn, error) {
+	sck.mu.RLock()
+	c, ok := sck.ids[peer]
+	sck.mu.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("zmq4: no peer %q connected", peer)
+	}
+	nc := c.UnderlyingConn()
+	if nc == nil {
+		return nil, errors.Errorf("zmq4: peer %q is not connected over a network connection", peer)
+	}
+	return nc, nil
+}
+
 // GetOption is used to retrieve an option for a socket.
 func (sck *socket) GetOption(name string) (interface{}, error) {
-	v, ok := sck.props[name]
-	if !ok {
-		return nil, ErrBadProperty
+	sck.mu.RLock()
+	defer sck.mu.RUnlock()
+
+	switch name {
+	case OptionIdentity:
+		return sck.id, nil
+	case OptionHWM, OptionSendHWM:
+		return sck.sndhwm, nil
+	case OptionRecvHWM:
+		return sck.rcvhwm, nil
+	case OptionLinger:
+		return sck.linger, nil
+	case OptionSendTimeout:
+		return sck.sndtimeo, nil
+	case OptionRecvTimeout:
+		return sck.rcvtimeo, nil
+	case OptionDialerRetry:
+		return sck.retry, nil
+	case OptionDialerTimeout:
+		return sck.dialer.Timeout, nil
+	case OptionHandshakeTimeout:
+		return sck.hstimeo, nil
+	case OptionMaxMsgSize:
+		return sck.maxsz, nil
 	}
-	return v, nil
+	return nil, ErrUnknownOption
 }
 
 // SetOption is used to set an option for a socket.
 func (sck *socket) SetOption(name string, value interface{}) error {
-	// FIXME(sbinet) different socket types support different options.
-	sck.props[name] = value
-	return nil
+	sck.mu.Lock()
+	defer sck.mu.Unlock()
+
+	switch name {
+	case OptionIdentity:
+		var v SocketIdentity
+		switch value := value.(type) {
+		case SocketIdentity:
+			v = value
+		case []byte:
+			v = append(SocketIdentity(nil), value...)
+		default:
+			return ErrBadProperty
+		}
+		if sck.started {
+			return ErrOptionImmutable
+		}
+		sck.id = v
+		return nil
+
+	case OptionHWM, OptionSendHWM, OptionRecvHWM:
+		v, ok := value.(int)
+		if !ok || v < 0 {
+			return ErrBadProperty
+		}
+		switch name {
+		case OptionHWM:
+			sck.sndhwm = v
+			sck.rcvhwm = v
+		case OptionSendHWM:
+			sck.sndhwm = v
+		case OptionRecvHWM:
+			sck.rcvhwm = v
+		}
+		// the queues of the connections added from now on, and the
+		// queue of PAIR sockets, use the new high water marks.
+		if r, ok := sck.r.(hwmSetter); ok {
+			r.setHWM(sck.rcvhwm)
+		}
+		if w, ok := sck.w.(hwmSetter); ok {
+			w.setHWM(sck.sndhwm)
+		}
+		return nil
+
+	case OptionLinger, OptionSendTimeout, OptionRecvTimeout, OptionDialerRetry, OptionDialerTimeout, OptionHandshakeTimeout:
+		v, ok := value.(time.Duration)
+		if !ok || v < 0 {
+			return ErrBadProperty
+		}
+		switch name {
+		case OptionLinger:
+			sck.linger = v
+		case OptionSendTimeout:
+			sck.sndtimeo = v
+		case OptionRecvTimeout:
+			sck.rcvtimeo = v
+		case OptionDialerRetry:
+			sck.retry = v
+		case OptionDialerTimeout:
+			sck.dialer.Timeout = v
+		case OptionHandshakeTimeout:
+			sck.hstimeo = v
+		}
+		return nil
+
+	case OptionMaxMsgSize:
+		v, ok := value.(int64)
+		if !ok {
+			return ErrBadProperty
+		}
+		sck.maxsz = v
+		return nil
+
+	case OptionRouterMandatory, OptionRouterHandover, OptionProbeRouter, OptionXPubVerbose, OptionXPubVerboser:
+		if !supportsOption(sck.typ, name) {
+			return ErrUnknownOption
+		}
+		v, ok := value.(bool)
+		if !ok {
+			return ErrBadProperty
+		}
+		switch name {
+		case OptionRouterMandatory:
+			sck.mandatory = v
+		case OptionRouterHandover:
+			sck.handover = v
+		case OptionProbeRouter:
+			sck.probe = v
+		case OptionXPubVerbose:
+			sck.verbose = v
+		case OptionXPubVerboser:
+			sck.verboser = v
+		}
+		return nil
+	}
+	return ErrUnknownOption
+}
+
+// SetSendDeadline sets the deadline of the send operations issued from
+// now on, like net.Conn does: past the deadline, they fail with
+// context.DeadlineExceeded, whose Timeout method reports true.
+// The deadline applies on top of the send timeout.
+// A zero value clears the deadline.
+func (sck *socket) SetSendDeadline(t time.Time) {
+	sck.mu.Lock()
+	sck.snddl = t
+	sck.mu.Unlock()
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued from
+// now on, like net.Conn does: past the deadline, they fail with
+// context.DeadlineExceeded, whose Timeout method reports true.
+// The deadline applies on top of the receive timeout.
+// A zero value clears the deadline.
+func (sck *socket) SetRecvDeadline(t time.Time) {
+	sck.mu.Lock()
+	sck.rcvdl = t
+	sck.mu.Unlock()
+}
+
+// sendContext returns the context bounding a Send operation issued with ctx.
+func (sck *socket) sendContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	sck.mu.RLock()
+	timeout, deadline := sck.sndtimeo, sck.snddl
+	sck.mu.RUnlock()
+	ctx, cancel := sck.callContext(ctx)
+	ctx, tcancel := context.WithTimeout(ctx, timeout)
+	ctx, dcancel := withDeadline(ctx, deadline)
+	return ctx, func() {
+		dcancel()
+		tcancel()
+		cancel()
+	}
 }
 
-func (sck *socket) timeout() time.Duration {
-	// FIXME(sbinet): extract from options
-	return defaultTimeout
+// recvContext returns the context bounding a Recv operation issued with ctx.
+func (sck *socket) recvContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	sck.mu.RLock()
+	timeout, deadline := sck.rcvtimeo, sck.rcvdl
+	sck.mu.RUnlock()
+	ctx, cancel := sck.callContext(ctx)
+	ctx, dcancel := withDeadline(ctx, deadline)
+	if timeout <= 0 {
+		return ctx, func() {
+			dcancel()
+			cancel()
+		}
+	}
+	ctx, tcancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		tcancel()
+		dcancel()
+		cancel()
+	}
+}
+
+// withDeadline bounds ctx by deadline, unless deadline is zero.
+func withDeadline(ctx context.Context, deadline time.Time) (context.Context, context.CancelFunc) {
+	if deadline.IsZero() {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, deadline)
+}
+
+// callContext returns a context that is done when either ctx or the
+// socket context is done.
+func (sck *socket) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == context.Background() {
+		return context.WithCancel(sck.ctx)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-sck.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
 }
 
 var (
@@ -0,0 +1,180 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSendRetry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, tc := range []struct {
+		name  string
+		retry int
+	}{
+		{"no-retry", 0},
+		{"retry", 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sck := newSocket(ctx, Push, WithSendRetry(tc.retry, 20*time.Millisecond))
+			sck.r = nil
+			sck.w = newLBWriter(sck.ctx)
+			defer sck.Close()
+
+			// the only peer drops before the message is sent.
+			dead, peer := newTestConnPair(t, Push)
+			sck.addConn(dead, "dead")
+			peer.Close()
+
+			// a live peer connects while the send is being retried.
+			live, pull := newTestConnPair(t, Push)
+			defer pull.Close()
+			if tc.retry > 0 {
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					sck.addConn(live, "live")
+				}()
+			}
+
+			msgs := make(chan Msg, 1)
+			go func() {
+				msgs <- pull.read()
+			}()
+
+			err := sck.Send(NewMsgString("hello"))
+			switch {
+			case tc.retry == 0:
+				if err == nil {
+					t.Fatalf("expected an error sending to a dropped peer")
+				}
+				return
+			case err != nil:
+				t.Fatalf("could not send message: %v", err)
+			}
+
+			select {
+			case msg := <-msgs:
+				if msg.err != nil {
+					t.Fatalf("could not recv message: %v", msg.err)
+				}
+				if got, want := string(msg.Frames[0]), "hello"; got != want {
+					t.Fatalf("invalid message: got=%q, want=%q", got, want)
+				}
+			case <-ctx.Done():
+				t.Fatalf("timeout waiting for message")
+			}
+		})
+	}
+}
+
+func TestBufferOptions(t *testing.T) {
+	pool := NewMsgPool()
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		pool *framePool
+	}{
+		{"none", nil, nil},
+		{"msg-pool", []Option{WithMsgPool(pool)}, pool.p},
+		{"msg-pool-then-nil-pool", []Option{WithMsgPool(pool), WithMsgPool(nil)}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sck := newSocket(context.Background(), Pull, tc.opts...)
+			defer sck.cancel()
+			if got, want := sck.pool, tc.pool; got != want {
+				t.Fatalf("invalid pool: got=%p, want=%p", got, want)
+			}
+
+			msg := NewMsgString("hello")
+			sck.recycle(&msg)
+			if got, want := msg.pool, tc.pool; got != want {
+				t.Fatalf("invalid message pool: got=%p, want=%p", got, want)
+			}
+		})
+	}
+}
+
+func TestAppHeartbeatUnsupportedPeer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const interval = 10 * time.Millisecond
+
+	sck := newSocket(ctx, Pull, WithAppHeartbeat(interval, 5*interval))
+	defer sck.Close()
+
+	// the greetings are written before being read: use a buffered
+	// connection rather than a net.Pipe.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer l.Close()
+	p2, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	p1, err := l.Accept()
+	if err != nil {
+		t.Fatalf("could not accept: %v", err)
+	}
+
+	c, err := newConn(p1, nullSecurity{}, Pull, nil, true)
+	if err != nil {
+		t.Fatalf("could not create conn: %v", err)
+	}
+	peer, err := newConn(p2, nullSecurity{}, Push, nil, false)
+	if err != nil {
+		t.Fatalf("could not create peer conn: %v", err)
+	}
+	defer peer.Close()
+	// the peer does not advertise application heartbeats.
+	delete(peer.Meta, appHeartbeatProperty)
+
+	errc := make(chan error, 1)
+	go func() { errc <- peer.init(nullSecurity{}) }()
+	if err := c.init(nullSecurity{}); err != nil {
+		t.Fatalf("could not init conn: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("could not init peer conn: %v", err)
+	}
+	if c.ahb {
+		t.Fatalf("application heartbeats enabled with a peer not advertising them")
+	}
+	sck.addConn(c, "peer")
+
+	pinged := make(chan Msg, 1)
+	go func() { pinged <- peer.read() }()
+
+	// heartbeat-looking frames from the peer are application messages.
+	frame := newAppHeartbeatFrame(appHeartbeatPing, make([]byte, appHeartbeatNonce))
+	for _, want := range [][]byte{frame, []byte("hello")} {
+		if err := peer.SendMsg(NewMsg(want)); err != nil {
+			t.Fatalf("could not send: %v", err)
+		}
+		msg, err := sck.Recv()
+		if err != nil {
+			t.Fatalf("could not recv: %v", err)
+		}
+		if got := msg.Frames[0]; !bytes.Equal(got, want) {
+			t.Fatalf("invalid message: got=%q, want=%q", got, want)
+		}
+	}
+
+	select {
+	case msg := <-pinged:
+		t.Fatalf("peer not advertising application heartbeats received %v", msg)
+	case <-c.done:
+		t.Fatalf("peer not advertising application heartbeats was disconnected")
+	case <-time.After(20 * interval):
+	}
+}
@@ -19,71 +19,43 @@ const (
 	Push   SocketType = "PUSH"   // a ZMQ_PUSH socket
 	XPub   SocketType = "XPUB"   // a ZMQ_XPUB socket
 	XSub   SocketType = "XSUB"   // a ZMQ_XSUB socket
+	Stream SocketType = "STREAM" // a ZMQ_STREAM socket
 )
 
+// peerTypes maps each socket type to the types of the peers it can be
+// connected to, as validated during the ZMTP handshake.
+// STREAM sockets talk to raw TCP peers, not to ZMTP ones.
+// The draft socket types, enabled by the zmq4_draft build tag, are
+// registered by draft.go.
+var peerTypes = map[SocketType][]SocketType{
+	Pair:   {Pair},
+	Pub:    {Sub, XSub},
+	Sub:    {Pub, XPub},
+	Req:    {Rep, Router},
+	Rep:    {Req, Dealer},
+	Dealer: {Rep, Dealer, Router},
+	Router: {Req, Dealer, Router},
+	Pull:   {Push},
+	Push:   {Pull},
+	XPub:   {Sub, XSub},
+	XSub:   {Pub, XPub},
+	Stream: nil,
+}
+
 // IsCompatible checks whether two sockets are compatible and thus
 // can be connected together.
+// IsCompatible panics if sck is not a known socket type.
 // See https://rfc.zeromq.org/spec:23/ZMTP/ for more informations.
 func (sck SocketType) IsCompatible(peer SocketType) bool {
-	switch sck {
-	case Pair:
-		if peer == Pair {
-			return true
-		}
-	case Pub:
-		switch peer {
-		case Sub, XSub:
-			return true
-		}
-	case Sub:
-		switch peer {
-		case Pub, XPub:
-			return true
-		}
-	case Req:
-		switch peer {
-		case Rep, Router:
-			return true
-		}
-	case Rep:
-		switch peer {
-		case Req, Dealer:
-			return true
-		}
-	case Dealer:
-		switch peer {
-		case Rep, Dealer, Router:
-			return true
-		}
-	case Router:
-		switch peer {
-		case Req, Dealer, Router:
-			return true
-		}
-	case Pull:
-		switch peer {
-		case Push:
-			return true
-		}
-	case Push:
-		switch peer {
-		case Pull:
-			return true
-		}
-	case XPub:
-		switch peer {
-		case Sub, XSub:
-			return true
-		}
-	case XSub:
-		switch peer {
-		case Pub, XPub:
+	peers, ok := peerTypes[sck]
+	if !ok {
+		panic("unknown socket-type: \"" + string(sck) + "\"")
+	}
+	for _, p := range peers {
+		if p == peer {
 			return true
 		}
-	default:
-		panic("unknown socket-type: \"" + string(sck) + "\"")
 	}
-
 	return false
 }
 
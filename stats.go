@@ -0,0 +1,128 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats describes the activity of a socket.
+// All the counters but Conns only ever increase over the lifetime of the
+// socket, so they can be exported as monotonic counters.
+type Stats struct {
+	MsgsSent    uint64 // number of messages sent to peers
+	MsgsRecv    uint64 // number of messages received from peers
+	BytesSent   uint64 // number of bytes sent to peers, in the frames of messages
+	BytesRecv   uint64 // number of bytes received from peers, in the frames of messages
+	MsgsDropped uint64 // number of messages dropped for slow subscribers (PUB, XPUB)
+	Reconnects  uint64 // number of dial attempts retried after a failure
+	Conns       int    // current number of connected peers
+
+	// Peers holds the activity of the connected peers, keyed by remote address.
+	Peers map[string]PeerStats
+
+	// Errors holds the last error reported for each endpoint.
+	Errors map[string]error
+}
+
+// PeerStats describes the activity of a connection with a peer.
+type PeerStats struct {
+	Endpoint    string // endpoint the connection was established on
+	MsgsSent    uint64 // number of messages sent to the peer
+	MsgsRecv    uint64 // number of messages received from the peer
+	BytesSent   uint64 // number of bytes sent to the peer
+	BytesRecv   uint64 // number of bytes received from the peer
+	MsgsDropped uint64 // number of messages dropped because the peer was too slow
+}
+
+// counters holds atomically updated message counters.
+type counters struct {
+	msgsSent    uint64
+	msgsRecv    uint64
+	bytesSent   uint64
+	bytesRecv   uint64
+	msgsDropped uint64
+}
+
+func (c *counters) recv(msg Msg) {
+	atomic.AddUint64(&c.msgsRecv, 1)
+	atomic.AddUint64(&c.bytesRecv, uint64(msgSize(msg)))
+}
+
+func (c *counters) dropped() {
+	atomic.AddUint64(&c.msgsDropped, 1)
+}
+
+func msgSize(msg Msg) int {
+	n := 0
+	for _, frame := range msg.Frames {
+		n += len(frame)
+	}
+	return n
+}
+
+// sockStats holds the activity of a socket.
+type sockStats struct {
+	counters
+	reconnects uint64
+
+	mu   sync.Mutex
+	errs map[string]error // last error per endpoint
+}
+
+func (s *sockStats) setErr(endpoint string, err error) {
+	s.mu.Lock()
+	if s.errs == nil {
+		s.errs = make(map[string]error)
+	}
+	s.errs[endpoint] = err
+	s.mu.Unlock()
+}
+
+// Stats returns the activity of the socket.
+func (sck *socket) Stats() Stats {
+	st := &sck.stats
+	stats := Stats{
+		MsgsSent:    atomic.LoadUint64(&st.msgsSent),
+		MsgsRecv:    atomic.LoadUint64(&st.msgsRecv),
+		BytesSent:   atomic.LoadUint64(&st.bytesSent),
+		BytesRecv:   atomic.LoadUint64(&st.bytesRecv),
+		MsgsDropped: atomic.LoadUint64(&st.msgsDropped),
+		Reconnects:  atomic.LoadUint64(&st.reconnects),
+		Peers:       make(map[string]PeerStats),
+		Errors:      make(map[string]error),
+	}
+
+	st.mu.Lock()
+	for k, v := range st.errs {
+		stats.Errors[k] = v
+	}
+	st.mu.Unlock()
+
+	sck.mu.RLock()
+	defer sck.mu.RUnlock()
+	stats.Conns = len(sck.conns)
+	for _, c := range sck.conns {
+		stats.Peers[c.remoteAddr()] = PeerStats{
+			Endpoint:    c.ep,
+			MsgsSent:    atomic.LoadUint64(&c.ctr.msgsSent),
+			MsgsRecv:    atomic.LoadUint64(&c.ctr.msgsRecv),
+			BytesSent:   atomic.LoadUint64(&c.ctr.bytesSent),
+			BytesRecv:   atomic.LoadUint64(&c.ctr.bytesRecv),
+			MsgsDropped: atomic.LoadUint64(&c.ctr.msgsDropped),
+		}
+	}
+	return stats
+}
+
+// remoteAddr returns the address of the peer of the connection.
+func (c *Conn) remoteAddr() string {
+	if conn, ok := c.rw.(net.Conn); ok && conn.RemoteAddr() != nil {
+		return conn.RemoteAddr().String()
+	}
+	return c.ep
+}
@@ -0,0 +1,279 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NewStream returns a new STREAM ZeroMQ socket.
+// The returned socket value is initially unbound.
+//
+// STREAM sockets exchange raw bytes with non-ZeroMQ TCP peers: no ZMTP
+// handshake nor framing is performed.
+// Received messages are made of two frames: the routing identity of
+// the peer, generated for the lifetime of its connection, and the data
+// read from it. An empty data frame signals the connection or the
+// disconnection of the peer.
+// Sent messages must be made of two frames: the routing identity of the
+// peer and the data to write to it. An empty data frame closes the
+// connection to the peer.
+func NewStream(ctx context.Context, opts ...Option) Socket {
+	stream := &streamSocket{newSocket(ctx, Stream, opts...)}
+	stream.sck.raw = true
+	stream.sck.r = newFQReaderHook(stream.sck.ctx, streamRecv)
+	stream.sck.w = newRouterMWriter(stream.sck.ctx)
+	return stream
+}
+
+// streamSocket is a STREAM ZeroMQ socket.
+type streamSocket struct {
+	sck *socket
+}
+
+// Close closes the open Socket
+func (stream *streamSocket) Close() error {
+	return stream.sck.Close()
+}
+
+// Send puts the message on the outbound send queue.
+// Send blocks until the message can be queued or the send deadline expires.
+func (stream *streamSocket) Send(msg Msg) error {
+	return stream.SendContext(context.Background(), msg)
+}
+
+// SendContext puts the message on the outbound send queue.
+// SendContext blocks until the message can be queued, the send deadline
+// expires or ctx is done.
+func (stream *streamSocket) SendContext(ctx context.Context, msg Msg) error {
+	if len(msg.Frames) != 2 {
+		return errors.Errorf("zmq4: STREAM messages must have 2 frames (got=%d)", len(msg.Frames))
+	}
+
+	if len(msg.Frames[1]) == 0 {
+		stream.sck.mu.RLock()
+		conn, ok := stream.sck.ids[string(msg.Frames[0])]
+		stream.sck.mu.RUnlock()
+		if !ok {
+			return nil
+		}
+		return conn.Close()
+	}
+
+	ctx, cancel := stream.sck.sendContext(ctx)
+	defer cancel()
+	return stream.sck.closedErr(stream.sck.w.write(ctx, msg))
+}
+
+// SendBatch sends msgs, in order, one at a time.
+func (stream *streamSocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	return sendEach(ctx, stream.SendContext, msgs)
+}
+
+// Recv receives a complete message.
+func (stream *streamSocket) Recv() (Msg, error) {
+	return stream.sck.Recv()
+}
+
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (stream *streamSocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	return stream.sck.RecvWithMeta()
+}
+
+// Listen connects a local endpoint to the Socket.
+func (stream *streamSocket) Listen(ep string) error {
+	return stream.sck.Listen(ep)
+}
+
+// Dial connects a remote endpoint to the Socket.
+func (stream *streamSocket) Dial(ep string) error {
+	return stream.sck.Dial(ep)
+}
+
+// Unbind stops listening on a local endpoint.
+func (stream *streamSocket) Unbind(ep string) error {
+	return stream.sck.Unbind(ep)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (stream *streamSocket) Disconnect(ep string) error {
+	return stream.sck.Disconnect(ep)
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (stream *streamSocket) WaitConnected(ctx context.Context) error {
+	return stream.sck.WaitConnected(ctx)
+}
+
+// Type returns the type of this Socket (PUB, SUB, ...)
+func (stream *streamSocket) Type() SocketType {
+	return stream.sck.Type()
+}
+
+// GetOption is used to retrieve an option for a socket.
+func (stream *streamSocket) GetOption(name string) (interface{}, error) {
+	return stream.sck.GetOption(name)
+}
+
+// SetOption is used to set an option for a socket.
+func (stream *streamSocket) SetOption(name string, value interface{}) error {
+	return stream.sck.SetOption(name, value)
+}
+
+// streamRecv prepends the peer identity to the data received by a STREAM,
+// and turns the end of a connection into a disconnection message.
+func streamRecv(r *msgReader, msg *Msg) bool {
+	id := []byte(r.r.Peer.Meta[sysSockID])
+	if msg.err != nil {
+		*msg = Msg{Frames: [][]byte{id, {}}}
+		return true
+	}
+	msg.Frames = append([][]byte{id}, msg.Frames...)
+	return true
+}
+
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+// STREAM peers do not announce any metadata.
+func (stream *streamSocket) ConnMetadata(peer string) map[string]string {
+	return stream.sck.ConnMetadata(peer)
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (stream *streamSocket) Monitor() <-chan Event {
+	return stream.sck.Monitor()
+}
+
+// Addr returns the address the Socket is listening on, or nil if
+// the Socket is not listening.
+func (stream *streamSocket) Addr() net.Addr {
+	return stream.sck.Addr()
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (stream *streamSocket) BoundEndpoints() []string {
+	return stream.sck.BoundEndpoints()
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (stream *streamSocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	return stream.sck.ConnHandshake(peer)
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (stream *streamSocket) PeerConn(peer string) (net.Conn, error) {
+	return stream.sck.PeerConn(peer)
+}
+
+// Peers returns the peers connected to the Socket, in the order they
+// connected.
+func (stream *streamSocket) Peers() []PeerInfo {
+	return stream.sck.Peers()
+}
+
+// SendFrame sends a single frame of a message.
+// STREAM sockets exchange raw bytes and can not send messages frame by frame.
+func (stream *streamSocket) SendFrame(frame []byte, more bool) error {
+	return errRawFrame
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (stream *streamSocket) RecvFrame() ([]byte, bool, error) {
+	return stream.sck.recvFrame(stream.Recv)
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+func (stream *streamSocket) SendFrames(rd io.Reader, size int64) error {
+	return stream.sck.SendFrames(rd, size)
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (stream *streamSocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	return stream.sck.recvFrameTo(stream.Recv, w)
+}
+
+// RecvContext receives a complete message.
+// RecvContext returns ctx.Err() without consuming a message if ctx is done
+// first.
+func (stream *streamSocket) RecvContext(ctx context.Context) (Msg, error) {
+	return stream.sck.RecvContext(ctx)
+}
+
+// TrySend sends msg if it can be done without waiting.
+func (stream *streamSocket) TrySend(msg Msg) (bool, error) {
+	return trySend(stream.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (stream *streamSocket) TryRecv() (Msg, bool, error) {
+	return tryRecv(stream.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (stream *streamSocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, stream.TryRecv, stream.RecvContext)
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (stream *streamSocket) SetSendDeadline(t time.Time) {
+	stream.sck.SetSendDeadline(t)
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (stream *streamSocket) SetRecvDeadline(t time.Time) {
+	stream.sck.SetRecvDeadline(t)
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+func (stream *streamSocket) RotateSecurity(sec Security) {
+	stream.sck.RotateSecurity(sec)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (stream *streamSocket) CloseIdle(maxIdle time.Duration) int {
+	return stream.sck.CloseIdle(maxIdle)
+}
+
+// Stats returns the activity of the Socket.
+func (stream *streamSocket) Stats() Stats {
+	return stream.sck.Stats()
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to,
+// in the order they were dialed.
+func (stream *streamSocket) DialEndpoints() []string {
+	return stream.sck.DialEndpoints()
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (stream *streamSocket) Config() ConfigSnapshot {
+	return stream.sck.Config()
+}
+
+// base returns the socket implementing the core of the Socket.
+func (stream *streamSocket) base() *socket {
+	return stream.sck
+}
+
+var (
+	_ Socket = (*streamSocket)(nil)
+)
@@ -0,0 +1,168 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultStreamFrameSize is the default maximum size of the frames sent
+// by a writer created with NewStreamWriter.
+const DefaultStreamFrameSize = 64 << 10
+
+// NewStreamReader returns a reader reassembling the frames of the messages
+// received from s into a flat stream of bytes.
+// Closing the reader closes s.
+func NewStreamReader(s Socket) io.ReadCloser {
+	return &streamReader{sck: s}
+}
+
+type streamReader struct {
+	sck Socket
+	msg Msg // message being read
+	cur int // index of the frame being read
+	off int // offset in the frame being read
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for r.cur >= len(r.msg.Frames) {
+		r.msg.Release()
+		msg, err := r.sck.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.msg = msg
+		r.cur = 0
+		r.off = 0
+	}
+
+	n := 0
+	for n < len(p) && r.cur < len(r.msg.Frames) {
+		frame := r.msg.Frames[r.cur][r.off:]
+		c := copy(p[n:], frame)
+		n += c
+		r.off += c
+		if c == len(frame) {
+			r.cur++
+			r.off = 0
+		}
+	}
+	return n, nil
+}
+
+func (r *streamReader) Close() error {
+	r.msg.Release()
+	return r.sck.Close()
+}
+
+// NewStreamWriter returns a writer sending the bytes written to it over s,
+// split into frames of at most DefaultStreamFrameSize bytes.
+// Closing the writer closes s.
+func NewStreamWriter(s Socket) io.WriteCloser {
+	return NewStreamWriterSize(s, DefaultStreamFrameSize)
+}
+
+// NewStreamWriterSize returns a writer sending the bytes written to it over s,
+// split into frames of at most size bytes.
+// Each call to Write sends a single multipart message, so a write is
+// received as a whole by a single peer.
+// Closing the writer closes s.
+func NewStreamWriterSize(s Socket, size int) io.WriteCloser {
+	if size <= 0 {
+		size = DefaultStreamFrameSize
+	}
+	return &streamWriter{sck: s, size: size}
+}
+
+type streamWriter struct {
+	sck  Socket
+	size int // maximum size of a frame
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// some sockets queue messages: p must not be retained.
+	buf := make([]byte, len(p))
+	copy(buf, p)
+
+	frames := make([][]byte, 0, (len(buf)+w.size-1)/w.size)
+	for beg := 0; beg < len(buf); beg += w.size {
+		end := beg + w.size
+		if end > len(buf) {
+			end = len(buf)
+		}
+		frames = append(frames, buf[beg:end])
+	}
+	err := w.sck.Send(NewMsgFrom(frames...))
+	if err != nil {
+		return 0, errors.Wrapf(err, "zmq4: could not write %d bytes", len(p))
+	}
+	return len(p), nil
+}
+
+func (w *streamWriter) Close() error {
+	return w.sck.Close()
+}
+
+// frameStream is the body of a large frame, read from the wire by the
+// receiver of its message instead of being assembled in memory.
+// The connection is not read from until the body is consumed.
+type frameStream struct {
+	r    io.Reader // body of the frame, limited to its size
+	size int64
+	once sync.Once
+	done chan struct{} // closed once the body is consumed
+}
+
+func newFrameStream(r io.Reader, size int64) *frameStream {
+	return &frameStream{
+		r:    io.LimitReader(r, size),
+		size: size,
+		done: make(chan struct{}),
+	}
+}
+
+// writeTo copies the body of the frame to w.
+// The rest of the body is discarded if w fails, so the next message can
+// be read from the connection.
+func (s *frameStream) writeTo(w io.Writer) (int64, error) {
+	defer s.release()
+	n, err := io.Copy(w, s.r)
+	if err != nil {
+		io.Copy(ioutil.Discard, s.r)
+		return n, errors.Wrapf(err, "zmq4: could not stream frame")
+	}
+	if n < s.size {
+		return n, errors.Wrapf(io.ErrUnexpectedEOF, "zmq4: could not stream frame")
+	}
+	return n, nil
+}
+
+// assemble reads the body of the frame into the frames of msg, for the
+// receivers of complete messages.
+func (s *frameStream) assemble(msg *Msg) error {
+	defer s.release()
+	frame := make([]byte, s.size)
+	if _, err := io.ReadFull(s.r, frame); err != nil {
+		return errors.Wrapf(err, "zmq4: could not read frame")
+	}
+	msg.Frames = append(msg.Frames, frame)
+	msg.stream = nil
+	return nil
+}
+
+// release lets the connection be read from again.
+func (s *frameStream) release() {
+	s.once.Do(func() { close(s.done) })
+}
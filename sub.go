@@ -5,16 +5,21 @@
 package zmq4
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"net"
 	"sync"
+	"time"
 )
 
 // NewSub returns a new SUB ZeroMQ socket.
 // The returned socket value is initially unbound.
-func NewSub(ctx context.Context, opts ...Option) Socket {
+func NewSub(ctx context.Context, opts ...Option) SubSocket {
 	sub := &subSocket{sck: newSocket(ctx, Sub, opts...)}
-	sub.sck.r = newQReader(sub.sck.ctx)
-	sub.topics = make(map[string]struct{})
+	sub.sck.r = newFQReaderHook(sub.sck.ctx, sub.filter)
+	sub.topics = make(map[string]int)
+	sub.sck.onConn = sub.greet
 	return sub
 }
 
@@ -23,7 +28,11 @@ type subSocket struct {
 	sck *socket
 
 	mu     sync.RWMutex
-	topics map[string]struct{}
+	topics map[string]int // number of subscriptions to each topic
+	smu    sync.Mutex     // orders subscription changes sent to peers
+
+	pmu  sync.Mutex
+	prev *Msg // last delivered message, when dropping duplicates
 }
 
 // Close closes the open Socket
@@ -39,7 +48,18 @@ func (sub *subSocket) Send(msg Msg) error {
 
 // Recv receives a complete message.
 func (sub *subSocket) Recv() (Msg, error) {
-	return sub.sck.Recv()
+	return sub.RecvContext(context.Background())
+}
+
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (sub *subSocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	for {
+		msg, meta, err := sub.sck.RecvWithMeta()
+		if err != nil || !sub.duplicate(&msg) {
+			return msg, meta, err
+		}
+	}
 }
 
 // Listen connects a local endpoint to the Socket.
@@ -48,23 +68,56 @@ func (sub *subSocket) Listen(ep string) error {
 }
 
 // Dial connects a remote endpoint to the Socket.
+// Subscriptions are sent to the remote end once connected.
 func (sub *subSocket) Dial(ep string) error {
-	err := sub.sck.Dial(ep)
-	if err != nil {
-		return err
-	}
-	// send our subscriptions to the remote end...
+	return sub.sck.Dial(ep)
+}
+
+// Unbind stops listening on a local endpoint.
+func (sub *subSocket) Unbind(ep string) error {
+	return sub.sck.Unbind(ep)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (sub *subSocket) Disconnect(ep string) error {
+	return sub.sck.Disconnect(ep)
+}
+
+// greet sends the current subscriptions to the new peer c, whether it
+// was dialed or accepted.
+func (sub *subSocket) greet(c *Conn) {
+	sub.smu.Lock()
+	defer sub.smu.Unlock()
 	sub.mu.RLock()
 	defer sub.mu.RUnlock()
 	for k := range sub.topics {
-		topic := append([]byte{1}, k...)
-		msg := NewMsg(topic)
-		err := sub.Send(msg)
+		err := c.SendMsg(NewMsg(append([]byte{1}, k...)))
 		if err != nil {
-			return err
+			logf(sub.sck.log, LevelWarn, "zmq4: could not send subscription to %q: %+v", c.ep, err)
+			return
 		}
 	}
-	return nil
+}
+
+// filter drops the messages received from multicast groups that match
+// no subscription: multicast senders publish all their messages.
+func (sub *subSocket) filter(r *msgReader, msg *Msg) bool {
+	if !r.r.multicast() || len(msg.Frames) == 0 {
+		return true
+	}
+	sub.mu.RLock()
+	defer sub.mu.RUnlock()
+	for topic := range sub.topics {
+		if bytes.HasPrefix(msg.Frames[0], []byte(topic)) {
+			return true
+		}
+	}
+	return false
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (sub *subSocket) WaitConnected(ctx context.Context) error {
+	return sub.sck.WaitConnected(ctx)
 }
 
 // Type returns the type of this Socket (PUB, SUB, ...)
@@ -78,50 +131,315 @@ func (sub *subSocket) GetOption(name string) (interface{}, error) {
 }
 
 // SetOption is used to set an option for a socket.
+// Subscriptions and unsubscriptions are sent to all connected peers, and
+// subscriptions to the peers connecting later on.
 func (sub *subSocket) SetOption(name string, value interface{}) error {
-	err := sub.sck.SetOption(name, value)
-	if err != nil {
-		return err
-	}
-
 	var (
 		topic []byte
 	)
 
+	// a peer connecting concurrently must not receive a subscription
+	// after its unsubscription.
+	sub.smu.Lock()
+	defer sub.smu.Unlock()
+
 	switch name {
 	case OptionSubscribe:
-		k := value.(string)
-		sub.subscribe(k, 1)
+		k, ok := value.(string)
+		if !ok {
+			return ErrBadProperty
+		}
+		if !sub.subscribe(k, 1) {
+			return nil
+		}
 		topic = append([]byte{1}, k...)
 
 	case OptionUnsubscribe:
-		k := value.(string)
+		k, ok := value.(string)
+		if !ok {
+			return ErrBadProperty
+		}
+		if !sub.subscribe(k, 0) {
+			return nil
+		}
 		topic = append([]byte{0}, k...)
-		sub.subscribe(k, 0)
 
 	default:
-		return ErrBadProperty
+		return sub.sck.SetOption(name, value)
 	}
 
-	sub.sck.mu.RLock()
-	if len(sub.sck.conns) > 0 {
-		err = sub.Send(NewMsg(topic))
+	return sub.forward(topic)
+}
+
+// SubscribeAll subscribes the SUB socket to all topics, by subscribing to
+// the empty topic.
+func (sub *subSocket) SubscribeAll() error {
+	return sub.SetOption(OptionSubscribe, "")
+}
+
+// UnsubscribeAll removes all the subscriptions of the SUB socket, however
+// many times each topic was subscribed to.
+func (sub *subSocket) UnsubscribeAll() error {
+	sub.smu.Lock()
+	defer sub.smu.Unlock()
+
+	sub.mu.Lock()
+	topics := make([]string, 0, len(sub.topics))
+	for k := range sub.topics {
+		topics = append(topics, k)
+	}
+	sub.topics = make(map[string]int)
+	sub.mu.Unlock()
+
+	for _, k := range sortedTopics(topics) {
+		if err := sub.forward(append([]byte{0}, k...)); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// forward sends the (un)subscription command topic to the connected peers.
+// forward must be called with sub.smu held.
+func (sub *subSocket) forward(topic []byte) error {
+	sub.sck.mu.RLock()
+	n := len(sub.sck.conns)
 	sub.sck.mu.RUnlock()
-	return err
+	if n == 0 {
+		return nil
+	}
+	return sub.Send(NewMsg(topic))
 }
 
-func (sub *subSocket) subscribe(topic string, v int) {
+// subscribe adds (v=1) or removes (v=0) a subscription to topic.
+// Subscriptions are reference-counted: subscribe reports whether the
+// (un)subscription must be forwarded to the peers, i.e. whether topic was
+// the first subscription to that topic or its last unsubscription.
+func (sub *subSocket) subscribe(topic string, v int) bool {
 	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	n := sub.topics[topic]
 	switch v {
 	case 0:
-		delete(sub.topics, topic)
-	case 1:
-		sub.topics[topic] = struct{}{}
+		switch n {
+		case 0:
+			return false
+		case 1:
+			delete(sub.topics, topic)
+			return true
+		}
+		sub.topics[topic] = n - 1
+		return false
+	default:
+		sub.topics[topic] = n + 1
+		return n == 0
 	}
-	sub.mu.Unlock()
+}
+
+// SubscriptionCount returns the number of subscriptions to topic:
+// a topic subscribed to n times stays subscribed until it has been
+// unsubscribed from n times.
+func (sub *subSocket) SubscriptionCount(topic string) int {
+	sub.mu.RLock()
+	defer sub.mu.RUnlock()
+	return sub.topics[topic]
+}
+
+// Subscriptions returns the sorted list of topics the SUB socket
+// is subscribed to.
+func (sub *subSocket) Subscriptions() [][]byte {
+	sub.mu.RLock()
+	defer sub.mu.RUnlock()
+	topics := make([]string, 0, len(sub.topics))
+	for k := range sub.topics {
+		topics = append(topics, k)
+	}
+	return sortedTopics(topics)
+}
+
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+func (sub *subSocket) ConnMetadata(peer string) map[string]string {
+	return sub.sck.ConnMetadata(peer)
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (sub *subSocket) Monitor() <-chan Event {
+	return sub.sck.Monitor()
+}
+
+// Addr returns the address the Socket is listening on, or nil if
+// the Socket is not listening.
+func (sub *subSocket) Addr() net.Addr {
+	return sub.sck.Addr()
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (sub *subSocket) BoundEndpoints() []string {
+	return sub.sck.BoundEndpoints()
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (sub *subSocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	return sub.sck.ConnHandshake(peer)
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (sub *subSocket) PeerConn(peer string) (net.Conn, error) {
+	return sub.sck.PeerConn(peer)
+}
+
+// Peers returns the peers connected to the Socket, in the order they
+// connected.
+func (sub *subSocket) Peers() []PeerInfo {
+	return sub.sck.Peers()
+}
+
+// SendFrame sends a single frame of a message.
+// More frames of the same message follow when more is true.
+func (sub *subSocket) SendFrame(frame []byte, more bool) error {
+	return sub.sck.SendFrame(frame, more)
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (sub *subSocket) RecvFrame() ([]byte, bool, error) {
+	return sub.sck.recvFrame(sub.Recv)
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+func (sub *subSocket) SendFrames(rd io.Reader, size int64) error {
+	return sub.sck.SendFrames(rd, size)
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (sub *subSocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	if sub.sck.dedup {
+		return sub.sck.recvFrameTo(sub.Recv, w)
+	}
+	return sub.sck.RecvFrameTo(w)
+}
+
+// SendContext puts the message on the outbound send queue.
+// SendContext blocks until the message can be queued, the send deadline
+// expires or ctx is done.
+func (sub *subSocket) SendContext(ctx context.Context, msg Msg) error {
+	return sub.sck.SendContext(ctx, msg)
+}
+
+// SendBatch sends msgs, in order, in as few writes as possible.
+func (sub *subSocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	return sub.sck.SendBatch(ctx, msgs)
+}
+
+// RecvContext receives a complete message.
+// RecvContext returns ctx.Err() without consuming a message if ctx is done
+// first.
+func (sub *subSocket) RecvContext(ctx context.Context) (Msg, error) {
+	for {
+		msg, err := sub.sck.RecvContext(ctx)
+		if err != nil || !sub.duplicate(&msg) {
+			return msg, err
+		}
+	}
+}
+
+// TrySend sends msg if it can be done without waiting.
+func (sub *subSocket) TrySend(msg Msg) (bool, error) {
+	return trySend(sub.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (sub *subSocket) TryRecv() (Msg, bool, error) {
+	return tryRecv(sub.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (sub *subSocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, sub.TryRecv, sub.RecvContext)
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (sub *subSocket) SetSendDeadline(t time.Time) {
+	sub.sck.SetSendDeadline(t)
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (sub *subSocket) SetRecvDeadline(t time.Time) {
+	sub.sck.SetRecvDeadline(t)
+}
+
+// duplicate reports whether msg must be dropped as a duplicate of the
+// previously delivered message, and remembers msg otherwise.
+func (sub *subSocket) duplicate(msg *Msg) bool {
+	if !sub.sck.dedup {
+		return false
+	}
+
+	sub.pmu.Lock()
+	defer sub.pmu.Unlock()
+	if sub.prev != nil && equalFrames(sub.prev.Frames, msg.Frames) {
+		msg.Release()
+		return true
+	}
+	prev := msg.Clone()
+	sub.prev = &prev
+	return false
+}
+
+func equalFrames(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+func (sub *subSocket) RotateSecurity(sec Security) {
+	sub.sck.RotateSecurity(sec)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (sub *subSocket) CloseIdle(maxIdle time.Duration) int {
+	return sub.sck.CloseIdle(maxIdle)
+}
+
+// Stats returns the activity of the Socket.
+func (sub *subSocket) Stats() Stats {
+	return sub.sck.Stats()
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to,
+// in the order they were dialed.
+func (sub *subSocket) DialEndpoints() []string {
+	return sub.sck.DialEndpoints()
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (sub *subSocket) Config() ConfigSnapshot {
+	return sub.sck.Config()
+}
+
+// base returns the socket implementing the core of the Socket.
+func (sub *subSocket) base() *socket {
+	return sub.sck
 }
 
 var (
-	_ Socket = (*subSocket)(nil)
+	_ SubSocket = (*subSocket)(nil)
 )
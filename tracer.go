@@ -0,0 +1,58 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Tracer is notified of the messages sent and received by a socket.
+// Tracer methods are called from the goroutines reading and writing
+// connections and must be safe for concurrent use.
+type Tracer interface {
+	// TraceRecv is called with every message read from
+	// a connection on endpoint.
+	TraceRecv(endpoint string, msg Msg)
+
+	// TraceSend is called with every message about to be written to
+	// a connection on endpoint.
+	TraceSend(endpoint string, msg Msg)
+}
+
+// NewLogTracer returns a Tracer writing a line per traced message to w,
+// followed by a line per frame holding at most its first 64 bytes.
+func NewLogTracer(w io.Writer) Tracer {
+	return &logTracer{w: w}
+}
+
+type logTracer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (t *logTracer) TraceRecv(endpoint string, msg Msg) {
+	t.trace("recv", endpoint, msg)
+}
+
+func (t *logTracer) TraceSend(endpoint string, msg Msg) {
+	t.trace("send", endpoint, msg)
+}
+
+func (t *logTracer) trace(dir, endpoint string, msg Msg) {
+	const max = 64
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fmt.Fprintf(t.w, "zmq4: %s %s frames=%d\n", endpoint, dir, len(msg.Frames))
+	for i, frame := range msg.Frames {
+		if len(frame) > max {
+			frame = frame[:max]
+		}
+		fmt.Fprintf(t.w, "zmq4:   [%d] %q\n", i, frame)
+	}
+}
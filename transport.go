@@ -0,0 +1,76 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"crypto/tls"
+	"net"
+
+	"github.com/go-zeromq/zmq4/internal/inproc"
+)
+
+// transport describes how sockets listen on and dial the endpoints of a
+// transport, identified by the scheme of the endpoints.
+type transport struct {
+	listen func(sck *socket, addr string) (net.Listener, error)
+	dial   func(sck *socket, addr string) (net.Conn, error)
+
+	// multicast transports join their group, see listenPGM and dialPGM,
+	// in place of listening and dialing.
+	multicast bool
+}
+
+// transports is the registry of the transports, indexed by scheme.
+// The pgm and epgm multicast transports are registered with the zmq4_draft
+// build tag only: lost packets are not repaired yet.
+var transports = map[string]transport{
+	"tcp":    {listen: listenTCP, dial: dialTCP},
+	"ipc":    {listen: listenIPC, dial: dialIPC},
+	"udp":    {listen: listenUDP, dial: dialUDP},
+	"inproc": {listen: listenInproc, dial: dialInproc},
+}
+
+func listenTCP(sck *socket, addr string) (net.Listener, error) {
+	l, err := sck.lc.Listen(sck.ctx, sck.tcpnet, addr)
+	if err == nil && sck.tlscfg != nil {
+		l = tls.NewListener(l, sck.tlscfg)
+	}
+	return l, err
+}
+
+func dialTCP(sck *socket, addr string) (net.Conn, error) {
+	conn, err := sck.dialContext(sck.tcpnet, addr)
+	if err == nil && sck.tlscfg != nil {
+		conn = tls.Client(conn, sck.tlsConfig(addr))
+	}
+	return conn, err
+}
+
+func listenIPC(sck *socket, addr string) (net.Listener, error) {
+	if err := prepareIPC(addr); err != nil {
+		return nil, err
+	}
+	return sck.lc.Listen(sck.ctx, "unix", addr)
+}
+
+func dialIPC(sck *socket, addr string) (net.Conn, error) {
+	return sck.dialContext("unix", addr)
+}
+
+func listenUDP(sck *socket, addr string) (net.Listener, error) {
+	return sck.lc.Listen(sck.ctx, "udp", addr)
+}
+
+func dialUDP(sck *socket, addr string) (net.Conn, error) {
+	return sck.dialContext("udp", addr)
+}
+
+func listenInproc(sck *socket, addr string) (net.Listener, error) {
+	return inproc.Listen(addr)
+}
+
+func dialInproc(sck *socket, addr string) (net.Conn, error) {
+	return inproc.Dial(addr)
+}
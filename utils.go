@@ -10,10 +10,15 @@ import (
 	"io"
 	"log"
 	"net"
+	"sort"
 	"strings"
 )
 
 // splitAddr returns the triplet (network, addr, error)
+// IPv6 hosts of tcp and udp endpoints are written as bracketed literals,
+// optionally with a zone identifier (e.g. tcp://[fe80::1%eth0]:5555).
+// A wildcard host (tcp://*:5555 or tcp://:5555) binds to all the
+// interfaces, with both IPv4 and IPv6 where available.
 func splitAddr(v string) (network, addr string, err error) {
 	ep := strings.Split(v, "://")
 	if len(ep) != 2 {
@@ -25,6 +30,9 @@ func splitAddr(v string) (network, addr string, err error) {
 		port string
 	)
 	network = ep[0]
+	if _, ok := transports[network]; !ok {
+		return network, addr, &ErrUnknownTransport{Scheme: network}
+	}
 	switch network {
 	case "tcp", "udp":
 		host, port, err = net.SplitHostPort(ep[1])
@@ -37,9 +45,9 @@ func splitAddr(v string) (network, addr string, err error) {
 		}
 		switch host {
 		case "", "*":
-			host = "0.0.0.0"
+			host = ""
 		}
-		addr = host + ":" + port
+		addr = net.JoinHostPort(host, port)
 		return network, addr, err
 
 	case "ipc":
@@ -49,8 +57,9 @@ func splitAddr(v string) (network, addr string, err error) {
 	case "inproc":
 		host = ep[1]
 		return "inproc", host, nil
-	default:
-		err = fmt.Errorf("zmq4: unknown protocol %q", network)
+	case "pgm", "epgm":
+		// interface;multicast-group:port, parsed by parsePGMAddr.
+		return network, ep[1], nil
 	}
 
 	return network, addr, err
@@ -65,3 +74,13 @@ func newUUID() string {
 	uuid[6] = uuid[6]&^0xf0 | 0x40
 	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
 }
+
+// sortedTopics returns the given topics, sorted, as a list of byte slices.
+func sortedTopics(topics []string) [][]byte {
+	sort.Strings(topics)
+	vs := make([][]byte, len(topics))
+	for i, topic := range topics {
+		vs[i] = []byte(topic)
+	}
+	return vs
+}
@@ -0,0 +1,53 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"testing"
+)
+
+func TestSplitAddr(t *testing.T) {
+	for _, tc := range []struct {
+		ep      string
+		network string
+		addr    string
+		err     bool
+	}{
+		{ep: "tcp://127.0.0.1:5555", network: "tcp", addr: "127.0.0.1:5555"},
+		{ep: "tcp://localhost:5555", network: "tcp", addr: "localhost:5555"},
+		{ep: "tcp://127.0.0.1:*", network: "tcp", addr: "127.0.0.1:0"},
+		{ep: "tcp://*:5555", network: "tcp", addr: ":5555"},
+		{ep: "tcp://:5555", network: "tcp", addr: ":5555"},
+		{ep: "tcp://*:*", network: "tcp", addr: ":0"},
+		{ep: "tcp://[::1]:5555", network: "tcp", addr: "[::1]:5555"},
+		{ep: "tcp://[::1]:*", network: "tcp", addr: "[::1]:0"},
+		{ep: "tcp://[::]:5555", network: "tcp", addr: "[::]:5555"},
+		{ep: "tcp://[::]:0", network: "tcp", addr: "[::]:0"},
+		{ep: "tcp://[fe80::1%eth0]:6000", network: "tcp", addr: "[fe80::1%eth0]:6000"},
+		{ep: "tcp://[fe80::1%eth0]:*", network: "tcp", addr: "[fe80::1%eth0]:0"},
+		{ep: "udp://[2001:db8::1]:5555", network: "udp", addr: "[2001:db8::1]:5555"},
+		{ep: "tcp://::1:5555", network: "tcp", err: true},
+		{ep: "tcp://[::1]", network: "tcp", err: true},
+		{ep: "ipc://tmp-sock", network: "ipc", addr: "tmp-sock"},
+		{ep: "inproc://name", network: "inproc", addr: "name"},
+		{ep: "127.0.0.1:5555", err: true},
+		{ep: "tpc://127.0.0.1:5555", err: true},
+	} {
+		t.Run(tc.ep, func(t *testing.T) {
+			network, addr, err := splitAddr(tc.ep)
+			switch {
+			case tc.err && err == nil:
+				t.Fatalf("expected an error, got addr=%q", addr)
+			case tc.err:
+				return
+			case err != nil:
+				t.Fatalf("could not split %q: %v", tc.ep, err)
+			}
+			if network != tc.network || addr != tc.addr {
+				t.Fatalf("invalid split: got=(%q, %q), want=(%q, %q)", network, addr, tc.network, tc.addr)
+			}
+		})
+	}
+}
@@ -6,18 +6,33 @@ package zmq4
 
 import (
 	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
 )
 
 // NewXPub returns a new XPUB ZeroMQ socket.
 // The returned socket value is initially unbound.
-func NewXPub(ctx context.Context, opts ...Option) Socket {
-	xpub := &xpubSocket{newSocket(ctx, XPub, opts...)}
+func NewXPub(ctx context.Context, opts ...Option) XPubSocket {
+	xpub := &xpubSocket{
+		sck:  newSocket(ctx, XPub, opts...),
+		subs: make(map[string]map[*Conn]struct{}),
+	}
+	xpub.sck.r = newFQReaderHook(xpub.sck.ctx, xpub.recv)
+	w := newPubMWriter(xpub.sck.ctx)
+	w.welcome = xpub.sck.welcome
+	w.lazy = true
+	xpub.sck.w = w
 	return xpub
 }
 
 // xpubSocket is a XPUB ZeroMQ socket.
 type xpubSocket struct {
 	sck *socket
+
+	mu   sync.Mutex
+	subs map[string]map[*Conn]struct{} // subscribed peers of each topic
 }
 
 // Close closes the open Socket
@@ -25,8 +40,10 @@ func (xpub *xpubSocket) Close() error {
 	return xpub.sck.Close()
 }
 
-// Send puts the message on the outbound send queue.
-// Send blocks until the message can be queued or the send deadline expires.
+// Send puts the message on the outbound send queue of every subscriber
+// whose subscriptions match the first frame of the message.
+// Send does not block on slow subscribers: the message is dropped for
+// subscribers whose queue is full.
 func (xpub *xpubSocket) Send(msg Msg) error {
 	return xpub.sck.Send(msg)
 }
@@ -36,6 +53,12 @@ func (xpub *xpubSocket) Recv() (Msg, error) {
 	return xpub.sck.Recv()
 }
 
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (xpub *xpubSocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	return xpub.sck.RecvWithMeta()
+}
+
 // Listen connects a local endpoint to the Socket.
 func (xpub *xpubSocket) Listen(ep string) error {
 	return xpub.sck.Listen(ep)
@@ -46,6 +69,21 @@ func (xpub *xpubSocket) Dial(ep string) error {
 	return xpub.sck.Dial(ep)
 }
 
+// Unbind stops listening on a local endpoint.
+func (xpub *xpubSocket) Unbind(ep string) error {
+	return xpub.sck.Unbind(ep)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (xpub *xpubSocket) Disconnect(ep string) error {
+	return xpub.sck.Disconnect(ep)
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (xpub *xpubSocket) WaitConnected(ctx context.Context) error {
+	return xpub.sck.WaitConnected(ctx)
+}
+
 // Type returns the type of this Socket (PUB, SUB, ...)
 func (xpub *xpubSocket) Type() SocketType {
 	return xpub.sck.Type()
@@ -53,6 +91,14 @@ func (xpub *xpubSocket) Type() SocketType {
 
 // GetOption is used to retrieve an option for a socket.
 func (xpub *xpubSocket) GetOption(name string) (interface{}, error) {
+	switch name {
+	case OptionXPubVerbose, OptionXPubVerboser:
+		verbose, verboser := xpub.verbosity()
+		if name == OptionXPubVerbose {
+			return verbose, nil
+		}
+		return verboser, nil
+	}
 	return xpub.sck.GetOption(name)
 }
 
@@ -61,6 +107,238 @@ func (xpub *xpubSocket) SetOption(name string, value interface{}) error {
 	return xpub.sck.SetOption(name, value)
 }
 
+// verbosity returns whether all subscriptions, and whether all
+// unsubscriptions, are delivered to the application.
+func (xpub *xpubSocket) verbosity() (verbose, verboser bool) {
+	xpub.sck.mu.RLock()
+	defer xpub.sck.mu.RUnlock()
+	return xpub.sck.verbose, xpub.sck.verboser
+}
+
+// PeerSubscriptions returns the sorted list of topics each connected
+// subscriber asked for, indexed by the identity of the subscriber.
+func (xpub *xpubSocket) PeerSubscriptions() map[string][][]byte {
+	xpub.sck.mu.RLock()
+	defer xpub.sck.mu.RUnlock()
+	subs := make(map[string][][]byte, len(xpub.sck.ids))
+	for id, conn := range xpub.sck.ids {
+		subs[id] = conn.subscriptions()
+	}
+	return subs
+}
+
+// recv records the subscription messages received by a XPUB.
+// Subscription messages are still delivered to the application, but only
+// the first subscription to a topic and its last unsubscription, across all
+// the peers: the other ones do not change the set of subscribed topics.
+// In verbose mode, all the subscriptions are delivered. In verboser mode,
+// all the unsubscriptions are delivered too.
+func (xpub *xpubSocket) recv(r *msgReader, msg *Msg) bool {
+	if msg.err != nil {
+		xpub.forget(r.r)
+		return true
+	}
+	if !isTopic(*msg) {
+		return true
+	}
+	xpub.sck.w.(*pubMWriter).subscribe(r.r, *msg)
+	changed := xpub.aggregate(r.r, *msg)
+	verbose, verboser := xpub.verbosity()
+	if msg.Frames[0][0] == 1 {
+		return changed || verbose || verboser
+	}
+	return changed || verboser
+}
+
+// aggregate records the (un)subscription msg of peer c, and reports whether
+// it changes the set of subscribed topics.
+func (xpub *xpubSocket) aggregate(c *Conn, msg Msg) bool {
+	frame := msg.Frames[0]
+	topic := string(frame[1:])
+
+	xpub.mu.Lock()
+	defer xpub.mu.Unlock()
+
+	peers := xpub.subs[topic]
+	switch frame[0] {
+	case 1:
+		if peers == nil {
+			peers = make(map[*Conn]struct{})
+			xpub.subs[topic] = peers
+		}
+		first := len(peers) == 0
+		peers[c] = struct{}{}
+		return first
+	default:
+		if _, ok := peers[c]; !ok {
+			return false
+		}
+		delete(peers, c)
+		if len(peers) > 0 {
+			return false
+		}
+		delete(xpub.subs, topic)
+		return true
+	}
+}
+
+// forget drops the subscriptions of the disconnected peer c.
+func (xpub *xpubSocket) forget(c *Conn) {
+	xpub.mu.Lock()
+	defer xpub.mu.Unlock()
+	for topic, peers := range xpub.subs {
+		delete(peers, c)
+		if len(peers) == 0 {
+			delete(xpub.subs, topic)
+		}
+	}
+}
+
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+func (xpub *xpubSocket) ConnMetadata(peer string) map[string]string {
+	return xpub.sck.ConnMetadata(peer)
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (xpub *xpubSocket) Monitor() <-chan Event {
+	return xpub.sck.Monitor()
+}
+
+// Addr returns the address the Socket is listening on, or nil if
+// the Socket is not listening.
+func (xpub *xpubSocket) Addr() net.Addr {
+	return xpub.sck.Addr()
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (xpub *xpubSocket) BoundEndpoints() []string {
+	return xpub.sck.BoundEndpoints()
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (xpub *xpubSocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	return xpub.sck.ConnHandshake(peer)
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (xpub *xpubSocket) PeerConn(peer string) (net.Conn, error) {
+	return xpub.sck.PeerConn(peer)
+}
+
+// Peers returns the peers connected to the Socket, in the order they
+// connected.
+func (xpub *xpubSocket) Peers() []PeerInfo {
+	return xpub.sck.Peers()
+}
+
+// SendFrame sends a single frame of a message.
+// More frames of the same message follow when more is true.
+func (xpub *xpubSocket) SendFrame(frame []byte, more bool) error {
+	return xpub.sck.SendFrame(frame, more)
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (xpub *xpubSocket) RecvFrame() ([]byte, bool, error) {
+	return xpub.sck.recvFrame(xpub.Recv)
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+func (xpub *xpubSocket) SendFrames(rd io.Reader, size int64) error {
+	return xpub.sck.SendFrames(rd, size)
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (xpub *xpubSocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	return xpub.sck.recvFrameTo(xpub.Recv, w)
+}
+
+// SendContext puts the message on the outbound send queue.
+// SendContext blocks until the message can be queued, the send deadline
+// expires or ctx is done.
+func (xpub *xpubSocket) SendContext(ctx context.Context, msg Msg) error {
+	return xpub.sck.SendContext(ctx, msg)
+}
+
+// SendBatch sends msgs, in order, in as few writes as possible.
+func (xpub *xpubSocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	return xpub.sck.SendBatch(ctx, msgs)
+}
+
+// RecvContext receives a complete message.
+// RecvContext returns ctx.Err() without consuming a message if ctx is done
+// first.
+func (xpub *xpubSocket) RecvContext(ctx context.Context) (Msg, error) {
+	return xpub.sck.RecvContext(ctx)
+}
+
+// TrySend sends msg if it can be done without waiting.
+func (xpub *xpubSocket) TrySend(msg Msg) (bool, error) {
+	return trySend(xpub.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (xpub *xpubSocket) TryRecv() (Msg, bool, error) {
+	return tryRecv(xpub.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (xpub *xpubSocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, xpub.TryRecv, xpub.RecvContext)
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (xpub *xpubSocket) SetSendDeadline(t time.Time) {
+	xpub.sck.SetSendDeadline(t)
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (xpub *xpubSocket) SetRecvDeadline(t time.Time) {
+	xpub.sck.SetRecvDeadline(t)
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+func (xpub *xpubSocket) RotateSecurity(sec Security) {
+	xpub.sck.RotateSecurity(sec)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (xpub *xpubSocket) CloseIdle(maxIdle time.Duration) int {
+	return xpub.sck.CloseIdle(maxIdle)
+}
+
+// Stats returns the activity of the Socket.
+func (xpub *xpubSocket) Stats() Stats {
+	return xpub.sck.Stats()
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to,
+// in the order they were dialed.
+func (xpub *xpubSocket) DialEndpoints() []string {
+	return xpub.sck.DialEndpoints()
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (xpub *xpubSocket) Config() ConfigSnapshot {
+	return xpub.sck.Config()
+}
+
+// base returns the socket implementing the core of the Socket.
+func (xpub *xpubSocket) base() *socket {
+	return xpub.sck
+}
+
 var (
-	_ Socket = (*xpubSocket)(nil)
+	_ XPubSocket = (*xpubSocket)(nil)
 )
@@ -6,6 +6,9 @@ package zmq4
 
 import (
 	"context"
+	"io"
+	"net"
+	"time"
 )
 
 // NewXSub returns a new XSUB ZeroMQ socket.
@@ -36,6 +39,12 @@ func (xsub *xsubSocket) Recv() (Msg, error) {
 	return xsub.sck.Recv()
 }
 
+// RecvWithMeta receives a complete message, together with
+// informations about the state of the Socket at reception time.
+func (xsub *xsubSocket) RecvWithMeta() (Msg, RecvMeta, error) {
+	return xsub.sck.RecvWithMeta()
+}
+
 // Listen connects a local endpoint to the Socket.
 func (xsub *xsubSocket) Listen(ep string) error {
 	return xsub.sck.Listen(ep)
@@ -46,6 +55,21 @@ func (xsub *xsubSocket) Dial(ep string) error {
 	return xsub.sck.Dial(ep)
 }
 
+// Unbind stops listening on a local endpoint.
+func (xsub *xsubSocket) Unbind(ep string) error {
+	return xsub.sck.Unbind(ep)
+}
+
+// Disconnect disconnects a remote endpoint from the Socket.
+func (xsub *xsubSocket) Disconnect(ep string) error {
+	return xsub.sck.Disconnect(ep)
+}
+
+// WaitConnected blocks until at least one peer is connected to the Socket.
+func (xsub *xsubSocket) WaitConnected(ctx context.Context) error {
+	return xsub.sck.WaitConnected(ctx)
+}
+
 // Type returns the type of this Socket (PUB, SUB, ...)
 func (xsub *xsubSocket) Type() SocketType {
 	return xsub.sck.Type()
@@ -61,6 +85,151 @@ func (xsub *xsubSocket) SetOption(name string, value interface{}) error {
 	return xsub.sck.SetOption(name, value)
 }
 
+// ConnMetadata returns the metadata announced during the handshake
+// by the peer identified by the given identity.
+func (xsub *xsubSocket) ConnMetadata(peer string) map[string]string {
+	return xsub.sck.ConnMetadata(peer)
+}
+
+// Monitor returns a channel receiving the lifecycle events of the Socket.
+func (xsub *xsubSocket) Monitor() <-chan Event {
+	return xsub.sck.Monitor()
+}
+
+// Addr returns the address the Socket is listening on, or nil if
+// the Socket is not listening.
+func (xsub *xsubSocket) Addr() net.Addr {
+	return xsub.sck.Addr()
+}
+
+// BoundEndpoints returns the endpoints the Socket is listening on.
+func (xsub *xsubSocket) BoundEndpoints() []string {
+	return xsub.sck.BoundEndpoints()
+}
+
+// ConnHandshake returns the durations of the handshake phases with
+// the peer identified by the given identity.
+func (xsub *xsubSocket) ConnHandshake(peer string) (HandshakeTimings, bool) {
+	return xsub.sck.ConnHandshake(peer)
+}
+
+// PeerConn returns the network connection to the peer identified
+// by the given identity.
+func (xsub *xsubSocket) PeerConn(peer string) (net.Conn, error) {
+	return xsub.sck.PeerConn(peer)
+}
+
+// Peers returns the peers connected to the Socket, in the order they
+// connected.
+func (xsub *xsubSocket) Peers() []PeerInfo {
+	return xsub.sck.Peers()
+}
+
+// SendFrame sends a single frame of a message.
+// More frames of the same message follow when more is true.
+func (xsub *xsubSocket) SendFrame(frame []byte, more bool) error {
+	return xsub.sck.SendFrame(frame, more)
+}
+
+// RecvFrame receives a single frame of a message, and whether more
+// frames of the same message follow.
+func (xsub *xsubSocket) RecvFrame() ([]byte, bool, error) {
+	return xsub.sck.recvFrame(xsub.Recv)
+}
+
+// SendFrames sends a single frame of size bytes, read from r, as the last
+// frame of a message.
+func (xsub *xsubSocket) SendFrames(rd io.Reader, size int64) error {
+	return xsub.sck.SendFrames(rd, size)
+}
+
+// RecvFrameTo writes the next frame of a message to w, and reports the
+// number of bytes written and whether more frames of the same message
+// follow.
+func (xsub *xsubSocket) RecvFrameTo(w io.Writer) (int64, bool, error) {
+	return xsub.sck.RecvFrameTo(w)
+}
+
+// SendContext puts the message on the outbound send queue.
+// SendContext blocks until the message can be queued, the send deadline
+// expires or ctx is done.
+func (xsub *xsubSocket) SendContext(ctx context.Context, msg Msg) error {
+	return xsub.sck.SendContext(ctx, msg)
+}
+
+// SendBatch sends msgs, in order, in as few writes as possible.
+func (xsub *xsubSocket) SendBatch(ctx context.Context, msgs []Msg) error {
+	return xsub.sck.SendBatch(ctx, msgs)
+}
+
+// RecvContext receives a complete message.
+// RecvContext returns ctx.Err() without consuming a message if ctx is done
+// first.
+func (xsub *xsubSocket) RecvContext(ctx context.Context) (Msg, error) {
+	return xsub.sck.RecvContext(ctx)
+}
+
+// TrySend sends msg if it can be done without waiting.
+func (xsub *xsubSocket) TrySend(msg Msg) (bool, error) {
+	return trySend(xsub.SendContext, msg)
+}
+
+// TryRecv receives a complete message if one is already queued.
+func (xsub *xsubSocket) TryRecv() (Msg, bool, error) {
+	return tryRecv(xsub.RecvContext)
+}
+
+// RecvAll receives messages until ctx is done or an empty message is received.
+func (xsub *xsubSocket) RecvAll(ctx context.Context) ([]Msg, error) {
+	return recvAll(ctx, xsub.TryRecv, xsub.RecvContext)
+}
+
+// SetSendDeadline sets the deadline of the send operations issued
+// from now on.
+func (xsub *xsubSocket) SetSendDeadline(t time.Time) {
+	xsub.sck.SetSendDeadline(t)
+}
+
+// SetRecvDeadline sets the deadline of the receive operations issued
+// from now on.
+func (xsub *xsubSocket) SetRecvDeadline(t time.Time) {
+	xsub.sck.SetRecvDeadline(t)
+}
+
+// RotateSecurity replaces the security mechanism used by the connections
+// established from now on. Established connections keep the mechanism,
+// and thus the keys, they negotiated during their handshake.
+func (xsub *xsubSocket) RotateSecurity(sec Security) {
+	xsub.sck.RotateSecurity(sec)
+}
+
+// CloseIdle closes the connections on which no message was read nor
+// written within maxIdle, and returns the number of closed connections.
+func (xsub *xsubSocket) CloseIdle(maxIdle time.Duration) int {
+	return xsub.sck.CloseIdle(maxIdle)
+}
+
+// Stats returns the activity of the Socket.
+func (xsub *xsubSocket) Stats() Stats {
+	return xsub.sck.Stats()
+}
+
+// DialEndpoints returns the endpoints the Socket is connected to,
+// in the order they were dialed.
+func (xsub *xsubSocket) DialEndpoints() []string {
+	return xsub.sck.DialEndpoints()
+}
+
+// Config returns a snapshot of the effective configuration of the Socket.
+func (xsub *xsubSocket) Config() ConfigSnapshot {
+	return xsub.sck.Config()
+}
+
+// base returns the socket implementing the core of the Socket.
+func (xsub *xsubSocket) base() *socket {
+	return xsub.sck
+}
+
 var (
 	_ Socket = (*xsubSocket)(nil)
 )
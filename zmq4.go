@@ -7,6 +7,13 @@
 // For more informations, see http://zeromq.org.
 package zmq4
 
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+)
+
 // Socket represents a ZeroMQ socket.
 type Socket interface {
 	// Close closes the open Socket
@@ -19,18 +26,227 @@ type Socket interface {
 	// Recv receives a complete message.
 	Recv() (Msg, error)
 
+	// SendContext puts the message on the outbound send queue.
+	// SendContext blocks until the message can be queued, the send deadline
+	// expires or ctx is done. A message is either sent as a whole or not
+	// at all.
+	SendContext(ctx context.Context, msg Msg) error
+
+	// SendBatch sends msgs, in order, like SendContext does, but hands
+	// them to the transport in as few writes as possible.
+	// Load-balancing sockets (PUSH, DEALER) send all the messages of a
+	// batch to a single peer; other sockets send them one at a time.
+	// SendBatch stops at the first message that could not be sent.
+	SendBatch(ctx context.Context, msgs []Msg) error
+
+	// RecvContext receives a complete message.
+	// RecvContext returns ctx.Err() without consuming a message if ctx is
+	// done before a message is available.
+	RecvContext(ctx context.Context) (Msg, error)
+
+	// TrySend sends msg if it can be done without waiting for a peer to
+	// connect or for room in the send queue, like ZMQ_DONTWAIT.
+	// TrySend returns false, without error, if msg could not be sent
+	// right away.
+	TrySend(msg Msg) (bool, error)
+
+	// TryRecv receives a complete message if one is already queued,
+	// like ZMQ_DONTWAIT.
+	// TryRecv returns false, without error, if no message is queued.
+	TryRecv() (Msg, bool, error)
+
+	// RecvAll receives messages until ctx is done, an error occurs or an
+	// empty message, with no frame or a single empty frame, is received.
+	// RecvAll returns the messages received before, and ctx.Err() if ctx
+	// was done first.
+	RecvAll(ctx context.Context) ([]Msg, error)
+
+	// SetSendDeadline sets the deadline of the send operations issued
+	// from now on, like net.Conn does: past the deadline, they fail with
+	// a timeout error. A zero value clears the deadline.
+	SetSendDeadline(t time.Time)
+
+	// SetRecvDeadline sets the deadline of the receive operations issued
+	// from now on, like net.Conn does: past the deadline, they fail with
+	// a timeout error. A zero value clears the deadline.
+	SetRecvDeadline(t time.Time)
+
+	// RecvWithMeta receives a complete message, together with
+	// informations about the state of the Socket at reception time.
+	RecvWithMeta() (Msg, RecvMeta, error)
+
+	// SendFrame sends a single frame of a message.
+	// More frames of the same message follow when more is true: the
+	// message is complete once a frame is sent with more set to false.
+	// All the frames of a message are sent to a single peer. Frames of
+	// a message must be sent from a single goroutine, and Send fails
+	// until the message is complete.
+	// Broadcasting sockets (PUB, XPUB, ...) can not send messages frame
+	// by frame.
+	SendFrame(frame []byte, more bool) error
+
+	// RecvFrame receives a single frame of a message, and whether more
+	// frames of the same message follow.
+	// Calling Recv does not discard the remaining frames of a message
+	// partially received with RecvFrame.
+	RecvFrame() ([]byte, bool, error)
+
+	// SendFrames sends a single frame of size bytes, read from r, as the
+	// last frame of a message. The frame is written to the wire as it is
+	// read, without being held in memory, unless the connection encrypts
+	// its frames. Envelope frames, such as the identity of a ROUTER peer,
+	// are sent beforehand with SendFrame.
+	// Peers receive the frame as any other frame.
+	SendFrames(r io.Reader, size int64) error
+
+	// RecvFrameTo writes the next frame of a message to w, and reports
+	// the number of bytes written and whether more frames of the same
+	// message follow.
+	// Frames larger than the threshold configured with WithStreamThreshold
+	// are copied from the wire to w, without being held in memory.
+	RecvFrameTo(w io.Writer) (int64, bool, error)
+
 	// Listen connects a local endpoint to the Socket.
+	// A Socket may listen on several endpoints. Listening on an
+	// endpoint that is already bound returns ErrAlreadyBound.
+	// Listen and Dial are safe for concurrent use.
 	Listen(ep string) error
 
 	// Dial connects a remote endpoint to the Socket.
+	// A Socket may be connected to several endpoints. Dialing an
+	// endpoint the Socket is already connected to returns
+	// ErrAlreadyConnected.
 	Dial(ep string) error
 
+	// Unbind stops listening on an endpoint passed to Listen, and closes
+	// the connections accepted on it.
+	// Unbinding an endpoint the Socket is not listening on returns
+	// ErrEndpointNotFound.
+	Unbind(ep string) error
+
+	// Disconnect closes the connections to an endpoint passed to Dial.
+	// Disconnecting an endpoint the Socket is not connected to returns
+	// ErrEndpointNotFound.
+	Disconnect(ep string) error
+
+	// Monitor returns a channel receiving the lifecycle events of the Socket.
+	// Each call returns a new channel.
+	// Events are dropped for channels that are not drained fast enough.
+	// Channels are closed when the Socket is closed.
+	Monitor() <-chan Event
+
+	// WaitConnected blocks until at least one peer is connected to
+	// the Socket, ctx is done or the Socket is closed.
+	WaitConnected(ctx context.Context) error
+
+	// Addr returns the address the Socket is listening on, or nil if
+	// the Socket is not listening.
+	// For tcp endpoints, Addr reports the port assigned by the OS when
+	// listening on port 0.
+	// If Listen was called several times, the address of the most recent
+	// listener is returned.
+	Addr() net.Addr
+
+	// BoundEndpoints returns the endpoints the Socket is listening on,
+	// in the order they were bound.
+	// Wildcard ports are resolved: listening on "tcp://127.0.0.1:0"
+	// reports the port assigned by the OS.
+	BoundEndpoints() []string
+
+	// DialEndpoints returns the endpoints the Socket is connected to,
+	// in the order they were dialed.
+	DialEndpoints() []string
+
 	// Type returns the type of this Socket (PUB, SUB, ...)
 	Type() SocketType
 
+	// ConnMetadata returns the metadata announced during the handshake
+	// by the peer identified by the given identity.
+	// ConnMetadata returns nil if no such peer is connected.
+	ConnMetadata(peer string) map[string]string
+
+	// ConnHandshake returns the durations of the handshake phases with
+	// the peer identified by the given identity.
+	// ConnHandshake returns false if no such peer is connected.
+	ConnHandshake(peer string) (HandshakeTimings, bool)
+
+	// PeerConn returns the network connection to the peer identified
+	// by the given identity.
+	// PeerConn fails if no such peer is connected.
+	PeerConn(peer string) (net.Conn, error)
+
+	// Peers returns the peers connected to the Socket, in the order
+	// they connected.
+	Peers() []PeerInfo
+
+	// RotateSecurity replaces the security mechanism used by the
+	// connections established from now on. Established connections keep
+	// the mechanism, and thus the keys, they negotiated.
+	RotateSecurity(sec Security)
+
+	// CloseIdle closes the connections on which no message was read nor
+	// written within maxIdle, and returns the number of closed connections.
+	CloseIdle(maxIdle time.Duration) int
+
+	// Stats returns the activity of the Socket: counters of sent, received
+	// and dropped messages, and their breakdown per connected peer.
+	Stats() Stats
+
+	// Config returns a snapshot of the effective configuration of the Socket.
+	Config() ConfigSnapshot
+
 	// GetOption is used to retrieve an option for a socket.
 	GetOption(name string) (interface{}, error)
 
 	// SetOption is used to set an option for a socket.
 	SetOption(name string, value interface{}) error
 }
+
+// SubSocket is a SUB ZeroMQ socket, as returned by NewSub.
+type SubSocket interface {
+	Socket
+
+	// SubscribeAll subscribes the socket to all topics, by subscribing
+	// to the empty topic.
+	SubscribeAll() error
+
+	// UnsubscribeAll removes all the subscriptions of the socket, however
+	// many times each topic was subscribed to.
+	UnsubscribeAll() error
+
+	// Subscriptions returns the sorted list of topics the socket is
+	// subscribed to.
+	Subscriptions() [][]byte
+
+	// SubscriptionCount returns the number of subscriptions to topic:
+	// a topic subscribed to n times stays subscribed until it has been
+	// unsubscribed from n times.
+	SubscriptionCount(topic string) int
+}
+
+// XPubSocket is a XPUB ZeroMQ socket, as returned by NewXPub.
+type XPubSocket interface {
+	Socket
+
+	// PeerSubscriptions returns the sorted list of topics each connected
+	// subscriber asked for, indexed by the identity of the subscriber.
+	PeerSubscriptions() map[string][][]byte
+}
+
+// RouterSocket is a ROUTER ZeroMQ socket, as returned by NewRouter.
+type RouterSocket interface {
+	Socket
+
+	// SendTo sends msg to the peer identified by id, prepending the
+	// routing envelope expected by the peer.
+	SendTo(id []byte, msg Msg) error
+
+	// RecvFrom receives a complete message, together with the identity
+	// of the peer it came from. The routing envelope is stripped from
+	// the returned message.
+	RecvFrom() ([]byte, Msg, error)
+
+	// ConnectPeer dials the remote endpoint ep, and routes messages to
+	// the peer listening there under the given identity.
+	ConnectPeer(ep, identity string) error
+}
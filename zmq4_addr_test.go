@@ -0,0 +1,582 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestSocketAddr(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	for _, tc := range []struct {
+		name string
+		ep   string
+	}{
+		{"tcp", "tcp://127.0.0.1:0"},
+		{"ipc", must(EndPoint("ipc"))},
+		{"inproc", must(EndPoint("inproc"))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pull := zmq4.NewPull(ctx)
+			defer pull.Close()
+
+			if addr := pull.Addr(); addr != nil {
+				t.Fatalf("unexpected address before Listen: %v", addr)
+			}
+
+			err := pull.Listen(tc.ep)
+			if err != nil {
+				t.Fatalf("could not listen on %q: %v", tc.ep, err)
+			}
+
+			addr := pull.Addr()
+			if addr == nil {
+				t.Fatalf("no address after Listen")
+			}
+
+			switch tc.name {
+			case "tcp":
+				tcp, ok := addr.(*net.TCPAddr)
+				if !ok {
+					t.Fatalf("invalid address type %T", addr)
+				}
+				if tcp.Port == 0 {
+					t.Fatalf("ephemeral port was not resolved: %v", addr)
+				}
+
+				push := zmq4.NewPush(ctx)
+				defer push.Close()
+				err = push.Dial("tcp://" + addr.String())
+				if err != nil {
+					t.Fatalf("could not dial %v: %v", addr, err)
+				}
+			default:
+				if got, want := addr.String(), strings.TrimPrefix(tc.ep, tc.name+"://"); got != want {
+					t.Fatalf("invalid address: got=%q, want=%q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBoundEndpoints(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	if eps := pull.BoundEndpoints(); len(eps) != 0 {
+		t.Fatalf("unexpected bound endpoints before Listen: %v", eps)
+	}
+
+	err := pull.Listen("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	eps := pull.BoundEndpoints()
+	if len(eps) != 1 {
+		t.Fatalf("invalid number of bound endpoints: %v", eps)
+	}
+	ep := eps[0]
+	if !strings.HasPrefix(ep, "tcp://127.0.0.1:") || strings.HasSuffix(ep, ":0") {
+		t.Fatalf("invalid bound endpoint %q", ep)
+	}
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	err = push.Dial(ep)
+	if err != nil {
+		t.Fatalf("could not dial %q: %v", ep, err)
+	}
+
+	err = push.Send(zmq4.NewMsgString("hello"))
+	if err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+
+	msg, err := pull.Recv()
+	if err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+	if got, want := string(msg.Frames[0]), "hello"; got != want {
+		t.Fatalf("invalid message: got=%q, want=%q", got, want)
+	}
+}
+
+func TestMultipleEndpoints(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	eps := []string{must(EndPoint("tcp")), must(EndPoint("ipc"))}
+
+	pub := zmq4.NewPub(ctx)
+	defer pub.Close()
+
+	grp, _ := errgroup.WithContext(ctx)
+	for _, ep := range eps {
+		ep := ep
+		grp.Go(func() error { return pub.Listen(ep) })
+	}
+	if err := grp.Wait(); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	if got, want := len(pub.BoundEndpoints()), len(eps); got != want {
+		t.Fatalf("invalid number of bound endpoints: got=%d, want=%d", got, want)
+	}
+	for _, ep := range eps {
+		if err := pub.Listen(ep); errors.Cause(err) != zmq4.ErrAlreadyBound {
+			t.Fatalf("invalid error listening twice on %q: got=%v, want=%v", ep, err, zmq4.ErrAlreadyBound)
+		}
+	}
+
+	var subs []zmq4.Socket
+	for _, ep := range eps {
+		sub := zmq4.NewSub(ctx)
+		defer sub.Close()
+		if err := sub.Dial(ep); err != nil {
+			t.Fatalf("could not dial %q: %v", ep, err)
+		}
+		if got, want := sub.DialEndpoints(), []string{ep}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("invalid dial endpoints: got=%q, want=%q", got, want)
+		}
+		if err := sub.SetOption(zmq4.OptionSubscribe, ""); err != nil {
+			t.Fatalf("could not subscribe: %v", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	// wait for both subscriptions to reach the publisher.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+				pub.Send(zmq4.NewMsgString("hello"))
+			}
+		}
+	}()
+
+	for i, sub := range subs {
+		msg, err := sub.Recv()
+		if err != nil {
+			t.Fatalf("could not recv from %q: %v", eps[i], err)
+		}
+		if got, want := string(msg.Frames[0]), "hello"; got != want {
+			t.Fatalf("invalid message from %q: got=%q, want=%q", eps[i], got, want)
+		}
+	}
+}
+
+func TestIPv6Endpoints(t *testing.T) {
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback not available: %v", err)
+	}
+	l.Close()
+
+	for _, ep := range []string{"tcp://[::1]:0", "tcp://*:0", "tcp://[::]:*"} {
+		t.Run(ep, func(t *testing.T) {
+			ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+			defer timeout()
+
+			rep := zmq4.NewRep(ctx)
+			defer rep.Close()
+
+			if err := rep.Listen(ep); err != nil {
+				t.Fatalf("could not listen on %q: %v", ep, err)
+			}
+
+			bound := rep.BoundEndpoints()[0]
+			if !strings.HasPrefix(bound, "tcp://[") {
+				t.Fatalf("bound endpoint %q is not a bracketed IPv6 address", bound)
+			}
+
+			req := zmq4.NewReq(ctx)
+			defer req.Close()
+
+			if err := req.Dial(bound); err != nil {
+				t.Fatalf("could not dial %q: %v", bound, err)
+			}
+
+			if err := req.Send(zmq4.NewMsgString("ping")); err != nil {
+				t.Fatalf("could not send request: %v", err)
+			}
+			msg, err := rep.Recv()
+			if err != nil {
+				t.Fatalf("could not recv request: %v", err)
+			}
+			if got, want := string(msg.Frames[0]), "ping"; got != want {
+				t.Fatalf("invalid request: got=%q, want=%q", got, want)
+			}
+			if err := rep.Send(zmq4.NewMsgString("pong")); err != nil {
+				t.Fatalf("could not send reply: %v", err)
+			}
+			msg, err = req.Recv()
+			if err != nil {
+				t.Fatalf("could not recv reply: %v", err)
+			}
+			if got, want := string(msg.Frames[0]), "pong"; got != want {
+				t.Fatalf("invalid reply: got=%q, want=%q", got, want)
+			}
+		})
+	}
+}
+
+func TestIPv4Only(t *testing.T) {
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback not available: %v", err)
+	}
+	l.Close()
+
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	v4 := zmq4.NewPull(ctx, zmq4.WithIPv4Only(true))
+	defer v4.Close()
+	if err := v4.Listen("tcp://[::1]:0"); err == nil {
+		t.Fatalf("IPv4-only socket listened on an IPv6 address")
+	}
+
+	v6 := zmq4.NewPull(ctx, zmq4.WithIPv4Only(false))
+	defer v6.Close()
+	if err := v6.Listen("tcp://127.0.0.1:0"); err == nil {
+		t.Fatalf("IPv6-only socket listened on an IPv4 address")
+	}
+	if got, want := v6.Config().TCPNetwork, "tcp6"; got != want {
+		t.Fatalf("invalid network: got=%q, want=%q", got, want)
+	}
+}
+
+func TestIPv6Clients(t *testing.T) {
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback not available: %v", err)
+	}
+	l.Close()
+
+	for _, tc := range []struct {
+		name string
+		ep   string
+		opts []zmq4.Option
+		host string // host clients dial
+		copt []zmq4.Option
+	}{
+		{"loopback-ipv6", "tcp://[::1]:*", []zmq4.Option{zmq4.WithIPv4Only(false)}, "::1", []zmq4.Option{zmq4.WithIPv4Only(false)}},
+		{"wildcard-ipv6", "tcp://[::]:*", []zmq4.Option{zmq4.WithIPv4Only(false)}, "::1", []zmq4.Option{zmq4.WithIPv4Only(false)}},
+		{"wildcard-native", "tcp://[::]:*", nil, "::1", nil},
+		{"wildcard-mapped", "tcp://[::]:*", nil, "::ffff:127.0.0.1", nil},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+			defer timeout()
+
+			pull := zmq4.NewPull(ctx, tc.opts...)
+			defer pull.Close()
+
+			if err := pull.Listen(tc.ep); err != nil {
+				t.Fatalf("could not listen on %q: %v", tc.ep, err)
+			}
+			port := pull.Addr().(*net.TCPAddr).Port
+
+			push := zmq4.NewPush(ctx, tc.copt...)
+			defer push.Close()
+
+			ep := "tcp://" + net.JoinHostPort(tc.host, strconv.Itoa(port))
+			if err := push.Dial(ep); err != nil {
+				t.Fatalf("could not dial %q: %v", ep, err)
+			}
+			if err := push.Send(zmq4.NewMsgString("hello")); err != nil {
+				t.Fatalf("could not send: %v", err)
+			}
+			msg, err := pull.Recv()
+			if err != nil {
+				t.Fatalf("could not recv: %v", err)
+			}
+			if got, want := string(msg.Frames[0]), "hello"; got != want {
+				t.Fatalf("invalid message: got=%q, want=%q", got, want)
+			}
+		})
+	}
+}
+
+func TestMultipleEndpointsPushPull(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	t.Run("fair-queue", func(t *testing.T) {
+		eps := []string{must(EndPoint("tcp")), must(EndPoint("ipc"))}
+
+		pull := zmq4.NewPull(ctx)
+		defer pull.Close()
+
+		for _, ep := range eps {
+			if err := pull.Listen(ep); err != nil {
+				t.Fatalf("could not listen on %q: %v", ep, err)
+			}
+		}
+
+		for _, ep := range eps {
+			push := zmq4.NewPush(ctx)
+			defer push.Close()
+			if err := push.Dial(ep); err != nil {
+				t.Fatalf("could not dial %q: %v", ep, err)
+			}
+			if err := push.Send(zmq4.NewMsgString(ep)); err != nil {
+				t.Fatalf("could not send to %q: %v", ep, err)
+			}
+		}
+
+		got := make(map[string]bool)
+		for range eps {
+			msg, err := pull.Recv()
+			if err != nil {
+				t.Fatalf("could not recv: %v", err)
+			}
+			got[string(msg.Frames[0])] = true
+		}
+		for _, ep := range eps {
+			if !got[ep] {
+				t.Fatalf("no message received from %q", ep)
+			}
+		}
+	})
+
+	t.Run("load-balance", func(t *testing.T) {
+		const (
+			nworkers = 3
+			nmsgs    = 5
+		)
+
+		push := zmq4.NewPush(ctx)
+		defer push.Close()
+
+		var workers []zmq4.Socket
+		for i := 0; i < nworkers; i++ {
+			ep := must(EndPoint("tcp"))
+			pull := zmq4.NewPull(ctx)
+			defer pull.Close()
+			if err := pull.Listen(ep); err != nil {
+				t.Fatalf("could not listen on %q: %v", ep, err)
+			}
+			if err := push.Dial(ep); err != nil {
+				t.Fatalf("could not dial %q: %v", ep, err)
+			}
+			workers = append(workers, pull)
+		}
+
+		for i := 0; i < nworkers*nmsgs; i++ {
+			if err := push.Send(zmq4.NewMsgString(strconv.Itoa(i))); err != nil {
+				t.Fatalf("could not send #%d: %v", i, err)
+			}
+		}
+
+		grp, _ := errgroup.WithContext(ctx)
+		for i, pull := range workers {
+			i, pull := i, pull
+			grp.Go(func() error {
+				for j := 0; j < nmsgs; j++ {
+					if _, err := pull.Recv(); err != nil {
+						return errors.Wrapf(err, "worker #%d could not recv #%d", i, j)
+					}
+				}
+				return nil
+			})
+		}
+		if err := grp.Wait(); err != nil {
+			t.Fatalf("messages not load-balanced: %v", err)
+		}
+	})
+}
+
+func TestDialDuplicateEndpoint(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+	evts := pull.Monitor()
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	waitEvent(t, evts, zmq4.EventAccepted)
+
+	if err := push.Dial(ep); errors.Cause(err) != zmq4.ErrAlreadyConnected {
+		t.Fatalf("invalid error dialing twice: got=%v, want=%v", err, zmq4.ErrAlreadyConnected)
+	}
+
+	// a duplicate dial opens no connection.
+	select {
+	case evt := <-evts:
+		if evt.Type == zmq4.EventAccepted {
+			t.Fatalf("duplicate dial opened a connection")
+		}
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestUnbind(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep1 := must(EndPoint("tcp"))
+	ep2 := must(EndPoint("ipc"))
+	defer cleanUp(ep2)
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+	evts := pull.Monitor()
+
+	for _, ep := range []string{ep1, ep2} {
+		if err := pull.Listen(ep); err != nil {
+			t.Fatalf("could not listen on %q: %v", ep, err)
+		}
+	}
+
+	push1 := zmq4.NewPush(ctx)
+	defer push1.Close()
+	if err := push1.Dial(ep1); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	waitEvent(t, evts, zmq4.EventAccepted)
+
+	if err := pull.Unbind(ep1); err != nil {
+		t.Fatalf("could not unbind: %v", err)
+	}
+	waitEvent(t, evts, zmq4.EventDisconnected)
+
+	if got, want := pull.BoundEndpoints(), []string{ep2}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid bound endpoints: got=%q, want=%q", got, want)
+	}
+	if n := len(pull.Peers()); n != 0 {
+		t.Fatalf("invalid number of peers: got=%d, want=0", n)
+	}
+	if conn, err := net.DialTimeout("tcp", strings.TrimPrefix(ep1, "tcp://"), time.Second); err == nil {
+		conn.Close()
+		t.Fatalf("unbound endpoint still accepts connections")
+	}
+
+	push2 := zmq4.NewPush(ctx)
+	defer push2.Close()
+	if err := push2.Dial(ep2); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	if err := push2.Send(zmq4.NewMsgString("still bound")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	msg, err := pull.Recv()
+	if err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+	if got, want := string(msg.Frames[0]), "still bound"; got != want {
+		t.Fatalf("invalid message: got=%q, want=%q", got, want)
+	}
+
+	if err := pull.Unbind(ep1); errors.Cause(err) != zmq4.ErrEndpointNotFound {
+		t.Fatalf("invalid error unbinding twice: got=%v, want=%v", err, zmq4.ErrEndpointNotFound)
+	}
+
+	// the endpoint can be bound again.
+	if err := pull.Listen(ep1); err != nil {
+		t.Fatalf("could not listen again: %v", err)
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep1 := must(EndPoint("tcp"))
+	ep2 := must(EndPoint("tcp"))
+
+	pull1 := zmq4.NewPull(ctx)
+	defer pull1.Close()
+	evts := pull1.Monitor()
+
+	pull2 := zmq4.NewPull(ctx)
+	defer pull2.Close()
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	if err := pull1.Listen(ep1); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := pull2.Listen(ep2); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	for _, ep := range []string{ep1, ep2} {
+		if err := push.Dial(ep); err != nil {
+			t.Fatalf("could not dial %q: %v", ep, err)
+		}
+	}
+	waitEvent(t, evts, zmq4.EventAccepted)
+
+	if err := push.Disconnect(ep1); err != nil {
+		t.Fatalf("could not disconnect: %v", err)
+	}
+	waitEvent(t, evts, zmq4.EventDisconnected)
+
+	if got, want := push.DialEndpoints(), []string{ep2}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid dial endpoints: got=%q, want=%q", got, want)
+	}
+	peers := push.Peers()
+	if len(peers) != 1 || peers[0].Endpoint != ep2 {
+		t.Fatalf("invalid peers: got=%+v, want the peer of %q", peers, ep2)
+	}
+
+	// all messages go to the remaining peer.
+	for i := 0; i < 4; i++ {
+		if err := push.Send(zmq4.NewMsgString(strconv.Itoa(i))); err != nil {
+			t.Fatalf("could not send: %v", err)
+		}
+		msg, err := pull2.Recv()
+		if err != nil {
+			t.Fatalf("could not recv: %v", err)
+		}
+		if got, want := string(msg.Frames[0]), strconv.Itoa(i); got != want {
+			t.Fatalf("invalid message: got=%q, want=%q", got, want)
+		}
+	}
+
+	if err := push.Disconnect(ep1); errors.Cause(err) != zmq4.ErrEndpointNotFound {
+		t.Fatalf("invalid error disconnecting twice: got=%v, want=%v", err, zmq4.ErrEndpointNotFound)
+	}
+
+	// the endpoint can be dialed again.
+	if err := push.Dial(ep1); err != nil {
+		t.Fatalf("could not dial again: %v", err)
+	}
+	waitEvent(t, evts, zmq4.EventAccepted)
+}
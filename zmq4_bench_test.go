@@ -0,0 +1,397 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func BenchmarkPubSubThroughput(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []zmq4.Option
+	}{
+		{"alloc", nil},
+		{"msg-pool", []zmq4.Option{zmq4.WithMsgPool(zmq4.NewMsgPool())}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ep := must(EndPoint("tcp"))
+
+			pub := zmq4.NewPub(ctx)
+			defer pub.Close()
+
+			sub := zmq4.NewSub(ctx, bc.opts...)
+			defer sub.Close()
+
+			if err := pub.Listen(ep); err != nil {
+				b.Fatalf("could not listen: %v", err)
+			}
+			if err := sub.Dial(ep); err != nil {
+				b.Fatalf("could not dial: %v", err)
+			}
+			if err := sub.SetOption(zmq4.OptionSubscribe, ""); err != nil {
+				b.Fatalf("could not subscribe: %v", err)
+			}
+
+			// wait for the subscription to reach the publisher.
+			for {
+				if err := pub.Send(zmq4.NewMsgString("ready")); err != nil {
+					b.Fatalf("could not send: %v", err)
+				}
+				rctx, rcancel := context.WithTimeout(ctx, 10*time.Millisecond)
+				_, err := sub.RecvContext(rctx)
+				rcancel()
+				if err == nil {
+					break
+				}
+			}
+
+			// the publisher keeps at most window messages in flight, so
+			// that none is dropped.
+			const window = 64
+			tokens := make(chan struct{}, window)
+			for i := 0; i < window; i++ {
+				tokens <- struct{}{}
+			}
+			msg := zmq4.NewMsg(make([]byte, 256))
+			go func() {
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-tokens:
+						_ = pub.Send(msg)
+					}
+				}
+			}()
+
+			b.SetBytes(int64(len(msg.Frames[0])))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				msg, err := sub.Recv()
+				if err != nil {
+					b.Fatalf("could not recv: %v", err)
+				}
+				msg.Release()
+				tokens <- struct{}{}
+			}
+			b.StopTimer()
+		})
+	}
+}
+
+func BenchmarkAllocsPerRecv(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []zmq4.Option
+	}{
+		{"alloc", nil},
+		{"release", []zmq4.Option{zmq4.WithMsgPool(zmq4.NewMsgPool())}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ep := must(EndPoint("tcp"))
+
+			push := zmq4.NewPush(ctx)
+			defer push.Close()
+
+			pull := zmq4.NewPull(ctx, bc.opts...)
+			defer pull.Close()
+
+			if err := pull.Listen(ep); err != nil {
+				b.Fatalf("could not listen: %v", err)
+			}
+			if err := push.Dial(ep); err != nil {
+				b.Fatalf("could not dial: %v", err)
+			}
+
+			msg := zmq4.NewMsgFrom(make([]byte, 64), make([]byte, 4096))
+			go func() {
+				for ctx.Err() == nil {
+					_ = push.Send(msg)
+				}
+			}()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				msg, err := pull.Recv()
+				if err != nil {
+					b.Fatalf("could not recv: %v", err)
+				}
+				msg.Release()
+			}
+			b.StopTimer()
+		})
+	}
+}
+
+func BenchmarkRecvThroughput(b *testing.B) {
+	pool := zmq4.NewMsgPool()
+	for _, bc := range []struct {
+		name string
+		opts []zmq4.Option
+	}{
+		{"alloc", nil},
+		{"msg-pool", []zmq4.Option{zmq4.WithMsgPool(pool)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ep := must(EndPoint("tcp"))
+
+			push := zmq4.NewPush(ctx)
+			defer push.Close()
+
+			pull := zmq4.NewPull(ctx, bc.opts...)
+			defer pull.Close()
+
+			if err := pull.Listen(ep); err != nil {
+				b.Fatalf("could not listen: %v", err)
+			}
+			if err := push.Dial(ep); err != nil {
+				b.Fatalf("could not dial: %v", err)
+			}
+
+			msg := zmq4.NewMsgFrom(make([]byte, 16), make([]byte, 256), make([]byte, 1024))
+			go func() {
+				for ctx.Err() == nil {
+					_ = push.Send(msg)
+				}
+			}()
+
+			b.SetBytes(16 + 256 + 1024)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				msg, err := pull.Recv()
+				if err != nil {
+					b.Fatalf("could not recv: %v", err)
+				}
+				msg.Release()
+			}
+			b.StopTimer()
+		})
+	}
+}
+
+func BenchmarkSendBatch(b *testing.B) {
+	const batch = 64
+	for _, bc := range []struct {
+		name string
+		send func(ctx context.Context, s zmq4.Socket, msgs []zmq4.Msg) error
+	}{
+		{"send", func(ctx context.Context, s zmq4.Socket, msgs []zmq4.Msg) error {
+			for _, msg := range msgs {
+				if err := s.SendContext(ctx, msg); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"batch", func(ctx context.Context, s zmq4.Socket, msgs []zmq4.Msg) error {
+			return s.SendBatch(ctx, msgs)
+		}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ep := must(EndPoint("tcp"))
+
+			push := zmq4.NewPush(ctx)
+			defer push.Close()
+
+			pull := zmq4.NewPull(ctx)
+			defer pull.Close()
+
+			if err := pull.Listen(ep); err != nil {
+				b.Fatalf("could not listen: %v", err)
+			}
+			if err := push.Dial(ep); err != nil {
+				b.Fatalf("could not dial: %v", err)
+			}
+
+			msgs := make([]zmq4.Msg, batch)
+			for i := range msgs {
+				msgs[i] = zmq4.NewMsg(make([]byte, 32))
+			}
+			done := make(chan error, 1)
+			go func() {
+				for i := 0; i < b.N*batch; i++ {
+					if _, err := pull.Recv(); err != nil {
+						done <- err
+						return
+					}
+				}
+				done <- nil
+			}()
+
+			w0, ok := writeSyscalls()
+			b.SetBytes(batch * 32)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := bc.send(ctx, push, msgs); err != nil {
+					b.Fatalf("could not send: %v", err)
+				}
+			}
+			if err := <-done; err != nil {
+				b.Fatalf("could not recv: %v", err)
+			}
+			b.StopTimer()
+
+			// the number of write syscalls is only known on Linux.
+			if w1, _ := writeSyscalls(); ok {
+				b.ReportMetric(float64(w1-w0)/float64(b.N), "writes/op")
+			}
+		})
+	}
+}
+
+// writeSyscalls returns the number of write syscalls made by the process
+// so far, as reported by /proc/self/io.
+func writeSyscalls() (uint64, bool) {
+	raw, err := ioutil.ReadFile("/proc/self/io")
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(raw), "\n") {
+		if !strings.HasPrefix(line, "syscw:") {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(line[len("syscw:"):]), 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func BenchmarkWriteBatching(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []zmq4.Option
+	}{
+		{"default", nil},
+		{"batching", []zmq4.Option{zmq4.WithWriteBatching(16<<10, time.Millisecond)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ep := must(EndPoint("tcp"))
+
+			push := zmq4.NewPush(ctx, bc.opts...)
+			defer push.Close()
+
+			pull := zmq4.NewPull(ctx)
+			defer pull.Close()
+
+			if err := pull.Listen(ep); err != nil {
+				b.Fatalf("could not listen: %v", err)
+			}
+			if err := push.Dial(ep); err != nil {
+				b.Fatalf("could not dial: %v", err)
+			}
+
+			msg := zmq4.NewMsg(make([]byte, 64))
+			go func() {
+				for ctx.Err() == nil {
+					_ = push.Send(msg)
+				}
+			}()
+
+			b.SetBytes(64)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := pull.Recv(); err != nil {
+					b.Fatalf("could not recv: %v", err)
+				}
+			}
+			b.StopTimer()
+		})
+	}
+}
+
+func BenchmarkRecvAll(b *testing.B) {
+	const batch = 64
+	for _, bc := range []struct {
+		name string
+		recv func(ctx context.Context, s zmq4.Socket) ([]zmq4.Msg, error)
+	}{
+		{"recv", func(ctx context.Context, s zmq4.Socket) ([]zmq4.Msg, error) {
+			var msgs []zmq4.Msg
+			for {
+				msg, err := s.RecvContext(ctx)
+				if err != nil {
+					return msgs, err
+				}
+				if len(msg.Frames) == 1 && len(msg.Frames[0]) == 0 {
+					return msgs, nil
+				}
+				msgs = append(msgs, msg)
+			}
+		}},
+		{"recv-all", func(ctx context.Context, s zmq4.Socket) ([]zmq4.Msg, error) {
+			return s.RecvAll(ctx)
+		}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ep := must(EndPoint("tcp"))
+
+			push := zmq4.NewPush(ctx)
+			defer push.Close()
+
+			pull := zmq4.NewPull(ctx)
+			defer pull.Close()
+
+			if err := pull.Listen(ep); err != nil {
+				b.Fatalf("could not listen: %v", err)
+			}
+			if err := push.Dial(ep); err != nil {
+				b.Fatalf("could not dial: %v", err)
+			}
+
+			msg := zmq4.NewMsgString("hello")
+			go func() {
+				for ctx.Err() == nil {
+					for i := 0; i < batch; i++ {
+						_ = push.Send(msg)
+					}
+					_ = push.Send(zmq4.NewMsg(nil))
+				}
+			}()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				msgs, err := bc.recv(ctx, pull)
+				if err != nil {
+					b.Fatalf("could not recv: %v", err)
+				}
+				if len(msgs) != batch {
+					b.Fatalf("invalid number of messages: got=%d, want=%d", len(msgs), batch)
+				}
+			}
+			b.StopTimer()
+		})
+	}
+}
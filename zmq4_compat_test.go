@@ -0,0 +1,61 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/pkg/errors"
+)
+
+func TestIncompatibleSocketTypes(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	rep := zmq4.NewRep(ctx)
+	defer rep.Close()
+	revts := rep.Monitor()
+
+	sub := zmq4.NewSub(ctx)
+	defer sub.Close()
+	sevts := sub.Monitor()
+
+	if err := rep.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	start := time.Now()
+	err := sub.Dial(ep)
+	if err == nil {
+		t.Fatalf("expected an error dialing a REP socket from a SUB socket")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("dial did not fail fast: %v", d)
+	}
+	if errors.Cause(err) != zmq4.ErrIncompatibleSocket {
+		t.Fatalf("invalid error: got=%v, want=%v", err, zmq4.ErrIncompatibleSocket)
+	}
+	for _, typ := range []zmq4.SocketType{zmq4.Sub, zmq4.Rep} {
+		if !strings.Contains(err.Error(), string(typ)) {
+			t.Fatalf("error %q does not name socket type %v", err, typ)
+		}
+	}
+
+	ev := waitEvent(t, sevts, zmq4.EventHandshakeFailed)
+	if errors.Cause(ev.Err) != zmq4.ErrIncompatibleSocket {
+		t.Fatalf("invalid event error: got=%v, want=%v", ev.Err, zmq4.ErrIncompatibleSocket)
+	}
+	waitEvent(t, revts, zmq4.EventHandshakeFailed)
+
+	if got := len(rep.Stats().Peers); got != 0 {
+		t.Fatalf("incompatible peer connected: %d peers", got)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func TestRecvContext(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	rctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := pull.RecvContext(rctx); err != context.DeadlineExceeded {
+		t.Fatalf("invalid error: got=%v, want=%v", err, context.DeadlineExceeded)
+	}
+
+	if err := push.SendContext(ctx, zmq4.NewMsgString("hello")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+
+	msg, err := pull.RecvContext(ctx)
+	if err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+	if got, want := string(msg.Bytes()), "hello"; got != want {
+		t.Fatalf("invalid message: got=%q, want=%q", got, want)
+	}
+}
+
+func TestSendContext(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	sctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if err := push.SendContext(sctx, zmq4.NewMsgString("hello")); err != context.Canceled {
+		t.Fatalf("invalid error: got=%v, want=%v", err, context.Canceled)
+	}
+
+	// the socket is still usable after a cancelled send.
+	ep := must(EndPoint("tcp"))
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	if err := push.SendContext(ctx, zmq4.NewMsgFromString([]string{"a", "b"})); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	msg, err := pull.Recv()
+	if err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+	if got, want := len(msg.Frames), 2; got != want {
+		t.Fatalf("invalid number of frames: got=%d, want=%d", got, want)
+	}
+}
+
+func TestDeadlines(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	router := zmq4.NewRouter(ctx)
+	defer router.Close()
+
+	dealer := zmq4.NewDealer(ctx, zmq4.WithID(zmq4.SocketIdentity("dealer")))
+	defer dealer.Close()
+
+	isTimeout := func(err error) bool {
+		e, ok := err.(interface{ Timeout() bool })
+		return ok && e.Timeout()
+	}
+
+	// no peer is connected: the send can not complete.
+	dealer.SetSendDeadline(time.Now().Add(100 * time.Millisecond))
+	start := time.Now()
+	err := dealer.Send(zmq4.NewMsgString("hello"))
+	if !isTimeout(err) {
+		t.Fatalf("invalid error past the send deadline: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("send deadline not honored: %v", d)
+	}
+
+	// deadlines in the past fail right away.
+	dealer.SetRecvDeadline(time.Now().Add(-time.Second))
+	if _, err := dealer.Recv(); !isTimeout(err) {
+		t.Fatalf("invalid error past the recv deadline: %v", err)
+	}
+
+	dealer.SetSendDeadline(time.Time{})
+	dealer.SetRecvDeadline(time.Time{})
+
+	if err := router.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := dealer.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	if err := dealer.Send(zmq4.NewMsgString("hello")); err != nil {
+		t.Fatalf("could not send once the deadline was cleared: %v", err)
+	}
+	if _, err := router.Recv(); err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+	if err := router.Send(zmq4.NewMsgFromString([]string{"dealer", "world"})); err != nil {
+		t.Fatalf("could not reply: %v", err)
+	}
+	if _, err := dealer.Recv(); err != nil {
+		t.Fatalf("could not recv once the deadline was cleared: %v", err)
+	}
+}
+
+func TestTrySendTryRecv(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	// no peer is connected: nothing can be sent nor received.
+	ok, err := push.TrySend(zmq4.NewMsgString("hello"))
+	if err != nil || ok {
+		t.Fatalf("invalid send without peer: ok=%v, err=%v", ok, err)
+	}
+	_, ok, err = pull.TryRecv()
+	if err != nil || ok {
+		t.Fatalf("invalid recv without peer: ok=%v, err=%v", ok, err)
+	}
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	_, ok, err = pull.TryRecv()
+	if err != nil || ok {
+		t.Fatalf("invalid recv without message: ok=%v, err=%v", ok, err)
+	}
+
+	ok, err = push.TrySend(zmq4.NewMsgString("hello"))
+	if err != nil || !ok {
+		t.Fatalf("could not send to connected peer: ok=%v, err=%v", ok, err)
+	}
+
+	for {
+		msg, ok, err := pull.TryRecv()
+		if err != nil {
+			t.Fatalf("could not recv: %v", err)
+		}
+		if !ok {
+			select {
+			case <-ctx.Done():
+				t.Fatalf("no message received: %v", ctx.Err())
+			case <-time.After(time.Millisecond):
+			}
+			continue
+		}
+		if got, want := string(msg.Bytes()), "hello"; got != want {
+			t.Fatalf("invalid message: got=%q, want=%q", got, want)
+		}
+		break
+	}
+}
+
+func TestCloseUnblocks(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	sub := zmq4.NewSub(ctx)
+	push := zmq4.NewPush(ctx)
+	dealer := zmq4.NewDealer(ctx)
+
+	// no peer ever connects: the calls can only be unblocked by Close.
+	errs := make(chan error, 3)
+	go func() {
+		_, err := sub.Recv()
+		errs <- err
+	}()
+	go func() {
+		errs <- push.Send(zmq4.NewMsgString("hello"))
+	}()
+	go func() {
+		_, err := dealer.Recv()
+		errs <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	for _, sck := range []zmq4.Socket{sub, push, dealer} {
+		sck.Close()
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case err := <-errs:
+			if err != zmq4.ErrClosedSocket {
+				t.Fatalf("invalid error: got=%v, want=%v", err, zmq4.ErrClosedSocket)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("pending calls not unblocked by Close")
+		}
+	}
+
+	if err := push.Send(zmq4.NewMsgString("hello")); err != zmq4.ErrClosedSocket {
+		t.Fatalf("invalid error after close: got=%v, want=%v", err, zmq4.ErrClosedSocket)
+	}
+	if _, ok, err := dealer.TryRecv(); ok || err != zmq4.ErrClosedSocket {
+		t.Fatalf("invalid recv after close: ok=%v, err=%v", ok, err)
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/pkg/errors"
+)
+
+func TestContextDialer(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	var (
+		mu    sync.Mutex
+		dials []string
+	)
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		mu.Lock()
+		dials = append(dials, network+"://"+addr)
+		mu.Unlock()
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx, zmq4.WithContextDialer(dial))
+	defer push.Close()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	if err := push.Send(zmq4.NewMsgString("hello")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	msg, err := pull.Recv()
+	if err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+	if got, want := string(msg.Frames[0]), "hello"; got != want {
+		t.Fatalf("invalid message: got=%q, want=%q", got, want)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dials) != 1 || dials[0] != ep {
+		t.Fatalf("invalid dial attempts: got=%q, want=%q", dials, []string{ep})
+	}
+
+	// dial errors are reported through the retry loop.
+	errProxy := errors.New("proxy refused connection")
+	edial := zmq4.NewPush(ctx,
+		zmq4.WithDialerRetry(time.Millisecond),
+		zmq4.WithContextDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, errProxy
+		}),
+	)
+	defer edial.Close()
+	err = edial.Dial(ep)
+	if err == nil || !strings.Contains(err.Error(), errProxy.Error()) {
+		t.Fatalf("invalid dial error: %v", err)
+	}
+}
+
+func TestDialer(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	var (
+		mu    sync.Mutex
+		dials []string
+	)
+	dialer := net.Dialer{
+		Timeout:   time.Second,
+		KeepAlive: 10 * time.Second,
+		Control: func(network, addr string, c syscall.RawConn) error {
+			mu.Lock()
+			dials = append(dials, network+"://"+addr)
+			mu.Unlock()
+			return nil
+		},
+	}
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx, zmq4.WithDialer(dialer))
+	defer push.Close()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	v, err := push.GetOption(zmq4.OptionDialerTimeout)
+	if err != nil {
+		t.Fatalf("could not get dialer timeout: %v", err)
+	}
+	if got, want := v.(time.Duration), dialer.Timeout; got != want {
+		t.Fatalf("invalid dialer timeout: got=%v, want=%v", got, want)
+	}
+
+	if err := push.Send(zmq4.NewMsgString("hello")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	if _, err := pull.Recv(); err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dials) != 1 || !strings.HasPrefix(dials[0], "tcp") {
+		t.Fatalf("invalid dial attempts: got=%q", dials)
+	}
+}
+
+// loopbackResolver resolves any host to a list of loopback addresses.
+type loopbackResolver struct {
+	mu    sync.Mutex
+	addrs []string
+}
+
+func (r *loopbackResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.addrs...), nil
+}
+
+func (r *loopbackResolver) set(addrs ...string) {
+	r.mu.Lock()
+	r.addrs = addrs
+	r.mu.Unlock()
+}
+
+func TestDNSRoundRobin(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 20*time.Second)
+	defer timeout()
+
+	port := must(getTCPPort())
+	ips := []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"}
+	pulls := make([]zmq4.Socket, len(ips))
+	for i, ip := range ips {
+		pulls[i] = zmq4.NewPull(ctx)
+		defer pulls[i].Close()
+		if err := pulls[i].Listen("tcp://" + net.JoinHostPort(ip, port)); err != nil {
+			t.Fatalf("could not listen on %s: %v", ip, err)
+		}
+	}
+
+	r := &loopbackResolver{addrs: ips[:2]}
+	push := zmq4.NewPush(ctx,
+		zmq4.WithDNSRoundRobin(true),
+		zmq4.WithDNSTTL(20*time.Millisecond),
+		zmq4.WithResolver(r),
+	)
+	defer push.Close()
+
+	ep := "tcp://zmq4.test:" + port
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	remotes := func() []string {
+		var addrs []string
+		for _, p := range push.Peers() {
+			if p.Endpoint != ep {
+				t.Fatalf("invalid peer endpoint: got=%q, want=%q", p.Endpoint, ep)
+			}
+			addrs = append(addrs, p.RemoteAddr)
+		}
+		sort.Strings(addrs)
+		return addrs
+	}
+	waitRemotes := func(ips ...string) {
+		t.Helper()
+		var want []string
+		for _, ip := range ips {
+			want = append(want, net.JoinHostPort(ip, port))
+		}
+		for {
+			got := remotes()
+			if reflect.DeepEqual(got, want) {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				t.Fatalf("invalid peers: got=%q, want=%q", got, want)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+	waitRemotes(ips[:2]...)
+
+	for i := 0; i < 2; i++ {
+		if err := push.Send(zmq4.NewMsgString("hello")); err != nil {
+			t.Fatalf("could not send: %v", err)
+		}
+	}
+	for i, pull := range pulls[:2] {
+		msg, err := pull.Recv()
+		if err != nil {
+			t.Fatalf("could not recv from %s: %v", ips[i], err)
+		}
+		if got, want := string(msg.Frames[0]), "hello"; got != want {
+			t.Fatalf("invalid message from %s: got=%q, want=%q", ips[i], got, want)
+		}
+	}
+
+	// connections follow the changes of the DNS record.
+	r.set(ips[1:]...)
+	waitRemotes(ips[1:]...)
+
+	// peers going away are dialed again.
+	reopened := time.Now()
+	pulls[2].Close()
+	pulls[2] = zmq4.NewPull(ctx)
+	defer pulls[2].Close()
+	if err := pulls[2].Listen("tcp://" + net.JoinHostPort(ips[2], port)); err != nil {
+		t.Fatalf("could not listen again on %s: %v", ips[2], err)
+	}
+	for reconnected := false; !reconnected; {
+		for _, p := range push.Peers() {
+			reconnected = reconnected || (p.RemoteAddr == net.JoinHostPort(ips[2], port) && p.ConnectedAt.After(reopened))
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("peer %s was not dialed again", ips[2])
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	waitRemotes(ips[1:]...)
+	for i := 0; i < 2; i++ {
+		if err := push.Send(zmq4.NewMsgString("again")); err != nil {
+			t.Fatalf("could not send: %v", err)
+		}
+	}
+	msg, err := pulls[2].Recv()
+	if err != nil {
+		t.Fatalf("could not recv from %s: %v", ips[2], err)
+	}
+	if got, want := string(msg.Frames[0]), "again"; got != want {
+		t.Fatalf("invalid message from %s: got=%q, want=%q", ips[2], got, want)
+	}
+
+	if err := push.Disconnect(ep); err != nil {
+		t.Fatalf("could not disconnect: %v", err)
+	}
+	r.set(ips...)
+	time.Sleep(100 * time.Millisecond)
+	if got := remotes(); len(got) != 0 {
+		t.Fatalf("invalid peers after disconnect: %q", got)
+	}
+}
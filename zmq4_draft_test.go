@@ -0,0 +1,373 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build zmq4_draft
+// +build zmq4_draft
+
+package zmq4_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestScatterGather(t *testing.T) {
+	var (
+		hello = zmq4.NewMsg([]byte("HELLO WORLD"))
+		bye   = zmq4.NewMsg([]byte("GOOD BYE"))
+	)
+
+	for _, tc := range []struct {
+		name     string
+		endpoint string
+	}{
+		{"tcp-scatter-gather", must(EndPoint("tcp"))},
+		{"ipc-scatter-gather", "ipc://ipc-scatter-gather"},
+		{"inproc-scatter-gather", "inproc://scatter-gather"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, timeout := context.WithTimeout(context.Background(), 20*time.Second)
+			defer timeout()
+
+			ep := tc.endpoint
+			cleanUp(ep)
+
+			scatter := zmq4.NewScatter(ctx)
+			defer scatter.Close()
+
+			gather := zmq4.NewGather(ctx)
+			defer gather.Close()
+
+			grp, ctx := errgroup.WithContext(ctx)
+			grp.Go(func() error {
+				err := scatter.Listen(ep)
+				if err != nil {
+					return errors.Wrapf(err, "could not listen")
+				}
+				for _, msg := range []zmq4.Msg{hello, bye} {
+					err = scatter.Send(msg)
+					if err != nil {
+						return errors.Wrapf(err, "could not send %v", msg)
+					}
+				}
+				return nil
+			})
+			grp.Go(func() error {
+				err := gather.Dial(ep)
+				if err != nil {
+					return errors.Wrapf(err, "could not dial")
+				}
+				for i, want := range []zmq4.Msg{hello, bye} {
+					msg, err := gather.Recv()
+					if err != nil {
+						return errors.Wrapf(err, "could not recv %v", want)
+					}
+					if !reflect.DeepEqual(msg.Frames, want.Frames) {
+						return errors.Errorf("recv%d: got = %v, want= %v", i+1, msg, want)
+					}
+				}
+				return nil
+			})
+			if err := grp.Wait(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestScatterMultipart(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	scatter := zmq4.NewScatter(ctx)
+	defer scatter.Close()
+
+	if err := scatter.Send(zmq4.NewMsgFromString([]string{"a", "b"})); err == nil {
+		t.Fatalf("expected an error sending a multipart message")
+	}
+	if err := scatter.SendFrame([]byte("a"), true); err == nil {
+		t.Fatalf("expected an error sending a multipart message frame by frame")
+	}
+}
+
+func TestScatterGatherIncompatible(t *testing.T) {
+	for _, tc := range []struct {
+		typ, peer zmq4.SocketType
+		want      bool
+	}{
+		{zmq4.Scatter, zmq4.Gather, true},
+		{zmq4.Gather, zmq4.Scatter, true},
+		{zmq4.Scatter, zmq4.Pull, false},
+		{zmq4.Push, zmq4.Gather, false},
+	} {
+		if got := tc.typ.IsCompatible(tc.peer); got != tc.want {
+			t.Errorf("%v.IsCompatible(%v): got=%v, want=%v", tc.typ, tc.peer, got, tc.want)
+		}
+	}
+}
+
+func TestScatterGatherConcurrent(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 20*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	scatter := zmq4.NewScatter(ctx)
+	defer scatter.Close()
+	evts := scatter.Monitor()
+
+	if err := scatter.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	var gathers []zmq4.Socket
+	for i := 0; i < 2; i++ {
+		gather := zmq4.NewGather(ctx)
+		defer gather.Close()
+		if err := gather.Dial(ep); err != nil {
+			t.Fatalf("could not dial: %v", err)
+		}
+		waitEvent(t, evts, zmq4.EventAccepted)
+		gathers = append(gathers, gather)
+	}
+
+	const (
+		nsenders = 4
+		nmsgs    = 50 // per sender
+		nrecvers = 3  // per gather socket
+	)
+
+	grp, _ := errgroup.WithContext(ctx)
+	for i := 0; i < nsenders; i++ {
+		i := i
+		grp.Go(func() error {
+			for j := 0; j < nmsgs; j++ {
+				msg := zmq4.NewMsgString(fmt.Sprintf("msg-%d-%d", i, j))
+				if err := scatter.Send(msg); err != nil {
+					return errors.Wrapf(err, "could not send %v", msg)
+				}
+			}
+			return nil
+		})
+	}
+
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]int)
+		per  = make([]int, len(gathers))
+	)
+	recvs, rctx := errgroup.WithContext(ctx)
+	for i := range gathers {
+		i := i
+		for j := 0; j < nrecvers; j++ {
+			recvs.Go(func() error {
+				for {
+					msg, err := gathers[i].RecvContext(rctx)
+					if err != nil {
+						if rctx.Err() != nil {
+							return nil
+						}
+						return errors.Wrapf(err, "could not recv")
+					}
+					mu.Lock()
+					seen[string(msg.Frames[0])]++
+					per[i]++
+					done := len(seen) == nsenders*nmsgs
+					mu.Unlock()
+					if done {
+						return context.Canceled
+					}
+				}
+			})
+		}
+	}
+
+	if err := grp.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if err := recvs.Wait(); err != nil && err != context.Canceled {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for k, n := range seen {
+		if n != 1 {
+			t.Fatalf("message %q received %d times", k, n)
+		}
+	}
+	// messages are distributed round-robin.
+	for i, n := range per {
+		if n != nsenders*nmsgs/len(gathers) {
+			t.Fatalf("invalid number of messages received by gather %d: got=%d, want=%d", i, n, nsenders*nmsgs/len(gathers))
+		}
+	}
+}
+
+func TestRadioDish(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 20*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	radio := zmq4.NewRadio(ctx)
+	defer radio.Close()
+	evts := radio.Monitor()
+
+	if err := radio.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	groups := []string{"weather", "sports"}
+	var dishes []zmq4.DishSocket
+	for _, group := range groups {
+		d := zmq4.NewDish(ctx)
+		defer d.Close()
+		if err := d.Join(group); err != nil {
+			t.Fatalf("could not join %q: %v", group, err)
+		}
+		if err := d.Dial(ep); err != nil {
+			t.Fatalf("could not dial: %v", err)
+		}
+		waitEvent(t, evts, zmq4.EventAccepted)
+		dishes = append(dishes, d)
+	}
+
+	if err := dishes[0].Join("weather"); err == nil {
+		t.Fatalf("expected an error joining a group twice")
+	}
+	if err := dishes[0].Leave("news"); err == nil {
+		t.Fatalf("expected an error leaving a group not joined")
+	}
+
+	const nmsgs = 5
+	recvs, rctx := errgroup.WithContext(ctx)
+	for i := range dishes {
+		d, group := dishes[i], groups[i]
+		recvs.Go(func() error {
+			for j := 0; j < nmsgs; j++ {
+				msg, err := d.RecvContext(rctx)
+				if err != nil {
+					return errors.Wrapf(err, "could not recv")
+				}
+				if msg.Group != group {
+					return errors.Errorf("dish of %q received a message of %q", group, msg.Group)
+				}
+				if got, want := string(msg.Frames[0]), group+"-data"; got != want {
+					return errors.Errorf("invalid message: got=%q, want=%q", got, want)
+				}
+			}
+			return nil
+		})
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- recvs.Wait() }()
+
+	// the groups may not be joined yet on the RADIO side: keep sending.
+	ticks := time.NewTicker(5 * time.Millisecond)
+	defer ticks.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			return
+		case <-ticks.C:
+			for _, group := range append([]string{"news"}, groups...) {
+				msg := zmq4.NewMsgString(group + "-data")
+				msg.Group = group
+				if err := radio.Send(msg); err != nil {
+					t.Fatalf("could not send: %v", err)
+				}
+			}
+		}
+	}
+}
+
+func TestRadioInvalidMessages(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	radio := zmq4.NewRadio(ctx)
+	defer radio.Close()
+
+	msg := zmq4.NewMsgString("data")
+	msg.Group = "a-much-too-long-group"
+	if err := radio.Send(msg); err == nil {
+		t.Fatalf("expected an error sending to a too long group")
+	}
+
+	msg = zmq4.NewMsgFromString([]string{"a", "b"})
+	msg.Group = "group"
+	if err := radio.Send(msg); err == nil {
+		t.Fatalf("expected an error sending a multipart message")
+	}
+
+	if err := zmq4.NewDish(ctx).Join("a-much-too-long-group"); err == nil {
+		t.Fatalf("expected an error joining a too long group")
+	}
+}
+
+func TestDishLeave(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	radio := zmq4.NewRadio(ctx)
+	defer radio.Close()
+
+	d := zmq4.NewDish(ctx)
+	defer d.Close()
+
+	if err := radio.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := d.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	if err := d.Join("old"); err != nil {
+		t.Fatalf("could not join: %v", err)
+	}
+	if err := d.Leave("old"); err != nil {
+		t.Fatalf("could not leave: %v", err)
+	}
+	if err := d.Join("new"); err != nil {
+		t.Fatalf("could not join: %v", err)
+	}
+
+	// commands are processed in order: once a message of the new group
+	// is received, the old group was left.
+	go func() {
+		for ctx.Err() == nil {
+			for _, group := range []string{"old", "new"} {
+				msg := zmq4.NewMsgString(group)
+				msg.Group = group
+				radio.Send(msg)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		msg, err := d.RecvContext(ctx)
+		if err != nil {
+			t.Fatalf("could not recv: %v", err)
+		}
+		if msg.Group != "new" {
+			t.Fatalf("received a message of group %q", msg.Group)
+		}
+	}
+}
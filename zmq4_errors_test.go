@@ -0,0 +1,262 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	stderrors "errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func TestErrBadEndpoint(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	const ep = "foo://bar"
+
+	sck := zmq4.NewPull(ctx)
+	defer sck.Close()
+
+	for _, tc := range []struct {
+		name string
+		f    func(string) error
+	}{
+		{"listen", sck.Listen},
+		{"dial", sck.Dial},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.f(ep)
+			var bad *zmq4.ErrBadEndpoint
+			if !stderrors.As(err, &bad) {
+				t.Fatalf("invalid error: got=%v (%T), want=*ErrBadEndpoint", err, err)
+			}
+			if bad.Endpoint != ep {
+				t.Fatalf("invalid endpoint: got=%q, want=%q", bad.Endpoint, ep)
+			}
+		})
+	}
+}
+
+func TestErrUnknownTransport(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	const ep = "tpc://127.0.0.1:5555"
+
+	sck := zmq4.NewPush(ctx)
+	defer sck.Close()
+
+	for _, tc := range []struct {
+		name string
+		f    func(string) error
+	}{
+		{"listen", sck.Listen},
+		{"dial", sck.Dial},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.f(ep)
+			if got, want := err.Error(), `zmq4: invalid endpoint "tpc://127.0.0.1:5555": unknown transport "tpc"`; got != want {
+				t.Fatalf("invalid error:\ngot= %s\nwant=%s", got, want)
+			}
+			var unknown *zmq4.ErrUnknownTransport
+			if !stderrors.As(err, &unknown) {
+				t.Fatalf("invalid error: got=%v (%T), want=*ErrUnknownTransport", err, err)
+			}
+			if got, want := unknown.Scheme, "tpc"; got != want {
+				t.Fatalf("invalid scheme: got=%q, want=%q", got, want)
+			}
+		})
+	}
+}
+
+func TestErrHandshake(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	rep := zmq4.NewRep(ctx)
+	defer rep.Close()
+
+	sub := zmq4.NewSub(ctx)
+	defer sub.Close()
+
+	if err := rep.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	err := sub.Dial(ep)
+	var hs *zmq4.ErrHandshake
+	if !stderrors.As(err, &hs) {
+		t.Fatalf("invalid error: got=%v (%T), want=*ErrHandshake", err, err)
+	}
+	if hs.Reason == "" {
+		t.Fatalf("handshake error has no reason")
+	}
+	if !stderrors.Is(err, zmq4.ErrIncompatibleSocket) {
+		t.Fatalf("invalid error: got=%v, want=%v", err, zmq4.ErrIncompatibleSocket)
+	}
+}
+
+func TestZMTPError(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx, zmq4.WithMaxConnections(1))
+	defer pull.Close()
+	evts := pull.Monitor()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	push1 := zmq4.NewPush(ctx)
+	defer push1.Close()
+	if err := push1.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	waitEvent(t, evts, zmq4.EventAccepted)
+
+	push2 := zmq4.NewPush(ctx)
+	defer push2.Close()
+	err := push2.Dial(ep)
+	var zerr *zmq4.ZMTPError
+	if !stderrors.As(err, &zerr) {
+		t.Fatalf("invalid error: got=%v (%T), want=*ZMTPError", err, err)
+	}
+	if got, want := zerr.Reason, "too-many-peers"; got != want {
+		t.Fatalf("invalid reason: got=%q, want=%q", got, want)
+	}
+	if !stderrors.Is(err, zmq4.ErrTooManyConnections) {
+		t.Fatalf("invalid error: got=%v, want=%v", err, zmq4.ErrTooManyConnections)
+	}
+}
+
+func TestErrTimeout(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	t.Run("recv", func(t *testing.T) {
+		ep := must(EndPoint("tcp"))
+
+		pull := zmq4.NewPull(ctx)
+		defer pull.Close()
+
+		if err := pull.Listen(ep); err != nil {
+			t.Fatalf("could not listen: %v", err)
+		}
+		if err := pull.SetOption(zmq4.OptionRecvTimeout, 50*time.Millisecond); err != nil {
+			t.Fatalf("could not set recv timeout: %v", err)
+		}
+
+		_, err := pull.Recv()
+		if !stderrors.Is(err, zmq4.ErrTimeout) {
+			t.Fatalf("invalid error: got=%v, want=%v", err, zmq4.ErrTimeout)
+		}
+	})
+
+	t.Run("handshake", func(t *testing.T) {
+		// a peer accepting connections, but never sending its greeting.
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("could not listen: %v", err)
+		}
+		defer l.Close()
+		go func() {
+			var conns []net.Conn
+			defer func() {
+				for _, conn := range conns {
+					conn.Close()
+				}
+			}()
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				conns = append(conns, conn)
+			}
+		}()
+
+		push := zmq4.NewPush(ctx,
+			zmq4.WithHandshakeTimeout(20*time.Millisecond),
+			zmq4.WithDialerRetry(10*time.Millisecond),
+		)
+		defer push.Close()
+
+		err = push.Dial("tcp://" + l.Addr().String())
+		if !stderrors.Is(err, zmq4.ErrTimeout) {
+			t.Fatalf("invalid error: got=%v, want=%v", err, zmq4.ErrTimeout)
+		}
+		var hs *zmq4.ErrHandshake
+		if !stderrors.As(err, &hs) {
+			t.Fatalf("invalid error: got=%v (%T), want=*ErrHandshake", err, err)
+		}
+	})
+}
+
+func TestErrSentinels(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	t.Run("host-unreachable", func(t *testing.T) {
+		router := zmq4.NewRouter(ctx, zmq4.WithRouterMandatory(true))
+		defer router.Close()
+
+		err := router.Send(zmq4.NewMsgFrom([]byte("unknown"), []byte("data")))
+		if !stderrors.Is(err, zmq4.ErrHostUnreachable) {
+			t.Fatalf("invalid error: got=%v, want=%v", err, zmq4.ErrHostUnreachable)
+		}
+	})
+
+	t.Run("msg-too-large", func(t *testing.T) {
+		ep := must(EndPoint("tcp"))
+
+		pull := zmq4.NewPull(ctx, zmq4.WithMaxMsgSize(16))
+		defer pull.Close()
+
+		push := zmq4.NewPush(ctx)
+		defer push.Close()
+
+		if err := pull.Listen(ep); err != nil {
+			t.Fatalf("could not listen: %v", err)
+		}
+		if err := push.Dial(ep); err != nil {
+			t.Fatalf("could not dial: %v", err)
+		}
+		if err := push.Send(zmq4.NewMsg(make([]byte, 1024))); err != nil {
+			t.Fatalf("could not send: %v", err)
+		}
+
+		_, err := pull.Recv()
+		if !stderrors.Is(err, zmq4.ErrMsgTooLarge) {
+			t.Fatalf("invalid error: got=%v, want=%v", err, zmq4.ErrMsgTooLarge)
+		}
+	})
+
+	t.Run("closed-socket", func(t *testing.T) {
+		pull := zmq4.NewPull(ctx)
+
+		errc := make(chan error, 1)
+		go func() {
+			_, err := pull.Recv()
+			errc <- err
+		}()
+		time.Sleep(20 * time.Millisecond)
+		pull.Close()
+
+		if err := <-errc; !stderrors.Is(err, zmq4.ErrClosedSocket) {
+			t.Fatalf("invalid error: got=%v, want=%v", err, zmq4.ErrClosedSocket)
+		}
+	})
+}
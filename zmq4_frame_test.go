@@ -0,0 +1,136 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func TestSendRecvFrame(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	pull1 := zmq4.NewPull(ctx)
+	defer pull1.Close()
+	pull2 := zmq4.NewPull(ctx)
+	defer pull2.Close()
+
+	if err := push.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	evts := push.Monitor()
+	for _, pull := range []zmq4.Socket{pull1, pull2} {
+		if err := pull.Dial(ep); err != nil {
+			t.Fatalf("could not dial: %v", err)
+		}
+		waitEvent(t, evts, zmq4.EventAccepted)
+	}
+
+	// the frames of a message go to a single peer, the next messages
+	// are load-balanced as usual.
+	for _, frame := range []string{"header", "body-1", "body-2"} {
+		if err := push.SendFrame([]byte(frame), frame != "body-2"); err != nil {
+			t.Fatalf("could not send frame %q: %v", frame, err)
+		}
+		if frame == "header" {
+			if err := push.Send(zmq4.NewMsgString("interleaved")); err == nil {
+				t.Fatalf("expected an error sending a message while a message is sent frame by frame")
+			}
+		}
+	}
+	if err := push.Send(zmq4.NewMsgString("next")); err != nil {
+		t.Fatalf("could not send message: %v", err)
+	}
+
+	msg, err := pull1.Recv()
+	if err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+	want := [][]byte{[]byte("header"), []byte("body-1"), []byte("body-2")}
+	if got := msg.Frames; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid message:\ngot= %q\nwant=%q", got, want)
+	}
+
+	frame, more, err := pull2.RecvFrame()
+	if err != nil {
+		t.Fatalf("could not recv frame: %v", err)
+	}
+	if string(frame) != "next" || more {
+		t.Fatalf("invalid frame: got=(%q, %v), want=(%q, %v)", frame, more, "next", false)
+	}
+
+	pub := zmq4.NewPub(ctx)
+	defer pub.Close()
+	if err := pub.SendFrame([]byte("topic"), true); err == nil {
+		t.Fatalf("expected an error sending frames on a PUB socket")
+	}
+}
+
+func TestReqRepFrame(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	rep := zmq4.NewRep(ctx)
+	defer rep.Close()
+
+	req := zmq4.NewReq(ctx)
+	defer req.Close()
+
+	if err := rep.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := req.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	recvFrames := func(sck zmq4.Socket) []string {
+		t.Helper()
+		var frames []string
+		for {
+			frame, more, err := sck.RecvFrame()
+			if err != nil {
+				t.Fatalf("could not recv frame: %v", err)
+			}
+			frames = append(frames, string(frame))
+			if !more {
+				return frames
+			}
+		}
+	}
+
+	if err := req.SendFrame([]byte("question"), true); err != nil {
+		t.Fatalf("could not send frame: %v", err)
+	}
+	if err := req.SendFrame([]byte("details"), false); err != nil {
+		t.Fatalf("could not send frame: %v", err)
+	}
+
+	if got, want := recvFrames(rep), []string{"question", "details"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid request:\ngot= %q\nwant=%q", got, want)
+	}
+
+	if err := rep.SendFrame([]byte("answer"), true); err != nil {
+		t.Fatalf("could not send frame: %v", err)
+	}
+	if err := rep.SendFrame([]byte("more details"), false); err != nil {
+		t.Fatalf("could not send frame: %v", err)
+	}
+
+	if got, want := recvFrames(req), []string{"answer", "more details"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid reply:\ngot= %q\nwant=%q", got, want)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func TestHandshakeTimings(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	router := zmq4.NewRouter(ctx, zmq4.WithID(zmq4.SocketIdentity("router")))
+	defer router.Close()
+	revts := router.Monitor()
+
+	dealer := zmq4.NewDealer(ctx, zmq4.WithID(zmq4.SocketIdentity("dealer")))
+	defer dealer.Close()
+	devts := dealer.Monitor()
+
+	if err := router.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := dealer.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	plausible := func(t *testing.T, name string, hs zmq4.HandshakeTimings) {
+		t.Helper()
+		if hs.Greeting <= 0 || hs.Security <= 0 {
+			t.Fatalf("%s: invalid handshake phases: %+v", name, hs)
+		}
+		if total := hs.Total(); total <= 0 || total > 5*time.Second {
+			t.Fatalf("%s: implausible handshake duration: %v", name, total)
+		}
+	}
+
+	dev := waitEvent(t, devts, zmq4.EventConnected)
+	plausible(t, "dealer-event", dev.Handshake)
+	if dev.Handshake.Connect <= 0 {
+		t.Fatalf("invalid connect duration: %v", dev.Handshake.Connect)
+	}
+
+	rev := waitEvent(t, revts, zmq4.EventAccepted)
+	plausible(t, "router-event", rev.Handshake)
+	if rev.Handshake.Connect != 0 {
+		t.Fatalf("invalid connect duration for accepted connection: %v", rev.Handshake.Connect)
+	}
+
+	hs, ok := dealer.ConnHandshake("router")
+	if !ok {
+		t.Fatalf("no handshake timings for peer %q", "router")
+	}
+	if hs != dev.Handshake {
+		t.Fatalf("invalid handshake timings: got=%+v, want=%+v", hs, dev.Handshake)
+	}
+
+	hs, ok = router.ConnHandshake("dealer")
+	if !ok {
+		t.Fatalf("no handshake timings for peer %q", "dealer")
+	}
+	plausible(t, "router", hs)
+
+	if _, ok := router.ConnHandshake("unknown"); ok {
+		t.Fatalf("unexpected handshake timings for unknown peer")
+	}
+}
+
+func TestHandshakeTimeoutDial(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	// a peer accepting connections, but never sending its greeting.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	const hstimeout = 50 * time.Millisecond
+	push := zmq4.NewPush(ctx, zmq4.WithHandshakeTimeout(hstimeout), zmq4.WithDialerRetry(10*time.Millisecond))
+	defer push.Close()
+	evts := push.Monitor()
+
+	start := time.Now()
+	err = push.Dial("tcp://" + l.Addr().String())
+	if err == nil {
+		t.Fatalf("expected an error dialing a silent peer")
+	}
+	// the handshake is retried like a failed dial, 10 times at most.
+	if elapsed, max := time.Since(start), 11*(hstimeout+10*time.Millisecond)+time.Second; elapsed > max {
+		t.Fatalf("dial took too long: %v > %v", elapsed, max)
+	}
+	waitEvent(t, evts, zmq4.EventHandshakeFailed)
+}
+
+func TestHandshakeTimeoutListen(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx, zmq4.WithHandshakeTimeout(100*time.Millisecond))
+	defer pull.Close()
+	evts := pull.Monitor()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	// a peer connecting, but never sending its greeting.
+	silent, err := net.Dial("tcp", pull.Addr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer silent.Close()
+
+	// the listener keeps accepting other peers.
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	if err := push.Send(zmq4.NewMsgString("hello")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	if _, err := pull.Recv(); err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+
+	ev := waitEvent(t, evts, zmq4.EventHandshakeFailed)
+	if ev.Err == nil {
+		t.Fatalf("no error reported for the failed handshake")
+	}
+	// the silent peer was disconnected, after the greeting of the socket.
+	silent.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.Copy(ioutil.Discard, silent); err != nil {
+		t.Fatalf("silent peer not disconnected: %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+// blackhole is a TCP proxy that can be told to silently drop all
+// the traffic, simulating a half-open connection, or to stop reading,
+// simulating a stalled peer.
+type blackhole struct {
+	l      net.Listener
+	target string
+	quit   chan struct{}
+
+	mu      sync.Mutex
+	blocked bool
+	stalled bool
+}
+
+func newBlackhole(t *testing.T, target string) *blackhole {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	p := &blackhole{l: l, target: target, quit: make(chan struct{})}
+	go p.serve()
+	return p
+}
+
+func (p *blackhole) Addr() string { return "tcp://" + p.l.Addr().String() }
+
+func (p *blackhole) Close() error {
+	close(p.quit)
+	return p.l.Close()
+}
+
+func (p *blackhole) block() {
+	p.mu.Lock()
+	p.blocked = true
+	p.mu.Unlock()
+}
+
+func (p *blackhole) stall() {
+	p.mu.Lock()
+	p.stalled = true
+	p.mu.Unlock()
+}
+
+func (p *blackhole) serve() {
+	for {
+		src, err := p.l.Accept()
+		if err != nil {
+			return
+		}
+		dst, err := net.Dial("tcp", p.target)
+		if err != nil {
+			src.Close()
+			continue
+		}
+		go p.pipe(dst, src)
+		go p.pipe(src, dst)
+	}
+}
+
+func (p *blackhole) pipe(dst io.Writer, src io.Reader) {
+	buf := make([]byte, 1024)
+	for {
+		n, err := src.Read(buf)
+		if err != nil {
+			return
+		}
+		p.mu.Lock()
+		w := dst
+		if p.blocked {
+			w = ioutil.Discard
+		}
+		stalled := p.stalled
+		p.mu.Unlock()
+		if stalled {
+			<-p.quit
+			return
+		}
+		if _, err := w.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	const (
+		interval = 50 * time.Millisecond
+		hbtimeo  = 100 * time.Millisecond
+	)
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx, zmq4.WithZMTPVersion(3, 1))
+	defer pull.Close()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	proxy := newBlackhole(t, strings.TrimPrefix(ep, "tcp://"))
+	defer proxy.Close()
+
+	push := zmq4.NewPush(ctx,
+		zmq4.WithZMTPVersion(3, 1),
+		zmq4.WithHeartbeatInterval(interval),
+		zmq4.WithHeartbeatTimeout(hbtimeo),
+	)
+	defer push.Close()
+
+	evts := push.Monitor()
+	if err := push.Dial(proxy.Addr()); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	// heartbeats flow through a live connection without reaching the application.
+	time.Sleep(5 * interval)
+	if err := push.Send(zmq4.NewMsgString("alive")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	msg, err := pull.Recv()
+	if err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+	if got, want := string(msg.Frames[0]), "alive"; got != want {
+		t.Fatalf("invalid message: got=%q, want=%q", got, want)
+	}
+	select {
+	case ev := <-evts:
+		if ev.Type == zmq4.EventDisconnected {
+			t.Fatalf("live connection was closed")
+		}
+	default:
+	}
+
+	proxy.block()
+	start := time.Now()
+	waitEvent(t, evts, zmq4.EventDisconnected)
+	if d, max := time.Since(start), hbtimeo+2*interval; d > max {
+		t.Fatalf("dead connection detected after %v, want < %v", d, max)
+	}
+}
+
+func TestHeartbeatZMTP30(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	const interval = 20 * time.Millisecond
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	proxy := newBlackhole(t, strings.TrimPrefix(ep, "tcp://"))
+	defer proxy.Close()
+
+	push := zmq4.NewPush(ctx,
+		zmq4.WithZMTPVersion(3, 1),
+		zmq4.WithHeartbeatInterval(interval),
+	)
+	defer push.Close()
+
+	evts := push.Monitor()
+	if err := push.Dial(proxy.Addr()); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	waitEvent(t, evts, zmq4.EventConnected)
+
+	// ZMTP 3.0 does not define PING commands: the peer is not pinged,
+	// and thus not declared dead.
+	proxy.block()
+	select {
+	case ev := <-evts:
+		t.Fatalf("unexpected event: %v", ev.Type)
+	case <-time.After(10 * interval):
+	}
+}
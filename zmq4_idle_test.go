@@ -0,0 +1,64 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func TestCloseIdle(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	router := zmq4.NewRouter(ctx, zmq4.WithID(zmq4.SocketIdentity("router")))
+	defer router.Close()
+	evts := router.Monitor()
+
+	if err := router.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	var dealers []zmq4.Socket
+	for _, id := range []string{"active", "idle"} {
+		dealer := zmq4.NewDealer(ctx, zmq4.WithID(zmq4.SocketIdentity(id)))
+		defer dealer.Close()
+		if err := dealer.Dial(ep); err != nil {
+			t.Fatalf("could not dial: %v", err)
+		}
+		waitEvent(t, evts, zmq4.EventAccepted)
+		dealers = append(dealers, dealer)
+	}
+
+	const maxIdle = 200 * time.Millisecond
+	if n := router.CloseIdle(maxIdle); n != 0 {
+		t.Fatalf("invalid number of reaped connections: got=%d, want=0", n)
+	}
+
+	time.Sleep(2 * maxIdle)
+	if err := dealers[0].Send(zmq4.NewMsgString("ping")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	if _, err := router.Recv(); err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+
+	if n := router.CloseIdle(maxIdle); n != 1 {
+		t.Fatalf("invalid number of reaped connections: got=%d, want=1", n)
+	}
+	waitEvent(t, evts, zmq4.EventDisconnected)
+
+	if md := router.ConnMetadata("idle"); md != nil {
+		t.Fatalf("idle peer still connected")
+	}
+	if md := router.ConnMetadata("active"); md == nil {
+		t.Fatalf("active peer disconnected")
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	stderrors "errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func TestIPCListen(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	dir, err := ioutil.TempDir("", "zmq4-ipc-")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("missing-dir", func(t *testing.T) {
+		path := filepath.Join(dir, "a", "b", "sock")
+
+		pull := zmq4.NewPull(ctx)
+		if err := pull.Listen("ipc://" + path); err != nil {
+			t.Fatalf("could not listen: %v", err)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("socket file not created: %v", err)
+		}
+		pull.Close()
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("socket file not removed on close: %v", err)
+		}
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		path := filepath.Join(dir, "stale")
+
+		// leave a socket file nothing listens on.
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatalf("could not listen: %v", err)
+		}
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		l.Close()
+
+		pull := zmq4.NewPull(ctx)
+		defer pull.Close()
+		if err := pull.Listen("ipc://" + path); err != nil {
+			t.Fatalf("could not listen on a stale socket file: %v", err)
+		}
+	})
+
+	t.Run("live", func(t *testing.T) {
+		path := filepath.Join(dir, "live")
+
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatalf("could not listen: %v", err)
+		}
+		defer l.Close()
+
+		pull := zmq4.NewPull(ctx)
+		defer pull.Close()
+		err = pull.Listen("ipc://" + path)
+		if !stderrors.Is(err, zmq4.ErrAlreadyBound) {
+			t.Fatalf("invalid error: got=%v, want=%v", err, zmq4.ErrAlreadyBound)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("live socket file removed: %v", err)
+		}
+	})
+}
+
+func TestIPCAbstract(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("abstract unix sockets not supported on %s", runtime.GOOS)
+	}
+
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	name := "@zmq4-" + newUUID()
+	ep := "ipc://" + name
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if _, err := os.Lstat(name); !os.IsNotExist(err) {
+		t.Fatalf("abstract socket touched the filesystem: %v", err)
+	}
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	if err := push.Send(zmq4.NewMsgString("abstract")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	msg, err := pull.Recv()
+	if err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+	if got, want := string(msg.Frames[0]), "abstract"; got != want {
+		t.Fatalf("invalid message: got=%q, want=%q", got, want)
+	}
+}
+
+func TestIPCDialBeforeListen(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("ipc"))
+	defer cleanUp(ep)
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx, zmq4.WithDialerRetry(20*time.Millisecond))
+	defer push.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- push.Dial(ep)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/pkg/errors"
+)
+
+// soReusePort is the value of SO_REUSEPORT on linux, not exported by syscall.
+const soReusePort = 0xf
+
+func TestListenConfig(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	reuse := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var err error
+			cerr := c.Control(func(fd uintptr) {
+				err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+				if err != nil {
+					return
+				}
+				err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+			})
+			if cerr != nil {
+				return cerr
+			}
+			return err
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		pull := zmq4.NewPull(ctx, zmq4.WithListenConfig(reuse))
+		defer pull.Close()
+		if err := pull.Listen(ep); err != nil {
+			t.Fatalf("could not listen #%d with reusable address: %v", i, err)
+		}
+	}
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+	if err := pull.Listen(ep); errors.Cause(err) != zmq4.ErrAlreadyBound {
+		t.Fatalf("invalid error: got=%v, want=%v", err, zmq4.ErrAlreadyBound)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLogger(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	buf := new(syncBuffer)
+	pull := zmq4.NewPull(ctx, zmq4.WithLogger(zmq4.NewLogLogger(log.New(buf, "", 0))))
+	defer pull.Close()
+
+	evts := pull.Monitor()
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	// a peer sending a garbage greeting fails the handshake.
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ep, "tcp://"))
+	if err != nil {
+		t.Fatalf("could not dial raw connection: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(make([]byte, 64)); err != nil {
+		t.Fatalf("could not write garbage greeting: %v", err)
+	}
+	waitEvent(t, evts, zmq4.EventHandshakeFailed)
+
+	// a peer going away is a connection read error.
+	push := zmq4.NewPush(ctx)
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	waitEvent(t, evts, zmq4.EventAccepted)
+	push.Close()
+	waitEvent(t, evts, zmq4.EventDisconnected)
+
+	out := buf.String()
+	for _, want := range []string{
+		`ERROR zmq4: could not open a ZMTP connection from "` + ep + `"`,
+		`ERROR zmq4: handshake-failed socket="PULL" endpoint="` + ep + `" error=`,
+		`WARN zmq4: could not read from "` + ep + `"`,
+		`WARN zmq4: disconnected socket="PULL" endpoint="` + ep + `"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing log entry %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestStructuredLogger(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	buf := new(syncBuffer)
+	pull := zmq4.NewPull(ctx, zmq4.WithLogger(zmq4.NewStdLogger(buf)))
+	defer pull.Close()
+
+	evts := pull.Monitor()
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	// a peer sending a garbage greeting fails the handshake.
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ep, "tcp://"))
+	if err != nil {
+		t.Fatalf("could not dial raw connection: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(make([]byte, 64)); err != nil {
+		t.Fatalf("could not write garbage greeting: %v", err)
+	}
+	waitEvent(t, evts, zmq4.EventHandshakeFailed)
+
+	// a peer going away closes its connection unexpectedly.
+	push := zmq4.NewPush(ctx)
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	waitEvent(t, evts, zmq4.EventAccepted)
+	push.Close()
+	waitEvent(t, evts, zmq4.EventDisconnected)
+
+	out := buf.String()
+	for _, want := range []string{
+		`DEBUG zmq4: listening socket="PULL" endpoint="` + ep + `"`,
+		`ERROR zmq4: handshake-failed socket="PULL" endpoint="` + ep + `" error=`,
+		`ERROR zmq4: could not open a ZMTP connection from "` + ep + `"`,
+		`DEBUG zmq4: accepted socket="PULL" endpoint="` + ep + `"`,
+		`WARN zmq4: could not read from "` + ep + `"`,
+		`WARN zmq4: disconnected socket="PULL" endpoint="` + ep + `"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing log entry %q in:\n%s", want, out)
+		}
+	}
+}
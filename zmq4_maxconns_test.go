@@ -0,0 +1,51 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/pkg/errors"
+)
+
+func TestMaxConnections(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx, zmq4.WithMaxConnections(2))
+	defer pull.Close()
+	evts := pull.Monitor()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		push := zmq4.NewPush(ctx, zmq4.WithID(zmq4.SocketIdentity(fmt.Sprintf("push-%d", i))))
+		defer push.Close()
+
+		err := push.Dial(ep)
+		switch {
+		case i < 2:
+			if err != nil {
+				t.Fatalf("client %d: could not dial: %v", i, err)
+			}
+			waitEvent(t, evts, zmq4.EventAccepted)
+		default:
+			if got, want := errors.Cause(err), zmq4.ErrTooManyConnections; got != want {
+				t.Fatalf("client %d: invalid error: got=%v, want=%v", i, err, want)
+			}
+			if ev := waitEvent(t, evts, zmq4.EventRejected); ev.Err != zmq4.ErrTooManyConnections {
+				t.Fatalf("client %d: invalid event error: got=%v, want=%v", i, ev.Err, zmq4.ErrTooManyConnections)
+			}
+		}
+	}
+}
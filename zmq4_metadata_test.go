@@ -0,0 +1,102 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestConnMetadata(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	rep := zmq4.NewRep(ctx)
+	defer rep.Close()
+
+	req := zmq4.NewReq(ctx,
+		zmq4.WithID(zmq4.SocketIdentity("client-0")),
+		zmq4.WithMetadata("App", "test"),
+	)
+	defer req.Close()
+
+	if md := rep.ConnMetadata("client-0"); md != nil {
+		t.Fatalf("unexpected metadata for unconnected peer: %v", md)
+	}
+
+	grp, _ := errgroup.WithContext(ctx)
+	grp.Go(func() error {
+		err := rep.Listen(ep)
+		if err != nil {
+			return errors.Wrapf(err, "could not listen")
+		}
+
+		msg, err := rep.Recv()
+		if err != nil {
+			return errors.Wrapf(err, "could not recv")
+		}
+
+		for _, tc := range []struct {
+			k, v string
+		}{
+			{"Socket-Type", "REQ"},
+			{"Identity", "client-0"},
+			{"X-App", "test"},
+		} {
+			if got, want := msg.Metadata[tc.k], tc.v; got != want {
+				return errors.Errorf("msg metadata[%q]: got=%q, want=%q", tc.k, got, want)
+			}
+		}
+
+		md := rep.ConnMetadata("client-0")
+		if md == nil {
+			return errors.Errorf("no metadata for peer %q", "client-0")
+		}
+		for _, tc := range []struct {
+			k, v string
+		}{
+			{"Socket-Type", "REQ"},
+			{"Identity", "client-0"},
+			{"X-App", "test"},
+		} {
+			if got, want := md[tc.k], tc.v; got != want {
+				return errors.Errorf("conn metadata[%q]: got=%q, want=%q", tc.k, got, want)
+			}
+		}
+
+		return rep.Send(zmq4.NewMsgString("ok"))
+	})
+	grp.Go(func() error {
+		err := req.Dial(ep)
+		if err != nil {
+			return errors.Wrapf(err, "could not dial")
+		}
+
+		err = req.Send(zmq4.NewMsgString("hello"))
+		if err != nil {
+			return errors.Wrapf(err, "could not send")
+		}
+
+		msg, err := req.Recv()
+		if err != nil {
+			return errors.Wrapf(err, "could not recv")
+		}
+		if got, want := msg.Metadata["Socket-Type"], "REP"; got != want {
+			return errors.Errorf("msg metadata: got=%q, want=%q", got, want)
+		}
+		return nil
+	})
+
+	if err := grp.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func waitEvent(t *testing.T, evts <-chan zmq4.Event, typ zmq4.EventType) zmq4.Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-evts:
+			if !ok {
+				t.Fatalf("monitor channel closed while waiting for %v", typ)
+			}
+			if ev.Type == typ {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("timeout waiting for %v", typ)
+		}
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	router := zmq4.NewRouter(ctx, zmq4.WithID(zmq4.SocketIdentity("router")))
+	revts := router.Monitor()
+
+	dealer := zmq4.NewDealer(ctx, zmq4.WithID(zmq4.SocketIdentity("dealer")))
+	devts := dealer.Monitor()
+
+	if err := router.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if ev := waitEvent(t, revts, zmq4.EventListening); ev.Endpoint != ep {
+		t.Fatalf("invalid endpoint: got=%q, want=%q", ev.Endpoint, ep)
+	}
+
+	if err := router.Listen(ep); err == nil {
+		t.Fatalf("expected an error listening twice on %q", ep)
+	}
+	if ev := waitEvent(t, revts, zmq4.EventBindFailed); ev.Err == nil {
+		t.Fatalf("expected an error in %v", ev)
+	}
+
+	if err := dealer.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	if ev := waitEvent(t, devts, zmq4.EventConnected); ev.Endpoint != ep {
+		t.Fatalf("invalid endpoint: got=%q, want=%q", ev.Endpoint, ep)
+	}
+	waitEvent(t, revts, zmq4.EventAccepted)
+
+	// a peer sending a garbage greeting fails the handshake.
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ep, "tcp://"))
+	if err != nil {
+		t.Fatalf("could not dial raw connection: %v", err)
+	}
+	if _, err := conn.Write(make([]byte, 64)); err != nil {
+		t.Fatalf("could not write garbage greeting: %v", err)
+	}
+	if ev := waitEvent(t, revts, zmq4.EventHandshakeFailed); ev.Err == nil {
+		t.Fatalf("expected an error in %v", ev)
+	}
+	conn.Close()
+
+	if err := dealer.Close(); err != nil {
+		t.Fatalf("could not close dealer: %v", err)
+	}
+	waitEvent(t, devts, zmq4.EventDisconnected)
+	waitEvent(t, revts, zmq4.EventDisconnected)
+
+	if err := router.Close(); err != nil {
+		t.Fatalf("could not close router: %v", err)
+	}
+	for range revts {
+	}
+	for range devts {
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !zmq4_draft
+// +build !zmq4_draft
+
+package zmq4
+
+import (
+	"testing"
+)
+
+// The draft socket types must not be part of the API without the zmq4_draft
+// build tag: these declarations would not compile otherwise.
+var (
+	Scatter    = SocketType("SCATTER")
+	Gather     = SocketType("GATHER")
+	Radio      = SocketType("RADIO")
+	Dish       = SocketType("DISH")
+	NewScatter = func() {}
+	NewGather  = func() {}
+	NewRadio   = func() {}
+	NewDish    = func() {}
+	DishSocket = 0
+	CmdJoin    = 0
+	CmdLeave   = 0
+)
+
+func TestNoDraftSocketTypes(t *testing.T) {
+	for _, typ := range []SocketType{Scatter, Gather, Radio, Dish} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%v is a known socket type", typ)
+				}
+			}()
+			typ.IsCompatible(Pull)
+		}()
+	}
+}
+
+func TestNoDraftTransports(t *testing.T) {
+	for _, ep := range []string{"pgm://;239.192.1.1:5555", "epgm://;239.192.1.1:5555"} {
+		_, _, err := splitAddr(ep)
+		if _, ok := err.(*ErrUnknownTransport); !ok {
+			t.Errorf("%s: invalid error: got=%v (%T), want=*ErrUnknownTransport", ep, err, err)
+		}
+	}
+}
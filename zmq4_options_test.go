@@ -0,0 +1,352 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	stderrors "errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func TestSocketOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		value interface{}
+	}{
+		{zmq4.OptionIdentity, zmq4.SocketIdentity("peer")},
+		{zmq4.OptionHWM, 41},
+		{zmq4.OptionSendHWM, 42},
+		{zmq4.OptionRecvHWM, 43},
+		{zmq4.OptionLinger, 1 * time.Second},
+		{zmq4.OptionSendTimeout, 2 * time.Second},
+		{zmq4.OptionRecvTimeout, 3 * time.Second},
+		{zmq4.OptionDialerRetry, 4 * time.Second},
+		{zmq4.OptionDialerTimeout, 5 * time.Second},
+		{zmq4.OptionMaxMsgSize, int64(1024)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sck := zmq4.NewDealer(bkg)
+			defer sck.Close()
+
+			err := sck.SetOption(tc.name, tc.value)
+			if err != nil {
+				t.Fatalf("could not set option: %v", err)
+			}
+
+			v, err := sck.GetOption(tc.name)
+			if err != nil {
+				t.Fatalf("could not get option: %v", err)
+			}
+
+			if !reflect.DeepEqual(v, tc.value) {
+				t.Fatalf("invalid option value: got=%v, want=%v", v, tc.value)
+			}
+
+			err = sck.SetOption(tc.name, "invalid")
+			if err != zmq4.ErrBadProperty {
+				t.Fatalf("invalid error setting a bad value: got=%v, want=%v", err, zmq4.ErrBadProperty)
+			}
+		})
+	}
+}
+
+func TestConstructorOptions(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	sck := zmq4.NewDealer(ctx,
+		zmq4.WithSendHWM(42),
+		zmq4.WithRecvHWM(24),
+		zmq4.WithLinger(time.Second),
+		zmq4.WithSendTimeout(2*time.Second),
+		zmq4.WithRecvTimeout(3*time.Second),
+		zmq4.WithProbeRouter(true),
+		zmq4.WithRouterMandatory(true), // ignored by DEALER sockets.
+	)
+	defer sck.Close()
+
+	cfg := sck.Config()
+	if got, want := [2]int{cfg.SendHWM, cfg.RecvHWM}, [2]int{42, 24}; got != want {
+		t.Fatalf("invalid hwm: got=%v, want=%v", got, want)
+	}
+	got := [3]time.Duration{cfg.Linger, cfg.SendTimeout, cfg.RecvTimeout}
+	if want := [3]time.Duration{time.Second, 2 * time.Second, 3 * time.Second}; got != want {
+		t.Fatalf("invalid linger and timeouts: got=%v, want=%v", got, want)
+	}
+	if v, err := sck.GetOption(zmq4.OptionProbeRouter); err != nil || v != true {
+		t.Fatalf("invalid probe router option: got=%v, err=%v", v, err)
+	}
+
+	if err := sck.Listen(must(EndPoint("tcp"))); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+}
+
+func TestConstructorOptionError(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	sck := zmq4.NewDealer(ctx,
+		zmq4.WithSendHWM(-1),
+		zmq4.WithLinger(-time.Second),
+	)
+	defer sck.Close()
+
+	// the first invalid option is reported by the first Listen or Dial.
+	err := sck.Listen(must(EndPoint("tcp")))
+	if !stderrors.Is(err, zmq4.ErrBadProperty) {
+		t.Fatalf("invalid error: got=%v, want=%v", err, zmq4.ErrBadProperty)
+	}
+	if got, want := err.Error(), `could not set option "SNDHWM": `+zmq4.ErrBadProperty.Error(); got != want {
+		t.Fatalf("invalid error message:\ngot= %q\nwant=%q", got, want)
+	}
+
+	if err := sck.Listen(must(EndPoint("tcp"))); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+}
+
+func TestUnknownOption(t *testing.T) {
+	for _, sck := range []zmq4.Socket{
+		zmq4.NewDealer(bkg),
+		zmq4.NewSub(bkg),
+	} {
+		err := sck.SetOption("NO-SUCH-OPTION", 42)
+		if err != zmq4.ErrUnknownOption {
+			t.Fatalf("%v: invalid error: got=%v, want=%v", sck.Type(), err, zmq4.ErrUnknownOption)
+		}
+
+		_, err = sck.GetOption("NO-SUCH-OPTION")
+		if err != zmq4.ErrUnknownOption {
+			t.Fatalf("%v: invalid error: got=%v, want=%v", sck.Type(), err, zmq4.ErrUnknownOption)
+		}
+		sck.Close()
+	}
+}
+
+func TestRecvTimeoutOption(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	err := pull.Listen(ep)
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	err = push.Dial(ep)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	err = pull.SetOption(zmq4.OptionRecvTimeout, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("could not set recv timeout: %v", err)
+	}
+
+	_, err = pull.Recv()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("invalid error: got=%v, want=%v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestConfigSnapshot(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	sck := zmq4.NewRouter(ctx,
+		zmq4.WithID(zmq4.SocketIdentity("router")),
+		zmq4.WithDialerTimeout(2*time.Second),
+		zmq4.WithMaxConnections(10),
+		zmq4.WithMaxMsgSize(1024),
+		zmq4.WithHeartbeatInterval(time.Second),
+		zmq4.WithSendRetry(3, 10*time.Millisecond),
+		zmq4.WithMetadata("app", "test"),
+		zmq4.WithMsgPool(zmq4.NewMsgPool()),
+	)
+	defer sck.Close()
+
+	for _, opt := range []struct {
+		name  string
+		value interface{}
+	}{
+		{zmq4.OptionSendHWM, 42},
+		{zmq4.OptionRecvHWM, 24},
+		{zmq4.OptionLinger, 3 * time.Second},
+		{zmq4.OptionRecvTimeout, 5 * time.Second},
+		{zmq4.OptionRouterMandatory, true},
+	} {
+		if err := sck.SetOption(opt.name, opt.value); err != nil {
+			t.Fatalf("could not set option %q: %v", opt.name, err)
+		}
+	}
+
+	cfg := sck.Config()
+	want := cfg
+	want.Type = zmq4.Router
+	want.ID = zmq4.SocketIdentity("router")
+	want.Security = zmq4.NullSecurity
+	want.SendHWM = 42
+	want.RecvHWM = 24
+	want.Linger = 3 * time.Second
+	want.RecvTimeout = 5 * time.Second
+	want.SendRetries = 3
+	want.SendBackoff = 10 * time.Millisecond
+	want.DialerTimeout = 2 * time.Second
+	want.MaxMsgSize = 1024
+	want.MaxConnections = 10
+	want.HeartbeatInterval = time.Second
+	want.HeartbeatTimeout = time.Second
+	want.ZMTPVersion = [2]int{3, 0}
+	want.RouterMandatory = true
+	want.BufferPool = true
+	want.Metadata = zmq4.Metadata{"app": "test"}
+
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("invalid config snapshot:\ngot= %+v\nwant=%+v", cfg, want)
+	}
+
+	// the snapshot is a copy.
+	cfg.Metadata["app"] = "modified"
+	if got := sck.Config().Metadata["app"]; got != "test" {
+		t.Fatalf("snapshot metadata aliases the socket metadata: got=%q", got)
+	}
+}
+
+func TestSupportedOptions(t *testing.T) {
+	values := map[string]interface{}{
+		zmq4.OptionSubscribe:        "topic",
+		zmq4.OptionUnsubscribe:      "topic",
+		zmq4.OptionIdentity:         zmq4.SocketIdentity("peer"),
+		zmq4.OptionHWM:              10,
+		zmq4.OptionSendHWM:          11,
+		zmq4.OptionRecvHWM:          12,
+		zmq4.OptionLinger:           time.Second,
+		zmq4.OptionSendTimeout:      2 * time.Second,
+		zmq4.OptionRecvTimeout:      3 * time.Second,
+		zmq4.OptionDialerRetry:      4 * time.Second,
+		zmq4.OptionDialerTimeout:    5 * time.Second,
+		zmq4.OptionHandshakeTimeout: 6 * time.Second,
+		zmq4.OptionMaxMsgSize:       int64(1024),
+		zmq4.OptionRouterMandatory:  true,
+		zmq4.OptionRouterHandover:   true,
+		zmq4.OptionProbeRouter:      true,
+		zmq4.OptionXPubVerbose:      true,
+		zmq4.OptionXPubVerboser:     true,
+	}
+
+	for _, sck := range []zmq4.Socket{
+		zmq4.NewPair(bkg),
+		zmq4.NewPub(bkg),
+		zmq4.NewSub(bkg),
+		zmq4.NewReq(bkg),
+		zmq4.NewRep(bkg),
+		zmq4.NewDealer(bkg),
+		zmq4.NewRouter(bkg),
+		zmq4.NewPull(bkg),
+		zmq4.NewPush(bkg),
+		zmq4.NewXPub(bkg),
+		zmq4.NewXSub(bkg),
+	} {
+		t.Run(string(sck.Type()), func(t *testing.T) {
+			defer sck.Close()
+			for _, name := range zmq4.SupportedOptions(sck.Type()) {
+				v, ok := values[name]
+				if !ok {
+					t.Fatalf("no test value for option %q", name)
+				}
+				if err := sck.SetOption(name, v); err != nil {
+					t.Fatalf("could not set option %q: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestImmutableIdentity(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	sck := zmq4.NewDealer(ctx, zmq4.WithID(zmq4.SocketIdentity("dealer")))
+	defer sck.Close()
+
+	v, err := sck.GetOption(zmq4.OptionIdentity)
+	if err != nil {
+		t.Fatalf("could not get identity: %v", err)
+	}
+	if got, want := v, zmq4.SocketIdentity("dealer"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid identity: got=%q, want=%q", got, want)
+	}
+
+	if err := sck.Listen(must(EndPoint("tcp"))); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	err = sck.SetOption(zmq4.OptionIdentity, zmq4.SocketIdentity("other"))
+	if err != zmq4.ErrOptionImmutable {
+		t.Fatalf("invalid error: got=%v, want=%v", err, zmq4.ErrOptionImmutable)
+	}
+
+	// runtime-mutable options can still be changed.
+	if err := sck.SetOption(zmq4.OptionLinger, time.Second); err != nil {
+		t.Fatalf("could not set linger on a live socket: %v", err)
+	}
+}
+
+func TestIdentityOption(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	router := zmq4.NewRouter(ctx)
+	defer router.Close()
+
+	dealer := zmq4.NewDealer(ctx)
+	defer dealer.Close()
+
+	id := []byte("worker")
+	if err := dealer.SetOption(zmq4.OptionIdentity, id); err != nil {
+		t.Fatalf("could not set identity: %v", err)
+	}
+	id[0] = 'W' // the identity is copied.
+
+	if err := router.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := dealer.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	if err := dealer.Send(zmq4.NewMsgString("hello")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	msg, err := router.Recv()
+	if err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+	if got, want := string(msg.Frames[0]), "worker"; got != want {
+		t.Fatalf("invalid peer identity: got=%q, want=%q", got, want)
+	}
+
+	v, err := dealer.GetOption(zmq4.OptionIdentity)
+	if err != nil {
+		t.Fatalf("could not get identity: %v", err)
+	}
+	if got, want := v, zmq4.SocketIdentity("worker"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid identity: got=%q, want=%q", got, want)
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func TestPairReconnect(t *testing.T) {
+	for _, transport := range []string{"tcp", "inproc"} {
+		t.Run(transport, func(t *testing.T) {
+			ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+			defer timeout()
+
+			const hwm = 32 // above the default high water mark.
+			ep := must(EndPoint(transport))
+
+			srv := zmq4.NewPair(ctx, zmq4.WithSendHWM(hwm))
+			defer srv.Close()
+			evts := srv.Monitor()
+
+			if err := srv.Listen(ep); err != nil {
+				t.Fatalf("could not listen: %v", err)
+			}
+
+			recv := func(sck zmq4.Socket, want string) {
+				t.Helper()
+				msg, err := sck.Recv()
+				if err != nil {
+					t.Fatalf("could not recv %q: %v", want, err)
+				}
+				if got := string(msg.Frames[0]); got != want {
+					t.Fatalf("invalid message: got=%q, want=%q", got, want)
+				}
+			}
+
+			cli := zmq4.NewPair(ctx)
+			if err := cli.Dial(ep); err != nil {
+				t.Fatalf("could not dial: %v", err)
+			}
+			waitEvent(t, evts, zmq4.EventAccepted)
+
+			if err := srv.Send(zmq4.NewMsgString("msg-00")); err != nil {
+				t.Fatalf("could not send: %v", err)
+			}
+			recv(cli, "msg-00")
+
+			// PAIR sockets only accept one peer at a time.
+			extra := zmq4.NewPair(ctx)
+			defer extra.Close()
+			_ = extra.Dial(ep)
+			waitEvent(t, evts, zmq4.EventRejected)
+
+			// the dialing side restarts: messages are queued meanwhile.
+			cli.Close()
+			waitEvent(t, evts, zmq4.EventDisconnected)
+
+			for i := 1; i <= hwm; i++ {
+				if err := srv.Send(zmq4.NewMsgString(fmt.Sprintf("msg-%02d", i))); err != nil {
+					t.Fatalf("could not queue message %d: %v", i, err)
+				}
+			}
+
+			cli = zmq4.NewPair(ctx)
+			defer cli.Close()
+			if err := cli.Dial(ep); err != nil {
+				t.Fatalf("could not redial: %v", err)
+			}
+			for i := 1; i <= hwm; i++ {
+				recv(cli, fmt.Sprintf("msg-%02d", i))
+			}
+		})
+	}
+}
+
+func TestPairSetSendHWM(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	srv := zmq4.NewPair(ctx)
+	defer srv.Close()
+
+	if err := srv.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	const hwm = 32
+	if err := srv.SetOption(zmq4.OptionSendHWM, hwm); err != nil {
+		t.Fatalf("could not set send hwm: %v", err)
+	}
+	if got := srv.Config().SendHWM; got != hwm {
+		t.Fatalf("invalid send hwm: got=%d, want=%d", got, hwm)
+	}
+
+	// without peer, messages are queued up to the new high water mark.
+	for i := 0; i < hwm; i++ {
+		sctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		err := srv.SendContext(sctx, zmq4.NewMsgString(fmt.Sprintf("msg-%02d", i)))
+		cancel()
+		if err != nil {
+			t.Fatalf("could not queue message %d: %v", i, err)
+		}
+	}
+
+	cli := zmq4.NewPair(ctx)
+	defer cli.Close()
+	if err := cli.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	for i := 0; i < hwm; i++ {
+		msg, err := cli.Recv()
+		if err != nil {
+			t.Fatalf("could not recv message %d: %v", i, err)
+		}
+		if got, want := string(msg.Frames[0]), fmt.Sprintf("msg-%02d", i); got != want {
+			t.Fatalf("invalid message: got=%q, want=%q", got, want)
+		}
+	}
+}
+
+func TestPairImmediate(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	srv := zmq4.NewPair(ctx, zmq4.WithImmediate(true))
+	defer srv.Close()
+	evts := srv.Monitor()
+
+	if err := srv.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	// sendTimeout sends msg, giving up after a short while.
+	sendTimeout := func(msg string) error {
+		sctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		return srv.SendContext(sctx, zmq4.NewMsgString(msg))
+	}
+
+	if err := sendTimeout("stale"); err != context.DeadlineExceeded {
+		t.Fatalf("invalid error sending without peer: got=%v, want=%v", err, context.DeadlineExceeded)
+	}
+
+	cli := zmq4.NewPair(ctx)
+	if err := cli.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	waitEvent(t, evts, zmq4.EventAccepted)
+
+	if err := sendTimeout("fresh"); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	msg, err := cli.Recv()
+	if err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+	if got, want := string(msg.Frames[0]), "fresh"; got != want {
+		t.Fatalf("invalid message: got=%q, want=%q", got, want)
+	}
+
+	// messages are not queued again once the peer is gone.
+	cli.Close()
+	waitEvent(t, evts, zmq4.EventDisconnected)
+	if err := sendTimeout("stale"); err != context.DeadlineExceeded {
+		t.Fatalf("invalid error sending after peer left: got=%v, want=%v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestPairLinger(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	const (
+		n      = 3
+		linger = 5 * time.Second
+	)
+	ep := must(EndPoint("tcp"))
+
+	srv := zmq4.NewPair(ctx)
+	if err := srv.SetOption(zmq4.OptionLinger, linger); err != nil {
+		t.Fatalf("could not set linger: %v", err)
+	}
+	if err := srv.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	// messages are queued until a peer connects.
+	for i := 0; i < n; i++ {
+		if err := srv.Send(zmq4.NewMsgString(fmt.Sprintf("msg-%02d", i))); err != nil {
+			t.Fatalf("could not queue message %d: %v", i, err)
+		}
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- srv.Close()
+	}()
+
+	cli := zmq4.NewPair(ctx)
+	defer cli.Close()
+	if err := cli.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		msg, err := cli.Recv()
+		if err != nil {
+			t.Fatalf("could not recv message %d: %v", i, err)
+		}
+		if got, want := string(msg.Frames[0]), fmt.Sprintf("msg-%02d", i); got != want {
+			t.Fatalf("invalid message: got=%q, want=%q", got, want)
+		}
+	}
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("could not close: %v", err)
+		}
+	case <-time.After(linger):
+		t.Fatalf("close did not complete once the queue was flushed")
+	}
+
+	if err := srv.Send(zmq4.NewMsgString("late")); err != zmq4.ErrClosedSocket {
+		t.Fatalf("invalid error sending on a closed socket: got=%v, want=%v", err, zmq4.ErrClosedSocket)
+	}
+}
+
+func TestPairLingerExpired(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	const linger = 200 * time.Millisecond
+
+	srv := zmq4.NewPair(ctx)
+	if err := srv.SetOption(zmq4.OptionLinger, linger); err != nil {
+		t.Fatalf("could not set linger: %v", err)
+	}
+	if err := srv.Listen(must(EndPoint("tcp"))); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := srv.Send(zmq4.NewMsgString("lost")); err != nil {
+		t.Fatalf("could not queue message: %v", err)
+	}
+
+	// no peer ever connects: the message is dropped once linger expires.
+	start := time.Now()
+	srv.Close()
+	if d := time.Since(start); d < linger || d > 10*linger {
+		t.Fatalf("invalid close duration: got=%v, want~%v", d, linger)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func TestPeerConn(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	router := zmq4.NewRouter(ctx, zmq4.WithID(zmq4.SocketIdentity("router")))
+	defer router.Close()
+	revts := router.Monitor()
+
+	dealer := zmq4.NewDealer(ctx, zmq4.WithID(zmq4.SocketIdentity("dealer")))
+	defer dealer.Close()
+
+	if err := router.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := dealer.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	waitEvent(t, revts, zmq4.EventAccepted)
+
+	for _, tc := range []struct {
+		sck  zmq4.Socket
+		peer string
+	}{
+		{router, "dealer"},
+		{dealer, "router"},
+	} {
+		nc, err := tc.sck.PeerConn(tc.peer)
+		if err != nil {
+			t.Fatalf("could not get connection to peer %q: %v", tc.peer, err)
+		}
+		tcp, ok := nc.(*net.TCPConn)
+		if !ok {
+			t.Fatalf("invalid connection type to peer %q: %T", tc.peer, nc)
+		}
+		if err := tcp.SetKeepAlive(true); err != nil {
+			t.Fatalf("could not enable keep-alives: %v", err)
+		}
+		if err := tcp.SetKeepAlivePeriod(30 * time.Second); err != nil {
+			t.Fatalf("could not set keep-alive period: %v", err)
+		}
+	}
+
+	// the connection still carries messages.
+	if err := dealer.Send(zmq4.NewMsgString("ping")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	msg, err := router.Recv()
+	if err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+	if got, want := string(msg.Frames[len(msg.Frames)-1]), "ping"; got != want {
+		t.Fatalf("invalid message: got=%q, want=%q", got, want)
+	}
+
+	if _, err := router.PeerConn("unknown"); err == nil {
+		t.Fatalf("expected an error for unknown peer")
+	}
+}
+
+func TestPeers(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	eps := []string{must(EndPoint("tcp")), must(EndPoint("ipc"))}
+
+	router := zmq4.NewRouter(ctx, zmq4.WithID(zmq4.SocketIdentity("router")))
+	defer router.Close()
+	revts := router.Monitor()
+
+	for _, ep := range eps {
+		if err := router.Listen(ep); err != nil {
+			t.Fatalf("could not listen on %q: %v", ep, err)
+		}
+	}
+	if peers := router.Peers(); len(peers) != 0 {
+		t.Fatalf("unexpected peers before any connection: %v", peers)
+	}
+
+	start := time.Now()
+	clients := []struct {
+		id string
+		ep string
+	}{
+		{"dealer-0", eps[0]},
+		{"dealer-1", eps[0]},
+		{"dealer-2", eps[1]},
+	}
+	for _, c := range clients {
+		dealer := zmq4.NewDealer(ctx, zmq4.WithID(zmq4.SocketIdentity(c.id)))
+		defer dealer.Close()
+		if err := dealer.Dial(c.ep); err != nil {
+			t.Fatalf("could not dial %q: %v", c.ep, err)
+		}
+		waitEvent(t, revts, zmq4.EventAccepted)
+
+		peers := dealer.Peers()
+		if len(peers) != 1 {
+			t.Fatalf("invalid number of dealer peers: got=%d, want=1", len(peers))
+		}
+		if got, want := peers[0], (zmq4.PeerInfo{Endpoint: c.ep, ID: "router", Type: zmq4.Router}); got.Endpoint != want.Endpoint || got.ID != want.ID || got.Type != want.Type {
+			t.Fatalf("invalid dealer peer:\ngot= %+v\nwant=%+v", got, want)
+		}
+	}
+
+	peers := router.Peers()
+	if got, want := len(peers), len(clients); got != want {
+		t.Fatalf("invalid number of router peers: got=%d, want=%d", got, want)
+	}
+	for i, peer := range peers {
+		c := clients[i]
+		if peer.ID != c.id || peer.Endpoint != c.ep || peer.Type != zmq4.Dealer {
+			t.Fatalf("invalid router peer #%d: got=(%q, %q, %v), want=(%q, %q, %v)", i, peer.ID, peer.Endpoint, peer.Type, c.id, c.ep, zmq4.Dealer)
+		}
+		if peer.ConnectedAt.Before(start) || peer.ConnectedAt.After(time.Now()) {
+			t.Fatalf("invalid connection time of router peer #%d: %v", i, peer.ConnectedAt)
+		}
+		if peer.RemoteAddr == "" {
+			t.Fatalf("no remote address for router peer #%d", i)
+		}
+	}
+}
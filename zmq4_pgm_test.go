@@ -0,0 +1,126 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build zmq4_draft
+// +build zmq4_draft
+
+package zmq4_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func TestPubSubPGM(t *testing.T) {
+	for _, transport := range []string{"epgm", "pgm"} {
+		transport := transport
+		t.Run(transport, func(t *testing.T) {
+			ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+			defer timeout()
+
+			ep := must(EndPoint(transport))
+
+			pub := zmq4.NewPub(ctx, zmq4.WithMulticastTTL(0))
+			defer pub.Close()
+
+			sub := zmq4.NewSub(ctx)
+			defer sub.Close()
+
+			// multicast needs raw sockets (pgm) and a multicast route.
+			if err := pub.Listen(ep); err != nil {
+				t.Skipf("%s not supported: %v", transport, err)
+			}
+			if err := sub.Dial(ep); err != nil {
+				t.Skipf("%s not supported: %v", transport, err)
+			}
+			if err := sub.SetOption(zmq4.OptionSubscribe, "a"); err != nil {
+				t.Fatalf("could not subscribe: %v", err)
+			}
+
+			ready := false
+			for i := 0; i < 20 && !ready; i++ {
+				if err := pub.Send(zmq4.NewMsgFromString([]string{"a", "ready"})); err != nil {
+					t.Fatalf("could not send: %v", err)
+				}
+				rctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+				_, err := sub.RecvContext(rctx)
+				cancel()
+				ready = err == nil
+			}
+			if !ready {
+				t.Skipf("no multicast loopback for %s", transport)
+			}
+			// drain the readiness messages still in flight.
+			for {
+				rctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+				_, err := sub.RecvContext(rctx)
+				cancel()
+				if err != nil {
+					break
+				}
+			}
+
+			// a message spanning several packets.
+			large := bytes.Repeat([]byte("x"), 10000)
+			msgs := []zmq4.Msg{
+				zmq4.NewMsgFromString([]string{"b", "filtered out"}),
+				zmq4.NewMsgFromString([]string{"a", "msg-0"}),
+				zmq4.NewMsgFrom([]byte("a"), large),
+				zmq4.NewMsgFromString([]string{"b", "filtered out"}),
+				zmq4.NewMsgFromString([]string{"a", "msg-1"}),
+			}
+			for i, msg := range msgs {
+				if err := pub.Send(msg); err != nil {
+					t.Fatalf("could not send #%d: %v", i, err)
+				}
+			}
+			for i, want := range []zmq4.Msg{msgs[1], msgs[2], msgs[4]} {
+				msg, err := sub.Recv()
+				if err != nil {
+					t.Fatalf("could not recv #%d: %v", i, err)
+				}
+				if got, want := fmt.Sprintf("%q", msg.Frames), fmt.Sprintf("%q", want.Frames); got != want {
+					t.Fatalf("invalid message #%d:\ngot= %.64s\nwant=%.64s", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPGMSocketTypes(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("epgm"))
+
+	for _, tc := range []struct {
+		name string
+		sck  zmq4.Socket
+		op   func(s zmq4.Socket, ep string) error
+	}{
+		{"sub-listen", zmq4.NewSub(ctx), zmq4.Socket.Listen},
+		{"pub-dial", zmq4.NewPub(ctx), zmq4.Socket.Dial},
+		{"push-listen", zmq4.NewPush(ctx), zmq4.Socket.Listen},
+		{"pull-dial", zmq4.NewPull(ctx), zmq4.Socket.Dial},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			defer tc.sck.Close()
+			if err := tc.op(tc.sck, ep); err == nil {
+				t.Fatalf("%s sockets can use epgm endpoints", tc.sck.Type())
+			}
+		})
+	}
+
+	pub := zmq4.NewPub(ctx)
+	defer pub.Close()
+	if err := pub.Listen("epgm://;127.0.0.1:5555"); err == nil {
+		t.Fatalf("could listen on a unicast address")
+	}
+}
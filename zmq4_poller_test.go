@@ -0,0 +1,191 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func TestPollerTimeout(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	poller := zmq4.NewPoller()
+	if err := poller.Add(pull, zmq4.PollIn); err != nil {
+		t.Fatalf("could not add pull socket: %v", err)
+	}
+	if err := poller.Add(push, zmq4.PollOut); err != nil {
+		t.Fatalf("could not add push socket: %v", err)
+	}
+
+	polled, err := poller.Wait(0)
+	if err != nil {
+		t.Fatalf("could not poll: %v", err)
+	}
+	if len(polled) != 0 {
+		t.Fatalf("unexpected ready sockets: %+v", polled)
+	}
+
+	start := time.Now()
+	polled, err = poller.Wait(50 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("could not poll: %v", err)
+	}
+	if len(polled) != 0 {
+		t.Fatalf("unexpected ready sockets: %+v", polled)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("poll returned before its timeout: %v", d)
+	}
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	polled, err = poller.Wait(-1)
+	if err != nil {
+		t.Fatalf("could not poll: %v", err)
+	}
+	if len(polled) != 1 || polled[0].Socket != push || polled[0].Events != zmq4.PollOut {
+		t.Fatalf("invalid ready sockets: %+v", polled)
+	}
+
+	poller.Remove(push)
+	if err := push.Send(zmq4.NewMsgString("hello")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	polled, err = poller.Wait(time.Second)
+	if err != nil {
+		t.Fatalf("could not poll: %v", err)
+	}
+	if len(polled) != 1 || polled[0].Socket != pull || polled[0].Events != zmq4.PollIn {
+		t.Fatalf("invalid ready sockets: %+v", polled)
+	}
+
+	pull.Close()
+	if _, err := poller.Wait(time.Second); err == nil {
+		t.Fatalf("expected an error polling a closed socket")
+	}
+}
+
+func TestPollerBroker(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	var (
+		fep = must(EndPoint("tcp"))
+		bep = must(EndPoint("tcp"))
+	)
+
+	frontend := zmq4.NewRouter(ctx)
+	defer frontend.Close()
+	backend := zmq4.NewDealer(ctx)
+	defer backend.Close()
+
+	if err := frontend.Listen(fep); err != nil {
+		t.Fatalf("could not listen on frontend: %v", err)
+	}
+	if err := backend.Listen(bep); err != nil {
+		t.Fatalf("could not listen on backend: %v", err)
+	}
+
+	worker := zmq4.NewRep(ctx)
+	defer worker.Close()
+	if err := worker.Dial(bep); err != nil {
+		t.Fatalf("could not dial backend: %v", err)
+	}
+	go func() {
+		for {
+			msg, err := worker.Recv()
+			if err != nil {
+				return
+			}
+			reply := zmq4.NewMsgString("re: " + string(msg.Frames[0]))
+			if err := worker.Send(reply); err != nil {
+				return
+			}
+		}
+	}()
+
+	// the broker shuttles messages between the frontend and the backend
+	// from a single goroutine.
+	go func() {
+		poller := zmq4.NewPoller()
+		poller.Add(frontend, zmq4.PollIn)
+		poller.Add(backend, zmq4.PollIn)
+		for {
+			polled, err := poller.Wait(-1)
+			if err != nil {
+				return
+			}
+			for _, p := range polled {
+				msg, err := p.Socket.Recv()
+				if err != nil {
+					return
+				}
+				switch p.Socket {
+				case frontend:
+					err = backend.Send(msg)
+				case backend:
+					err = frontend.Send(msg)
+				}
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	const nclients = 3
+	errc := make(chan error, nclients)
+	for i := 0; i < nclients; i++ {
+		go func(i int) {
+			client := zmq4.NewReq(ctx)
+			defer client.Close()
+			if err := client.Dial(fep); err != nil {
+				errc <- fmt.Errorf("client %d: could not dial: %v", i, err)
+				return
+			}
+			for j := 0; j < 5; j++ {
+				req := fmt.Sprintf("req-%d-%d", i, j)
+				if err := client.Send(zmq4.NewMsgString(req)); err != nil {
+					errc <- fmt.Errorf("client %d: could not send: %v", i, err)
+					return
+				}
+				msg, err := client.Recv()
+				if err != nil {
+					errc <- fmt.Errorf("client %d: could not recv: %v", i, err)
+					return
+				}
+				if got, want := string(msg.Frames[0]), "re: "+req; got != want {
+					errc <- fmt.Errorf("client %d: invalid reply: got=%q, want=%q", i, got, want)
+					return
+				}
+			}
+			errc <- nil
+		}(i)
+	}
+
+	for i := 0; i < nclients; i++ {
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -7,6 +7,8 @@ package zmq4_test
 import (
 	"context"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -103,7 +105,7 @@ func TestPubSub(t *testing.T) {
 			defer tc.sub2.Close()
 
 			if tc.skip {
-				t.Skipf(tc.name)
+				t.Skip(tc.name)
 			}
 			t.Parallel()
 
@@ -169,8 +171,8 @@ func TestPubSub(t *testing.T) {
 							if err != nil {
 								return errors.Wrapf(err, "could not recv message %v", want)
 							}
-							if !reflect.DeepEqual(msg, want) {
-								return errors.Errorf("sub[%d][msg=%d]: got = %v, want= %v", isub, imsg, msg, want)
+							if !reflect.DeepEqual(msg.Frames, want.Frames) || msg.Type != want.Type {
+								return errors.Errorf("sub[%d][msg=%d]: got = %#v, want= %#v", isub, imsg, msg, want)
 							}
 							nmsgs[isub]++
 						}
@@ -192,3 +194,786 @@ func TestPubSub(t *testing.T) {
 		})
 	}
 }
+
+func TestWaitConnected(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pub := zmq4.NewPub(ctx)
+	defer pub.Close()
+
+	err := pub.Listen(ep)
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	err = pub.WaitConnected(tctx)
+	cancel()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("invalid error waiting for an unconnected socket: got=%v, want=%v", err, context.DeadlineExceeded)
+	}
+
+	sub := zmq4.NewSub(ctx)
+	defer sub.Close()
+
+	err = sub.Dial(ep)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	err = pub.WaitConnected(ctx)
+	if err != nil {
+		t.Fatalf("could not wait for connection: %v", err)
+	}
+
+	err = sub.WaitConnected(ctx)
+	if err != nil {
+		t.Fatalf("could not wait for connection: %v", err)
+	}
+
+	closed := zmq4.NewSub(ctx)
+	closed.Close()
+	err = closed.WaitConnected(ctx)
+	if err == nil {
+		t.Fatalf("expected an error waiting on a closed socket")
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	xpub := zmq4.NewXPub(ctx)
+	defer xpub.Close()
+
+	sub := zmq4.NewSub(ctx, zmq4.WithID(zmq4.SocketIdentity("sub")))
+	defer sub.Close()
+
+	for _, topic := range []string{"c", "a", "b"} {
+		if err := sub.SetOption(zmq4.OptionSubscribe, topic); err != nil {
+			t.Fatalf("could not subscribe to %q: %v", topic, err)
+		}
+	}
+	if err := sub.SetOption(zmq4.OptionUnsubscribe, "b"); err != nil {
+		t.Fatalf("could not unsubscribe from %q: %v", "b", err)
+	}
+
+	want := [][]byte{[]byte("a"), []byte("c")}
+	subs := sub.Subscriptions()
+	if !reflect.DeepEqual(subs, want) {
+		t.Fatalf("invalid SUB subscriptions:\ngot= %q\nwant=%q", subs, want)
+	}
+
+	if err := xpub.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := sub.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	// XPUB sockets deliver subscription messages to the application.
+	for range want {
+		if _, err := xpub.Recv(); err != nil {
+			t.Fatalf("could not recv subscription: %v", err)
+		}
+	}
+
+	peers := xpub.PeerSubscriptions()
+	if got := peers["sub"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid XPUB subscriptions for peer %q:\ngot= %q\nwant=%q", "sub", got, want)
+	}
+}
+
+func TestSubDuplicateSubscriptions(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pub := zmq4.NewPub(ctx)
+	defer pub.Close()
+
+	sub := zmq4.NewSub(ctx)
+	defer sub.Close()
+
+	if err := pub.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := sub.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	count := func(topic string) int {
+		return sub.SubscriptionCount(topic)
+	}
+
+	for _, topic := range []string{"a", "a", "z"} {
+		if err := sub.SetOption(zmq4.OptionSubscribe, topic); err != nil {
+			t.Fatalf("could not subscribe to %q: %v", topic, err)
+		}
+	}
+	if got, want := count("a"), 2; got != want {
+		t.Fatalf("invalid subscription count: got=%d, want=%d", got, want)
+	}
+
+	// round publishes "a" then "z", and reports whether "a" was received
+	// before "z". Rounds are retried until "z" is received, as
+	// subscriptions reach the publisher asynchronously.
+	round := func() bool {
+		for {
+			for _, topic := range []string{"a", "z"} {
+				if err := pub.Send(zmq4.NewMsgString(topic)); err != nil {
+					t.Fatalf("could not send %q: %v", topic, err)
+				}
+			}
+			gotA := false
+			for {
+				rctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+				msg, err := sub.RecvContext(rctx)
+				cancel()
+				if err != nil {
+					if ctx.Err() != nil {
+						t.Fatalf("could not recv: %v", err)
+					}
+					break
+				}
+				switch string(msg.Frames[0]) {
+				case "a":
+					gotA = true
+				case "z":
+					return gotA
+				}
+			}
+		}
+	}
+
+	for !round() {
+	}
+
+	if err := sub.SetOption(zmq4.OptionUnsubscribe, "a"); err != nil {
+		t.Fatalf("could not unsubscribe: %v", err)
+	}
+	if got, want := count("a"), 1; got != want {
+		t.Fatalf("invalid subscription count: got=%d, want=%d", got, want)
+	}
+	for i := 0; i < 5; i++ {
+		if !round() {
+			t.Fatalf("message %q not received while still subscribed", "a")
+		}
+	}
+
+	if err := sub.SetOption(zmq4.OptionUnsubscribe, "a"); err != nil {
+		t.Fatalf("could not unsubscribe: %v", err)
+	}
+	if got, want := count("a"), 0; got != want {
+		t.Fatalf("invalid subscription count: got=%d, want=%d", got, want)
+	}
+	for round() {
+	}
+}
+
+func TestSubSubscribeAll(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	xpub := zmq4.NewXPub(ctx)
+	defer xpub.Close()
+
+	sub := zmq4.NewSub(ctx)
+	defer sub.Close()
+
+	if err := xpub.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := sub.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	// subscribed waits for the XPUB socket to deliver the given (un)subscriptions.
+	subscribed := func(want ...string) {
+		t.Helper()
+		for _, w := range want {
+			msg, err := xpub.Recv()
+			if err != nil {
+				t.Fatalf("could not recv subscription: %v", err)
+			}
+			if got := string(msg.Frames[0]); got != w {
+				t.Fatalf("invalid subscription: got=%q, want=%q", got, w)
+			}
+		}
+	}
+
+	// check publishes topics, and checks that exactly those in want are
+	// received.
+	check := func(topics []string, want ...string) {
+		t.Helper()
+		for _, topic := range topics {
+			if err := xpub.Send(zmq4.NewMsgString(topic)); err != nil {
+				t.Fatalf("could not send %q: %v", topic, err)
+			}
+		}
+		for _, w := range want {
+			msg, err := sub.Recv()
+			if err != nil {
+				t.Fatalf("could not recv: %v", err)
+			}
+			if got := string(msg.Frames[0]); got != w {
+				t.Fatalf("invalid message: got=%q, want=%q", got, w)
+			}
+		}
+		rctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		if msg, err := sub.RecvContext(rctx); err == nil {
+			t.Fatalf("unexpected message %q", msg.Frames[0])
+		}
+	}
+
+	for _, topic := range []string{"a", "b", "b", "c"} {
+		if err := sub.SetOption(zmq4.OptionSubscribe, topic); err != nil {
+			t.Fatalf("could not subscribe to %q: %v", topic, err)
+		}
+	}
+	subscribed("\x01a", "\x01b", "\x01c")
+	check([]string{"a", "z", "b"}, "a", "b")
+
+	if err := sub.UnsubscribeAll(); err != nil {
+		t.Fatalf("could not unsubscribe: %v", err)
+	}
+	if subs := sub.Subscriptions(); len(subs) != 0 {
+		t.Fatalf("subscriptions left after UnsubscribeAll: %q", subs)
+	}
+	subscribed("\x00a", "\x00b", "\x00c")
+	check([]string{"a", "b", "c"})
+
+	if err := sub.SubscribeAll(); err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+	subscribed("\x01")
+	check([]string{"z", "a"}, "z", "a")
+
+	if err := sub.UnsubscribeAll(); err != nil {
+		t.Fatalf("could not unsubscribe: %v", err)
+	}
+	subscribed("\x00")
+	check([]string{"z"})
+}
+
+func TestXPubSubscribedDelivery(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	xpub := zmq4.NewXPub(ctx)
+	defer xpub.Close()
+
+	if err := xpub.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	subs := make(map[string]zmq4.Socket)
+	for _, topic := range []string{"a", "b", ""} {
+		sub := zmq4.NewSub(ctx)
+		defer sub.Close()
+		if topic != "" {
+			if err := sub.SetOption(zmq4.OptionSubscribe, topic); err != nil {
+				t.Fatalf("could not subscribe to %q: %v", topic, err)
+			}
+		}
+		if err := sub.Dial(ep); err != nil {
+			t.Fatalf("could not dial: %v", err)
+		}
+		subs[topic] = sub
+	}
+
+	// wait for the subscriptions to reach the XPUB socket.
+	for i := 0; i < 2; i++ {
+		if _, err := xpub.Recv(); err != nil {
+			t.Fatalf("could not recv subscription: %v", err)
+		}
+	}
+
+	for _, topic := range []string{"b", "a"} {
+		if err := xpub.Send(zmq4.NewMsgFrom([]byte(topic), []byte("data-"+topic))); err != nil {
+			t.Fatalf("could not send to %q: %v", topic, err)
+		}
+	}
+
+	for _, topic := range []string{"a", "b"} {
+		msg, err := subs[topic].Recv()
+		if err != nil {
+			t.Fatalf("could not recv on %q: %v", topic, err)
+		}
+		want := [][]byte{[]byte(topic), []byte("data-" + topic)}
+		if !reflect.DeepEqual(msg.Frames, want) {
+			t.Fatalf("invalid message for %q:\ngot= %q\nwant=%q", topic, msg.Frames, want)
+		}
+	}
+
+	// a peer without subscriptions receives nothing.
+	none := subs[""]
+	if err := none.SetOption(zmq4.OptionRecvTimeout, 100*time.Millisecond); err != nil {
+		t.Fatalf("could not set recv timeout: %v", err)
+	}
+	if msg, err := none.Recv(); err == nil {
+		t.Fatalf("unexpected message for unsubscribed peer: %q", msg.Frames)
+	}
+}
+
+func TestSubDropConsecutiveDuplicates(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pub := zmq4.NewPub(ctx)
+	defer pub.Close()
+
+	sub := zmq4.NewSub(ctx, zmq4.WithDropConsecutiveDuplicates(true))
+	defer sub.Close()
+
+	if err := pub.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := sub.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	if err := sub.SetOption(zmq4.OptionSubscribe, ""); err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+
+	// probe until the subscription reached the publisher.
+	// extra probes are dropped as duplicates of the first one.
+	for {
+		if err := pub.Send(zmq4.NewMsgString("probe")); err != nil {
+			t.Fatalf("could not send probe: %v", err)
+		}
+		rctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		_, err := sub.RecvContext(rctx)
+		cancel()
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("could not recv probe: %v", err)
+		}
+	}
+
+	for _, v := range []string{"A", "A", "B", "A", "end"} {
+		if err := pub.Send(zmq4.NewMsgString(v)); err != nil {
+			t.Fatalf("could not send %q: %v", v, err)
+		}
+	}
+
+	var got []string
+	for {
+		msg, err := sub.Recv()
+		if err != nil {
+			t.Fatalf("could not recv: %v", err)
+		}
+		v := string(msg.Frames[0])
+		if v == "end" {
+			break
+		}
+		got = append(got, v)
+	}
+
+	if want := []string{"A", "B", "A"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid messages: got=%q, want=%q", got, want)
+	}
+}
+
+func TestXPubSubscriptionAggregation(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	xpub := zmq4.NewXPub(ctx)
+	defer xpub.Close()
+	evts := xpub.Monitor()
+
+	if err := xpub.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	var subs []zmq4.Socket
+	for i := 0; i < 2; i++ {
+		sub := zmq4.NewSub(ctx)
+		defer sub.Close()
+		if err := sub.Dial(ep); err != nil {
+			t.Fatalf("could not dial: %v", err)
+		}
+		waitEvent(t, evts, zmq4.EventAccepted)
+		subs = append(subs, sub)
+	}
+
+	set := func(sub zmq4.Socket, name, topic string) {
+		t.Helper()
+		if err := sub.SetOption(name, topic); err != nil {
+			t.Fatalf("could not set %s %q: %v", name, topic, err)
+		}
+	}
+	expect := func(want string) {
+		t.Helper()
+		msg, err := xpub.Recv()
+		if err != nil {
+			t.Fatalf("could not recv: %v", err)
+		}
+		if got := string(msg.Frames[0]); got != want {
+			t.Fatalf("invalid subscription message: got=%q, want=%q", got, want)
+		}
+	}
+
+	// marker topics are subscribed to after the messages that must be
+	// suppressed, on the same connection, to prove they were not delivered.
+	set(subs[0], zmq4.OptionSubscribe, "a")
+	expect("\x01a")
+
+	set(subs[1], zmq4.OptionSubscribe, "a")
+	set(subs[1], zmq4.OptionSubscribe, "m1")
+	expect("\x01m1")
+
+	set(subs[0], zmq4.OptionUnsubscribe, "a")
+	set(subs[0], zmq4.OptionSubscribe, "m2")
+	expect("\x01m2")
+
+	set(subs[1], zmq4.OptionUnsubscribe, "a")
+	expect("\x00a")
+}
+
+func TestXPubVerbose(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opt  string
+		want []string // subscription messages delivered to the application
+	}{
+		{
+			name: "verbose",
+			opt:  zmq4.OptionXPubVerbose,
+			want: []string{"\x01a", "\x01a", "\x01m", "\x00a"},
+		},
+		{
+			name: "verboser",
+			opt:  zmq4.OptionXPubVerboser,
+			want: []string{"\x01a", "\x01a", "\x00a", "\x01m", "\x00a"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+			defer timeout()
+
+			ep := must(EndPoint("tcp"))
+
+			xpub := zmq4.NewXPub(ctx)
+			defer xpub.Close()
+			evts := xpub.Monitor()
+
+			if err := xpub.SetOption(tc.opt, true); err != nil {
+				t.Fatalf("could not set %s: %v", tc.opt, err)
+			}
+			if err := xpub.Listen(ep); err != nil {
+				t.Fatalf("could not listen: %v", err)
+			}
+
+			var subs []zmq4.Socket
+			for i := 0; i < 2; i++ {
+				sub := zmq4.NewSub(ctx)
+				defer sub.Close()
+				if err := sub.Dial(ep); err != nil {
+					t.Fatalf("could not dial: %v", err)
+				}
+				waitEvent(t, evts, zmq4.EventAccepted)
+				subs = append(subs, sub)
+			}
+
+			var got []string
+			set := func(sub zmq4.Socket, name, topic string) {
+				t.Helper()
+				if err := sub.SetOption(name, topic); err != nil {
+					t.Fatalf("could not set %s %q: %v", name, topic, err)
+				}
+				// wait for the message of the subscription, if delivered,
+				// so they are received in order.
+				for len(got) < len(tc.want) {
+					msg, err := xpub.RecvContext(ctx)
+					if err != nil {
+						t.Fatalf("could not recv: %v", err)
+					}
+					got = append(got, string(msg.Frames[0]))
+					if got[len(got)-1][1:] == topic {
+						break
+					}
+				}
+			}
+
+			set(subs[0], zmq4.OptionSubscribe, "a")
+			set(subs[1], zmq4.OptionSubscribe, "a")
+			if tc.opt == zmq4.OptionXPubVerboser {
+				set(subs[0], zmq4.OptionUnsubscribe, "a")
+			} else {
+				// the unsubscription is not delivered: a marker topic is.
+				if err := subs[0].SetOption(zmq4.OptionUnsubscribe, "a"); err != nil {
+					t.Fatalf("could not unsubscribe: %v", err)
+				}
+			}
+			set(subs[0], zmq4.OptionSubscribe, "m")
+
+			// outgoing messages are still filtered on the subscriptions.
+			if err := xpub.Send(zmq4.NewMsgString("a-value")); err != nil {
+				t.Fatalf("could not send: %v", err)
+			}
+			msg, err := subs[1].Recv()
+			if err != nil {
+				t.Fatalf("could not recv: %v", err)
+			}
+			if got, want := string(msg.Frames[0]), "a-value"; got != want {
+				t.Fatalf("invalid message: got=%q, want=%q", got, want)
+			}
+
+			set(subs[1], zmq4.OptionUnsubscribe, "a")
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("invalid subscription messages:\ngot= %q\nwant=%q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWelcomeMessage(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		pub  func(ctx context.Context, opts ...zmq4.Option) zmq4.Socket
+	}{
+		{"pub", zmq4.NewPub},
+		{"xpub", func(ctx context.Context, opts ...zmq4.Option) zmq4.Socket { return zmq4.NewXPub(ctx, opts...) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+			defer timeout()
+
+			ep := must(EndPoint("tcp"))
+
+			pub := tc.pub(ctx, zmq4.WithWelcomeMessage(zmq4.NewMsgString("welcome")))
+			defer pub.Close()
+			evts := pub.Monitor()
+
+			if err := pub.Listen(ep); err != nil {
+				t.Fatalf("could not listen: %v", err)
+			}
+
+			// broadcast traffic flows while subscribers come and go.
+			go func() {
+				for ctx.Err() == nil {
+					pub.Send(zmq4.NewMsgString("data"))
+					time.Sleep(time.Millisecond)
+				}
+			}()
+
+			// each (re)connection is welcomed exactly once, first.
+			for i := 0; i < 3; i++ {
+				sub := zmq4.NewSub(ctx)
+				if err := sub.Dial(ep); err != nil {
+					t.Fatalf("could not dial: %v", err)
+				}
+				if err := sub.SetOption(zmq4.OptionSubscribe, ""); err != nil {
+					t.Fatalf("could not subscribe: %v", err)
+				}
+				for j := 0; j < 5; j++ {
+					msg, err := sub.Recv()
+					if err != nil {
+						t.Fatalf("could not recv: %v", err)
+					}
+					want := "data"
+					if j == 0 {
+						want = "welcome"
+					}
+					if got := string(msg.Frames[0]); got != want {
+						t.Fatalf("connection %d: invalid message %d: got=%q, want=%q", i, j, got, want)
+					}
+				}
+				sub.Close()
+				waitEvent(t, evts, zmq4.EventDisconnected)
+			}
+		})
+	}
+}
+
+func TestSubDynamicSubscriptions(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	sub := zmq4.NewSub(ctx)
+	defer sub.Close()
+
+	// subscriptions made before any peer connects reach peers dialing in.
+	if err := sub.SetOption(zmq4.OptionSubscribe, "a"); err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+	if err := sub.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	pubs := make([]zmq4.Socket, 2)
+	for i := range pubs {
+		pubs[i] = zmq4.NewPub(ctx)
+		defer pubs[i].Close()
+		if err := pubs[i].Dial(ep); err != nil {
+			t.Fatalf("could not dial: %v", err)
+		}
+	}
+
+	// await sends topic from each publisher until it is received from all,
+	// as subscriptions reach the publishers asynchronously.
+	await := func(topic string) {
+		t.Helper()
+		seen := make(map[string]bool)
+		for len(seen) < len(pubs) {
+			for i, pub := range pubs {
+				msg := zmq4.NewMsgFromString([]string{topic, strconv.Itoa(i)})
+				if err := pub.Send(msg); err != nil {
+					t.Fatalf("could not send: %v", err)
+				}
+			}
+			rctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			msg, err := sub.RecvContext(rctx)
+			cancel()
+			if err != nil {
+				if ctx.Err() != nil {
+					t.Fatalf("topic %q not received from all publishers: %v", topic, err)
+				}
+				continue
+			}
+			if string(msg.Frames[0]) == topic {
+				seen[string(msg.Frames[1])] = true
+			}
+		}
+	}
+
+	await("a")
+
+	// subscriptions made once connected reach all publishers.
+	if err := sub.SetOption(zmq4.OptionSubscribe, "b"); err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+	await("b")
+}
+
+func TestPubSubZMTP31(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		pub  []zmq4.Option
+		sub  []zmq4.Option
+	}{
+		{"pub-3.0", nil, []zmq4.Option{zmq4.WithZMTPVersion(3, 1)}},
+		{"sub-3.0", []zmq4.Option{zmq4.WithZMTPVersion(3, 1)}, nil},
+		{"3.1", []zmq4.Option{zmq4.WithZMTPVersion(3, 1)}, []zmq4.Option{zmq4.WithZMTPVersion(3, 1)}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+			defer timeout()
+
+			ep := must(EndPoint("tcp"))
+
+			pub := zmq4.NewPub(ctx, tc.pub...)
+			defer pub.Close()
+
+			sub := zmq4.NewSub(ctx, tc.sub...)
+			defer sub.Close()
+
+			if err := pub.Listen(ep); err != nil {
+				t.Fatalf("could not listen: %v", err)
+			}
+			if err := sub.Dial(ep); err != nil {
+				t.Fatalf("could not dial: %v", err)
+			}
+			if err := sub.SetOption(zmq4.OptionSubscribe, "news"); err != nil {
+				t.Fatalf("could not subscribe: %v", err)
+			}
+
+			// wait for the subscription to reach the publisher.
+			for {
+				for _, topic := range []string{"weather", "news"} {
+					if err := pub.Send(zmq4.NewMsgFromString([]string{topic, "msg"})); err != nil {
+						t.Fatalf("could not send: %v", err)
+					}
+				}
+				rctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+				msg, err := sub.RecvContext(rctx)
+				cancel()
+				if err != nil {
+					if ctx.Err() != nil {
+						t.Fatalf("no message received: %v", ctx.Err())
+					}
+					continue
+				}
+				if got, want := string(msg.Frames[0]), "news"; got != want {
+					t.Fatalf("invalid topic: got=%q, want=%q", got, want)
+				}
+				return
+			}
+		})
+	}
+}
+
+func TestXSubSendTimeoutStalledPeer(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 20*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	xpub := zmq4.NewXPub(ctx)
+	defer xpub.Close()
+	if err := xpub.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	proxy := newBlackhole(t, strings.TrimPrefix(ep, "tcp://"))
+	defer proxy.Close()
+
+	xsub := zmq4.NewXSub(ctx)
+	defer xsub.Close()
+	if err := xsub.SetOption(zmq4.OptionSendTimeout, 200*time.Millisecond); err != nil {
+		t.Fatalf("could not set send timeout: %v", err)
+	}
+	if err := xsub.Dial(proxy.Addr()); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	// the peer stops reading: the message can not be written in time.
+	proxy.stall()
+	frame := make([]byte, 64<<20)
+	frame[0] = 1
+	sent := make(chan error, 1)
+	go func() {
+		sent <- xsub.Send(zmq4.NewMsg(frame))
+	}()
+	select {
+	case err := <-sent:
+		if err == nil {
+			t.Fatalf("send to a stalled peer did not fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("send to a stalled peer did not time out")
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- xsub.Close()
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("close did not return")
+	}
+}
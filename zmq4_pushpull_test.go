@@ -5,8 +5,13 @@
 package zmq4_test
 
 import (
+	"bytes"
 	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
 	"reflect"
+	"strconv"
 	"testing"
 	"time"
 
@@ -59,7 +64,7 @@ func TestPushPull(t *testing.T) {
 			defer tc.push.Close()
 
 			if tc.skip {
-				t.Skipf(tc.name)
+				t.Skip(tc.name)
 			}
 			t.Parallel()
 
@@ -100,8 +105,8 @@ func TestPushPull(t *testing.T) {
 					return errors.Wrapf(err, "could not recv %v", hello)
 				}
 
-				if got, want := msg, hello; !reflect.DeepEqual(got, want) {
-					return errors.Errorf("recv1: got = %v, want= %v", got, want)
+				if got, want := msg, hello; !reflect.DeepEqual(got.Frames, want.Frames) || got.Type != want.Type {
+					return errors.Errorf("recv1: got = %#v, want= %#v", got, want)
 				}
 
 				msg, err = tc.pull.Recv()
@@ -109,8 +114,8 @@ func TestPushPull(t *testing.T) {
 					return errors.Wrapf(err, "could not recv %v", bye)
 				}
 
-				if got, want := msg, bye; !reflect.DeepEqual(got, want) {
-					return errors.Errorf("recv2: got = %v, want= %v", got, want)
+				if got, want := msg, bye; !reflect.DeepEqual(got.Frames, want.Frames) || got.Type != want.Type {
+					return errors.Errorf("recv2: got = %#v, want= %#v", got, want)
 				}
 
 				return err
@@ -121,3 +126,640 @@ func TestPushPull(t *testing.T) {
 		})
 	}
 }
+
+func TestPushPullMaxMsgSize(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx, zmq4.WithMaxMsgSize(16))
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	err := pull.Listen(ep)
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	err = push.Dial(ep)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	err = push.Send(zmq4.NewMsg(make([]byte, 1024)))
+	if err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := pull.Recv()
+		errc <- err
+	}()
+
+	select {
+	case err := <-errc:
+		if got, want := errors.Cause(err), zmq4.ErrMsgTooLarge; got != want {
+			t.Fatalf("invalid error receiving an oversized message: got=%v, want=%v", err, want)
+		}
+	case <-ctx.Done():
+		t.Fatalf("recv of an oversized message did not complete")
+	}
+}
+
+func TestPushPullTruncateOversize(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx, zmq4.WithMaxMsgSize(16), zmq4.WithTruncateOversize(true))
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	err := pull.Listen(ep)
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	err = push.Dial(ep)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	big := bytes.Repeat([]byte("0123456789"), 100)
+	for _, msg := range []zmq4.Msg{
+		zmq4.NewMsgFrom([]byte("header"), big, []byte("trailer")),
+		zmq4.NewMsgString("small"),
+	} {
+		err = push.Send(msg)
+		if err != nil {
+			t.Fatalf("could not send: %v", err)
+		}
+	}
+
+	for _, want := range []struct {
+		frames    [][]byte
+		truncated bool
+	}{
+		{[][]byte{[]byte("header"), big[:10]}, true},
+		{[][]byte{[]byte("small")}, false},
+	} {
+		msg, meta, err := pull.RecvWithMeta()
+		if err != nil {
+			t.Fatalf("could not recv: %v", err)
+		}
+		if !reflect.DeepEqual(msg.Frames, want.frames) {
+			t.Fatalf("invalid message:\ngot= %q\nwant=%q", msg.Frames, want.frames)
+		}
+		if meta.Truncated != want.truncated {
+			t.Fatalf("invalid truncated flag: got=%v, want=%v", meta.Truncated, want.truncated)
+		}
+	}
+}
+
+func TestPushPullMsgPool(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx, zmq4.WithMsgPool(zmq4.NewMsgPool()))
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	err := pull.Listen(ep)
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	err = push.Dial(ep)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	const n = 100
+	go func() {
+		for i := 0; i < n; i++ {
+			frame := bytes.Repeat([]byte{byte(i)}, 100+i)
+			if err := push.Send(zmq4.NewMsgFrom([]byte("header"), frame)); err != nil {
+				return
+			}
+		}
+	}()
+
+	// unreleased messages stay valid across receives.
+	var kept []zmq4.Msg
+	for i := 0; i < n; i++ {
+		msg, err := pull.Recv()
+		if err != nil {
+			t.Fatalf("could not recv msg #%d: %v", i, err)
+		}
+		want := [][]byte{[]byte("header"), bytes.Repeat([]byte{byte(i)}, 100+i)}
+		if !reflect.DeepEqual(msg.Frames, want) {
+			t.Fatalf("invalid message #%d:\ngot= %q\nwant=%q", i, msg.Frames, want)
+		}
+		if i%2 == 0 {
+			msg.Release()
+			if msg.Frames != nil {
+				t.Fatalf("released message #%d still holds frames", i)
+			}
+			continue
+		}
+		kept = append(kept, msg)
+	}
+
+	for i, msg := range kept {
+		if got, want := msg.Frames[1], bytes.Repeat([]byte{byte(2*i + 1)}, 100+2*i+1); !bytes.Equal(got, want) {
+			t.Fatalf("invalid kept message #%d:\ngot= %q\nwant=%q", 2*i+1, got, want)
+		}
+	}
+}
+
+func TestPushPullFairQueue(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 20*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	fast := zmq4.NewPush(ctx)
+	defer fast.Close()
+
+	slow := zmq4.NewPush(ctx)
+	defer slow.Close()
+
+	err := pull.Listen(ep)
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	for _, push := range []zmq4.Socket{fast, slow} {
+		err = push.Dial(ep)
+		if err != nil {
+			t.Fatalf("could not dial: %v", err)
+		}
+	}
+
+	const (
+		nfast = 200
+		nslow = 5
+	)
+
+	grp, ctx := errgroup.WithContext(ctx)
+	grp.Go(func() error {
+		for i := 0; i < nfast; i++ {
+			err := fast.Send(zmq4.NewMsgString("fast"))
+			if err != nil {
+				return errors.Wrapf(err, "could not send fast message %d", i)
+			}
+		}
+		return nil
+	})
+	grp.Go(func() error {
+		for i := 0; i < nslow; i++ {
+			time.Sleep(10 * time.Millisecond)
+			err := slow.Send(zmq4.NewMsgString("slow"))
+			if err != nil {
+				return errors.Wrapf(err, "could not send slow message %d", i)
+			}
+		}
+		return nil
+	})
+
+	var (
+		nf, ns int
+		last   = -1 // index of the last slow message
+	)
+	for i := 0; i < nfast+nslow; i++ {
+		msg, err := pull.Recv()
+		if err != nil {
+			t.Fatalf("could not recv message %d: %v", i, err)
+		}
+		switch string(msg.Frames[0]) {
+		case "fast":
+			nf++
+		case "slow":
+			ns++
+			last = i
+		}
+		// slow down the consumer so the fast peer builds up a backlog.
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := grp.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if nf != nfast || ns != nslow {
+		t.Fatalf("invalid number of messages: fast=%d/%d, slow=%d/%d", nf, nfast, ns, nslow)
+	}
+
+	if last >= nfast {
+		t.Fatalf("slow peer starved: last slow message received at %d/%d", last, nfast+nslow)
+	}
+}
+
+func TestPushPullFairQueueOrdering(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 20*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	err := pull.Listen(ep)
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	const (
+		npush = 3
+		nmsgs = 50
+	)
+
+	pushes := make([]zmq4.Socket, npush)
+	for i := range pushes {
+		pushes[i] = zmq4.NewPush(ctx)
+		defer pushes[i].Close()
+		err = pushes[i].Dial(ep)
+		if err != nil {
+			t.Fatalf("could not dial: %v", err)
+		}
+	}
+
+	grp, _ := errgroup.WithContext(ctx)
+	for i := range pushes {
+		ipush := i
+		grp.Go(func() error {
+			for j := 0; j < nmsgs; j++ {
+				msg := zmq4.NewMsgFromString([]string{fmt.Sprintf("%d", ipush), fmt.Sprintf("%d", j)})
+				err := pushes[ipush].Send(msg)
+				if err != nil {
+					return errors.Wrapf(err, "push-%d: could not send message %d", ipush, j)
+				}
+			}
+			return nil
+		})
+	}
+
+	next := make([]int, npush) // next expected message index, per push.
+	for i := 0; i < npush*nmsgs; i++ {
+		msg, err := pull.Recv()
+		if err != nil {
+			t.Fatalf("could not recv message %d: %v", i, err)
+		}
+		var ipush, j int
+		fmt.Sscanf(string(msg.Frames[0]), "%d", &ipush)
+		fmt.Sscanf(string(msg.Frames[1]), "%d", &j)
+		if j != next[ipush] {
+			t.Fatalf("push-%d: out of order message: got=%d, want=%d", ipush, j, next[ipush])
+		}
+		next[ipush]++
+	}
+
+	if err := grp.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, n := range next {
+		if n != nmsgs {
+			t.Fatalf("push-%d: got %d messages, want %d", i, n, nmsgs)
+		}
+	}
+}
+
+func TestPullRecvWithMeta(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	err := pull.Listen(ep)
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	err = push.Dial(ep)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	const nmsgs = 5
+	for i := 0; i < nmsgs; i++ {
+		err = push.Send(zmq4.NewMsgString(fmt.Sprintf("msg-%d", i)))
+		if err != nil {
+			t.Fatalf("could not send message %d: %v", i, err)
+		}
+	}
+
+	// wait for the whole backlog to be queued on the PULL side.
+	time.Sleep(500 * time.Millisecond)
+
+	for i := 0; i < nmsgs; i++ {
+		msg, meta, err := pull.RecvWithMeta()
+		if err != nil {
+			t.Fatalf("could not recv message %d: %v", i, err)
+		}
+		if got, want := string(msg.Frames[0]), fmt.Sprintf("msg-%d", i); got != want {
+			t.Fatalf("invalid message: got=%q, want=%q", got, want)
+		}
+		if got, want := meta.QueueDepth, nmsgs-1-i; got != want {
+			t.Fatalf("invalid queue depth for message %d: got=%d, want=%d", i, got, want)
+		}
+	}
+}
+
+func TestPushPullReconnect(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+	evts := pull.Monitor()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		push := zmq4.NewPush(ctx)
+		if err := push.Dial(ep); err != nil {
+			t.Fatalf("could not dial #%d: %v", i, err)
+		}
+		want := fmt.Sprintf("msg-%d", i)
+		if err := push.Send(zmq4.NewMsgString(want)); err != nil {
+			t.Fatalf("could not send #%d: %v", i, err)
+		}
+		msg, err := pull.Recv()
+		if err != nil {
+			t.Fatalf("could not recv #%d: %v", i, err)
+		}
+		if got := string(msg.Frames[0]); got != want {
+			t.Fatalf("invalid message: got=%q, want=%q", got, want)
+		}
+
+		push.Close()
+		waitEvent(t, evts, zmq4.EventDisconnected)
+
+		// all peers are gone: the socket is not connected anymore.
+		wctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		err = pull.WaitConnected(wctx)
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatalf("invalid error waiting for a connection: got=%v, want=%v", err, context.DeadlineExceeded)
+		}
+		// the error of the closed connection may be reported first.
+		rctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		_, err = pull.RecvContext(rctx)
+		if err == io.EOF {
+			_, err = pull.RecvContext(rctx)
+		}
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatalf("invalid error receiving without peer: got=%v, want=%v", err, context.DeadlineExceeded)
+		}
+	}
+}
+
+func TestPushPullSendBatch(t *testing.T) {
+	for _, ep := range []string{
+		must(EndPoint("tcp")),
+		"ipc://ipc-push-pull-batch",
+		"inproc://push-pull-batch",
+	} {
+		ep := ep
+		t.Run(ep, func(t *testing.T) {
+			ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+			defer timeout()
+
+			pull := zmq4.NewPull(ctx)
+			defer pull.Close()
+
+			push := zmq4.NewPush(ctx)
+			defer push.Close()
+
+			if err := pull.Listen(ep); err != nil {
+				t.Fatalf("could not listen: %v", err)
+			}
+			if err := push.Dial(ep); err != nil {
+				t.Fatalf("could not dial: %v", err)
+			}
+
+			msgs := make([]zmq4.Msg, 100)
+			for i := range msgs {
+				msgs[i] = zmq4.NewMsgFromString([]string{fmt.Sprintf("msg-%d", i), "part"})
+			}
+			// a frame needing a long header.
+			msgs[42] = zmq4.NewMsg(bytes.Repeat([]byte("x"), 1024))
+
+			// inproc connections are not buffered: receive while sending.
+			var grp errgroup.Group
+			grp.Go(func() error {
+				for i, want := range msgs {
+					msg, err := pull.Recv()
+					if err != nil {
+						return errors.Wrapf(err, "could not recv #%d", i)
+					}
+					if !reflect.DeepEqual(msg.Frames, want.Frames) {
+						return errors.Errorf("invalid message #%d:\ngot= %q\nwant=%q", i, msg.Frames, want.Frames)
+					}
+				}
+				return nil
+			})
+			if err := push.SendBatch(ctx, msgs); err != nil {
+				t.Fatalf("could not send batch: %v", err)
+			}
+			if err := grp.Wait(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := push.Stats().MsgsSent, uint64(len(msgs)); got != want {
+				t.Fatalf("invalid number of sent messages: got=%d, want=%d", got, want)
+			}
+		})
+	}
+}
+
+func TestPushPullWriteBatching(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx, zmq4.WithWriteBatching(4096, 5*time.Millisecond))
+	defer push.Close()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	msgs := make([]zmq4.Msg, 200)
+	for i := range msgs {
+		msgs[i] = zmq4.NewMsgFromString([]string{fmt.Sprintf("msg-%d", i), "part"})
+	}
+	// a frame larger than the batch.
+	msgs[100] = zmq4.NewMsg(bytes.Repeat([]byte("x"), 8192))
+
+	for i, msg := range msgs {
+		if err := push.Send(msg); err != nil {
+			t.Fatalf("could not send #%d: %v", i, err)
+		}
+	}
+	for i, want := range msgs {
+		msg, err := pull.Recv()
+		if err != nil {
+			t.Fatalf("could not recv #%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(msg.Frames, want.Frames) {
+			t.Fatalf("invalid message #%d:\ngot= %q\nwant=%q", i, msg.Frames, want.Frames)
+		}
+	}
+
+	// a lone message is sent once the delay elapsed.
+	if err := push.Send(zmq4.NewMsgString("last")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	rctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	msg, err := pull.RecvContext(rctx)
+	if err != nil {
+		t.Fatalf("could not recv last message: %v", err)
+	}
+	if got, want := string(msg.Frames[0]), "last"; got != want {
+		t.Fatalf("invalid last message: got=%q, want=%q", got, want)
+	}
+}
+
+func TestPushPullRecvAll(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	const nmsgs = 100
+	for i := 0; i < nmsgs; i++ {
+		if err := push.Send(zmq4.NewMsgFromString([]string{"msg", strconv.Itoa(i)})); err != nil {
+			t.Fatalf("could not send #%d: %v", i, err)
+		}
+	}
+	// the empty message ends the series.
+	if err := push.Send(zmq4.NewMsg(nil)); err != nil {
+		t.Fatalf("could not send sentinel: %v", err)
+	}
+
+	msgs, err := pull.RecvAll(ctx)
+	if err != nil {
+		t.Fatalf("could not recv all: %v", err)
+	}
+	if got, want := len(msgs), nmsgs; got != want {
+		t.Fatalf("invalid number of messages: got=%d, want=%d", got, want)
+	}
+	for i, msg := range msgs {
+		want := [][]byte{[]byte("msg"), []byte(strconv.Itoa(i))}
+		if !reflect.DeepEqual(msg.Frames, want) {
+			t.Fatalf("invalid message #%d: got=%q, want=%q", i, msg.Frames, want)
+		}
+	}
+
+	// without sentinel, messages are received until ctx is done.
+	for i := 0; i < 3; i++ {
+		if err := push.Send(zmq4.NewMsgString("tail")); err != nil {
+			t.Fatalf("could not send #%d: %v", i, err)
+		}
+	}
+	rctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	msgs, err = pull.RecvAll(rctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("invalid error: got=%v, want=%v", err, context.DeadlineExceeded)
+	}
+	if got, want := len(msgs), 3; got != want {
+		t.Fatalf("invalid number of messages: got=%d, want=%d", got, want)
+	}
+}
+
+func TestPushNoPeerTimeout(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+	evts := push.Monitor()
+
+	if err := push.SetOption(zmq4.OptionSendTimeout, 10*time.Millisecond); err != nil {
+		t.Fatalf("could not set send timeout: %v", err)
+	}
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	if err := push.Send(zmq4.NewMsgString("hello")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	if _, err := pull.Recv(); err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+
+	pull.Close()
+	waitEvent(t, evts, zmq4.EventDisconnected)
+
+	// without peers, sends block until the send timeout, and fail:
+	// messages are not buffered for peers that may never come back.
+	const n = 100
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		err := push.Send(zmq4.NewMsgString("lost"))
+		if !stderrors.Is(err, zmq4.ErrTimeout) {
+			t.Fatalf("invalid error sending #%d without peers: got=%v, want=%v", i, err, zmq4.ErrTimeout)
+		}
+	}
+	if elapsed, min := time.Since(start), n*10*time.Millisecond; elapsed < min {
+		t.Fatalf("sends without peers did not block: %v < %v", elapsed, min)
+	}
+}
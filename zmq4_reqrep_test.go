@@ -6,7 +6,9 @@ package zmq4_test
 
 import (
 	"context"
+	"net"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -63,7 +65,7 @@ func TestReqRep(t *testing.T) {
 			defer tc.rep.Close()
 
 			if tc.skip {
-				t.Skipf(tc.name)
+				t.Skip(tc.name)
 			}
 			t.Parallel()
 
@@ -130,8 +132,8 @@ func TestReqRep(t *testing.T) {
 						return errors.Wrapf(err, "could not recv REP message %v", msg.req)
 					}
 
-					if got, want := rep, msg.rep; !reflect.DeepEqual(got, want) {
-						return errors.Errorf("got = %v, want= %v", got, want)
+					if got, want := rep, msg.rep; !reflect.DeepEqual(got.Frames, want.Frames) || got.Type != want.Type {
+						return errors.Errorf("got = %#v, want= %#v", got, want)
 					}
 				}
 
@@ -143,3 +145,169 @@ func TestReqRep(t *testing.T) {
 		})
 	}
 }
+
+func TestDealerRep(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	rep := zmq4.NewRep(ctx)
+	defer rep.Close()
+
+	dealer := zmq4.NewDealer(ctx)
+	defer dealer.Close()
+
+	if err := rep.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := dealer.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	// DEALER sockets pass frames through: the envelope is up to the application.
+	err := dealer.Send(zmq4.NewMsgFrom([]byte("hop"), nil, []byte("request")))
+	if err != nil {
+		t.Fatalf("could not send request: %v", err)
+	}
+
+	req, err := rep.Recv()
+	if err != nil {
+		t.Fatalf("could not recv request: %v", err)
+	}
+	if got, want := req.Frames, [][]byte{[]byte("request")}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid request:\ngot= %q\nwant=%q", got, want)
+	}
+
+	if err := rep.Send(zmq4.NewMsgString("reply")); err != nil {
+		t.Fatalf("could not send reply: %v", err)
+	}
+	if err := rep.Send(zmq4.NewMsgString("reply")); err == nil {
+		t.Fatalf("expected an error sending a second reply")
+	}
+
+	msg, err := dealer.Recv()
+	if err != nil {
+		t.Fatalf("could not recv reply: %v", err)
+	}
+	if got, want := msg.Frames, [][]byte{[]byte("hop"), {}, []byte("reply")}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid reply:\ngot= %q\nwant=%q", got, want)
+	}
+}
+
+func TestReqRouter(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	router := zmq4.NewRouter(ctx)
+	defer router.Close()
+
+	req := zmq4.NewReq(ctx, zmq4.WithID(zmq4.SocketIdentity("req")))
+	defer req.Close()
+
+	if err := router.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := req.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	if err := req.Send(zmq4.NewMsgString("request")); err != nil {
+		t.Fatalf("could not send request: %v", err)
+	}
+
+	msg, err := router.Recv()
+	if err != nil {
+		t.Fatalf("could not recv request: %v", err)
+	}
+	want := [][]byte{[]byte("req"), {}, []byte("request")}
+	if got := msg.Frames; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid request:\ngot= %q\nwant=%q", got, want)
+	}
+
+	err = router.Send(zmq4.NewMsgFrom([]byte("req"), nil, []byte("reply")))
+	if err != nil {
+		t.Fatalf("could not send reply: %v", err)
+	}
+
+	msg, err = req.Recv()
+	if err != nil {
+		t.Fatalf("could not recv reply: %v", err)
+	}
+	if got, want := msg.Frames, [][]byte{[]byte("reply")}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid reply:\ngot= %q\nwant=%q", got, want)
+	}
+}
+
+func TestRepMultipleEndpoints(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	eps := []string{must(EndPoint("tcp")), must(EndPoint("ipc"))}
+
+	rep := zmq4.NewRep(ctx)
+	defer rep.Close()
+
+	for _, ep := range eps {
+		if err := rep.Listen(ep); err != nil {
+			t.Fatalf("could not listen on %q: %v", ep, err)
+		}
+	}
+
+	grp, _ := errgroup.WithContext(ctx)
+	grp.Go(func() error {
+		for range eps {
+			msg, err := rep.Recv()
+			if err != nil {
+				return errors.Wrap(err, "could not recv request")
+			}
+			err = rep.Send(zmq4.NewMsgString("reply-" + string(msg.Frames[0])))
+			if err != nil {
+				return errors.Wrap(err, "could not send reply")
+			}
+		}
+		return nil
+	})
+
+	for _, ep := range eps {
+		ep := ep
+		req := zmq4.NewReq(ctx)
+		defer req.Close()
+		grp.Go(func() error {
+			if err := req.Dial(ep); err != nil {
+				return errors.Wrapf(err, "could not dial %q", ep)
+			}
+			if err := req.Send(zmq4.NewMsgString(ep)); err != nil {
+				return errors.Wrapf(err, "could not send request to %q", ep)
+			}
+			msg, err := req.Recv()
+			if err != nil {
+				return errors.Wrapf(err, "could not recv reply from %q", ep)
+			}
+			if got, want := string(msg.Frames[0]), "reply-"+ep; got != want {
+				return errors.Errorf("invalid reply: got=%q, want=%q", got, want)
+			}
+			return nil
+		})
+	}
+	if err := grp.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Close shuts all the listeners down.
+	if err := rep.Close(); err != nil {
+		t.Fatalf("could not close: %v", err)
+	}
+	for _, ep := range eps {
+		network, addr := "tcp", strings.TrimPrefix(ep, "tcp://")
+		if strings.HasPrefix(ep, "ipc://") {
+			network, addr = "unix", strings.TrimPrefix(ep, "ipc://")
+		}
+		if conn, err := net.DialTimeout(network, addr, time.Second); err == nil {
+			conn.Close()
+			t.Fatalf("%q still accepting connections after Close", ep)
+		}
+	}
+}
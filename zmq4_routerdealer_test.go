@@ -95,7 +95,7 @@ func TestRouterDealer(t *testing.T) {
 		tc := routerdealers[i]
 		t.Run(tc.name, func(t *testing.T) {
 			if tc.skip {
-				t.Skipf(tc.name)
+				t.Skip(tc.name)
 			}
 			t.Parallel()
 			ep := tc.endpoint()
@@ -231,3 +231,356 @@ func TestRouterDealer(t *testing.T) {
 		})
 	}
 }
+
+func TestRouterSendToRecvFrom(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		peer func(ctx context.Context) zmq4.Socket
+	}{
+		{
+			name: "req",
+			peer: func(ctx context.Context) zmq4.Socket {
+				return zmq4.NewReq(ctx, zmq4.WithID(zmq4.SocketIdentity("peer")))
+			},
+		},
+		{
+			name: "dealer",
+			peer: func(ctx context.Context) zmq4.Socket {
+				return zmq4.NewDealer(ctx, zmq4.WithID(zmq4.SocketIdentity("peer")))
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+			defer timeout()
+
+			ep := must(EndPoint("tcp"))
+
+			router := zmq4.NewRouter(ctx)
+			defer router.Close()
+
+			peer := tc.peer(ctx)
+			defer peer.Close()
+
+			if err := router.Listen(ep); err != nil {
+				t.Fatalf("could not listen: %v", err)
+			}
+			if err := peer.Dial(ep); err != nil {
+				t.Fatalf("could not dial: %v", err)
+			}
+
+			if err := peer.Send(zmq4.NewMsgFrom([]byte("hello"), []byte("world"))); err != nil {
+				t.Fatalf("could not send request: %v", err)
+			}
+
+			id, msg, err := router.RecvFrom()
+			if err != nil {
+				t.Fatalf("could not recv request: %v", err)
+			}
+			if got, want := string(id), "peer"; got != want {
+				t.Fatalf("invalid identity: got=%q, want=%q", got, want)
+			}
+			if got, want := msg.Frames, [][]byte{[]byte("hello"), []byte("world")}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("invalid request:\ngot= %q\nwant=%q", got, want)
+			}
+
+			err = router.SendTo(id, zmq4.NewMsgString("reply"))
+			if err != nil {
+				t.Fatalf("could not send reply: %v", err)
+			}
+
+			msg, err = peer.Recv()
+			if err != nil {
+				t.Fatalf("could not recv reply: %v", err)
+			}
+			if got, want := msg.Frames, [][]byte{[]byte("reply")}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("invalid reply:\ngot= %q\nwant=%q", got, want)
+			}
+		})
+	}
+}
+
+func TestRouterMandatory(t *testing.T) {
+	for _, mandatory := range []bool{true, false} {
+		t.Run(fmt.Sprintf("mandatory=%v", mandatory), func(t *testing.T) {
+			ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+			defer timeout()
+
+			ep := must(EndPoint("tcp"))
+
+			router := zmq4.NewRouter(ctx, zmq4.WithRouterMandatory(mandatory))
+			defer router.Close()
+			evts := router.Monitor()
+
+			dealer := zmq4.NewDealer(ctx, zmq4.WithID(zmq4.SocketIdentity("dealer")))
+			defer dealer.Close()
+
+			if err := router.Listen(ep); err != nil {
+				t.Fatalf("could not listen: %v", err)
+			}
+			if err := dealer.Dial(ep); err != nil {
+				t.Fatalf("could not dial: %v", err)
+			}
+			waitEvent(t, evts, zmq4.EventAccepted)
+
+			err := router.Send(zmq4.NewMsgFrom([]byte("dealer"), []byte("hello")))
+			if err != nil {
+				t.Fatalf("could not send to known peer: %v", err)
+			}
+			msg, err := dealer.Recv()
+			if err != nil {
+				t.Fatalf("could not recv: %v", err)
+			}
+			if got, want := string(msg.Frames[0]), "hello"; got != want {
+				t.Fatalf("invalid message: got=%q, want=%q", got, want)
+			}
+
+			dealer.Close()
+			waitEvent(t, evts, zmq4.EventDisconnected)
+
+			err = router.Send(zmq4.NewMsgFrom([]byte("dealer"), []byte("hello")))
+			switch {
+			case mandatory:
+				if err != zmq4.ErrHostUnreachable {
+					t.Fatalf("invalid error: got=%v, want=%v", err, zmq4.ErrHostUnreachable)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("message to unknown peer not silently dropped: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRouterMandatoryOption(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	router := zmq4.NewRouter(ctx)
+	defer router.Close()
+	evts := router.Monitor()
+
+	dealer := zmq4.NewDealer(ctx, zmq4.WithID(zmq4.SocketIdentity("dealer")))
+	defer dealer.Close()
+
+	if err := router.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := dealer.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	waitEvent(t, evts, zmq4.EventAccepted)
+
+	msg := zmq4.NewMsgFrom([]byte("unknown"), []byte("hello"))
+	if err := router.Send(msg); err != nil {
+		t.Fatalf("message to unknown peer not silently dropped: %v", err)
+	}
+
+	if err := router.SetOption(zmq4.OptionRouterMandatory, "yes"); err != zmq4.ErrBadProperty {
+		t.Fatalf("invalid error: got=%v, want=%v", err, zmq4.ErrBadProperty)
+	}
+	if err := router.SetOption(zmq4.OptionRouterMandatory, true); err != nil {
+		t.Fatalf("could not set option: %v", err)
+	}
+	v, err := router.GetOption(zmq4.OptionRouterMandatory)
+	if err != nil {
+		t.Fatalf("could not get option: %v", err)
+	}
+	if v != true {
+		t.Fatalf("invalid option value: got=%v, want=%v", v, true)
+	}
+
+	if err := router.Send(msg); err != zmq4.ErrHostUnreachable {
+		t.Fatalf("invalid error: got=%v, want=%v", err, zmq4.ErrHostUnreachable)
+	}
+
+	if err := router.SetOption(zmq4.OptionRouterMandatory, false); err != nil {
+		t.Fatalf("could not reset option: %v", err)
+	}
+	if err := router.Send(msg); err != nil {
+		t.Fatalf("message to unknown peer not silently dropped: %v", err)
+	}
+}
+
+func TestRouterHandover(t *testing.T) {
+	for _, handover := range []bool{false, true} {
+		handover := handover
+		t.Run(fmt.Sprintf("handover=%v", handover), func(t *testing.T) {
+			ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+			defer timeout()
+
+			ep := must(EndPoint("tcp"))
+
+			router := zmq4.NewRouter(ctx, zmq4.WithRouterHandover(handover))
+			defer router.Close()
+			evts := router.Monitor()
+
+			if err := router.Listen(ep); err != nil {
+				t.Fatalf("could not listen: %v", err)
+			}
+
+			// the first worker stops reading, as if it crashed.
+			crashed := zmq4.NewDealer(ctx, zmq4.WithID(zmq4.SocketIdentity("worker-1")))
+			defer crashed.Close()
+			if err := crashed.Dial(ep); err != nil {
+				t.Fatalf("could not dial: %v", err)
+			}
+			waitEvent(t, evts, zmq4.EventAccepted)
+
+			worker := zmq4.NewDealer(ctx, zmq4.WithID(zmq4.SocketIdentity("worker-1")))
+			defer worker.Close()
+			if err := worker.Dial(ep); err != nil {
+				t.Fatalf("could not dial: %v", err)
+			}
+			ev := waitEvent(t, evts, zmq4.EventIdentityConflict)
+			if ev.Err == nil {
+				t.Fatalf("no error reported for identity conflict")
+			}
+			if handover {
+				// the old connection is closed before the new one is accepted.
+				waitEvent(t, evts, zmq4.EventDisconnected)
+			}
+			waitEvent(t, evts, zmq4.EventAccepted)
+
+			if !handover {
+				return
+			}
+
+			if err := router.Send(zmq4.NewMsgFromString([]string{"worker-1", "job"})); err != nil {
+				t.Fatalf("could not send: %v", err)
+			}
+			msg, err := worker.Recv()
+			if err != nil {
+				t.Fatalf("could not recv: %v", err)
+			}
+			if got, want := string(msg.Frames[0]), "job"; got != want {
+				t.Fatalf("invalid message: got=%q, want=%q", got, want)
+			}
+
+			v, err := router.GetOption(zmq4.OptionRouterHandover)
+			if err != nil {
+				t.Fatalf("could not get option: %v", err)
+			}
+			if v != true {
+				t.Fatalf("invalid option value: got=%v, want=%v", v, true)
+			}
+		})
+	}
+}
+
+func TestRouterConnectPeer(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	router := zmq4.NewRouter(ctx, zmq4.WithRouterMandatory(true))
+	defer router.Close()
+
+	dealer := zmq4.NewDealer(ctx, zmq4.WithID(zmq4.SocketIdentity("announced")))
+	defer dealer.Close()
+
+	if err := dealer.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	msg := zmq4.NewMsgFromString([]string{"peer-1", "ping"})
+	if err := router.Send(msg); errors.Cause(err) != zmq4.ErrHostUnreachable {
+		t.Fatalf("invalid error sending before connecting: got=%v, want=%v", err, zmq4.ErrHostUnreachable)
+	}
+
+	if err := router.ConnectPeer(ep, ""); err == nil {
+		t.Fatalf("expected an error connecting with an empty identity")
+	}
+	if err := router.ConnectPeer(ep, "peer-1"); err != nil {
+		t.Fatalf("could not connect peer: %v", err)
+	}
+	if err := router.ConnectPeer(ep, "peer-1"); err == nil {
+		t.Fatalf("expected an error connecting with an identity in use")
+	}
+
+	// the router sends first, to the identity it chose.
+	if err := router.Send(msg); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	got, err := dealer.Recv()
+	if err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+	if got, want := string(got.Frames[0]), "ping"; got != want {
+		t.Fatalf("invalid message: got=%q, want=%q", got, want)
+	}
+
+	// replies are routed back from that identity.
+	if err := dealer.Send(zmq4.NewMsgString("pong")); err != nil {
+		t.Fatalf("could not send reply: %v", err)
+	}
+	got, err = router.Recv()
+	if err != nil {
+		t.Fatalf("could not recv reply: %v", err)
+	}
+	want := zmq4.NewMsgFromString([]string{"peer-1", "pong"})
+	if !reflect.DeepEqual(got.Frames, want.Frames) {
+		t.Fatalf("invalid reply: got=%q, want=%q", got.Frames, want.Frames)
+	}
+}
+
+func TestProbeRouter(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		prober func(ctx context.Context) zmq4.Socket
+	}{
+		{
+			name: "dealer",
+			prober: func(ctx context.Context) zmq4.Socket {
+				return zmq4.NewDealer(ctx, zmq4.WithID(zmq4.SocketIdentity("prober")), zmq4.WithProbeRouter(true))
+			},
+		},
+		{
+			name: "router",
+			prober: func(ctx context.Context) zmq4.Socket {
+				return zmq4.NewRouter(ctx, zmq4.WithID(zmq4.SocketIdentity("prober")), zmq4.WithProbeRouter(true))
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+			defer timeout()
+
+			ep := must(EndPoint("tcp"))
+
+			router := zmq4.NewRouter(ctx)
+			defer router.Close()
+
+			prober := tc.prober(ctx)
+			defer prober.Close()
+
+			if err := router.Listen(ep); err != nil {
+				t.Fatalf("could not listen: %v", err)
+			}
+			if err := prober.Dial(ep); err != nil {
+				t.Fatalf("could not dial: %v", err)
+			}
+
+			// the router learns the identity of the prober before it speaks.
+			msg, err := router.Recv()
+			if err != nil {
+				t.Fatalf("could not recv probe: %v", err)
+			}
+			if len(msg.Frames) != 2 || string(msg.Frames[0]) != "prober" || len(msg.Frames[1]) != 0 {
+				t.Fatalf("invalid probe: %q", msg.Frames)
+			}
+
+			// the probe is not echoed back to the prober.
+			rctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+			defer cancel()
+			if msg, err := prober.RecvContext(rctx); err == nil {
+				t.Fatalf("unexpected message: %q", msg.Frames)
+			}
+		})
+	}
+}
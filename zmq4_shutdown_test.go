@@ -0,0 +1,145 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !windows
+
+package zmq4_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	if err := push.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := pull.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	msg := zmq4.NewMsgString("before shutdown")
+	if err := push.Send(msg); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	if _, err := pull.Recv(); err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+
+	const deadline = 2 * time.Second
+	errc := zmq4.GracefulShutdown(ctx, deadline, push, pull)
+
+	proc, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("could not find current process: %v", err)
+	}
+	start := time.Now()
+	if err := proc.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("could not send SIGTERM: %v", err)
+	}
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("graceful shutdown failed: %v", err)
+		}
+	case <-time.After(2 * deadline):
+		t.Fatalf("graceful shutdown did not complete")
+	}
+
+	if d := time.Since(start); d > deadline {
+		t.Fatalf("sockets closed after %v, want < %v", d, deadline)
+	}
+
+	if err := push.Send(msg); err == nil {
+		t.Fatalf("expected an error sending on a closed socket")
+	}
+}
+
+func TestGracefulShutdownFlush(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	srv := zmq4.NewPair(ctx)
+	defer srv.Close()
+	if err := srv.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	// messages are queued until a peer connects.
+	const n = 3
+	for i := 0; i < n; i++ {
+		if err := srv.Send(zmq4.NewMsgString(fmt.Sprintf("msg-%02d", i))); err != nil {
+			t.Fatalf("could not queue message %d: %v", i, err)
+		}
+	}
+
+	const deadline = 5 * time.Second
+	errc := zmq4.GracefulShutdown(ctx, deadline, srv)
+
+	proc, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("could not find current process: %v", err)
+	}
+	if err := proc.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("could not send SIGTERM: %v", err)
+	}
+
+	// wait for the socket to stop accepting sends. the messages sent
+	// meanwhile are queued as well.
+	sent := n
+	for {
+		err := srv.Send(zmq4.NewMsgString(fmt.Sprintf("msg-%02d", sent)))
+		if err == zmq4.ErrClosedSocket {
+			break
+		}
+		if err != nil {
+			t.Fatalf("could not send: %v", err)
+		}
+		sent++
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cli := zmq4.NewPair(ctx)
+	defer cli.Close()
+	if err := cli.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	for i := 0; i < sent; i++ {
+		msg, err := cli.Recv()
+		if err != nil {
+			t.Fatalf("could not recv message %d: %v", i, err)
+		}
+		if got, want := string(msg.Frames[0]), fmt.Sprintf("msg-%02d", i); got != want {
+			t.Fatalf("invalid message: got=%q, want=%q", got, want)
+		}
+	}
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("graceful shutdown failed: %v", err)
+		}
+	case <-time.After(deadline):
+		t.Fatalf("graceful shutdown did not complete once the queue was flushed")
+	}
+}
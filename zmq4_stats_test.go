@@ -0,0 +1,148 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func TestStats(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx)
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	msgs := []zmq4.Msg{
+		zmq4.NewMsgString("hello"),
+		zmq4.NewMsgFromString([]string{"multi", "part"}),
+		zmq4.NewMsgString("bye"),
+	}
+	for _, msg := range msgs {
+		if err := push.Send(msg); err != nil {
+			t.Fatalf("could not send: %v", err)
+		}
+	}
+	for range msgs {
+		if _, err := pull.Recv(); err != nil {
+			t.Fatalf("could not recv: %v", err)
+		}
+	}
+
+	const nbytes = 5 + 5 + 4 + 3
+
+	sent := push.Stats()
+	if got, want := sent.MsgsSent, uint64(len(msgs)); got != want {
+		t.Fatalf("invalid number of sent messages: got=%d, want=%d", got, want)
+	}
+	if got, want := sent.BytesSent, uint64(nbytes); got != want {
+		t.Fatalf("invalid number of sent bytes: got=%d, want=%d", got, want)
+	}
+	if got, want := sent.Conns, 1; got != want {
+		t.Fatalf("invalid number of connections: got=%d, want=%d", got, want)
+	}
+	if got, want := len(sent.Peers), 1; got != want {
+		t.Fatalf("invalid number of peers: got=%d, want=%d", got, want)
+	}
+	for addr, peer := range sent.Peers {
+		if got, want := peer.Endpoint, ep; got != want {
+			t.Fatalf("invalid peer %q endpoint: got=%q, want=%q", addr, got, want)
+		}
+		if got, want := peer.MsgsSent, sent.MsgsSent; got != want {
+			t.Fatalf("invalid number of messages sent to peer %q: got=%d, want=%d", addr, got, want)
+		}
+	}
+
+	recv := pull.Stats()
+	if got, want := recv.MsgsRecv, uint64(len(msgs)); got != want {
+		t.Fatalf("invalid number of received messages: got=%d, want=%d", got, want)
+	}
+	if got, want := recv.BytesRecv, uint64(nbytes); got != want {
+		t.Fatalf("invalid number of received bytes: got=%d, want=%d", got, want)
+	}
+}
+
+func TestStatsErrors(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	push := zmq4.NewPush(ctx, zmq4.WithDialerRetry(time.Millisecond))
+	defer push.Close()
+
+	if err := push.Dial(ep); err == nil {
+		t.Fatalf("expected an error dialing %q", ep)
+	}
+
+	stats := push.Stats()
+	if stats.Reconnects == 0 {
+		t.Fatalf("no reconnect attempt recorded")
+	}
+	if stats.Errors[ep] == nil {
+		t.Fatalf("no error recorded for endpoint %q", ep)
+	}
+}
+
+func TestStatsDropped(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pub := zmq4.NewPub(ctx)
+	defer pub.Close()
+
+	if err := pub.SetOption(zmq4.OptionSendHWM, 1); err != nil {
+		t.Fatalf("could not set send HWM: %v", err)
+	}
+
+	sub := zmq4.NewSub(ctx)
+	defer sub.Close()
+
+	if err := pub.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := sub.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	if err := sub.SetOption(zmq4.OptionSubscribe, ""); err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+
+	// the subscriber does not read: messages pile up until they are dropped.
+	msg := zmq4.NewMsg(make([]byte, 64<<10))
+	for pub.Stats().MsgsDropped == 0 {
+		if err := pub.Send(msg); err != nil {
+			t.Fatalf("could not send: %v", err)
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("no dropped message")
+		}
+	}
+
+	stats := pub.Stats()
+	for addr, peer := range stats.Peers {
+		if got, want := peer.MsgsDropped, stats.MsgsDropped; got > want || got == 0 {
+			t.Fatalf("invalid number of messages dropped for peer %q: got=%d, want=%d", addr, got, want)
+		}
+	}
+}
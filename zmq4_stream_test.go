@@ -0,0 +1,101 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func TestStream(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	stream := zmq4.NewStream(ctx)
+	defer stream.Close()
+
+	if err := stream.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	recv := func(want string) []byte {
+		t.Helper()
+		msg, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("could not recv: %v", err)
+		}
+		if len(msg.Frames) != 2 {
+			t.Fatalf("invalid number of frames: got=%d, want=2", len(msg.Frames))
+		}
+		if got := string(msg.Frames[1]); got != want {
+			t.Fatalf("invalid data: got=%q, want=%q", got, want)
+		}
+		return msg.Frames[0]
+	}
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ep, "tcp://"))
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer conn.Close()
+
+	id := recv("") // connection
+	if len(id) == 0 {
+		t.Fatalf("empty routing identity")
+	}
+
+	if _, err := conn.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	if got := recv("hello\n"); string(got) != string(id) {
+		t.Fatalf("routing identity changed: got=%q, want=%q", got, id)
+	}
+
+	if err := stream.Send(zmq4.NewMsgFrom(id, []byte("world\n"))); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	if got, want := line, "world\n"; got != want {
+		t.Fatalf("invalid data: got=%q, want=%q", got, want)
+	}
+
+	// an empty data frame closes the connection to the peer.
+	if err := stream.Send(zmq4.NewMsgFrom(id, nil)); err != nil {
+		t.Fatalf("could not close peer: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected EOF from closed peer, got %v", err)
+	}
+	if got := recv(""); string(got) != string(id) { // disconnection
+		t.Fatalf("invalid routing identity: got=%q, want=%q", got, id)
+	}
+
+	// peers closing their connection are reported as disconnected.
+	conn2, err := net.Dial("tcp", strings.TrimPrefix(ep, "tcp://"))
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	id2 := recv("")
+	if string(id2) == string(id) {
+		t.Fatalf("routing identity reused: %q", id2)
+	}
+	conn2.Close()
+	if got := recv(""); string(got) != string(id2) {
+		t.Fatalf("invalid routing identity: got=%q, want=%q", got, id2)
+	}
+}
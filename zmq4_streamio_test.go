@@ -0,0 +1,205 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+func TestStreamReaderWriter(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		size  int // maximum frame size
+		sizes []int
+	}{
+		{
+			name:  "small-writes",
+			size:  zmq4.DefaultStreamFrameSize,
+			sizes: []int{1, 10, 100, 1000},
+		},
+		{
+			name:  "multi-frame-writes",
+			size:  zmq4.DefaultStreamFrameSize,
+			sizes: []int{3*zmq4.DefaultStreamFrameSize + 17, zmq4.DefaultStreamFrameSize, 5},
+		},
+		{
+			name:  "tiny-frames",
+			size:  7,
+			sizes: []int{6, 7, 8, 100},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+			defer timeout()
+
+			ep := must(EndPoint("tcp"))
+
+			pull := zmq4.NewPull(ctx)
+			push := zmq4.NewPush(ctx)
+
+			if err := pull.Listen(ep); err != nil {
+				t.Fatalf("could not listen: %v", err)
+			}
+			if err := push.Dial(ep); err != nil {
+				t.Fatalf("could not dial: %v", err)
+			}
+
+			r := zmq4.NewStreamReader(pull)
+			defer r.Close()
+			w := zmq4.NewStreamWriterSize(push, tc.size)
+			defer w.Close()
+
+			var src bytes.Buffer
+			rnd := rand.New(rand.NewSource(1234))
+			for _, n := range tc.sizes {
+				data := make([]byte, n)
+				rnd.Read(data)
+				src.Write(data)
+				if _, err := w.Write(data); err != nil {
+					t.Fatalf("could not write %d bytes: %v", n, err)
+				}
+			}
+
+			var dst bytes.Buffer
+			if _, err := io.CopyN(&dst, r, int64(src.Len())); err != nil {
+				t.Fatalf("could not read stream: %v", err)
+			}
+			if !bytes.Equal(dst.Bytes(), src.Bytes()) {
+				t.Fatalf("stream corrupted: got %d bytes, want %d", dst.Len(), src.Len())
+			}
+		})
+	}
+}
+
+func TestSendFramesRecvFrameTo(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 20*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx, zmq4.WithStreamThreshold(64<<10))
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx)
+	defer push.Close()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	big := make([]byte, 8<<20)
+	rand.New(rand.NewSource(1234)).Read(big)
+
+	// the frames are read from the wire as they are received:
+	// the sender blocks until they are.
+	errc := make(chan error, 1)
+	go func() {
+		errc <- func() error {
+			// a streamed frame, followed by a regular message.
+			err := push.SendFrames(bytes.NewReader(big), int64(len(big)))
+			if err != nil {
+				return err
+			}
+			err = push.Send(zmq4.NewMsgFromString([]string{"small", "msg"}))
+			if err != nil {
+				return err
+			}
+			return push.SendFrames(bytes.NewReader(big), int64(len(big)))
+		}()
+	}()
+
+	var buf bytes.Buffer
+	n, more, err := pull.RecvFrameTo(&buf)
+	if err != nil {
+		t.Fatalf("could not recv frame: %v", err)
+	}
+	if n != int64(len(big)) || more {
+		t.Fatalf("invalid frame: n=%d more=%v, want n=%d more=false", n, more, len(big))
+	}
+	if !bytes.Equal(buf.Bytes(), big) {
+		t.Fatalf("invalid streamed frame")
+	}
+
+	for i, want := range []string{"small", "msg"} {
+		buf.Reset()
+		_, more, err := pull.RecvFrameTo(&buf)
+		if err != nil {
+			t.Fatalf("could not recv frame %d: %v", i, err)
+		}
+		if got := buf.String(); got != want || more != (i == 0) {
+			t.Fatalf("invalid frame %d: got=%q more=%v, want=%q", i, got, more, want)
+		}
+	}
+
+	// a streamed frame is received as a whole by Recv.
+	msg, err := pull.Recv()
+	if err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+	if len(msg.Frames) != 1 || !bytes.Equal(msg.Frames[0], big) {
+		t.Fatalf("invalid message: %d frames", len(msg.Frames))
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+}
+
+func TestSendFramesRouter(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	router := zmq4.NewRouter(ctx, zmq4.WithID(zmq4.SocketIdentity("router")))
+	defer router.Close()
+
+	dealer := zmq4.NewDealer(ctx, zmq4.WithID(zmq4.SocketIdentity("dealer")))
+	defer dealer.Close()
+
+	if err := router.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := dealer.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	if err := dealer.Send(zmq4.NewMsgString("hello")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	if _, err := router.Recv(); err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+
+	// the peer identity can not be streamed.
+	if err := router.SendFrames(bytes.NewReader([]byte("dealer")), 6); err == nil {
+		t.Fatalf("expected an error streaming a ROUTER identity")
+	}
+
+	big := bytes.Repeat([]byte("0123456789"), 100<<10)
+	if err := router.SendFrame([]byte("dealer"), true); err != nil {
+		t.Fatalf("could not send identity: %v", err)
+	}
+	if err := router.SendFrames(bytes.NewReader(big), int64(len(big))); err != nil {
+		t.Fatalf("could not send frame: %v", err)
+	}
+
+	msg, err := dealer.Recv()
+	if err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+	if len(msg.Frames) != 1 || !bytes.Equal(msg.Frames[0], big) {
+		t.Fatalf("invalid message: %d frames", len(msg.Frames))
+	}
+}
@@ -44,6 +44,13 @@ func EndPoint(transport string) (string, error) {
 		return "ipc://tmp-" + newUUID(), nil
 	case "inproc":
 		return "inproc://tmp-" + newUUID(), nil
+	case "pgm", "epgm":
+		c, err := net.ListenPacket("udp4", ":0")
+		if err != nil {
+			return "", err
+		}
+		defer c.Close()
+		return fmt.Sprintf("%s://;239.192.1.1:%d", transport, c.LocalAddr().(*net.UDPAddr).Port), nil
 	default:
 		panic("invalid transport: [" + transport + "]")
 	}
@@ -0,0 +1,148 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+// newTLSConfigs returns the TLS configurations of a server holding a
+// self-signed certificate for localhost, and of a client trusting it.
+func newTLSConfigs(t *testing.T) (srv, cli *tls.Config) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("could not parse certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	srv = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+	cli = &tls.Config{RootCAs: pool}
+	return srv, cli
+}
+
+func TestPushPullTLS(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	srv, cli := newTLSConfigs(t)
+
+	ep := must(EndPoint("tcp"))
+
+	pull := zmq4.NewPull(ctx, zmq4.WithTLS(srv))
+	defer pull.Close()
+
+	push := zmq4.NewPush(ctx, zmq4.WithTLS(cli), zmq4.WithID(zmq4.SocketIdentity("push")))
+	defer push.Close()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	if err := push.Send(zmq4.NewMsgString("secret")); err != nil {
+		t.Fatalf("could not send: %v", err)
+	}
+	msg, err := pull.Recv()
+	if err != nil {
+		t.Fatalf("could not recv: %v", err)
+	}
+	if got, want := string(msg.Frames[0]), "secret"; got != want {
+		t.Fatalf("invalid message: got=%q, want=%q", got, want)
+	}
+
+	conn, err := pull.PeerConn("push")
+	if err != nil {
+		t.Fatalf("could not get peer conn: %v", err)
+	}
+	tconn, ok := conn.(*tls.Conn)
+	if !ok {
+		t.Fatalf("invalid peer conn: got=%T, want=*tls.Conn", conn)
+	}
+	if !tconn.ConnectionState().HandshakeComplete {
+		t.Fatalf("TLS handshake not complete")
+	}
+
+	if !pull.Config().TLS {
+		t.Fatalf("TLS not reported by the socket configuration")
+	}
+}
+
+func TestTLSMismatch(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	srv, _ := newTLSConfigs(t)
+	_, untrusted := newTLSConfigs(t)
+
+	for _, tc := range []struct {
+		name string
+		cfg  *tls.Config
+	}{
+		{"plaintext", nil},
+		{"untrusted", untrusted},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ep := must(EndPoint("tcp"))
+
+			pull := zmq4.NewPull(ctx, zmq4.WithTLS(srv))
+			defer pull.Close()
+
+			opts := []zmq4.Option{zmq4.WithHandshakeTimeout(100 * time.Millisecond), zmq4.WithDialerRetry(10 * time.Millisecond)}
+			if tc.cfg != nil {
+				opts = append(opts, zmq4.WithTLS(tc.cfg))
+			}
+			push := zmq4.NewPush(ctx, opts...)
+			defer push.Close()
+
+			if err := pull.Listen(ep); err != nil {
+				t.Fatalf("could not listen: %v", err)
+			}
+			if err := push.Dial(ep); err == nil {
+				t.Fatalf("expected an error dialing a TLS endpoint")
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+type recTracer struct {
+	mu  sync.Mutex
+	evs []string
+}
+
+func (t *recTracer) TraceRecv(ep string, msg zmq4.Msg) {
+	t.mu.Lock()
+	t.evs = append(t.evs, "recv "+string(msg.Frames[0]))
+	t.mu.Unlock()
+}
+
+func (t *recTracer) TraceSend(ep string, msg zmq4.Msg) {
+	t.mu.Lock()
+	t.evs = append(t.evs, "send "+string(msg.Frames[0]))
+	t.mu.Unlock()
+}
+
+func TestTracer(t *testing.T) {
+	ctx, timeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer timeout()
+
+	ep := must(EndPoint("tcp"))
+
+	var (
+		rec = new(recTracer)
+		buf = new(bytes.Buffer)
+	)
+
+	push := zmq4.NewPush(ctx, zmq4.WithTracer(rec))
+	defer push.Close()
+
+	pull := zmq4.NewPull(ctx, zmq4.WithTracer(zmq4.NewLogTracer(buf)))
+	defer pull.Close()
+
+	if err := pull.Listen(ep); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := push.Dial(ep); err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	const n = 3
+	var want []string
+	for i := 0; i < n; i++ {
+		msg := zmq4.NewMsgFrom([]byte(fmt.Sprintf("msg-%d", i)), bytes.Repeat([]byte("x"), 100))
+		if err := push.Send(msg); err != nil {
+			t.Fatalf("could not send message %d: %v", i, err)
+		}
+		if _, err := pull.Recv(); err != nil {
+			t.Fatalf("could not recv message %d: %v", i, err)
+		}
+		want = append(want, fmt.Sprintf("send msg-%d", i))
+	}
+
+	rec.mu.Lock()
+	got := rec.evs
+	rec.mu.Unlock()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid send traces:\ngot= %q\nwant=%q", got, want)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if got, want := len(lines), 3*n; got != want {
+		t.Fatalf("invalid number of trace lines: got=%d, want=%d\n%s", got, want, buf)
+	}
+	for i := 0; i < n; i++ {
+		if got, want := lines[3*i], "zmq4: "+ep+" recv frames=2"; got != want {
+			t.Fatalf("invalid trace line:\ngot= %q\nwant=%q", got, want)
+		}
+		if got, want := lines[3*i+1], fmt.Sprintf("zmq4:   [0] \"msg-%d\"", i); got != want {
+			t.Fatalf("invalid trace line:\ngot= %q\nwant=%q", got, want)
+		}
+		if got, want := lines[3*i+2], fmt.Sprintf("zmq4:   [1] %q", strings.Repeat("x", 64)); got != want {
+			t.Fatalf("invalid trace line:\ngot= %q\nwant=%q", got, want)
+		}
+	}
+}